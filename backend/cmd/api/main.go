@@ -5,7 +5,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"farmlite/internal/currency"
 	"farmlite/internal/handlers"
 
 	"github.com/gin-gonic/gin"
@@ -22,6 +24,7 @@ func main() {
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -57,6 +60,31 @@ func main() {
 	// 3. Initialize Handlers
 	h := handlers.NewHandler(pool)
 
+	// Exchange rates shipped alongside the binary (currency,units_per_usd,effective_date)
+	ratesFile := os.Getenv("EXCHANGE_RATES_FILE")
+	if ratesFile == "" {
+		ratesFile = "exchange_rates.csv"
+	}
+	if rates, err := currency.LoadRatesFile(ratesFile); err == nil {
+		if err := h.StoreExchangeRates(context.Background(), rates); err != nil {
+			log.Printf("Exchange rate import error: %v\n", err)
+		} else {
+			log.Printf("Loaded %d exchange rates from %s\n", len(rates), ratesFile)
+		}
+	} else if !os.IsNotExist(err) {
+		log.Printf("Exchange rate file error: %v\n", err)
+	}
+
+	// Background jobs
+	runEvery(time.Hour, "Reputation refresh", h.RefreshReputation)
+	runEvery(10*time.Minute, "Price summary refresh", h.RefreshPriceSummaries)
+	runDaily(2, "Price forecast recompute", h.RecomputeForecasts)
+	runEvery(15*time.Minute, "Price alert evaluation", h.EvaluatePriceAlerts)
+	runEvery(time.Hour, "Listing expiry", h.ExpireListings)
+	runEvery(15*time.Minute, "Offer expiry", h.ExpireOffers)
+	runEvery(time.Hour, "Demand request expiry", h.ExpireDemandRequests)
+	runEvery(time.Hour, "Trust refresh", h.RefreshTrust)
+
 	// 4. Routes
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "up"})
@@ -71,21 +99,86 @@ func main() {
 	r.GET("/api/prices", h.GetLatestPrices)
 	r.POST("/api/prices", h.SubmitPrice)
 	r.DELETE("/api/prices/:id", h.DeletePrice)
+	r.GET("/api/prices/series", h.GetPriceSeries)
+	r.GET("/api/prices/forecast", h.GetPriceForecast)
+	r.GET("/api/prices/pending", h.GetPendingPrices)
+	r.POST("/api/prices/:id/confirm", h.ConfirmPrice)
+	r.POST("/api/prices/:id/reject", h.RejectPrice)
+	r.POST("/api/prices/:id/vote", h.VotePrice)
+	r.POST("/api/admin/prices/import", h.UploadPriceSheet)
 	r.GET("/api/estimate", h.GetEstimation)
+	r.POST("/api/estimate/compare", h.CompareScenarios)
+	r.GET("/api/scenarios", h.GetSavedScenarios)
+	r.GET("/api/scenarios/:id", h.GetSavedScenario)
+	r.DELETE("/api/scenarios/:id", h.DeleteSavedScenario)
 	r.GET("/api/crops", h.GetCropTypes)
 	// Auth
 	r.POST("/api/register", h.Register)
 	r.POST("/api/login", h.Login)
+	r.PUT("/api/users/:id/preferences", h.UpdatePreferences)
+	r.GET("/api/users/:id/reputation", h.GetUserReputation)
+	r.GET("/api/users/:id/trust", h.GetUserTrust)
+	r.POST("/api/users/:id/verify-phone", h.VerifyPhone)
+
+	// Notifications & Alerts
+	r.GET("/api/notifications", h.GetNotifications)
+	r.POST("/api/notifications/read-all", h.MarkAllNotificationsRead)
+	r.POST("/api/notifications/:id/read", h.MarkNotificationRead)
+	r.POST("/api/alerts", h.CreatePriceAlert)
+	r.GET("/api/alerts", h.GetPriceAlerts)
+	r.DELETE("/api/alerts/:id", h.DeletePriceAlert)
+
+	// Currency
+	r.GET("/api/exchange-rates", h.GetExchangeRates)
+	r.POST("/api/admin/exchange-rates", h.UpdateExchangeRates)
 
 	// Marketplace
 	r.Static("/uploads", "./uploads")
 	r.GET("/api/marketplace", h.GetMarketplaceListings)
 	r.POST("/api/marketplace", h.CreateListing)
+	r.PUT("/api/marketplace/:id", h.UpdateListing)
 	r.DELETE("/api/marketplace/:id", h.DeleteListing)
+	r.GET("/api/marketplace/:id/history", h.GetListingHistory)
+	r.GET("/api/marketplace/:id/matches", h.GetListingMatches)
+	r.POST("/api/marketplace/:id/status", h.SetListingStatus)
+	r.POST("/api/marketplace/:id/renew", h.RenewListing)
+
+	// Orders
+	r.POST("/api/orders", h.PlaceOrder)
+	r.GET("/api/orders", h.GetOrders)
+	r.GET("/api/orders/:id", h.GetOrder)
+	r.POST("/api/orders/:id/status", h.UpdateOrderStatus)
+
+	// Offers
+	r.POST("/api/offers", h.MakeOffer)
+	r.GET("/api/offers", h.GetOffers)
+	r.POST("/api/offers/:id/respond", h.RespondToOffer)
+	r.GET("/api/offers/:id/thread", h.GetOfferThread)
+
+	// Messaging
+	r.POST("/api/conversations", h.StartConversation)
+	r.GET("/api/conversations", h.GetConversations)
+	r.GET("/api/conversations/:id/messages", h.GetMessages)
+	r.POST("/api/conversations/:id/messages", h.SendMessage)
+	r.POST("/api/conversations/:id/read", h.MarkConversationRead)
+	r.POST("/api/conversations/:id/share-phone", h.SharePhone)
+	r.GET("/api/messages/unread", h.GetUnreadMessageCount)
+	r.GET("/api/messages/ws", h.MessageSocket)
+	r.POST("/api/blocks", h.BlockUser)
+	r.GET("/api/blocks", h.GetBlockedUsers)
+	r.DELETE("/api/blocks/:id", h.UnblockUser)
 
 	// Reviews
 	r.POST("/api/reviews", h.CreateReview)
+	r.GET("/api/reviews/reports", h.GetReportedReviews)
+	r.PUT("/api/reviews/:id", h.UpdateReview)
+	r.POST("/api/reviews/:id/reply", h.ReplyToReview)
+	r.POST("/api/reviews/:id/report", h.ReportReview)
+	r.POST("/api/reviews/:id/moderate", h.ModerateReview)
 	r.GET("/api/farmers/:id/reviews", h.GetFarmerReviews)
+	r.POST("/api/buyer-reviews", h.CreateBuyerReview)
+	r.PUT("/api/buyer-reviews/:id", h.UpdateBuyerReview)
+	r.GET("/api/buyers/:id/reviews", h.GetBuyerReviews)
 
 	// Saved Listings
 	r.POST("/api/saved", h.SaveListing)
@@ -95,13 +188,21 @@ func main() {
 	// Demand Requests
 	r.POST("/api/demands", h.CreateDemandRequest)
 	r.GET("/api/demands", h.GetDemandRequests)
+	r.GET("/api/search/suggest", h.GetSearchSuggestions)
+	r.GET("/api/demands/:id", h.GetDemandRequest)
+	r.PUT("/api/demands/:id", h.UpdateDemandRequest)
 	r.DELETE("/api/demands/:id", h.DeleteDemandRequest)
+	r.POST("/api/demands/:id/responses", h.RespondToDemand)
+	r.POST("/api/demands/:id/responses/:response_id", h.AnswerDemandResponse)
+	r.POST("/api/demands/:id/fulfilments", h.RecordDemandFulfilment)
+	r.GET("/api/demands/:id/matches", h.GetDemandMatches)
 
 	// Analytics
 	r.POST("/api/marketplace/:id/view", h.IncrementViewCount)
 	r.POST("/api/marketplace/:id/contact", h.IncrementContactCount)
 	r.GET("/api/farmers/:id/analytics", h.GetFarmerAnalytics)
 	r.GET("/api/analytics", h.GetPlatformAnalytics)
+	r.GET("/api/analytics/arbitrage", h.GetArbitrage)
 
 	// Weather
 	r.GET("/api/weather/current", h.GetCurrentWeather)
@@ -117,3 +218,35 @@ func main() {
 	log.Printf("Server starting on :8080...")
 	r.Run(":8080")
 }
+
+// runEvery runs job in the background immediately and then at every interval, logging failures.
+func runEvery(interval time.Duration, name string, job func(context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := job(context.Background()); err != nil {
+				log.Printf("%s error: %v\n", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// runDaily runs job in the background every day at the given local hour, logging failures.
+func runDaily(hour int, name string, job func(context.Context) error) {
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			if err := job(context.Background()); err != nil {
+				log.Printf("%s error: %v\n", name, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,76 @@
+package main
+
+// legacyLatestPricesQuery is GetLatestPrices as it was before price_summaries: the
+// aggregate plus correlated subqueries evaluated on every request. Kept here so the
+// benchmark can compare against it ($1 currency, $2 trim fraction, $3 anonymous
+// weight, $4 default reputation).
+const legacyLatestPricesQuery = `
+		WITH votes AS (
+			SELECT pv.price_id,
+			       SUM(COALESCE(vr.score, $4)) FILTER (WHERE pv.vote = 'confirm') AS confirm_weight,
+			       SUM(COALESCE(vr.score, $4)) FILTER (WHERE pv.vote = 'dispute') AS dispute_weight
+			FROM price_votes pv
+			LEFT JOIN user_reputation vr ON vr.user_id = pv.user_id
+			GROUP BY pv.price_id
+		),
+		converted AS (
+			SELECT m.crop_type_id, m.region, m.volume_tier, m.submitted_at,
+			       m.price_per_kg * fx_rate(m.currency, $1, m.submitted_at::date) AS price,
+			       CASE WHEN m.submitted_by IS NULL THEN $3 ELSE COALESCE(r.score, $4) END
+			       * LEAST(GREATEST((1 + COALESCE(v.confirm_weight, 0)) / (1 + COALESCE(v.dispute_weight, 0)), 0.25), 2) AS weight
+			FROM market_prices m
+			LEFT JOIN user_reputation r ON r.user_id = m.submitted_by
+			LEFT JOIN votes v ON v.price_id = m.id
+			WHERE m.is_active = TRUE AND m.status = 'published' AND m.submitted_at >= NOW() - INTERVAL '30 days'
+		),
+		ranked AS (
+			SELECT converted.*,
+			       ROW_NUMBER() OVER (PARTITION BY crop_type_id, region, volume_tier ORDER BY price) AS rn,
+			       COUNT(*) OVER (PARTITION BY crop_type_id, region, volume_tier) AS cnt
+			FROM converted
+			WHERE price IS NOT NULL
+		),
+		trimmed AS (
+			SELECT ranked.*, (rn > FLOOR(cnt * $2::numeric) AND rn <= cnt - FLOOR(cnt * $2::numeric)) AS kept
+			FROM ranked
+		)
+		SELECT 
+			c.name as crop_name,
+			m1.region,
+			COALESCE(SUM(m1.price * m1.weight) FILTER (WHERE m1.volume_tier = 'retail' AND m1.kept)
+				/ NULLIF(SUM(m1.weight) FILTER (WHERE m1.volume_tier = 'retail' AND m1.kept), 0), 0) as retail_price,
+			COALESCE(SUM(m1.price * m1.weight) FILTER (WHERE m1.volume_tier = 'wholesale' AND m1.kept)
+				/ NULLIF(SUM(m1.weight) FILTER (WHERE m1.volume_tier = 'wholesale' AND m1.kept), 0), 0) as wholesale_price,
+			COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY m1.price) FILTER (WHERE m1.volume_tier = 'retail'), 0) as retail_median,
+			COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY m1.price) FILTER (WHERE m1.volume_tier = 'wholesale'), 0) as wholesale_median,
+			COUNT(*) FILTER (WHERE m1.volume_tier = 'retail') as retail_samples,
+			COUNT(*) FILTER (WHERE m1.volume_tier = 'wholesale') as wholesale_samples,
+			COALESCE(SUM(m1.weight) FILTER (WHERE m1.submitted_at >= NOW() - INTERVAL '48 hours'), 0) as recent_weight,
+			MAX(m1.submitted_at) as last_update,
+			(
+				SELECT json_agg(json_build_object(
+					'id', id, 
+					'price', price_per_kg * fx_rate(currency, $1, submitted_at::date), 
+					'original_price', price_per_kg,
+					'currency', currency,
+					'date', submitted_at, 
+					'tier', volume_tier,
+					'user_id', submitted_by
+				))
+				FROM (
+					SELECT id, price_per_kg, currency, submitted_at, volume_tier, submitted_by
+					FROM market_prices history
+					WHERE history.crop_type_id = m1.crop_type_id AND history.region = m1.region AND history.is_active = TRUE AND history.status = 'published'
+					AND history.submitted_at >= NOW() - INTERVAL '30 days'
+					ORDER BY submitted_at ASC
+				) h
+			) as history,
+			(SELECT COUNT(DISTINCT submitted_by) FROM market_prices v WHERE v.crop_type_id = m1.crop_type_id AND v.region = m1.region AND v.submitted_at >= NOW() - INTERVAL '48 hours' AND v.is_active = TRUE AND v.status = 'published' AND v.submitted_by IS NOT NULL) as dist_farmers,
+			(SELECT COUNT(*) FROM market_prices v WHERE v.crop_type_id = m1.crop_type_id AND v.region = m1.region AND v.submitted_at >= NOW() - INTERVAL '48 hours' AND v.is_active = TRUE AND v.status = 'published' AND v.submitted_by IS NULL) as anon_reports,
+			(SELECT submitted_by FROM market_prices s WHERE s.crop_type_id = m1.crop_type_id AND s.region = m1.region AND s.is_active = TRUE AND s.status = 'published' ORDER BY submitted_at DESC LIMIT 1) as owner,
+			(SELECT id FROM market_prices i WHERE i.crop_type_id = m1.crop_type_id AND i.region = m1.region AND i.is_active = TRUE AND i.status = 'published' ORDER BY submitted_at DESC LIMIT 1) as latest_id
+		FROM trimmed m1
+		JOIN crop_types c ON m1.crop_type_id = c.id
+		GROUP BY c.name, m1.region, m1.crop_type_id
+		ORDER BY last_update DESC
+`
@@ -0,0 +1,122 @@
+package currency
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Soum is the platform's first-class currency; everything else is converted to or from it.
+const (
+	UZS = "UZS"
+	USD = "USD"
+)
+
+// Supported lists the currencies users may submit prices in.
+var Supported = []string{UZS, USD, "EUR", "RUB", "KZT"}
+
+// Normalize validates a currency code. An empty code falls back to def.
+func Normalize(code, def string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return def, nil
+	}
+	// Common local spellings of the soum
+	if code == "SUM" || code == "SOM" || code == "SO'M" {
+		return UZS, nil
+	}
+	for _, s := range Supported {
+		if s == code {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported currency %q (use one of %s)", code, strings.Join(Supported, ", "))
+}
+
+// Rate is how many units of Currency buy one US dollar on EffectiveDate.
+type Rate struct {
+	Currency      string    `json:"currency"`
+	UnitsPerUSD   float64   `json:"units_per_usd"`
+	EffectiveDate time.Time `json:"effective_date"`
+	Source        string    `json:"source,omitempty"`
+}
+
+// Rates holds the latest units-per-USD for each currency.
+type Rates map[string]float64
+
+// Convert converts an amount between currencies. It returns false if either rate is unknown.
+func (r Rates) Convert(amount float64, from, to string) (float64, bool) {
+	if from == to {
+		return amount, true
+	}
+	fromRate := r.unitsPerUSD(from)
+	toRate := r.unitsPerUSD(to)
+	if fromRate <= 0 || toRate <= 0 {
+		return 0, false
+	}
+	return amount / fromRate * toRate, true
+}
+
+func (r Rates) unitsPerUSD(code string) float64 {
+	if code == USD {
+		return 1
+	}
+	return r[code]
+}
+
+// LoadRatesFile reads exchange rates from a CSV file with the columns
+// currency,units_per_usd,effective_date (YYYY-MM-DD). A header row is optional.
+func LoadRatesFile(path string) ([]Rate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseRatesCSV(f, "file:"+path)
+}
+
+// ParseRatesCSV parses rates in the LoadRatesFile format, tagging each with source.
+func ParseRatesCSV(r io.Reader, source string) ([]Rate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var rates []Rate
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: expected currency,units_per_usd,effective_date", line)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "currency") {
+			continue
+		}
+
+		code, err := Normalize(record[0], "")
+		if err != nil || code == "" {
+			return nil, fmt.Errorf("line %d: unsupported currency %q", line, record[0])
+		}
+		units, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil || units <= 0 {
+			return nil, fmt.Errorf("line %d: units_per_usd must be a positive number", line)
+		}
+		date, err := time.Parse("2006-01-02", strings.TrimSpace(record[2]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: effective_date must be YYYY-MM-DD", line)
+		}
+
+		rates = append(rates, Rate{Currency: code, UnitsPerUSD: units, EffectiveDate: date, Source: source})
+	}
+	return rates, nil
+}
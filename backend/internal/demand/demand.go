@@ -0,0 +1,75 @@
+// Package demand defines the life of a buyer's demand request: it stays open while
+// farmers respond and fills partially as their responses are accepted, closing on its
+// own once the full quantity is filled or its needed-by date has passed.
+package demand
+
+import (
+	"math"
+	"time"
+)
+
+// Demand request states
+const (
+	Open    = "open"
+	Filled  = "filled"
+	Expired = "expired" // needed_by passed before it was filled
+	Closed  = "closed"  // withdrawn by the buyer
+)
+
+// Farmer response states
+const (
+	Pending   = "pending"
+	Accepted  = "accepted"
+	Declined  = "declined"
+	Withdrawn = "withdrawn"
+	Lapsed    = "lapsed" // the request closed before the buyer answered
+)
+
+// Answers to a farmer's response
+const (
+	Accept   = "accept"
+	Decline  = "decline"
+	Withdraw = "withdraw" // by the farmer who responded
+)
+
+// Remaining is how much of a request is still to be filled, to the hundredth of a kg
+// quantities are stored in, so float error never leaves a sliver open.
+func Remaining(quantityKG, fulfilledKG float64) float64 {
+	return max(math.Round((quantityKG-fulfilledKG)*100)/100, 0)
+}
+
+// Status is the state a request that hasn't been withdrawn should be in on day now:
+// filled once nothing remains, expired once needed_by has passed, open otherwise.
+func Status(quantityKG, fulfilledKG float64, neededBy *time.Time, now time.Time) string {
+	if Remaining(quantityKG, fulfilledKG) == 0 {
+		return Filled
+	}
+	if neededBy != nil {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		day := time.Date(neededBy.Year(), neededBy.Month(), neededBy.Day(), 0, 0, 0, 0, time.UTC)
+		if day.Before(today) {
+			return Expired
+		}
+	}
+	return Open
+}
+
+// ValidAnswer reports whether answer is a known answer to a response.
+func ValidAnswer(answer string) bool {
+	return answer == Accept || answer == Decline || answer == Withdraw
+}
+
+// ByFarmer reports whether an answer is made by the responding farmer rather than the
+// buyer.
+func ByFarmer(answer string) bool {
+	return answer == Withdraw
+}
+
+// Valid reports whether status is a known demand request state.
+func Valid(status string) bool {
+	switch status {
+	case Open, Filled, Expired, Closed:
+		return true
+	}
+	return false
+}
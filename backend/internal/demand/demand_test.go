@@ -0,0 +1,47 @@
+package demand
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemaining(t *testing.T) {
+	tests := []struct {
+		quantity, fulfilled, want float64
+	}{
+		{10.7, 0.4, 10.3}, // 10.299999999999999 before rounding
+		{10, 2.5, 7.5},
+		{0.3, 0.1 + 0.2, 0}, // 0.30000000000000004 filled
+		{5, 6, 0},
+	}
+	for _, tt := range tests {
+		if got := Remaining(tt.quantity, tt.fulfilled); got != tt.want {
+			t.Errorf("Remaining(%v, %v) = %v, want %v", tt.quantity, tt.fulfilled, got, tt.want)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	now := time.Date(2026, 6, 10, 15, 0, 0, 0, time.UTC)
+	yesterday := now.AddDate(0, 0, -1)
+	today := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                string
+		quantity, fulfilled float64
+		neededBy            *time.Time
+		want                string
+	}{
+		{"partly filled", 10.7, 0.4, nil, Open},
+		{"filled in parts", 10.7, 0.4 + 10.3, nil, Filled},
+		{"sums short by float error", 0.3, 0.1 + 0.2, nil, Filled},
+		{"needed today", 10, 1, &today, Open},
+		{"needed yesterday", 10, 1, &yesterday, Expired},
+		{"filled after needed_by", 10, 10, &yesterday, Filled},
+	}
+	for _, tt := range tests {
+		if got := Status(tt.quantity, tt.fulfilled, tt.neededBy, now); got != tt.want {
+			t.Errorf("%s: Status = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
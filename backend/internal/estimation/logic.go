@@ -7,54 +7,65 @@ type Estimate struct {
 	MinIncome     float64 `json:"min_income_usd"`
 	MaxIncome     float64 `json:"max_income_usd"`
 	AvgPricePerKG float64 `json:"avg_price_per_kg"`
+	Region        string  `json:"region,omitempty"`
+	Irrigation    string  `json:"irrigation,omitempty"`
+	Hectares      float64 `json:"hectares"`
+	YieldSource   string  `json:"yield_source"`
+	PriceSource   string  `json:"price_source"`
+
+	// Income and price in the caller's currency (USD unless converted with InCurrency)
+	Currency   string  `json:"currency"`
+	MinRevenue float64 `json:"min_income"`
+	MaxRevenue float64 `json:"max_income"`
+	PricePerKG float64 `json:"price_per_kg"`
 }
 
-// GetCropEstimate provides rough ranges based on Uzbekistan averages and FAO data.
-func GetCropEstimate(cropName string, hectares float64, priceOverride float64) Estimate {
-	var yieldMin, yieldMax, avgPrice float64
-
-	switch cropName {
-	case "Wheat":
-		yieldMin, yieldMax = 4000, 6000 // kg per hectare (Uzbekistan avg: 4.5-5.5t)
-		avgPrice = 0.35                 // ~$0.35 per kg
-	case "Rice":
-		yieldMin, yieldMax = 4500, 6500
-		avgPrice = 1.10
-	case "Tomato":
-		yieldMin, yieldMax = 25000, 45000
-		avgPrice = 0.45
-	case "Onion":
-		yieldMin, yieldMax = 20000, 35000
-		avgPrice = 0.25
-	case "Cotton":
-		yieldMin, yieldMax = 2500, 3500 // Uzbekistan avg: ~2.8-3.2t
-		avgPrice = 0.85
-	case "Carrot":
-		yieldMin, yieldMax = 20000, 40000
-		avgPrice = 0.20
-	case "Maize":
-		yieldMin, yieldMax = 5000, 9000
-		avgPrice = 0.22
-	case "Potato":
-		yieldMin, yieldMax = 18000, 28000
-		avgPrice = 0.32
-	default:
-		// Fallback for unknown crops
-		yieldMin, yieldMax = 1000, 3000
-		avgPrice = 0.30
-	}
+// InCurrency expresses the estimate's money fields in another currency.
+// unitsPerUSD is how many units of that currency buy one dollar.
+// The *_usd fields are left untouched.
+func (e *Estimate) InCurrency(code string, unitsPerUSD float64) {
+	e.Currency = code
+	e.MinRevenue = e.MinIncome * unitsPerUSD
+	e.MaxRevenue = e.MaxIncome * unitsPerUSD
+	e.PricePerKG = e.AvgPricePerKG * unitsPerUSD
+}
 
-	// Use price from database if available (dynamic crowdsourced price)
-	if priceOverride > 0 {
-		avgPrice = priceOverride
-	}
+// cropBaseline holds per-hectare yield ranges and a reference farm-gate price.
+type cropBaseline struct {
+	YieldMin float64 // kg per hectare
+	YieldMax float64 // kg per hectare
+	AvgPrice float64 // USD per kg
+}
 
-	return Estimate{
-		CropName:      cropName,
-		MinYield:      yieldMin * hectares,
-		MaxYield:      yieldMax * hectares,
-		MinIncome:     yieldMin * hectares * avgPrice,
-		MaxIncome:     yieldMax * hectares * avgPrice,
-		AvgPricePerKG: avgPrice,
+// Uzbekistan averages and FAO data.
+var cropBaselines = map[string]cropBaseline{
+	"Wheat":  {4000, 6000, 0.35}, // Uzbekistan avg: 4.5-5.5t, ~$0.35 per kg
+	"Rice":   {4500, 6500, 1.10},
+	"Tomato": {25000, 45000, 0.45},
+	"Onion":  {20000, 35000, 0.25},
+	"Cotton": {2500, 3500, 0.85}, // Uzbekistan avg: ~2.8-3.2t
+	"Carrot": {20000, 40000, 0.20},
+	"Maize":  {5000, 9000, 0.22},
+	"Potato": {18000, 28000, 0.32},
+}
+
+// Fallback for unknown crops
+var defaultBaseline = cropBaseline{1000, 3000, 0.30}
+
+func baselineFor(cropName string) cropBaseline {
+	if b, ok := cropBaselines[cropName]; ok {
+		return b
 	}
+	return defaultBaseline
+}
+
+// GetCropEstimate provides rough ranges based on Uzbekistan averages and FAO data.
+func GetCropEstimate(cropName string, hectares float64, priceOverride float64) Estimate {
+	// Use price from database if available (dynamic crowdsourced price)
+	return GetFieldEstimate(FieldInput{
+		CropName:    cropName,
+		Hectares:    hectares,
+		Price:       priceOverride,
+		PriceSource: PriceSourceNational,
+	})
 }
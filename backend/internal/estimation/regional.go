@@ -0,0 +1,198 @@
+package estimation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Yield data sources, from most to least specific.
+const (
+	YieldSourceRegionTable = "region_table"      // measured yields for this crop in this region
+	YieldSourceRegionScale = "region_factor"     // national baseline scaled by regional productivity
+	YieldSourceNational    = "national_baseline" // Uzbekistan-wide average
+	YieldSourceDefault     = "default"           // crop not in our tables
+)
+
+// Price data sources, from most to least specific.
+const (
+	PriceSourceRegional  = "regional_market" // crowdsourced reports from the same region
+	PriceSourceNational  = "national_market" // crowdsourced reports from all regions
+	PriceSourceReference = "reference"       // built-in reference price
+)
+
+// Region/crop combinations with their own yield statistics (kg per hectare, irrigated).
+var regionCropYields = map[string]map[string]cropBaseline{
+	"Fergana": {
+		"Tomato": {30000, 50000, 0},
+		"Onion":  {25000, 40000, 0},
+		"Cotton": {2800, 3800, 0},
+		"Wheat":  {5000, 6500, 0},
+		"Potato": {20000, 30000, 0},
+	},
+	"Andijan": {
+		"Tomato": {28000, 48000, 0},
+		"Onion":  {24000, 38000, 0},
+		"Cotton": {2800, 3700, 0},
+	},
+	"Samarkand": {
+		"Potato": {20000, 32000, 0},
+		"Wheat":  {4500, 6000, 0},
+	},
+	"Surkhandarya": {
+		"Cotton": {2800, 3600, 0},
+	},
+	"Khorezm": {
+		"Rice":   {4500, 6000, 0},
+		"Cotton": {2200, 3000, 0},
+	},
+	"Karakalpakstan": {
+		"Cotton": {1500, 2500, 0},
+		"Wheat":  {2500, 4000, 0},
+		"Rice":   {3500, 5500, 0},
+	},
+}
+
+// General productivity of each region relative to the national average.
+// Reflects soil salinity, water availability and growing season length.
+var regionYieldFactors = map[string]float64{
+	"Tashkent":       1.05,
+	"Samarkand":      1.00,
+	"Bukhara":        0.90,
+	"Fergana":        1.10,
+	"Andijan":        1.10,
+	"Namangan":       1.05,
+	"Kashkadarya":    0.90,
+	"Surkhandarya":   0.95,
+	"Jizzakh":        0.85,
+	"Syrdarya":       0.85,
+	"Navoiy":         0.80,
+	"Khorezm":        0.85,
+	"Karakalpakstan": 0.70,
+}
+
+// Irrigation types
+const (
+	IrrigationFurrow  = "irrigated" // conventional furrow/flood irrigation, the baseline
+	IrrigationDrip    = "drip"
+	IrrigationRainfed = "rainfed" // bogara land
+)
+
+// Rainfed (bogara) yields relative to irrigated ones. Only wheat is commonly grown rainfed.
+var rainfedFactors = map[string]float64{
+	"Wheat":  0.35,
+	"Maize":  0.25,
+	"Potato": 0.20,
+}
+
+const defaultRainfedFactor = 0.15
+const dripFactor = 1.15
+
+// Plot size units and their size in hectares
+var unitHectares = map[string]float64{
+	"hectare": 1,
+	"ha":      1,
+	"sotix":   0.01, // 100 m²
+	"sotyk":   0.01,
+	"sotka":   0.01,
+	"m2":      0.0001,
+}
+
+// ToHectares converts an area in the given unit to hectares. An empty unit means hectares.
+func ToHectares(area float64, unit string) (float64, error) {
+	unit = strings.ToLower(strings.TrimSpace(unit))
+	if unit == "" {
+		return area, nil
+	}
+	factor, ok := unitHectares[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q (use hectare or sotix)", unit)
+	}
+	return area * factor, nil
+}
+
+// NormalizeIrrigation validates an irrigation type. An empty value means furrow irrigation.
+func NormalizeIrrigation(irrigation string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(irrigation)) {
+	case "", IrrigationFurrow, "furrow", "flood":
+		return IrrigationFurrow, nil
+	case IrrigationDrip:
+		return IrrigationDrip, nil
+	case IrrigationRainfed, "bogara":
+		return IrrigationRainfed, nil
+	}
+	return "", fmt.Errorf("unknown irrigation type %q (use irrigated, drip or rainfed)", irrigation)
+}
+
+// regionalYield resolves per-hectare yields for a crop in a region under an
+// irrigation type, walking region table -> region factor -> national baseline.
+func regionalYield(cropName, region, irrigation string) (yieldMin, yieldMax float64, source string) {
+	national, known := cropBaselines[cropName]
+	if !known {
+		national = defaultBaseline
+	}
+
+	switch {
+	case regionCropYields[region][cropName].YieldMax > 0:
+		b := regionCropYields[region][cropName]
+		yieldMin, yieldMax, source = b.YieldMin, b.YieldMax, YieldSourceRegionTable
+	case known && regionYieldFactors[region] > 0:
+		f := regionYieldFactors[region]
+		yieldMin, yieldMax, source = national.YieldMin*f, national.YieldMax*f, YieldSourceRegionScale
+	case known:
+		yieldMin, yieldMax, source = national.YieldMin, national.YieldMax, YieldSourceNational
+	default:
+		yieldMin, yieldMax, source = national.YieldMin, national.YieldMax, YieldSourceDefault
+	}
+
+	switch irrigation {
+	case IrrigationDrip:
+		yieldMin, yieldMax = yieldMin*dripFactor, yieldMax*dripFactor
+	case IrrigationRainfed:
+		f, ok := rainfedFactors[cropName]
+		if !ok {
+			f = defaultRainfedFactor
+		}
+		yieldMin, yieldMax = yieldMin*f, yieldMax*f
+	}
+
+	return yieldMin, yieldMax, source
+}
+
+type FieldInput struct {
+	CropName    string
+	Region      string  // canonical region name, may be empty
+	Irrigation  string  // normalized irrigation type, may be empty
+	Hectares    float64 // already converted from the caller's unit
+	Price       float64 // USD per kg; zero falls back to the reference price
+	PriceSource string
+}
+
+// GetFieldEstimate provides yield and income ranges for a specific field,
+// taking region and irrigation type into account.
+func GetFieldEstimate(in FieldInput) Estimate {
+	if in.Irrigation == "" {
+		in.Irrigation = IrrigationFurrow
+	}
+	yieldMin, yieldMax, yieldSource := regionalYield(in.CropName, in.Region, in.Irrigation)
+
+	avgPrice, priceSource := in.Price, in.PriceSource
+	if avgPrice <= 0 {
+		avgPrice, priceSource = baselineFor(in.CropName).AvgPrice, PriceSourceReference
+	}
+
+	est := Estimate{
+		CropName:      in.CropName,
+		Region:        in.Region,
+		Irrigation:    in.Irrigation,
+		Hectares:      in.Hectares,
+		MinYield:      yieldMin * in.Hectares,
+		MaxYield:      yieldMax * in.Hectares,
+		MinIncome:     yieldMin * in.Hectares * avgPrice,
+		MaxIncome:     yieldMax * in.Hectares * avgPrice,
+		AvgPricePerKG: avgPrice,
+		YieldSource:   yieldSource,
+		PriceSource:   priceSource,
+	}
+	est.InCurrency("USD", 1)
+	return est
+}
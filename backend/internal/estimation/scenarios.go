@@ -0,0 +1,263 @@
+package estimation
+
+import (
+	"math"
+	"sort"
+)
+
+// Seasonal irrigation water need (m³ per hectare)
+var cropWaterNeeds = map[string]float64{
+	"Rice":   8000,
+	"Wheat":  4000,
+	"Maize":  5000,
+	"Potato": 4500,
+	"Tomato": 5500,
+	"Carrot": 3500,
+	"Onion":  4000,
+	"Cotton": 6000,
+}
+
+const defaultWaterNeed = 5000
+
+// Person-days of labor per hectare over a season (planting, weeding, harvest)
+var cropLaborDays = map[string]float64{
+	"Wheat":  15,
+	"Rice":   60,
+	"Tomato": 250,
+	"Onion":  180,
+	"Cotton": 120, // hand picking
+	"Carrot": 150,
+	"Maize":  30,
+	"Potato": 120,
+}
+
+const defaultLaborDays = 80
+
+// scenarioSimulationRuns keeps comparisons fast; the seed is fixed so a saved
+// scenario can be recomputed with identical risk numbers.
+const scenarioSimulationRuns = 2000
+
+type Field struct {
+	Area       float64 `json:"area"`
+	Unit       string  `json:"unit"`
+	Hectares   float64 `json:"hectares"`
+	Region     string  `json:"region,omitempty"`
+	Irrigation string  `json:"irrigation"`
+}
+
+// ScenarioCrop is one candidate crop plus the market data gathered for it.
+type ScenarioCrop struct {
+	CropName    string
+	Price       float64 // per kg; zero falls back to the reference price
+	PriceSource string
+	PriceStdDev float64 // zero means unknown volatility
+	SupplyKG    float64 // active listings in the region
+	DemandKG    float64 // open demand requests in the region
+}
+
+type ScenarioResult struct {
+	Rank              int      `json:"rank"`
+	CropName          string   `json:"crop_name"`
+	Estimate          Estimate `json:"estimate"`
+	TotalCost         float64  `json:"total_cost_usd"`
+	ExpectedNetProfit float64  `json:"expected_net_profit_usd"`
+	P10NetProfit      float64  `json:"p10_net_profit_usd"`
+	P90NetProfit      float64  `json:"p90_net_profit_usd"`
+	ProbabilityOfLoss float64  `json:"probability_of_loss"`
+	WaterNeedM3       float64  `json:"water_need_m3"`
+	ProfitPerM3       float64  `json:"profit_per_m3_usd"`
+	WithinWaterBudget bool     `json:"within_water_budget"`
+	LaborDays         float64  `json:"labor_days"`
+	SupplyKG          float64  `json:"market_supply_kg"`
+	DemandKG          float64  `json:"market_demand_kg"`
+	MarketSaturation  float64  `json:"market_saturation"` // 0 = unmet demand, 1 = only supply
+	Score             float64  `json:"score"`
+
+	// Money in the caller's currency (USD unless converted with InCurrency)
+	Currency    string  `json:"currency"`
+	Cost        float64 `json:"total_cost"`
+	ExpectedNet float64 `json:"expected_net_profit"`
+	P10Net      float64 `json:"p10_net_profit"`
+	P90Net      float64 `json:"p90_net_profit"`
+	PerM3       float64 `json:"profit_per_m3"`
+}
+
+// InCurrency expresses the result's money fields, its estimate's included, in
+// another currency. unitsPerUSD is how many units of that currency buy one dollar.
+// The *_usd fields are left untouched.
+func (r *ScenarioResult) InCurrency(code string, unitsPerUSD float64) {
+	r.Estimate.InCurrency(code, unitsPerUSD)
+	r.Currency = code
+	r.Cost = r.TotalCost * unitsPerUSD
+	r.ExpectedNet = r.ExpectedNetProfit * unitsPerUSD
+	r.P10Net = r.P10NetProfit * unitsPerUSD
+	r.P90Net = r.P90NetProfit * unitsPerUSD
+	r.PerM3 = r.ProfitPerM3 * unitsPerUSD
+}
+
+type Recommendation struct {
+	CropName string `json:"crop_name"`
+	Reason   string `json:"reason"`
+}
+
+type Comparison struct {
+	Field          Field            `json:"field"`
+	WaterBudgetM3  float64          `json:"water_budget_m3"`
+	CostPerHectare float64          `json:"cost_per_hectare_usd"`
+	Results        []ScenarioResult `json:"results"`
+	Recommendation *Recommendation  `json:"recommendation"`
+
+	Currency  string  `json:"currency"`
+	CostPerHa float64 `json:"cost_per_hectare"` // in Currency
+}
+
+// InCurrency expresses every result of the comparison in another currency, like
+// ScenarioResult.InCurrency. Ranks and scores stay as computed in USD.
+func (c *Comparison) InCurrency(code string, unitsPerUSD float64) {
+	c.Currency = code
+	c.CostPerHa = c.CostPerHectare * unitsPerUSD
+	for i := range c.Results {
+		c.Results[i].InCurrency(code, unitsPerUSD)
+	}
+}
+
+// marketSaturation compares what is already offered to what buyers are asking for.
+// With no market data it returns a neutral 0.5.
+func marketSaturation(supply, demand float64) float64 {
+	if supply+demand <= 0 {
+		return 0.5
+	}
+	return supply / (supply + demand)
+}
+
+// CompareScenarios evaluates several crops on the same field and ranks them.
+// Crops that fit the water budget (if one is given) always rank above those
+// that don't; within each group the score is expected profit discounted by
+// the probability of loss and by market saturation.
+func CompareScenarios(field Field, crops []ScenarioCrop, waterBudgetM3, costPerHectare float64) Comparison {
+	if field.Irrigation == "" {
+		field.Irrigation = IrrigationFurrow
+	}
+
+	results := make([]ScenarioResult, 0, len(crops))
+	for _, crop := range crops {
+		est := GetFieldEstimate(FieldInput{
+			CropName:    crop.CropName,
+			Region:      field.Region,
+			Irrigation:  field.Irrigation,
+			Hectares:    field.Hectares,
+			Price:       crop.Price,
+			PriceSource: crop.PriceSource,
+		})
+
+		sim := Simulate(SimulationParams{
+			CropName:       crop.CropName,
+			Region:         field.Region,
+			Irrigation:     field.Irrigation,
+			Hectares:       field.Hectares,
+			PriceMean:      est.AvgPricePerKG,
+			PriceStdDev:    crop.PriceStdDev,
+			CostPerHectare: costPerHectare,
+			Runs:           scenarioSimulationRuns,
+			Seed:           1,
+		})
+
+		water, ok := cropWaterNeeds[crop.CropName]
+		if !ok {
+			water = defaultWaterNeed
+		}
+		labor, ok := cropLaborDays[crop.CropName]
+		if !ok {
+			labor = defaultLaborDays
+		}
+		// Rainfed fields draw no irrigation water
+		if field.Irrigation == IrrigationRainfed {
+			water = 0
+		} else if field.Irrigation == IrrigationDrip {
+			water *= 0.7
+		}
+		waterNeed := water * field.Hectares
+
+		saturation := marketSaturation(crop.SupplyKG, crop.DemandKG)
+		expected := sim.MeanIncome
+
+		r := ScenarioResult{
+			CropName:          crop.CropName,
+			Estimate:          est,
+			TotalCost:         sim.TotalCost,
+			ExpectedNetProfit: expected,
+			P10NetProfit:      sim.P10Income,
+			P90NetProfit:      sim.P90Income,
+			ProbabilityOfLoss: sim.ProbabilityOfLoss,
+			WaterNeedM3:       waterNeed,
+			WithinWaterBudget: waterBudgetM3 <= 0 || waterNeed <= waterBudgetM3,
+			LaborDays:         labor * field.Hectares,
+			SupplyKG:          crop.SupplyKG,
+			DemandKG:          crop.DemandKG,
+			MarketSaturation:  saturation,
+			Score:             riskAdjusted(expected, sim.ProbabilityOfLoss, saturation),
+		}
+		if waterNeed > 0 {
+			r.ProfitPerM3 = expected / waterNeed
+		}
+		results = append(results, r)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].WithinWaterBudget != results[j].WithinWaterBudget {
+			return results[i].WithinWaterBudget
+		}
+		return results[i].Score > results[j].Score
+	})
+	for i := range results {
+		results[i].Rank = i + 1
+	}
+
+	cmp := Comparison{
+		Field:          field,
+		WaterBudgetM3:  waterBudgetM3,
+		CostPerHectare: costPerHectare,
+		Results:        results,
+		Recommendation: recommend(results),
+	}
+	cmp.InCurrency("USD", 1)
+	return cmp
+}
+
+// riskAdjusted discounts a profit by risk and saturation. Losses are amplified
+// by the same factor so that a risky loss still ranks below a safe one.
+func riskAdjusted(profit, probLoss, saturation float64) float64 {
+	factor := math.Max(0.05, (1-probLoss)*(1-0.5*saturation))
+	if profit < 0 {
+		return profit / factor
+	}
+	return profit * factor
+}
+
+func recommend(results []ScenarioResult) *Recommendation {
+	if len(results) == 0 {
+		return nil
+	}
+	best := results[0]
+	switch {
+	case !best.WithinWaterBudget:
+		return &Recommendation{
+			CropName: best.CropName,
+			Reason:   "None of the crops fit the water budget; " + best.CropName + " has the best outlook if more water can be secured.",
+		}
+	case best.ExpectedNetProfit <= 0:
+		return &Recommendation{
+			CropName: best.CropName,
+			Reason:   "All options are expected to lose money at current prices; " + best.CropName + " loses the least.",
+		}
+	case best.MarketSaturation > 0.8:
+		return &Recommendation{
+			CropName: best.CropName,
+			Reason:   best.CropName + " has the best risk-adjusted profit, but the local market is already well supplied; line up buyers early.",
+		}
+	}
+	return &Recommendation{
+		CropName: best.CropName,
+		Reason:   best.CropName + " has the best risk-adjusted profit within the water budget.",
+	}
+}
@@ -0,0 +1,260 @@
+package estimation
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Shock is a yield-reducing event that hits a season with some probability.
+type Shock struct {
+	Name        string  `json:"name"`
+	Probability float64 `json:"probability"` // chance per season, 0-1
+	LossMin     float64 `json:"loss_min"`    // fraction of yield lost, 0-1
+	LossMax     float64 `json:"loss_max"`
+}
+
+// RiskProfile describes how exposed a crop is to weather and pest shocks.
+type RiskProfile struct {
+	Drought Shock
+	Pest    Shock
+	Hail    Shock
+}
+
+var cropRisks = map[string]RiskProfile{
+	"Wheat":  {Drought: Shock{"drought", 0.15, 0.15, 0.40}, Pest: Shock{"pest", 0.10, 0.05, 0.20}, Hail: Shock{"hail", 0.05, 0.10, 0.50}},
+	"Rice":   {Drought: Shock{"drought", 0.20, 0.25, 0.60}, Pest: Shock{"pest", 0.10, 0.05, 0.20}, Hail: Shock{"hail", 0.04, 0.10, 0.40}},
+	"Tomato": {Drought: Shock{"drought", 0.12, 0.15, 0.40}, Pest: Shock{"pest", 0.25, 0.10, 0.35}, Hail: Shock{"hail", 0.06, 0.20, 0.70}},
+	"Onion":  {Drought: Shock{"drought", 0.12, 0.10, 0.35}, Pest: Shock{"pest", 0.15, 0.05, 0.25}, Hail: Shock{"hail", 0.05, 0.05, 0.30}},
+	"Cotton": {Drought: Shock{"drought", 0.18, 0.15, 0.45}, Pest: Shock{"pest", 0.20, 0.10, 0.30}, Hail: Shock{"hail", 0.06, 0.15, 0.60}},
+	"Carrot": {Drought: Shock{"drought", 0.10, 0.10, 0.30}, Pest: Shock{"pest", 0.10, 0.05, 0.20}, Hail: Shock{"hail", 0.04, 0.05, 0.20}},
+	"Maize":  {Drought: Shock{"drought", 0.15, 0.20, 0.50}, Pest: Shock{"pest", 0.12, 0.05, 0.25}, Hail: Shock{"hail", 0.05, 0.15, 0.50}},
+	"Potato": {Drought: Shock{"drought", 0.12, 0.15, 0.40}, Pest: Shock{"pest", 0.22, 0.10, 0.35}, Hail: Shock{"hail", 0.04, 0.05, 0.25}},
+}
+
+var defaultRisk = RiskProfile{
+	Drought: Shock{"drought", 0.15, 0.15, 0.40},
+	Pest:    Shock{"pest", 0.15, 0.05, 0.25},
+	Hail:    Shock{"hail", 0.05, 0.10, 0.40},
+}
+
+// DefaultCostPerHectare is the regional average of seeds, fertilizer, labor and water (USD).
+const DefaultCostPerHectare = 510.0
+
+// DefaultPriceVolatility is used when there is too little price history (stddev as a fraction of mean).
+const DefaultPriceVolatility = 0.20
+
+type SimulationParams struct {
+	CropName       string
+	Region         string // canonical region name, may be empty
+	Irrigation     string // normalized irrigation type, may be empty
+	Hectares       float64
+	PriceMean      float64 // per kg; falls back to the crop baseline if zero
+	PriceStdDev    float64 // per kg; falls back to DefaultPriceVolatility if zero
+	CostPerHectare float64
+	Runs           int
+	Seed           int64
+	Buckets        int
+}
+
+type HistogramBucket struct {
+	From        float64 `json:"from"`
+	To          float64 `json:"to"`
+	Count       int     `json:"count"`
+	Probability float64 `json:"probability"`
+}
+
+type Simulation struct {
+	CropName          string             `json:"crop_name"`
+	Region            string             `json:"region,omitempty"`
+	Irrigation        string             `json:"irrigation"`
+	YieldSource       string             `json:"yield_source"`
+	Runs              int                `json:"runs"`
+	Seed              int64              `json:"seed"`
+	Hectares          float64            `json:"hectares"`
+	PriceMean         float64            `json:"price_mean"`
+	PriceStdDev       float64            `json:"price_std_dev"`
+	TotalCost         float64            `json:"total_cost_usd"`
+	MeanYield         float64            `json:"mean_yield_kg"`
+	P10Income         float64            `json:"p10_income_usd"`
+	P50Income         float64            `json:"p50_income_usd"`
+	P90Income         float64            `json:"p90_income_usd"`
+	MeanIncome        float64            `json:"mean_income_usd"`
+	ProbabilityOfLoss float64            `json:"probability_of_loss"`
+	ShockFrequency    map[string]float64 `json:"shock_frequency"`
+	Histogram         []HistogramBucket  `json:"histogram"` // income, in Currency
+
+	// Money in the caller's currency (USD unless converted with InCurrency)
+	Currency   string  `json:"currency"`
+	PricePerKG float64 `json:"price_per_kg"`
+	Cost       float64 `json:"total_cost"`
+	P10        float64 `json:"p10_income"`
+	P50        float64 `json:"p50_income"`
+	P90        float64 `json:"p90_income"`
+	Mean       float64 `json:"mean_income"`
+}
+
+// InCurrency expresses the simulation's money fields and histogram in another
+// currency. unitsPerUSD is how many units of that currency buy one dollar.
+// The *_usd fields are left untouched.
+func (s *Simulation) InCurrency(code string, unitsPerUSD float64) {
+	s.Currency = code
+	s.PricePerKG = s.PriceMean * unitsPerUSD
+	s.Cost = s.TotalCost * unitsPerUSD
+	s.P10 = s.P10Income * unitsPerUSD
+	s.P50 = s.P50Income * unitsPerUSD
+	s.P90 = s.P90Income * unitsPerUSD
+	s.Mean = s.MeanIncome * unitsPerUSD
+	for i := range s.Histogram {
+		s.Histogram[i].From *= unitsPerUSD
+		s.Histogram[i].To *= unitsPerUSD
+	}
+}
+
+// Simulate runs a Monte Carlo model of net income for one season.
+// Yield is drawn from a normal distribution spanning the crop's regional range,
+// reduced by independent drought/pest/hail shocks; price is drawn from a
+// lognormal distribution matching the observed mean and volatility.
+// The same params (including Seed) always produce the same result.
+func Simulate(p SimulationParams) Simulation {
+	if p.Irrigation == "" {
+		p.Irrigation = IrrigationFurrow
+	}
+	yieldMin, yieldMax, yieldSource := regionalYield(p.CropName, p.Region, p.Irrigation)
+	risk, ok := cropRisks[p.CropName]
+	if !ok {
+		risk = defaultRisk
+	}
+
+	if p.Runs <= 0 {
+		p.Runs = 5000
+	}
+	if p.Buckets <= 0 {
+		p.Buckets = 20
+	}
+	if p.PriceMean <= 0 {
+		p.PriceMean = baselineFor(p.CropName).AvgPrice
+	}
+	if p.PriceStdDev <= 0 {
+		p.PriceStdDev = p.PriceMean * DefaultPriceVolatility
+	}
+	if p.CostPerHectare < 0 {
+		p.CostPerHectare = 0
+	}
+
+	rng := rand.New(rand.NewSource(p.Seed))
+
+	// Baseline min/max is treated as roughly a 95% interval.
+	yieldMean := (yieldMin + yieldMax) / 2
+	yieldSD := (yieldMax - yieldMin) / 4
+
+	// Lognormal parameters that reproduce the requested price mean and stddev.
+	cv := p.PriceStdDev / p.PriceMean
+	sigma := math.Sqrt(math.Log(1 + cv*cv))
+	mu := math.Log(p.PriceMean) - sigma*sigma/2
+
+	totalCost := p.CostPerHectare * p.Hectares
+	shocks := []Shock{risk.Drought, risk.Pest, risk.Hail}
+	hits := make(map[string]int, len(shocks))
+
+	incomes := make([]float64, p.Runs)
+	var yieldSum, incomeSum float64
+	losses := 0
+
+	for i := 0; i < p.Runs; i++ {
+		yield := math.Max(0, yieldMean+rng.NormFloat64()*yieldSD)
+		for _, s := range shocks {
+			if rng.Float64() < s.Probability {
+				hits[s.Name]++
+				yield *= 1 - (s.LossMin + rng.Float64()*(s.LossMax-s.LossMin))
+			}
+		}
+		price := math.Exp(mu + sigma*rng.NormFloat64())
+
+		harvest := yield * p.Hectares
+		income := harvest*price - totalCost
+
+		incomes[i] = income
+		yieldSum += harvest
+		incomeSum += income
+		if income < 0 {
+			losses++
+		}
+	}
+
+	sort.Float64s(incomes)
+
+	freq := make(map[string]float64, len(shocks))
+	for _, s := range shocks {
+		freq[s.Name] = float64(hits[s.Name]) / float64(p.Runs)
+	}
+
+	sim := Simulation{
+		CropName:          p.CropName,
+		Region:            p.Region,
+		Irrigation:        p.Irrigation,
+		YieldSource:       yieldSource,
+		Runs:              p.Runs,
+		Seed:              p.Seed,
+		Hectares:          p.Hectares,
+		PriceMean:         p.PriceMean,
+		PriceStdDev:       p.PriceStdDev,
+		TotalCost:         totalCost,
+		MeanYield:         yieldSum / float64(p.Runs),
+		P10Income:         Percentile(incomes, 0.10),
+		P50Income:         Percentile(incomes, 0.50),
+		P90Income:         Percentile(incomes, 0.90),
+		MeanIncome:        incomeSum / float64(p.Runs),
+		ProbabilityOfLoss: float64(losses) / float64(p.Runs),
+		ShockFrequency:    freq,
+		Histogram:         histogram(incomes, p.Buckets),
+	}
+	sim.InCurrency("USD", 1)
+	return sim
+}
+
+// Percentile returns the q-th quantile (0-1) of an ascending slice using linear interpolation.
+func Percentile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	if lo == hi {
+		return sorted[lo]
+	}
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+func histogram(sorted []float64, buckets int) []HistogramBucket {
+	if len(sorted) == 0 {
+		return []HistogramBucket{}
+	}
+	lo, hi := sorted[0], sorted[len(sorted)-1]
+	if hi == lo {
+		return []HistogramBucket{{From: lo, To: hi, Count: len(sorted), Probability: 1}}
+	}
+
+	width := (hi - lo) / float64(buckets)
+	// NaN or infinite incomes can't be placed in a bucket
+	if math.IsNaN(width) || math.IsInf(width, 0) || width <= 0 {
+		return []HistogramBucket{}
+	}
+	result := make([]HistogramBucket, buckets)
+	for i := range result {
+		result[i].From = lo + float64(i)*width
+		result[i].To = lo + float64(i+1)*width
+	}
+	for _, v := range sorted {
+		idx := int((v - lo) / width)
+		if idx >= buckets {
+			idx = buckets - 1
+		}
+		result[idx].Count++
+	}
+	for i := range result {
+		result[i].Probability = float64(result[i].Count) / float64(len(sorted))
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package estimation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistogramNonFinite(t *testing.T) {
+	tests := map[string][]float64{
+		"NaN":       {math.NaN(), math.NaN(), math.NaN()},
+		"NaN mixed": {math.NaN(), 1, 2},
+		"+Inf":      {1, 2, math.Inf(1)},
+		"-Inf":      {math.Inf(-1), 1, 2},
+	}
+	for name, sorted := range tests {
+		if got := histogram(sorted, 10); len(got) != 0 {
+			t.Errorf("%s: got %d buckets, want none", name, len(got))
+		}
+	}
+}
+
+func TestHistogramCountsEveryValue(t *testing.T) {
+	sorted := []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	buckets := histogram(sorted, 5)
+	if len(buckets) != 5 {
+		t.Fatalf("got %d buckets, want 5", len(buckets))
+	}
+	total := 0
+	for _, b := range buckets {
+		total += b.Count
+	}
+	if total != len(sorted) {
+		t.Errorf("buckets hold %d values, want %d", total, len(sorted))
+	}
+	if last := buckets[len(buckets)-1]; last.To != 10 {
+		t.Errorf("last bucket ends at %v, want 10", last.To)
+	}
+}
+
+// A NaN area used to reach histogram and index it with int(NaN)
+func TestSimulateNaNHectares(t *testing.T) {
+	sim := Simulate(SimulationParams{CropName: "Cotton", Hectares: math.NaN(), Runs: 100, Seed: 1})
+	if len(sim.Histogram) != 0 {
+		t.Errorf("got %d histogram buckets for a NaN area, want none", len(sim.Histogram))
+	}
+}
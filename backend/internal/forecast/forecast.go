@@ -0,0 +1,205 @@
+package forecast
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Forecast limits
+const (
+	MinHorizon      = 2
+	MaxHorizon      = 8
+	MinObservations = 8 // weeks with actual reports, before gap filling
+	minTraining     = 6 // shortest series a backtest fit may use
+)
+
+// z-scores for two-sided prediction intervals
+const (
+	z80 = 1.2816
+	z95 = 1.9600
+)
+
+var ErrInsufficientHistory = errors.New("not enough price history to forecast")
+
+type Point struct {
+	Week    string  `json:"week"` // Monday of the forecast week
+	Price   float64 `json:"price"`
+	Lower80 float64 `json:"lower_80"`
+	Upper80 float64 `json:"upper_80"`
+	Lower95 float64 `json:"lower_95"`
+	Upper95 float64 `json:"upper_95"`
+}
+
+type Result struct {
+	Model         string  `json:"model"`
+	Points        []Point `json:"points"`
+	BacktestWeeks int     `json:"backtest_weeks"`
+	MAPE          float64 `json:"mape"`     // mean absolute percentage error on the backtest, 0-1
+	Accuracy      float64 `json:"accuracy"` // 1 - MAPE, floored at 0
+	Observations  int     `json:"observations"`
+	HistoryWeeks  int     `json:"history_weeks"`
+}
+
+// WeekStart returns the Monday (UTC) of the week containing t.
+func WeekStart(t time.Time) time.Time {
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	offset := (int(t.Weekday()) + 6) % 7
+	return t.AddDate(0, 0, -offset)
+}
+
+// Regularize places weekly observations on a gap-free grid from the first to the
+// last observed week, linearly interpolating the weeks in between. observed marks
+// the weeks that had actual reports. The grid stops at the last observation rather
+// than carrying it forward, so no week is ever scored against an invented value.
+func Regularize(weeks []time.Time, values []float64) (start time.Time, series []float64, observed []bool) {
+	if len(weeks) == 0 {
+		return time.Time{}, nil, nil
+	}
+	start = WeekStart(weeks[0])
+	n := weeksBetween(start, WeekStart(weeks[len(weeks)-1])) + 1
+
+	series = make([]float64, n)
+	observed = make([]bool, n)
+	for i, w := range weeks {
+		idx := weeksBetween(start, WeekStart(w))
+		if idx >= 0 && idx < n {
+			series[idx], observed[idx] = values[i], true
+		}
+	}
+
+	prev := -1
+	for i := 0; i < n; i++ {
+		if !observed[i] {
+			continue
+		}
+		if prev >= 0 && i-prev > 1 {
+			step := (series[i] - series[prev]) / float64(i-prev)
+			for j := prev + 1; j < i; j++ {
+				series[j] = series[prev] + step*float64(j-prev)
+			}
+		}
+		prev = i
+	}
+	return start, series, observed
+}
+
+// weeksBetween is the number of whole weeks from one Monday to another.
+func weeksBetween(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours() / (24 * 7)))
+}
+
+// Forecast picks the model with the lowest backtest error on a regular weekly
+// series from Regularize, refits it on the full history and forecasts the horizon
+// weeks after the week containing now. Weeks between the last observation and now
+// are forecast too, but not returned.
+func Forecast(start time.Time, series []float64, observed []bool, now time.Time, horizon int) (Result, error) {
+	observations := 0
+	for _, ok := range observed {
+		if ok {
+			observations++
+		}
+	}
+	if observations < MinObservations || len(series) < MinObservations || len(observed) != len(series) {
+		return Result{}, ErrInsufficientHistory
+	}
+	if horizon < MinHorizon {
+		horizon = MinHorizon
+	} else if horizon > MaxHorizon {
+		horizon = MaxHorizon
+	}
+
+	// Hold back the last weeks, up to one horizon, to score each model. Training
+	// stops at the last observation before them: interpolated weeks in between were
+	// drawn towards the held-back values, and only observed weeks are scored.
+	holdout, trainEnd := horizon, -1
+	for ; holdout > 0; holdout-- {
+		trainEnd = lastObserved(observed, len(series)-holdout)
+		if trainEnd+1 >= minTraining {
+			break
+		}
+	}
+	if holdout == 0 {
+		return Result{}, ErrInsufficientHistory
+	}
+	train := series[:trainEnd+1]
+	steps := len(series) - 1 - trainEnd
+
+	best, bestMAPE := models[0], math.Inf(1)
+	for _, m := range models {
+		if len(train) < m.minLength {
+			continue
+		}
+		predicted, _ := m.fit(train, steps)
+		var actual, scored []float64
+		for i := len(series) - holdout; i < len(series); i++ {
+			if observed[i] {
+				actual = append(actual, series[i])
+				scored = append(scored, predicted[i-trainEnd-1])
+			}
+		}
+		if e := mape(actual, scored); e < bestMAPE {
+			best, bestMAPE = m, e
+		}
+	}
+
+	// Only possible if every held-back week was zero
+	if math.IsInf(bestMAPE, 1) {
+		bestMAPE = 1
+	}
+
+	last := start.AddDate(0, 0, 7*(len(series)-1))
+	gap := max(0, weeksBetween(last, WeekStart(now)))
+	points, sigma := best.fit(series, gap+horizon)
+
+	res := Result{
+		Model:         best.name,
+		BacktestWeeks: holdout,
+		MAPE:          bestMAPE,
+		Accuracy:      math.Max(0, 1-bestMAPE),
+		Observations:  observations,
+		HistoryWeeks:  len(series),
+	}
+	for h := gap; h < len(points); h++ {
+		spread := sigma
+		if !best.seasonal {
+			spread *= math.Sqrt(float64(h + 1))
+		}
+		p := math.Max(0, points[h])
+		res.Points = append(res.Points, Point{
+			Week:    last.AddDate(0, 0, 7*(h+1)).Format("2006-01-02"),
+			Price:   p,
+			Lower80: math.Max(0, p-z80*spread),
+			Upper80: p + z80*spread,
+			Lower95: math.Max(0, p-z95*spread),
+			Upper95: p + z95*spread,
+		})
+	}
+	return res, nil
+}
+
+// lastObserved is the index of the last observed week before end, or -1.
+func lastObserved(observed []bool, end int) int {
+	for i := end - 1; i >= 0; i-- {
+		if observed[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// mape is the mean absolute percentage error, skipping zero actuals.
+func mape(actual, predicted []float64) float64 {
+	sum, n := 0.0, 0
+	for i := range actual {
+		if actual[i] == 0 || i >= len(predicted) {
+			continue
+		}
+		sum += math.Abs((actual[i] - predicted[i]) / actual[i])
+		n++
+	}
+	if n == 0 {
+		return math.Inf(1)
+	}
+	return sum / float64(n)
+}
@@ -0,0 +1,73 @@
+package forecast
+
+import (
+	"testing"
+	"time"
+)
+
+var monday = time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+
+func week(i int) time.Time { return monday.AddDate(0, 0, 7*i) }
+
+func TestRegularizeStopsAtLastObservation(t *testing.T) {
+	start, series, observed := Regularize(
+		[]time.Time{week(0), week(3), week(4)},
+		[]float64{10, 16, 20},
+	)
+	if !start.Equal(monday) {
+		t.Fatalf("start = %v, want %v", start, monday)
+	}
+	want := []float64{10, 12, 14, 16, 20}
+	if len(series) != len(want) {
+		t.Fatalf("series = %v, want %v", series, want)
+	}
+	for i := range want {
+		if series[i] != want[i] {
+			t.Fatalf("series = %v, want %v", series, want)
+		}
+	}
+	wantObserved := []bool{true, false, false, true, true}
+	for i := range wantObserved {
+		if observed[i] != wantObserved[i] {
+			t.Fatalf("observed = %v, want %v", observed, wantObserved)
+		}
+	}
+}
+
+// A series that stopped reporting months ago used to be carried forward to now,
+// so the backtest scored every model against flat invented weeks and the naive
+// model looked perfect.
+func TestForecastSparseSeriesIsNotPerfect(t *testing.T) {
+	values := []float64{100, 112, 95, 120, 90, 118, 97, 125, 88, 121, 99, 130}
+	var weeks []time.Time
+	for i := range values {
+		weeks = append(weeks, week(3*i)) // one report every three weeks
+	}
+	now := week(3*len(values) + 20)
+
+	start, series, observed := Regularize(weeks, values)
+	res, err := Forecast(start, series, observed, now, MaxHorizon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MAPE < 0.01 || res.Accuracy > 0.99 {
+		t.Errorf("MAPE = %.4f, accuracy = %.4f; a noisy sparse series can't be forecast perfectly", res.MAPE, res.Accuracy)
+	}
+	if res.Observations != len(values) {
+		t.Errorf("Observations = %d, want %d", res.Observations, len(values))
+	}
+	if len(res.Points) != MaxHorizon {
+		t.Fatalf("got %d points, want %d", len(res.Points), MaxHorizon)
+	}
+	if first := now.AddDate(0, 0, 7).Format("2006-01-02"); res.Points[0].Week != first {
+		t.Errorf("first point is for %s, want the week after now (%s)", res.Points[0].Week, first)
+	}
+}
+
+func TestForecastNeedsObservedWeeks(t *testing.T) {
+	// Two reports far apart interpolate to a long series, but that isn't history
+	start, series, observed := Regularize([]time.Time{week(0), week(30)}, []float64{100, 130})
+	if _, err := Forecast(start, series, observed, week(31), MaxHorizon); err != ErrInsufficientHistory {
+		t.Errorf("err = %v, want ErrInsufficientHistory", err)
+	}
+}
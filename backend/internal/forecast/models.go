@@ -0,0 +1,179 @@
+package forecast
+
+import "math"
+
+// SeasonLength is one year of weekly observations.
+const SeasonLength = 52
+
+// Smoothing parameters tried when fitting exponential smoothing models
+var smoothingGrid = []float64{0.1, 0.2, 0.3, 0.5, 0.7, 0.9}
+
+// Trend damping keeps a short-lived slope from running away over the horizon
+const dampingFactor = 0.9
+
+// model fits a weekly series and produces point forecasts plus the in-sample
+// one-step residual standard deviation used for prediction intervals.
+type model struct {
+	name      string
+	minLength int
+	fit       func(y []float64, horizon int) (points []float64, sigma float64)
+	// seasonal models' errors don't compound week to week the way a random walk's do
+	seasonal bool
+}
+
+var models = []model{
+	{name: ModelNaive, minLength: 2, fit: naive},
+	{name: ModelHolt, minLength: 4, fit: holt},
+	{name: ModelSeasonalNaive, minLength: SeasonLength + 1, fit: seasonalNaive, seasonal: true},
+	{name: ModelHoltWinters, minLength: 2 * SeasonLength, fit: holtWinters, seasonal: true},
+}
+
+// Model names
+const (
+	ModelNaive         = "naive"
+	ModelHolt          = "holt_damped"
+	ModelSeasonalNaive = "seasonal_naive"
+	ModelHoltWinters   = "holt_winters"
+)
+
+// naive repeats the last observation.
+func naive(y []float64, horizon int) ([]float64, float64) {
+	var residuals []float64
+	for t := 1; t < len(y); t++ {
+		residuals = append(residuals, y[t]-y[t-1])
+	}
+	points := make([]float64, horizon)
+	for h := range points {
+		points[h] = y[len(y)-1]
+	}
+	return points, rms(residuals)
+}
+
+// seasonalNaive repeats the value from the same week last year.
+func seasonalNaive(y []float64, horizon int) ([]float64, float64) {
+	var residuals []float64
+	for t := SeasonLength; t < len(y); t++ {
+		residuals = append(residuals, y[t]-y[t-SeasonLength])
+	}
+	points := make([]float64, horizon)
+	n := len(y)
+	for h := range points {
+		// Step back whole seasons until we land inside the history
+		i := n + h - SeasonLength
+		for i >= n {
+			i -= SeasonLength
+		}
+		points[h] = y[i]
+	}
+	return points, rms(residuals)
+}
+
+// holt is double exponential smoothing with a damped trend, with alpha and beta
+// chosen by grid search on one-step errors.
+func holt(y []float64, horizon int) ([]float64, float64) {
+	bestSSE := math.Inf(1)
+	var bestLevel, bestTrend float64
+	var bestResiduals []float64
+
+	for _, alpha := range smoothingGrid {
+		for _, beta := range smoothingGrid {
+			level, trend := y[0], y[1]-y[0]
+			residuals := make([]float64, 0, len(y)-1)
+			sse := 0.0
+			for t := 1; t < len(y); t++ {
+				predicted := level + dampingFactor*trend
+				e := y[t] - predicted
+				residuals = append(residuals, e)
+				sse += e * e
+
+				prevLevel := level
+				level = alpha*y[t] + (1-alpha)*predicted
+				trend = beta*(level-prevLevel) + (1-beta)*dampingFactor*trend
+			}
+			if sse < bestSSE {
+				bestSSE, bestLevel, bestTrend, bestResiduals = sse, level, trend, residuals
+			}
+		}
+	}
+
+	points := make([]float64, horizon)
+	damp := 0.0
+	for h := range points {
+		damp += math.Pow(dampingFactor, float64(h+1))
+		points[h] = bestLevel + damp*bestTrend
+	}
+	return points, rms(bestResiduals)
+}
+
+// holtWinters is additive triple exponential smoothing with a yearly season.
+func holtWinters(y []float64, horizon int) ([]float64, float64) {
+	m := SeasonLength
+
+	// Initial level and trend from the first two seasons, seasonal indices from the first
+	first, second := mean(y[:m]), mean(y[m:2*m])
+	initTrend := (second - first) / float64(m)
+	initSeason := make([]float64, m)
+	for i := 0; i < m; i++ {
+		initSeason[i] = y[i] - first
+	}
+
+	bestSSE := math.Inf(1)
+	var bestLevel, bestTrend float64
+	var bestSeason, bestResiduals []float64
+
+	for _, alpha := range smoothingGrid {
+		for _, beta := range smoothingGrid[:3] {
+			for _, gamma := range smoothingGrid[:4] {
+				level, trend := first, initTrend
+				season := append([]float64(nil), initSeason...)
+				residuals := make([]float64, 0, len(y)-m)
+				sse := 0.0
+				for t := m; t < len(y); t++ {
+					s := season[t%m]
+					predicted := level + trend + s
+					e := y[t] - predicted
+					residuals = append(residuals, e)
+					sse += e * e
+
+					prevLevel := level
+					level = alpha*(y[t]-s) + (1-alpha)*(level+trend)
+					trend = beta*(level-prevLevel) + (1-beta)*trend
+					season[t%m] = gamma*(y[t]-level) + (1-gamma)*s
+				}
+				if sse < bestSSE {
+					bestSSE, bestLevel, bestTrend, bestSeason, bestResiduals = sse, level, trend, season, residuals
+				}
+			}
+		}
+	}
+
+	n := len(y)
+	points := make([]float64, horizon)
+	for h := range points {
+		points[h] = bestLevel + float64(h+1)*bestTrend + bestSeason[(n+h)%m]
+	}
+	return points, rms(bestResiduals)
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// rms is the root mean square of the residuals, i.e. their standard deviation around zero.
+func rms(residuals []float64) float64 {
+	if len(residuals) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, e := range residuals {
+		sum += e * e
+	}
+	return math.Sqrt(sum / float64(len(residuals)))
+}
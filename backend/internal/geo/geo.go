@@ -0,0 +1,45 @@
+package geo
+
+import "math"
+
+// EarthRadiusKm is the mean radius of the Earth.
+const EarthRadiusKm = 6371.0
+
+// HaversineKm returns the great-circle distance in kilometres between two points
+// given in decimal degrees.
+func HaversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	dLat := radians(lat2 - lat1)
+	dLng := radians(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Box is a latitude/longitude rectangle in decimal degrees.
+type Box struct {
+	MinLat, MaxLat float64
+	MinLng, MaxLng float64
+}
+
+// BoundingBox returns a box containing every point within radiusKm of (lat, lng), for
+// cheap prefiltering before an exact distance check. When the circle reaches a pole
+// or crosses the antimeridian the box spans all longitudes.
+func BoundingBox(lat, lng, radiusKm float64) Box {
+	dLat := degrees(radiusKm / EarthRadiusKm)
+	box := Box{MinLat: math.Max(lat-dLat, -90), MaxLat: math.Min(lat+dLat, 90), MinLng: -180, MaxLng: 180}
+	if box.MinLat > -90 && box.MaxLat < 90 {
+		dLng := degrees(math.Asin(math.Min(1, math.Sin(radiusKm/EarthRadiusKm)/math.Cos(radians(lat)))))
+		if lng-dLng >= -180 && lng+dLng <= 180 {
+			box.MinLng, box.MaxLng = lng-dLng, lng+dLng
+		}
+	}
+	return box
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
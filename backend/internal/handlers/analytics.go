@@ -39,7 +39,7 @@ func (h *Handler) GetPlatformAnalytics(c *gin.Context) {
 	// Active listings (within last 30 days)
 	err = h.DB.QueryRow(c.Request.Context(), `
 		SELECT COUNT(*) FROM marketplace_listings 
-		WHERE is_active = TRUE AND created_at >= NOW() - INTERVAL '30 days'
+		WHERE is_active = TRUE AND status = 'active' AND created_at >= NOW() - INTERVAL '30 days'
 	`).Scan(&stats.ActiveListings)
 	if err != nil {
 		log.Printf("Error fetching active listings: %v", err)
@@ -64,20 +64,20 @@ func (h *Handler) GetPlatformAnalytics(c *gin.Context) {
 		log.Printf("Error fetching price reports: %v", err)
 	}
 
-	// Average price change (last 7 days vs previous 7 days)
+	// Average price change (last 7 days vs previous 7 days), compared in USD so mixed currencies don't skew it
 	var avgChange *float64
 	err = h.DB.QueryRow(c.Request.Context(), `
 		WITH recent_avg AS (
-			SELECT AVG(price_per_kg) as avg_price
+			SELECT AVG(price_per_kg * fx_rate(currency, 'USD', submitted_at::date)) as avg_price
 			FROM market_prices
-			WHERE submitted_at >= NOW() - INTERVAL '7 days' AND is_active = TRUE
+			WHERE submitted_at >= NOW() - INTERVAL '7 days' AND is_active = TRUE AND status = 'published'
 		),
 		previous_avg AS (
-			SELECT AVG(price_per_kg) as avg_price
+			SELECT AVG(price_per_kg * fx_rate(currency, 'USD', submitted_at::date)) as avg_price
 			FROM market_prices
 			WHERE submitted_at >= NOW() - INTERVAL '14 days' 
 			  AND submitted_at < NOW() - INTERVAL '7 days'
-			  AND is_active = TRUE
+			  AND is_active = TRUE AND status = 'published'
 		)
 		SELECT ((recent_avg.avg_price - previous_avg.avg_price) / previous_avg.avg_price * 100)
 		FROM recent_avg, previous_avg
@@ -96,7 +96,7 @@ func (h *Handler) GetPlatformAnalytics(c *gin.Context) {
 		       COUNT(DISTINCT m.farmer_id) as farmer_count
 		FROM marketplace_listings m
 		JOIN users u ON m.farmer_id = u.id
-		WHERE m.is_active = TRUE
+		WHERE m.is_active = TRUE AND m.status = 'active'
 		GROUP BY u.region
 		ORDER BY listing_count DESC
 		LIMIT 10
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"farmlite/internal/currency"
+	"farmlite/internal/pricing"
+	"farmlite/internal/regions"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetArbitrage ranks wholesale-to-retail margins and price gaps between regions.
+// GET /api/analytics/arbitrage?crop=&days=30&transport_cost_per_km=&min_samples=3&limit=20&currency=
+// transport_cost_per_km is the cost of moving one tonne one km, in the response currency.
+func (h *Handler) GetArbitrage(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	target, err := h.resolveCurrency(c, currency.UZS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	days := 30
+	if v := c.Query("days"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil || days < 1 || days > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+			return
+		}
+	}
+	minSamples := 3
+	if v := c.Query("min_samples"); v != "" {
+		if minSamples, err = strconv.Atoi(v); err != nil || minSamples < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_samples must be a positive integer"})
+			return
+		}
+	}
+	limit := 20
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+	}
+
+	var costPerTonneKm float64
+	if v := c.Query("transport_cost_per_km"); v != "" {
+		if costPerTonneKm, err = strconv.ParseFloat(v, 64); err != nil || costPerTonneKm < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "transport_cost_per_km must be a non-negative number"})
+			return
+		}
+	} else {
+		converted, ok := h.loadRates(ctx).Convert(pricing.DefaultTransportCostPerTonneKm, currency.USD, target)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No exchange rate available for " + target})
+			return
+		}
+		costPerTonneKm = converted
+	}
+
+	// Reports may use alias spellings of a region; they're pooled under the canonical name
+	spellings, canonical := regions.Spellings()
+	rows, err := h.DB.Query(ctx, `
+		SELECT c.name, r.region, p.volume_tier,
+		       PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY x.price),
+		       COUNT(*)
+		FROM market_prices p
+		JOIN crop_types c ON p.crop_type_id = c.id
+		JOIN unnest($5::text[], $6::text[]) AS r(spelling, region) ON r.spelling = LOWER(TRIM(p.region))
+		CROSS JOIN LATERAL (SELECT p.price_per_kg * fx_rate(p.currency, $1, p.submitted_at::date) AS price) x
+		WHERE p.is_active = TRUE AND p.status = 'published'
+		  AND p.submitted_at >= NOW() - make_interval(days => $2)
+		  AND ($3 = '' OR LOWER(c.name) = LOWER($3))
+		  AND x.price IS NOT NULL
+		GROUP BY c.name, r.region, p.volume_tier
+		HAVING COUNT(*) >= $4
+	`, target, days, strings.TrimSpace(c.Query("crop")), minSamples, spellings, canonical)
+	if err != nil {
+		log.Printf("GetArbitrage: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load regional prices"})
+		return
+	}
+	defer rows.Close()
+
+	prices := []pricing.RegionalPrice{}
+	for rows.Next() {
+		var p pricing.RegionalPrice
+		if err := rows.Scan(&p.Crop, &p.Region, &p.Tier, &p.Median, &p.Samples); err != nil {
+			log.Printf("GetArbitrage: Scan error: %v\n", err)
+			continue
+		}
+		prices = append(prices, p)
+	}
+
+	spreads := pricing.Spreads(prices)
+	gaps := pricing.RegionGaps(prices, costPerTonneKm/1000)
+	if len(spreads) > limit {
+		spreads = spreads[:limit]
+	}
+	if len(gaps) > limit {
+		gaps = gaps[:limit]
+	}
+	if spreads == nil {
+		spreads = []pricing.CropSpread{}
+	}
+	if gaps == nil {
+		gaps = []pricing.RegionGap{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency":              target,
+		"days":                  days,
+		"transport_cost_per_km": costPerTonneKm,
+		"spreads":               spreads,
+		"region_gaps":           gaps,
+	})
+}
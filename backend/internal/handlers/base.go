@@ -1,15 +1,35 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Handler struct {
 	DB *pgxpool.Pool
+
+	latestPrices *responseCache
+	messages     *messageHub
 }
 
 func NewHandler(db *pgxpool.Pool) *Handler {
 	return &Handler{
-		DB: db,
+		DB:           db,
+		latestPrices: newResponseCache(latestPricesTTL),
+		messages:     newMessageHub(),
 	}
 }
+
+// execer runs a statement on either the pool or a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// isUniqueViolation reports whether err is Postgres rejecting a duplicate key.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
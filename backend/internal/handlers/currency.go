@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"farmlite/internal/currency"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resolveCurrency picks the currency a response should be expressed in:
+// the explicit ?currency= param, then the caller's saved preference (?user_id=), then def.
+func (h *Handler) resolveCurrency(c *gin.Context, def string) (string, error) {
+	if code := c.Query("currency"); code != "" {
+		return currency.Normalize(code, def)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		return h.preferredCurrency(c.Request.Context(), userID, def)
+	}
+	return def, nil
+}
+
+// preferredCurrency is the user's saved currency, or def when they have none.
+func (h *Handler) preferredCurrency(ctx context.Context, userID interface{}, def string) (string, error) {
+	var preferred *string
+	err := h.DB.QueryRow(ctx, "SELECT preferred_currency FROM users WHERE id = $1", userID).Scan(&preferred)
+	if err == nil && preferred != nil && *preferred != "" {
+		return currency.Normalize(*preferred, def)
+	}
+	return def, nil
+}
+
+// loadRates returns the latest exchange rate for every currency.
+func (h *Handler) loadRates(ctx context.Context) currency.Rates {
+	rates := currency.Rates{}
+	rows, err := h.DB.Query(ctx, `
+		SELECT DISTINCT ON (currency) currency, units_per_usd
+		FROM exchange_rates
+		WHERE effective_date <= CURRENT_DATE
+		ORDER BY currency, effective_date DESC
+	`)
+	if err != nil {
+		log.Printf("loadRates: Query error: %v", err)
+		return rates
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		var units float64
+		if err := rows.Scan(&code, &units); err != nil {
+			continue
+		}
+		rates[code] = units
+	}
+	return rates
+}
+
+// StoreExchangeRates upserts rates in a single transaction.
+func (h *Handler) StoreExchangeRates(ctx context.Context, rates []currency.Rate) error {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, r := range rates {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO exchange_rates (currency, units_per_usd, effective_date, source)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (currency, effective_date)
+			DO UPDATE SET units_per_usd = EXCLUDED.units_per_usd, source = EXCLUDED.source
+		`, r.Currency, r.UnitsPerUSD, r.EffectiveDate, r.Source)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (h *Handler) GetExchangeRates(c *gin.Context) {
+	rows, err := h.DB.Query(c.Request.Context(), `
+		SELECT DISTINCT ON (currency) currency, units_per_usd, effective_date, COALESCE(source, '')
+		FROM exchange_rates
+		WHERE effective_date <= CURRENT_DATE
+		ORDER BY currency, effective_date DESC
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+		return
+	}
+	defer rows.Close()
+
+	rates := []currency.Rate{}
+	for rows.Next() {
+		var r currency.Rate
+		if err := rows.Scan(&r.Currency, &r.UnitsPerUSD, &r.EffectiveDate, &r.Source); err != nil {
+			continue
+		}
+		rates = append(rates, r)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"base": currency.USD, "rates": rates})
+}
+
+// UpdateExchangeRates lets an admin load rates, either as JSON
+// {"user_id": 1, "rates": [{"currency": "UZS", "units_per_usd": 12650, "effective_date": "2026-03-01"}]}
+// or as a CSV body (Content-Type: text/csv) with ?user_id=.
+func (h *Handler) UpdateExchangeRates(c *gin.Context) {
+	var userID int
+	var rates []currency.Rate
+
+	if strings.HasPrefix(c.ContentType(), "text/csv") {
+		parsed, err := currency.ParseRatesCSV(c.Request.Body, "admin")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV: " + err.Error()})
+			return
+		}
+		rates = parsed
+		userID, _ = strconv.Atoi(c.Query("user_id"))
+	} else {
+		var req struct {
+			UserID int `json:"user_id" binding:"required"`
+			Rates  []struct {
+				Currency      string  `json:"currency" binding:"required"`
+				UnitsPerUSD   float64 `json:"units_per_usd" binding:"required"`
+				EffectiveDate string  `json:"effective_date"`
+			} `json:"rates" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+			return
+		}
+		userID = req.UserID
+
+		for _, r := range req.Rates {
+			code, err := currency.Normalize(r.Currency, "")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if r.UnitsPerUSD <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "units_per_usd must be positive"})
+				return
+			}
+			date := time.Now().Truncate(24 * time.Hour)
+			if r.EffectiveDate != "" {
+				date, err = time.Parse("2006-01-02", r.EffectiveDate)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "effective_date must be YYYY-MM-DD"})
+					return
+				}
+			}
+			rates = append(rates, currency.Rate{Currency: code, UnitsPerUSD: r.UnitsPerUSD, EffectiveDate: date, Source: "admin"})
+		}
+	}
+
+	if !h.userHasRole(c.Request.Context(), userID, "admin") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can update exchange rates"})
+		return
+	}
+	if len(rates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No rates provided"})
+		return
+	}
+
+	if err := h.StoreExchangeRates(c.Request.Context(), rates); err != nil {
+		log.Printf("UpdateExchangeRates: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store exchange rates"})
+		return
+	}
+	// Price summaries are converted at the stored rates, so they're recomputed now
+	// rather than at the next scheduled refresh
+	if err := h.RefreshPriceSummaries(c.Request.Context()); err != nil {
+		log.Printf("UpdateExchangeRates: Price summary refresh error: %v", err)
+		h.InvalidatePriceCache()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rates updated", "count": len(rates)})
+}
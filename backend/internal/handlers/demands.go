@@ -0,0 +1,826 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"farmlite/internal/currency"
+	"farmlite/internal/demand"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrDemandClosed means the demand request is filled, expired or withdrawn.
+	ErrDemandClosed = errors.New("demand request is no longer open")
+	// ErrDemandOverfilled means a fill is larger than what the request still needs.
+	ErrDemandOverfilled = errors.New("more than the request still needs")
+)
+
+type DemandResponse struct {
+	ID          int        `json:"id"`
+	DemandID    int        `json:"demand_id"`
+	CropName    string     `json:"crop_name"`
+	FarmerID    int        `json:"farmer_id"`
+	FarmerName  string     `json:"farmer_name"`
+	ListingID   *int       `json:"listing_id,omitempty"` // the listing the farmer would sell from
+	QuantityKG  float64    `json:"quantity_kg"`
+	PricePerKG  float64    `json:"price_per_kg"`
+	Currency    string     `json:"currency"`
+	Message     string     `json:"message,omitempty"`
+	Status      string     `json:"status"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Actions     []string   `json:"actions,omitempty"` // answers open to the caller
+}
+
+type DemandFulfilment struct {
+	ID         int       `json:"id"`
+	ResponseID *int      `json:"response_id,omitempty"` // nil when the buyer sourced it elsewhere
+	FarmerID   *int      `json:"farmer_id,omitempty"`
+	FarmerName string    `json:"farmer_name,omitempty"`
+	QuantityKG float64   `json:"quantity_kg"`
+	Note       string    `json:"note,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DemandDetail is one demand request with the responses and fills the caller may see.
+type DemandDetail struct {
+	DemandRequest
+	Responses   []DemandResponse   `json:"responses"`
+	Fulfilments []DemandFulfilment `json:"fulfilments,omitempty"` // buyer only
+}
+
+// UpdateDemandRequest edits a demand request. Omitted fields are left as they are; an
+// empty needed_by clears it.
+type UpdateDemandRequest struct {
+	BuyerID       int      `json:"buyer_id" binding:"required"`
+	QuantityKG    *float64 `json:"quantity_kg"`
+	MaxPricePerKG *float64 `json:"max_price_per_kg"` // 0 for no limit
+	Currency      *string  `json:"currency"`
+	NeededBy      *string  `json:"needed_by"` // YYYY-MM-DD
+	Region        *string  `json:"region"`
+	Description   *string  `json:"description"`
+}
+
+type RespondToDemandRequest struct {
+	FarmerID   int     `json:"farmer_id" binding:"required"`
+	QuantityKG float64 `json:"quantity_kg" binding:"required"`
+	PricePerKG float64 `json:"price_per_kg" binding:"required"`
+	Currency   string  `json:"currency"`   // defaults to the listing's, or the request's
+	ListingID  *int    `json:"listing_id"` // optional listing of the same crop
+	Message    string  `json:"message"`
+}
+
+type AnswerDemandResponseRequest struct {
+	UserID     int     `json:"user_id" binding:"required"`
+	Action     string  `json:"action" binding:"required"` // accept, decline or withdraw
+	QuantityKG float64 `json:"quantity_kg"`               // accept only: take less than offered
+	Note       string  `json:"note"`
+}
+
+type RecordFulfilmentRequest struct {
+	BuyerID    int     `json:"buyer_id" binding:"required"`
+	QuantityKG float64 `json:"quantity_kg" binding:"required"`
+	Note       string  `json:"note"`
+}
+
+// demandState is the part of a demand request its mutations check and change.
+type demandState struct {
+	ID, BuyerID, CropTypeID int
+	Crop                    string
+	QuantityKG, FulfilledKG float64
+	Currency, Status        string
+	NeededBy                *time.Time
+}
+
+func (d demandState) remaining() float64 {
+	return demand.Remaining(d.QuantityKG, d.FulfilledKG)
+}
+
+// lockDemand loads a demand request that hasn't been deleted and locks it for the
+// rest of tx.
+func lockDemand(ctx context.Context, tx pgx.Tx, demandID int) (demandState, error) {
+	d := demandState{ID: demandID}
+	err := tx.QueryRow(ctx, `
+		SELECT d.buyer_id, d.crop_type_id, c.name, d.quantity_kg, d.fulfilled_kg, d.currency, d.status, d.needed_by
+		FROM demand_requests d
+		JOIN crop_types c ON c.id = d.crop_type_id
+		WHERE d.id = $1 AND d.is_active = TRUE
+		FOR UPDATE OF d
+	`, demandID).Scan(&d.BuyerID, &d.CropTypeID, &d.Crop, &d.QuantityKG, &d.FulfilledKG, &d.Currency, &d.Status, &d.NeededBy)
+	return d, err
+}
+
+// GetDemandRequest returns a demand request with its responses: all of them for the
+// buyer, a farmer's own for that farmer. Only the buyer sees the fill history.
+// GET /api/demands/:id?user_id=
+func (h *Handler) GetDemandRequest(c *gin.Context) {
+	demandID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid demand request id"})
+		return
+	}
+	userID, _ := strconv.Atoi(c.Query("user_id"))
+	ctx := c.Request.Context()
+
+	var detail DemandDetail
+	d := &detail.DemandRequest
+	var neededBy *time.Time
+	var created time.Time
+	err = h.DB.QueryRow(ctx, `
+		SELECT d.id, d.buyer_id, u.full_name, d.crop_type_id, c.name,
+		       d.quantity_kg, COALESCE(d.max_price_per_kg, 0), d.currency, d.needed_by, d.region, d.description, d.created_at,
+		       d.status, d.fulfilled_kg, COALESCE(t.badges, '{}')
+		FROM demand_requests d
+		JOIN users u ON d.buyer_id = u.id
+		LEFT JOIN user_trust t ON t.user_id = d.buyer_id
+		JOIN crop_types c ON d.crop_type_id = c.id
+		WHERE d.id = $1 AND d.is_active = TRUE
+	`, demandID).Scan(&d.ID, &d.BuyerID, &d.BuyerName, &d.CropTypeID, &d.CropName,
+		&d.QuantityKG, &d.MaxPricePerKG, &d.Currency, &neededBy, &d.Region, &d.Description, &created,
+		&d.Status, &d.FulfilledKG, &d.BuyerBadges)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Demand request not found"})
+		return
+	} else if err != nil {
+		log.Printf("GetDemandRequest: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch demand request"})
+		return
+	}
+	if neededBy != nil {
+		d.NeededBy = neededBy.Format("2006-01-02")
+	}
+	d.CreatedAt = created.Format("2006-01-02 15:04")
+	d.RemainingKG = demand.Remaining(d.QuantityKG, d.FulfilledKG)
+
+	isBuyer := userID != 0 && userID == d.BuyerID
+	detail.Responses = []DemandResponse{}
+	if userID != 0 {
+		query := demandResponseSelect + " WHERE r.demand_id = $1"
+		args := []interface{}{demandID}
+		if !isBuyer {
+			query += " AND r.farmer_id = $2"
+			args = append(args, userID)
+		}
+		rows, err := h.DB.Query(ctx, query+" ORDER BY r.created_at DESC", args...)
+		if err != nil {
+			log.Printf("GetDemandRequest: Responses error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch responses"})
+			return
+		}
+		for rows.Next() {
+			r, err := scanDemandResponse(rows)
+			if err != nil {
+				continue
+			}
+			r.Actions = r.actions(userID, d.BuyerID, d.Status)
+			detail.Responses = append(detail.Responses, r)
+		}
+		rows.Close()
+	}
+
+	if isBuyer {
+		rows, err := h.DB.Query(ctx, `
+			SELECT f.id, f.response_id, f.farmer_id, COALESCE(u.full_name, ''), f.quantity_kg, COALESCE(f.note, ''), f.created_at
+			FROM demand_fulfilments f
+			LEFT JOIN users u ON u.id = f.farmer_id
+			WHERE f.demand_id = $1
+			ORDER BY f.created_at
+		`, demandID)
+		if err != nil {
+			log.Printf("GetDemandRequest: Fulfilments error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch fulfilments"})
+			return
+		}
+		for rows.Next() {
+			var f DemandFulfilment
+			if err := rows.Scan(&f.ID, &f.ResponseID, &f.FarmerID, &f.FarmerName, &f.QuantityKG, &f.Note, &f.CreatedAt); err != nil {
+				continue
+			}
+			detail.Fulfilments = append(detail.Fulfilments, f)
+		}
+		rows.Close()
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// UpdateDemandRequest lets the buyer edit a demand request. The quantity can't drop
+// below what is already filled. An edit that leaves nothing to fill closes the request;
+// a filled or expired request opens again when more is needed or needed_by moves on.
+// PUT /api/demands/:id
+func (h *Handler) UpdateDemandRequest(c *gin.Context) {
+	demandID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid demand request id"})
+		return
+	}
+	var req UpdateDemandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update demand request"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	d, err := lockDemand(ctx, tx, demandID)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Demand request not found"})
+		return
+	} else if err != nil {
+		log.Printf("UpdateDemandRequest: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update demand request"})
+		return
+	}
+	if d.BuyerID != req.BuyerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own requests"})
+		return
+	}
+	if d.Status == demand.Closed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Withdrawn requests can't be edited"})
+		return
+	}
+
+	set := []string{}
+	args := []interface{}{demandID}
+	assign := func(column string, value interface{}) {
+		args = append(args, value)
+		set = append(set, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if req.QuantityKG != nil {
+		if *req.QuantityKG <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quantity_kg must be positive"})
+			return
+		}
+		if *req.QuantityKG < d.FulfilledKG {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s kg is already filled", formatAmount(d.FulfilledKG))})
+			return
+		}
+		d.QuantityKG = *req.QuantityKG
+		assign("quantity_kg", d.QuantityKG)
+	}
+	if req.MaxPricePerKG != nil {
+		if *req.MaxPricePerKG < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_price_per_kg can't be negative"})
+			return
+		}
+		assign("max_price_per_kg", *req.MaxPricePerKG)
+	}
+	if req.Currency != nil {
+		code, err := currency.Normalize(*req.Currency, d.Currency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		assign("currency", code)
+	}
+	if req.NeededBy != nil {
+		d.NeededBy = nil
+		if *req.NeededBy != "" {
+			t, err := time.Parse("2006-01-02", *req.NeededBy)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "needed_by must be YYYY-MM-DD"})
+				return
+			}
+			d.NeededBy = &t
+		}
+		assign("needed_by", d.NeededBy)
+	}
+	if req.Region != nil {
+		assign("region", strings.TrimSpace(*req.Region))
+	}
+	if req.Description != nil {
+		assign("description", strings.TrimSpace(*req.Description))
+	}
+	if len(set) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	status := demand.Status(d.QuantityKG, d.FulfilledKG, d.NeededBy, time.Now())
+	if status != d.Status {
+		assign("status", status)
+		if status == demand.Open {
+			set = append(set, "closed_at = NULL")
+		} else {
+			set = append(set, "closed_at = NOW()")
+		}
+	}
+	set = append(set, "updated_at = NOW()")
+
+	if _, err := tx.Exec(ctx, "UPDATE demand_requests SET "+strings.Join(set, ", ")+" WHERE id = $1", args...); err != nil {
+		log.Printf("UpdateDemandRequest: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update demand request"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update demand request"})
+		return
+	}
+
+	if status != demand.Open {
+		h.lapseDemandResponses(ctx, demandID)
+	}
+	h.matchDemand(ctx, demandID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Demand request updated",
+		"demand_id":    demandID,
+		"status":       status,
+		"fulfilled_kg": d.FulfilledKG,
+		"remaining_kg": d.remaining(),
+	})
+}
+
+// RespondToDemand lets a farmer offer to fill some or all of an open demand request,
+// optionally from one of their listings. A farmer has one pending response per request.
+// POST /api/demands/:id/responses
+func (h *Handler) RespondToDemand(c *gin.Context) {
+	demandID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid demand request id"})
+		return
+	}
+	var req RespondToDemandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	if req.PricePerKG <= 0 || req.QuantityKG <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price_per_kg and quantity_kg must be positive"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to respond"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	d, err := lockDemand(ctx, tx, demandID)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Demand request not found"})
+		return
+	} else if err != nil {
+		log.Printf("RespondToDemand: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to respond"})
+		return
+	}
+	if d.BuyerID == req.FarmerID {
+		c.JSON(http.StatusConflict, gin.H{"error": "You can't respond to your own request"})
+		return
+	}
+	if d.Status != demand.Open || demand.Status(d.QuantityKG, d.FulfilledKG, d.NeededBy, time.Now()) != demand.Open {
+		c.JSON(http.StatusConflict, gin.H{"error": "This request is no longer open"})
+		return
+	}
+	if req.QuantityKG > d.remaining() {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("The request only needs %s kg more", formatAmount(d.remaining()))})
+		return
+	}
+
+	responseCurrency := d.Currency
+	if req.ListingID != nil {
+		var farmerID, cropTypeID int
+		err := tx.QueryRow(ctx, `
+			SELECT farmer_id, crop_type_id, currency FROM marketplace_listings WHERE id = $1 AND is_active = TRUE
+		`, *req.ListingID).Scan(&farmerID, &cropTypeID, &responseCurrency)
+		if err == pgx.ErrNoRows || (err == nil && farmerID != req.FarmerID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "listing_id must be one of your listings"})
+			return
+		} else if err != nil {
+			log.Printf("RespondToDemand: Listing error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to respond"})
+			return
+		}
+		if cropTypeID != d.CropTypeID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The listing is for a different crop"})
+			return
+		}
+	}
+	responseCurrency, err = currency.Normalize(req.Currency, responseCurrency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var pendingID int
+	err = tx.QueryRow(ctx, "SELECT id FROM demand_responses WHERE demand_id = $1 AND farmer_id = $2 AND status = 'pending'", demandID, req.FarmerID).Scan(&pendingID)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a pending response to this request; withdraw it first", "response_id": pendingID})
+		return
+	} else if err != pgx.ErrNoRows {
+		log.Printf("RespondToDemand: Pending check error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to respond"})
+		return
+	}
+
+	var responseID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO demand_responses (demand_id, farmer_id, listing_id, quantity_kg, price_per_kg, currency, message)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		RETURNING id
+	`, demandID, req.FarmerID, req.ListingID, req.QuantityKG, req.PricePerKG, responseCurrency, strings.TrimSpace(req.Message)).Scan(&responseID)
+	if err != nil {
+		log.Printf("RespondToDemand: Insert error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to respond"})
+		return
+	}
+	r, err := scanDemandResponse(tx.QueryRow(ctx, demandResponseSelect+" WHERE r.id = $1", responseID))
+	if err != nil {
+		log.Printf("RespondToDemand: Reload error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to respond"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to respond"})
+		return
+	}
+
+	h.notifyDemandResponse(ctx, r, d.BuyerID, r.FarmerName+" can supply "+d.Crop)
+	r.Actions = r.actions(req.FarmerID, d.BuyerID, d.Status)
+	c.JSON(http.StatusCreated, r)
+}
+
+// AnswerDemandResponse accepts or declines a farmer's response (buyer), or withdraws
+// it (farmer). Accepting fills the request by the response's quantity, or by less
+// when quantity_kg is given; a request with nothing left to fill closes.
+// POST /api/demands/:id/responses/:response_id
+func (h *Handler) AnswerDemandResponse(c *gin.Context) {
+	demandID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid demand request id"})
+		return
+	}
+	responseID, err := strconv.Atoi(c.Param("response_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid response id"})
+		return
+	}
+	var req AnswerDemandResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	if !demand.ValidAnswer(req.Action) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action must be accept, decline or withdraw"})
+		return
+	}
+	if req.QuantityKG < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity_kg can't be negative"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to answer response"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	d, err := lockDemand(ctx, tx, demandID)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Demand request not found"})
+		return
+	} else if err != nil {
+		log.Printf("AnswerDemandResponse: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to answer response"})
+		return
+	}
+	r, err := scanDemandResponse(tx.QueryRow(ctx, demandResponseSelect+" WHERE r.id = $1 AND r.demand_id = $2 FOR UPDATE OF r", responseID, demandID))
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Response not found"})
+		return
+	} else if err != nil {
+		log.Printf("AnswerDemandResponse: Response error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to answer response"})
+		return
+	}
+
+	if demand.ByFarmer(req.Action) {
+		if req.UserID != r.FarmerID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the farmer who responded can withdraw it"})
+			return
+		}
+	} else if req.UserID != d.BuyerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the buyer can accept or decline responses"})
+		return
+	}
+	if r.Status != demand.Pending {
+		c.JSON(http.StatusConflict, gin.H{"error": "This response has already been answered"})
+		return
+	}
+
+	var filledKG float64
+	switch req.Action {
+	case demand.Accept:
+		r.Status = demand.Accepted
+		filledKG = r.QuantityKG
+		if req.QuantityKG > 0 {
+			if req.QuantityKG > r.QuantityKG {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("The farmer offered %s kg", formatAmount(r.QuantityKG))})
+				return
+			}
+			filledKG = req.QuantityKG
+		}
+		err = fillDemand(ctx, tx, &d, &r.ID, &r.FarmerID, filledKG, req.Note)
+		if errors.Is(err, ErrDemandClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This request is no longer open"})
+			return
+		} else if errors.Is(err, ErrDemandOverfilled) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("The request only needs %s kg more; accept part of the response with quantity_kg", formatAmount(d.remaining()))})
+			return
+		} else if err != nil {
+			log.Printf("AnswerDemandResponse: Fill error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to answer response"})
+			return
+		}
+	case demand.Decline:
+		r.Status = demand.Declined
+	case demand.Withdraw:
+		r.Status = demand.Withdrawn
+	}
+
+	err = tx.QueryRow(ctx, `
+		UPDATE demand_responses SET status = $2, responded_at = NOW() WHERE id = $1 RETURNING responded_at
+	`, r.ID, r.Status).Scan(&r.RespondedAt)
+	if err != nil {
+		log.Printf("AnswerDemandResponse: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to answer response"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to answer response"})
+		return
+	}
+
+	switch r.Status {
+	case demand.Accepted:
+		title := "Your " + d.Crop + " response was accepted"
+		if filledKG < r.QuantityKG {
+			title = fmt.Sprintf("%s kg of your %s response was accepted", formatAmount(filledKG), d.Crop)
+		}
+		h.notifyDemandResponse(ctx, r, r.FarmerID, title)
+	case demand.Declined:
+		h.notifyDemandResponse(ctx, r, r.FarmerID, "Your "+d.Crop+" response was declined")
+	case demand.Withdrawn:
+		h.notifyDemandResponse(ctx, r, d.BuyerID, r.FarmerName+" withdrew their "+d.Crop+" response")
+	}
+	if d.Status != demand.Open {
+		h.lapseDemandResponses(ctx, demandID)
+	}
+	if filledKG > 0 {
+		h.matchDemand(ctx, demandID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"response":     r,
+		"status":       d.Status,
+		"fulfilled_kg": d.FulfilledKG,
+		"remaining_kg": d.remaining(),
+	})
+}
+
+// RecordDemandFulfilment lets the buyer record a quantity sourced outside the
+// request's responses, so farmers only see what is still needed.
+// POST /api/demands/:id/fulfilments
+func (h *Handler) RecordDemandFulfilment(c *gin.Context) {
+	demandID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid demand request id"})
+		return
+	}
+	var req RecordFulfilmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	if req.QuantityKG <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity_kg must be positive"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record fulfilment"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	d, err := lockDemand(ctx, tx, demandID)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Demand request not found"})
+		return
+	} else if err != nil {
+		log.Printf("RecordDemandFulfilment: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record fulfilment"})
+		return
+	}
+	if d.BuyerID != req.BuyerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only fill your own requests"})
+		return
+	}
+
+	err = fillDemand(ctx, tx, &d, nil, nil, req.QuantityKG, req.Note)
+	if errors.Is(err, ErrDemandClosed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This request is no longer open"})
+		return
+	} else if errors.Is(err, ErrDemandOverfilled) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("The request only needs %s kg more", formatAmount(d.remaining()))})
+		return
+	} else if err != nil {
+		log.Printf("RecordDemandFulfilment: Fill error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record fulfilment"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record fulfilment"})
+		return
+	}
+
+	if d.Status != demand.Open {
+		h.lapseDemandResponses(ctx, demandID)
+	}
+	h.matchDemand(ctx, demandID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Fulfilment recorded",
+		"status":       d.Status,
+		"fulfilled_kg": d.FulfilledKG,
+		"remaining_kg": d.remaining(),
+	})
+}
+
+// fillDemand records kg of d as filled and closes d as filled when nothing remains.
+// d is updated in place.
+func fillDemand(ctx context.Context, tx pgx.Tx, d *demandState, responseID, farmerID *int, kg float64, note string) error {
+	kg = math.Round(kg*100) / 100
+	if d.Status != demand.Open || demand.Status(d.QuantityKG, d.FulfilledKG, d.NeededBy, time.Now()) == demand.Expired {
+		return ErrDemandClosed
+	}
+	if kg <= 0 || kg > d.remaining() {
+		return ErrDemandOverfilled
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO demand_fulfilments (demand_id, response_id, farmer_id, quantity_kg, note)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+	`, d.ID, responseID, farmerID, kg, strings.TrimSpace(note))
+	if err != nil {
+		return fmt.Errorf("insert fulfilment: %w", err)
+	}
+
+	d.FulfilledKG += kg
+	d.Status = demand.Status(d.QuantityKG, d.FulfilledKG, d.NeededBy, time.Now())
+	_, err = tx.Exec(ctx, `
+		UPDATE demand_requests
+		SET fulfilled_kg = fulfilled_kg + $2, status = $3,
+		    closed_at = CASE WHEN $3 = 'open' THEN NULL ELSE NOW() END, updated_at = NOW()
+		WHERE id = $1
+	`, d.ID, kg, d.Status)
+	if err != nil {
+		return fmt.Errorf("update demand: %w", err)
+	}
+	return nil
+}
+
+// lapseDemandResponses closes the pending responses of a request that is no longer
+// open and tells their farmers, logging rather than failing the caller.
+func (h *Handler) lapseDemandResponses(ctx context.Context, demandID int) {
+	rows, err := h.DB.Query(ctx, `
+		WITH lapsed AS (
+			UPDATE demand_responses r SET status = 'lapsed', responded_at = NOW()
+			FROM demand_requests d
+			WHERE r.demand_id = $1 AND r.status = 'pending'
+			  AND d.id = r.demand_id AND (d.status <> 'open' OR d.is_active = FALSE)
+			RETURNING r.id
+		)
+		`+demandResponseSelect+` WHERE r.id IN (SELECT id FROM lapsed)`, demandID)
+	if err != nil {
+		log.Printf("Demand response lapse error (demand %d): %v\n", demandID, err)
+		return
+	}
+	var lapsed []DemandResponse
+	for rows.Next() {
+		r, err := scanDemandResponse(rows)
+		if err != nil {
+			continue
+		}
+		lapsed = append(lapsed, r)
+	}
+	rows.Close()
+
+	for _, r := range lapsed {
+		r.Status = demand.Lapsed // the select above still sees the row as it was
+		h.notifyDemandResponse(ctx, r, r.FarmerID, "A "+r.CropName+" request you responded to has closed")
+	}
+}
+
+// ExpireDemandRequests closes open demand requests whose needed_by has passed, tells
+// their buyers and lapses any responses still waiting. Run periodically.
+func (h *Handler) ExpireDemandRequests(ctx context.Context) error {
+	rows, err := h.DB.Query(ctx, `
+		WITH expired AS (
+			UPDATE demand_requests
+			SET status = 'expired', closed_at = NOW(), updated_at = NOW()
+			WHERE is_active = TRUE AND status = 'open' AND needed_by < CURRENT_DATE
+			RETURNING id, buyer_id, crop_type_id, quantity_kg, fulfilled_kg
+		)
+		SELECT e.id, e.buyer_id, c.name, e.quantity_kg, e.fulfilled_kg
+		FROM expired e
+		JOIN crop_types c ON c.id = e.crop_type_id
+	`)
+	if err != nil {
+		return fmt.Errorf("expire demand requests: %w", err)
+	}
+	var expired []demandState
+	for rows.Next() {
+		var d demandState
+		if err := rows.Scan(&d.ID, &d.BuyerID, &d.Crop, &d.QuantityKG, &d.FulfilledKG); err != nil {
+			rows.Close()
+			return err
+		}
+		expired = append(expired, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range expired {
+		body := fmt.Sprintf("Your request for %s kg of %s passed its needed-by date", formatAmount(d.QuantityKG), d.Crop)
+		if d.FulfilledKG > 0 {
+			body += fmt.Sprintf(" with %s kg filled", formatAmount(d.FulfilledKG))
+		}
+		body += ". Edit it with a new date if you still need it."
+		data := gin.H{"demand_id": d.ID, "status": demand.Expired}
+		if _, err := h.notify(ctx, d.BuyerID, "demand_expired", d.Crop+" request closed", body, data, fmt.Sprintf("demand_expired:%d", d.ID)); err != nil {
+			log.Printf("Demand expiry notification error (demand %d): %v\n", d.ID, err)
+		}
+		h.lapseDemandResponses(ctx, d.ID)
+		h.matchDemand(ctx, d.ID)
+	}
+	if len(expired) > 0 {
+		log.Printf("Demand expiry: %d expired\n", len(expired))
+	}
+	return nil
+}
+
+// notifyDemandResponse sends a response update to the buyer or the farmer.
+func (h *Handler) notifyDemandResponse(ctx context.Context, r DemandResponse, recipient int, title string) {
+	body := fmt.Sprintf("%s kg at %s %s/kg", formatAmount(r.QuantityKG), formatAmount(r.PricePerKG), r.Currency)
+	data := gin.H{"demand_id": r.DemandID, "response_id": r.ID, "status": r.Status}
+	key := fmt.Sprintf("demand_response:%d:%s", r.ID, r.Status)
+	if _, err := h.notify(ctx, recipient, "demand_response", title, body, data, key); err != nil {
+		log.Printf("Demand response notification error (response %d): %v\n", r.ID, err)
+	}
+}
+
+// actions returns the answers userID can give to the response.
+func (r DemandResponse) actions(userID, buyerID int, demandStatus string) []string {
+	if r.Status != demand.Pending || demandStatus != demand.Open {
+		return nil
+	}
+	if userID == r.FarmerID {
+		return []string{demand.Withdraw}
+	}
+	if userID == buyerID {
+		return []string{demand.Accept, demand.Decline}
+	}
+	return nil
+}
+
+const demandResponseSelect = `
+	SELECT r.id, r.demand_id, c.name, r.farmer_id, f.full_name, r.listing_id, r.quantity_kg, r.price_per_kg, r.currency,
+	       COALESCE(r.message, ''), r.status, r.responded_at, r.created_at
+	FROM demand_responses r
+	JOIN users f ON f.id = r.farmer_id
+	JOIN demand_requests d ON d.id = r.demand_id
+	JOIN crop_types c ON c.id = d.crop_type_id`
+
+func scanDemandResponse(row pgx.Row) (DemandResponse, error) {
+	var r DemandResponse
+	err := row.Scan(&r.ID, &r.DemandID, &r.CropName, &r.FarmerID, &r.FarmerName, &r.ListingID, &r.QuantityKG, &r.PricePerKG, &r.Currency,
+		&r.Message, &r.Status, &r.RespondedAt, &r.CreatedAt)
+	return r, err
+}
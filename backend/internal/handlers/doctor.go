@@ -9,6 +9,8 @@ import (
 	"os"
 	"strings"
 
+	"farmlite/internal/imaging"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -45,27 +47,27 @@ func (h *Handler) AnalyzeCrop(c *gin.Context) {
 	}
 
 	// 1. Get uploaded file
-	file, _, err := c.Request.FormFile("image")
+	fh, err := c.FormFile("image")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No image uploaded"})
 		return
 	}
-	defer file.Close()
 
 	// 2. Read file bytes
-	fileBytes, err := io.ReadAll(file)
+	fileBytes, err := readUpload(fh)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read image"})
+		uploadError(c, err, "AnalyzeCrop")
 		return
 	}
 
-	// 3. Encode to Base64 and detect MIME type
-	base64Data := base64.StdEncoding.EncodeToString(fileBytes)
-	mimeType := http.DetectContentType(fileBytes)
-	if !strings.HasPrefix(mimeType, "image/") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported file type: " + mimeType})
+	// 3. Re-encode, which checks the type and drops EXIF/GPS before the photo leaves us
+	img, err := imaging.Convert(fileBytes, imaging.Medium)
+	if err != nil {
+		uploadError(c, err, "AnalyzeCrop")
 		return
 	}
+	base64Data := base64.StdEncoding.EncodeToString(img.Data)
+	mimeType := img.ContentType
 
 	// 4. Prepare request to Gemini
 	prompt := `Analyze this crop image. Identify if there is any disease, pest, or deficiency. 
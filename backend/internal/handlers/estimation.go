@@ -1,15 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
+	"farmlite/internal/currency"
 	"farmlite/internal/estimation"
+	"farmlite/internal/regions"
 
 	"github.com/gin-gonic/gin"
 )
 
+// GetEstimation handles /api/estimate.
+// Required: crop, area. Optional: unit (hectare|sotix), region, irrigation (irrigated|drip|rainfed), mode=simulate.
 func (h *Handler) GetEstimation(c *gin.Context) {
 	crop := c.Query("crop")
 	areaStr := c.Query("area")
@@ -20,25 +27,213 @@ func (h *Handler) GetEstimation(c *gin.Context) {
 	}
 
 	area, err := strconv.ParseFloat(areaStr, 64)
-	if err != nil {
+	if err != nil || math.IsNaN(area) || math.IsInf(area, 0) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "area must be a valid number"})
 		return
 	}
+	if area <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "area must be greater than zero"})
+		return
+	}
+
+	hectares, err := estimation.ToHectares(area, c.Query("unit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	irrigation, err := estimation.NormalizeIrrigation(c.Query("irrigation"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	region := ""
+	if r := c.Query("region"); r != "" && r != "All" {
+		canonical, ok := regions.Canonical(r)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown region: " + r})
+			return
+		}
+		region = canonical
+	}
+
+	target, err := h.resolveCurrency(c, currency.USD)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("mode") == "simulate" {
+		h.simulateEstimation(c, target, estimation.SimulationParams{
+			CropName:   crop,
+			Region:     region,
+			Irrigation: irrigation,
+			Hectares:   hectares,
+		})
+		return
+	}
 
 	// Fetch dynamic price from DB if available
+	price, priceSource := h.lookupCropPrice(c.Request.Context(), crop, region)
+
+	res := estimation.GetFieldEstimate(estimation.FieldInput{
+		CropName:    crop,
+		Region:      region,
+		Irrigation:  irrigation,
+		Hectares:    hectares,
+		Price:       price,
+		PriceSource: priceSource,
+	})
+
+	if target != currency.USD {
+		unitsPerUSD, ok := h.loadRates(c.Request.Context()).Convert(1, currency.USD, target)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No exchange rate available for " + target})
+			return
+		}
+		res.InCurrency(target, unitsPerUSD)
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// lookupCropPrice resolves the price used for estimates: recent reports from the
+// region first, then the all-time national average. Prices are returned in USD,
+// converted at the rate in effect when each was reported. A zero price means the
+// estimator should fall back to its reference price.
+func (h *Handler) lookupCropPrice(ctx context.Context, crop, region string) (float64, string) {
 	var avgPrice float64
-	err = h.DB.QueryRow(c.Request.Context(), `
-		SELECT COALESCE(AVG(p.price_per_kg), 0)
+
+	if region != "" {
+		err := h.DB.QueryRow(ctx, `
+			SELECT COALESCE(AVG(p.price_per_kg * fx_rate(p.currency, 'USD', p.submitted_at::date)), 0)
+			FROM market_prices p
+			JOIN crop_types c ON p.crop_type_id = c.id
+			WHERE c.name = $1 AND p.region = $2 AND p.is_active = TRUE AND p.status = 'published'
+			  AND p.submitted_at >= NOW() - INTERVAL '90 days'
+		`, crop, region).Scan(&avgPrice)
+
+		if err != nil {
+			log.Printf("Error fetching regional avg price for %s in %s: %v", crop, region, err)
+		}
+		if avgPrice > 0 {
+			return avgPrice, estimation.PriceSourceRegional
+		}
+	}
+
+	err := h.DB.QueryRow(ctx, `
+		SELECT COALESCE(AVG(p.price_per_kg * fx_rate(p.currency, 'USD', p.submitted_at::date)), 0)
 		FROM market_prices p
 		JOIN crop_types c ON p.crop_type_id = c.id
-		WHERE c.name = $1 AND p.is_active = TRUE
+		WHERE c.name = $1 AND p.is_active = TRUE AND p.status = 'published'
 	`, crop).Scan(&avgPrice)
 
 	if err != nil {
 		// Log but continue with fallback price
 		log.Printf("Error fetching avg price for %s: %v", crop, err)
 	}
+	if avgPrice > 0 {
+		return avgPrice, estimation.PriceSourceNational
+	}
+	return 0, estimation.PriceSourceReference
+}
 
-	res := estimation.GetCropEstimate(crop, area, avgPrice)
-	c.JSON(http.StatusOK, res)
+// lookupPriceVolatility returns the mean and standard deviation (in USD) of the last
+// year of price reports, preferring the region when it has enough samples.
+func (h *Handler) lookupPriceVolatility(ctx context.Context, crop, region string) (mean, stdDev float64, samples int, source string) {
+	query := `
+		SELECT COALESCE(AVG(p.usd), 0), COALESCE(STDDEV_SAMP(p.usd), 0), COUNT(p.usd)
+		FROM (
+			SELECT p.price_per_kg * fx_rate(p.currency, 'USD', p.submitted_at::date) AS usd
+			FROM market_prices p
+			JOIN crop_types c ON p.crop_type_id = c.id
+			WHERE c.name = $1 AND p.is_active = TRUE AND p.status = 'published'
+			  AND p.submitted_at >= NOW() - INTERVAL '365 days'
+			  AND ($2 = '' OR p.region = $2)
+		) p
+	`
+
+	if region != "" {
+		err := h.DB.QueryRow(ctx, query, crop, region).Scan(&mean, &stdDev, &samples)
+		if err != nil {
+			log.Printf("Error fetching regional price volatility for %s in %s: %v", crop, region, err)
+		}
+		if samples >= 3 {
+			return mean, stdDev, samples, estimation.PriceSourceRegional
+		}
+	}
+
+	err := h.DB.QueryRow(ctx, query, crop, "").Scan(&mean, &stdDev, &samples)
+	if err != nil {
+		log.Printf("Error fetching price volatility for %s: %v", crop, err)
+	}
+	if samples == 0 {
+		return 0, 0, 0, estimation.PriceSourceReference
+	}
+	return mean, stdDev, samples, estimation.PriceSourceNational
+}
+
+// simulateEstimation runs the Monte Carlo risk model for /api/estimate?mode=simulate.
+// Optional params: runs, seed, cost_per_ha (USD), buckets.
+func (h *Handler) simulateEstimation(c *gin.Context, target string, params estimation.SimulationParams) {
+	params.CostPerHectare = estimation.DefaultCostPerHectare
+	params.Runs = 5000
+	params.Buckets = 20
+	params.Seed = time.Now().UnixNano()
+
+	if v := c.Query("runs"); v != "" {
+		runs, err := strconv.Atoi(v)
+		if err != nil || runs < 100 || runs > 50000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "runs must be between 100 and 50000"})
+			return
+		}
+		params.Runs = runs
+	}
+	if v := c.Query("seed"); v != "" {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "seed must be an integer"})
+			return
+		}
+		params.Seed = seed
+	}
+	if v := c.Query("cost_per_ha"); v != "" {
+		cost, err := strconv.ParseFloat(v, 64)
+		if err != nil || cost < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cost_per_ha must be a non-negative number"})
+			return
+		}
+		params.CostPerHectare = cost
+	}
+	if v := c.Query("buckets"); v != "" {
+		buckets, err := strconv.Atoi(v)
+		if err != nil || buckets < 2 || buckets > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "buckets must be between 2 and 100"})
+			return
+		}
+		params.Buckets = buckets
+	}
+
+	// Price distribution from the last year of crowdsourced reports
+	mean, stdDev, samples, priceSource := h.lookupPriceVolatility(c.Request.Context(), params.CropName, params.Region)
+	params.PriceMean = mean
+	// Too few reports to trust the spread; let the model use its default volatility
+	if samples >= 3 {
+		params.PriceStdDev = stdDev
+	}
+
+	res := estimation.Simulate(params)
+	if target != currency.USD {
+		unitsPerUSD, ok := h.loadRates(c.Request.Context()).Convert(1, currency.USD, target)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No exchange rate available for " + target})
+			return
+		}
+		res.InCurrency(target, unitsPerUSD)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"simulation":    res,
+		"price_samples": samples,
+		"price_source":  priceSource,
+	})
 }
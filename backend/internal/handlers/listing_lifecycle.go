@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"farmlite/internal/listing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type ListingStatusRequest struct {
+	FarmerID int    `json:"farmer_id" binding:"required"`
+	Status   string `json:"status" binding:"required"`
+}
+
+type RenewListingRequest struct {
+	FarmerID   int      `json:"farmer_id" binding:"required"`
+	QuantityKG *float64 `json:"quantity_kg"` // required when renewing a sold-out listing
+}
+
+// listingState is the lifecycle part of a listing row.
+type listingState struct {
+	FarmerID  int
+	Status    string
+	Quantity  float64
+	Reserved  float64
+	Harvest   *time.Time
+	ExpiresAt *time.Time
+}
+
+// lockListingState loads a listing's lifecycle state and locks the row for the rest
+// of tx, so orders, sales and the expiry job can't change it underneath the caller.
+func lockListingState(ctx context.Context, tx pgx.Tx, listingID int) (listingState, error) {
+	var s listingState
+	err := tx.QueryRow(ctx, `
+		SELECT farmer_id, status, quantity_kg, reserved_kg, harvest_ready_date, expires_at
+		FROM marketplace_listings
+		WHERE id = $1 AND is_active = TRUE
+		FOR UPDATE
+	`, listingID).Scan(&s.FarmerID, &s.Status, &s.Quantity, &s.Reserved, &s.Harvest, &s.ExpiresAt)
+	return s, err
+}
+
+// SetListingStatus moves a listing to another state: publish a draft, pause, resume
+// or mark it sold.
+// POST /api/marketplace/:id/status
+func (h *Handler) SetListingStatus(c *gin.Context) {
+	listingID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing id"})
+		return
+	}
+	var req ListingStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	if !listing.Valid(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of draft, active, paused, sold, expired"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update listing"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	state, err := lockListingState(ctx, tx, listingID)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Listing not found"})
+		return
+	} else if err != nil {
+		log.Printf("SetListingStatus: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load listing"})
+		return
+	}
+	if state.FarmerID != req.FarmerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only change your own listings"})
+		return
+	}
+	if state.Status == req.Status {
+		c.JSON(http.StatusOK, gin.H{"message": "Listing is already " + req.Status, "id": listingID, "status": req.Status})
+		return
+	}
+	if !listing.CanTransition(state.Status, req.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A %s listing cannot be made %s", state.Status, req.Status)})
+		return
+	}
+	// Coming back from sold or expired is a renewal, which sets a new quantity and expiry
+	if state.Status == listing.Sold || state.Status == listing.Expired {
+		c.JSON(http.StatusConflict, gin.H{"error": "Renew the listing to make it active again"})
+		return
+	}
+
+	// Publishing starts the expiry clock; resuming a paused listing keeps it
+	expiresAt := state.ExpiresAt
+	if state.Status == listing.Draft {
+		t := listing.ExpiresAt(state.Harvest, time.Now())
+		expiresAt = &t
+	}
+	if req.Status == listing.Active && expiresAt != nil && !expiresAt.After(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Listing has expired; renew it instead"})
+		return
+	}
+
+	err = changeListingStatus(ctx, tx, listingID, req.FarmerID, state.Status, req.Status, expiresAt)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		log.Printf("SetListingStatus: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update listing"})
+		return
+	}
+	h.matchListing(ctx, listingID)
+	c.JSON(http.StatusOK, gin.H{"message": "Listing is now " + req.Status, "id": listingID, "status": req.Status, "expires_at": expiresAt})
+}
+
+// RenewListing reactivates an expired or sold listing, or extends an active one, with
+// a fresh expiry date.
+// POST /api/marketplace/:id/renew
+func (h *Handler) RenewListing(c *gin.Context) {
+	listingID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing id"})
+		return
+	}
+	var req RenewListingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to renew listing"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	state, err := lockListingState(ctx, tx, listingID)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Listing not found"})
+		return
+	} else if err != nil {
+		log.Printf("RenewListing: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load listing"})
+		return
+	}
+	if state.FarmerID != req.FarmerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only renew your own listings"})
+		return
+	}
+	if state.Status != listing.Active && state.Status != listing.Expired && state.Status != listing.Sold {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A %s listing cannot be renewed", state.Status)})
+		return
+	}
+
+	quantity := state.Quantity
+	if req.QuantityKG != nil {
+		if *req.QuantityKG <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quantity_kg must be positive"})
+			return
+		}
+		quantity = *req.QuantityKG
+	}
+	if quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity_kg is required to renew a sold-out listing"})
+		return
+	}
+	if kgHundredths(quantity) < kgHundredths(state.Reserved) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("quantity_kg can't be below the %s kg reserved by open orders", formatAmount(state.Reserved))})
+		return
+	}
+
+	expiresAt := listing.ExpiresAt(state.Harvest, time.Now())
+	_, err = tx.Exec(ctx, `
+		UPDATE marketplace_listings
+		SET status = 'active', status_changed_at = NOW(), expires_at = $1, expiry_reminded_at = NULL, quantity_kg = $2
+		WHERE id = $3
+	`, expiresAt, quantity, listingID)
+	if err == nil && quantity != state.Quantity {
+		err = insertListingChange(ctx, tx, listingID, req.FarmerID, listingChange("quantity_kg", formatAmount(state.Quantity), formatAmount(quantity)))
+	}
+	if err == nil && state.Status != listing.Active {
+		err = insertListingChange(ctx, tx, listingID, req.FarmerID, listingChange("status", state.Status, listing.Active))
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		log.Printf("RenewListing: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to renew listing"})
+		return
+	}
+
+	h.matchListing(ctx, listingID)
+	c.JSON(http.StatusOK, gin.H{"message": "Listing renewed", "id": listingID, "status": listing.Active, "expires_at": expiresAt, "quantity_kg": quantity})
+}
+
+// changeListingStatus updates a listing locked in tx and logs the change in
+// listing_changes.
+func changeListingStatus(ctx context.Context, tx pgx.Tx, listingID, userID int, from, to string, expiresAt *time.Time) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE marketplace_listings
+		SET status = $1, status_changed_at = NOW(), expires_at = $2
+		WHERE id = $3
+	`, to, expiresAt, listingID)
+	if err != nil {
+		return err
+	}
+	return insertListingChange(ctx, tx, listingID, userID, listingChange("status", from, to))
+}
+
+// sellFromListing takes kg off a listing's quantity when an order completes, marking
+// it sold once nothing is left. It returns the remaining quantity.
+func sellFromListing(ctx context.Context, tx pgx.Tx, listingID int, kg float64) (float64, error) {
+	var remaining float64
+	var status string
+	err := tx.QueryRow(ctx, `
+		UPDATE marketplace_listings
+		SET quantity_kg = GREATEST(quantity_kg - $1, 0),
+		    status = CASE WHEN quantity_kg - $1 <= 0 AND status IN ('active', 'paused') THEN 'sold' ELSE status END,
+		    status_changed_at = CASE WHEN quantity_kg - $1 <= 0 AND status IN ('active', 'paused') THEN NOW() ELSE status_changed_at END
+		WHERE id = $2
+		RETURNING quantity_kg, status
+	`, kg, listingID).Scan(&remaining, &status)
+	return remaining, err
+}
+
+// ExpireListings expires listings past their expiry date and reminds farmers of
+// listings about to expire. Run periodically.
+func (h *Handler) ExpireListings(ctx context.Context) error {
+	rows, err := h.DB.Query(ctx, `
+		WITH expired AS (
+			UPDATE marketplace_listings m
+			SET status = 'expired', status_changed_at = NOW()
+			FROM (
+				SELECT id, status FROM marketplace_listings
+				WHERE is_active = TRUE AND status IN ('active', 'paused') AND expires_at <= NOW()
+				FOR UPDATE
+			) old
+			WHERE m.id = old.id
+			RETURNING m.id, m.farmer_id, m.crop_type_id, old.status
+		)
+		SELECT e.id, e.farmer_id, c.name, e.status
+		FROM expired e
+		JOIN crop_types c ON c.id = e.crop_type_id
+	`)
+	if err != nil {
+		return fmt.Errorf("expire listings: %w", err)
+	}
+	type expiry struct {
+		ID, FarmerID int
+		Crop, Status string
+		ExpiresAt    time.Time
+	}
+	var expired []expiry
+	for rows.Next() {
+		var e expiry
+		if err := rows.Scan(&e.ID, &e.FarmerID, &e.Crop, &e.Status); err != nil {
+			rows.Close()
+			return err
+		}
+		expired = append(expired, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range expired {
+		if err := insertListingChange(ctx, h.DB, e.ID, 0, listingChange("status", e.Status, listing.Expired)); err != nil {
+			log.Printf("Listing expiry log error (listing %d): %v\n", e.ID, err)
+		}
+		body := fmt.Sprintf("Your %s listing is no longer shown to buyers. Renew it if you still have produce to sell.", e.Crop)
+		data := gin.H{"listing_id": e.ID}
+		if _, err := h.notify(ctx, e.FarmerID, "listing_expired", e.Crop+" listing expired", body, data, fmt.Sprintf("listing_expired:%d:%s", e.ID, time.Now().Format("2006-01-02"))); err != nil {
+			log.Printf("Listing expiry notification error (listing %d): %v\n", e.ID, err)
+		}
+	}
+
+	// The reminded flag is set in the same statement, so each expiry date is reminded once
+	rows, err = h.DB.Query(ctx, `
+		WITH due AS (
+			UPDATE marketplace_listings
+			SET expiry_reminded_at = NOW()
+			WHERE is_active = TRUE AND status = 'active' AND expiry_reminded_at IS NULL
+			  AND expires_at > NOW() AND expires_at <= NOW() + make_interval(days => $1)
+			RETURNING id, farmer_id, crop_type_id, expires_at
+		)
+		SELECT d.id, d.farmer_id, c.name, d.expires_at
+		FROM due d
+		JOIN crop_types c ON c.id = d.crop_type_id
+	`, listing.ReminderDays)
+	if err != nil {
+		return fmt.Errorf("find expiring listings: %w", err)
+	}
+	var expiring []expiry
+	for rows.Next() {
+		var e expiry
+		if err := rows.Scan(&e.ID, &e.FarmerID, &e.Crop, &e.ExpiresAt); err != nil {
+			rows.Close()
+			return err
+		}
+		expiring = append(expiring, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range expiring {
+		body := fmt.Sprintf("Your %s listing expires on %s. Renew it to keep it visible to buyers.", e.Crop, e.ExpiresAt.Format("2006-01-02"))
+		data := gin.H{"listing_id": e.ID, "expires_at": e.ExpiresAt}
+		key := fmt.Sprintf("listing_expiry_reminder:%d:%s", e.ID, e.ExpiresAt.Format("2006-01-02"))
+		if _, err := h.notify(ctx, e.FarmerID, "listing_expiring", e.Crop+" listing expires soon", body, data, key); err != nil {
+			log.Printf("Listing reminder notification error (listing %d): %v\n", e.ID, err)
+		}
+	}
+
+	if len(expired) > 0 || len(expiring) > 0 {
+		log.Printf("Listing expiry: %d expired, %d reminded\n", len(expired), len(expiring))
+	}
+	return nil
+}
+
+// listingChange builds a change log entry with its summary.
+func listingChange(field, oldValue, newValue string) ListingChange {
+	change := ListingChange{Field: field}
+	if oldValue != "" {
+		change.OldValue = &oldValue
+	}
+	if newValue != "" {
+		change.NewValue = &newValue
+	}
+	change.Summary = describeListingChange(change, "")
+	return change
+}
@@ -0,0 +1,478 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"farmlite/internal/listing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// How long a price change is shown on the listing itself ("price dropped 10%")
+const priceChangeBadgeDays = 30
+
+// UpdateListingRequest edits a listing. Omitted fields are left as they are; an empty
+// harvest_ready_date or tags clears it. New images are sent as "images" files and a new
+// main photo as "image", like on create.
+type UpdateListingRequest struct {
+	FarmerID         int      `json:"farmer_id" form:"farmer_id" binding:"required"`
+	QuantityKG       *float64 `json:"quantity_kg" form:"quantity_kg"`
+	PricePerKG       *float64 `json:"price_per_kg" form:"price_per_kg"`
+	HarvestReadyDate *string  `json:"harvest_ready_date" form:"harvest_ready_date"` // YYYY-MM-DD
+	Description      *string  `json:"description" form:"description"`
+	Tags             *string  `json:"tags" form:"tags"`                   // Comma-separated
+	RemoveImages     []string `json:"remove_images" form:"remove_images"` // image URLs to drop
+}
+
+type ListingChange struct {
+	Field     string  `json:"field"`
+	OldValue  *string `json:"old_value"`
+	NewValue  *string `json:"new_value"`
+	Summary   string  `json:"summary"`
+	ChangedAt string  `json:"changed_at,omitempty"`
+}
+
+type PricePoint struct {
+	Price     float64  `json:"price"`
+	ChangedAt string   `json:"changed_at"`
+	ChangePct *float64 `json:"change_pct,omitempty"` // against the previous price
+}
+
+// UpdateListing lets the owner edit a listing in place, keeping its views, contacts
+// and watchlist entries. Every changed field is recorded in listing_changes.
+// PUT /api/marketplace/:id
+func (h *Handler) UpdateListing(c *gin.Context) {
+	listingID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing id"})
+		return
+	}
+	var req UpdateListingRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+
+	// Photos are processed before the row is locked so a slow upload doesn't hold it
+	newMain, err := saveListingImage(c)
+	if err != nil {
+		uploadError(c, err, "UpdateListing")
+		return
+	}
+	newImages, err := saveUploads(c, "images", "marketplace")
+	if err != nil {
+		removeImages(newMain)
+		uploadError(c, err, "UpdateListing")
+		return
+	}
+	// Until the edit commits, the new photos belong to nothing
+	committed := false
+	defer func() {
+		if !committed {
+			removeImages(append(newImages, newMain)...)
+		}
+	}()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update listing"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// The row is locked so orders, sales and other edits can't change it between
+	// reading the current values and writing them back
+	var ownerID int
+	var quantity, price, reserved float64
+	var listingCurrency, description, imageURL, status string
+	var harvest, expiresAt *time.Time
+	var tags []string
+	err = tx.QueryRow(ctx, `
+		SELECT farmer_id, quantity_kg, price_per_kg, currency, harvest_ready_date,
+		       COALESCE(description, ''), COALESCE(image_url, ''), COALESCE(tags, '[]'::jsonb),
+		       status, expires_at, reserved_kg
+		FROM marketplace_listings
+		WHERE id = $1 AND is_active = TRUE
+		FOR UPDATE
+	`, listingID).Scan(&ownerID, &quantity, &price, &listingCurrency, &harvest, &description, &imageURL, &tags, &status, &expiresAt, &reserved)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Listing not found"})
+		return
+	} else if err != nil {
+		log.Printf("UpdateListing: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load listing"})
+		return
+	}
+	if ownerID != req.FarmerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own listings"})
+		return
+	}
+
+	var changes []ListingChange
+	record := func(field, oldValue, newValue string) {
+		if oldValue == newValue {
+			return
+		}
+		change := ListingChange{Field: field}
+		if oldValue != "" {
+			change.OldValue = &oldValue
+		}
+		if newValue != "" {
+			change.NewValue = &newValue
+		}
+		change.Summary = describeListingChange(change, listingCurrency)
+		changes = append(changes, change)
+	}
+
+	if req.QuantityKG != nil {
+		if kgHundredths(*req.QuantityKG) <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quantity_kg must be at least 0.01"})
+			return
+		}
+		if kgHundredths(*req.QuantityKG) < kgHundredths(reserved) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s kg is reserved by open orders", formatAmount(reserved))})
+			return
+		}
+		record("quantity_kg", formatAmount(quantity), formatAmount(*req.QuantityKG))
+		quantity = *req.QuantityKG
+	}
+	if req.PricePerKG != nil {
+		if *req.PricePerKG <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "price_per_kg must be positive"})
+			return
+		}
+		record("price_per_kg", formatAmount(price), formatAmount(*req.PricePerKG))
+		price = *req.PricePerKG
+	}
+	if req.HarvestReadyDate != nil {
+		oldDate := ""
+		if harvest != nil {
+			oldDate = harvest.Format("2006-01-02")
+		}
+		harvest = nil
+		if *req.HarvestReadyDate != "" {
+			t, err := time.Parse("2006-01-02", *req.HarvestReadyDate)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "harvest_ready_date must be YYYY-MM-DD"})
+				return
+			}
+			harvest = &t
+		}
+		record("harvest_ready_date", oldDate, *req.HarvestReadyDate)
+
+		// A later harvest keeps a published listing up longer; an earlier one never cuts it short
+		if expiresAt != nil && harvest != nil && (status == listing.Active || status == listing.Paused) {
+			if afterHarvest := harvest.AddDate(0, 0, listing.ExpiryDaysAfterHarvest); afterHarvest.After(*expiresAt) {
+				expiresAt = &afterHarvest
+			}
+		}
+	}
+	if req.Description != nil {
+		record("description", description, strings.TrimSpace(*req.Description))
+		description = strings.TrimSpace(*req.Description)
+	}
+	if req.Tags != nil {
+		newTags := []string{}
+		for _, tag := range strings.Split(*req.Tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				newTags = append(newTags, tag)
+			}
+		}
+		record("tags", strings.Join(tags, ", "), strings.Join(newTags, ", "))
+		tags = newTags
+	}
+	tagsJSON, _ := json.Marshal(tags)
+
+	// Images change outside the row, so they are counted before and after
+	var imagesBefore int
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM listing_images WHERE listing_id = $1", listingID).Scan(&imagesBefore); err != nil {
+		log.Printf("UpdateListing: Image count error: %v\n", err)
+	}
+	if imageURL != "" {
+		imagesBefore++
+	}
+	removed := make(map[string]bool)
+	for _, url := range req.RemoveImages {
+		removed[url] = true
+	}
+	// Files of the photos dropped from the listing, deleted once the edit commits
+	var dropped []string
+	if imageURL != "" && (removed[imageURL] || newMain != "") {
+		dropped = append(dropped, imageURL)
+		imageURL = ""
+	}
+	if newMain != "" {
+		imageURL = newMain
+	}
+
+	// A moved expiry date earns the farmer a fresh reminder before the new one
+	_, err = tx.Exec(ctx, `
+		UPDATE marketplace_listings
+		SET quantity_kg = $1, price_per_kg = $2, harvest_ready_date = $3, description = $4, tags = $5::jsonb, image_url = $6, expires_at = $7,
+		    expiry_reminded_at = CASE WHEN expires_at IS DISTINCT FROM $7 THEN NULL ELSE expiry_reminded_at END
+		WHERE id = $8
+	`, quantity, price, harvest, description, string(tagsJSON), imageURL, expiresAt, listingID)
+	if err != nil {
+		log.Printf("UpdateListing: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update listing"})
+		return
+	}
+	if len(req.RemoveImages) > 0 {
+		// Only URLs that were this listing's images have their files deleted
+		rows, err := tx.Query(ctx, "DELETE FROM listing_images WHERE listing_id = $1 AND image_url = ANY($2) RETURNING image_url", listingID, req.RemoveImages)
+		if err == nil {
+			for rows.Next() {
+				var url string
+				if err = rows.Scan(&url); err != nil {
+					break
+				}
+				dropped = append(dropped, url)
+			}
+			rows.Close()
+			if err == nil {
+				err = rows.Err()
+			}
+		}
+		if err != nil {
+			log.Printf("UpdateListing: Image delete error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update listing"})
+			return
+		}
+	}
+	if err := addListingImages(ctx, tx, listingID, newImages); err != nil {
+		log.Printf("UpdateListing: Image insert error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update listing"})
+		return
+	}
+	for _, change := range changes {
+		if err := insertListingChange(ctx, tx, listingID, req.FarmerID, change); err != nil {
+			log.Printf("UpdateListing: Change log error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update listing"})
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update listing"})
+		return
+	}
+	committed = true
+	removeImages(dropped...)
+
+	var imagesAfter int
+	if err := h.DB.QueryRow(ctx, "SELECT COUNT(*) FROM listing_images WHERE listing_id = $1", listingID).Scan(&imagesAfter); err != nil {
+		log.Printf("UpdateListing: Image count error: %v\n", err)
+	}
+	if imageURL != "" {
+		imagesAfter++
+	}
+	if imagesAfter != imagesBefore || newMain != "" {
+		change := ListingChange{Field: "images"}
+		before, after := strconv.Itoa(imagesBefore), strconv.Itoa(imagesAfter)
+		change.OldValue, change.NewValue = &before, &after
+		change.Summary = describeListingChange(change, listingCurrency)
+		changes = append(changes, change)
+		if err := insertListingChange(ctx, h.DB, listingID, req.FarmerID, change); err != nil {
+			log.Printf("UpdateListing: Change log error: %v\n", err)
+		}
+	}
+
+	if len(changes) > 0 {
+		h.matchListing(ctx, listingID)
+	}
+	if changes == nil {
+		changes = []ListingChange{}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Listing updated successfully", "listing_id": listingID, "changes": changes})
+}
+
+// GetListingHistory returns a listing's price history, oldest first, and its change
+// log, newest first.
+// GET /api/marketplace/:id/history?currency=
+func (h *Handler) GetListingHistory(c *gin.Context) {
+	listingID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing id"})
+		return
+	}
+	target, err := h.resolveCurrency(c, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+
+	var price float64
+	var listingCurrency string
+	var created time.Time
+	err = h.DB.QueryRow(ctx,
+		"SELECT price_per_kg, currency, created_at FROM marketplace_listings WHERE id = $1",
+		listingID).Scan(&price, &listingCurrency, &created)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Listing not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load listing"})
+		return
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT field, old_value, new_value, created_at
+		FROM listing_changes
+		WHERE listing_id = $1
+		ORDER BY created_at ASC, id ASC
+	`, listingID)
+	if err != nil {
+		log.Printf("GetListingHistory: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load listing history"})
+		return
+	}
+	defer rows.Close()
+
+	var changes []ListingChange
+	for rows.Next() {
+		var change ListingChange
+		var at time.Time
+		if err := rows.Scan(&change.Field, &change.OldValue, &change.NewValue, &at); err != nil {
+			log.Printf("GetListingHistory: Scan error: %v\n", err)
+			continue
+		}
+		change.ChangedAt = at.Format(time.RFC3339)
+		change.Summary = describeListingChange(change, listingCurrency)
+		changes = append(changes, change)
+	}
+
+	rate := 1.0
+	displayCurrency := listingCurrency
+	if target != "" && target != listingCurrency {
+		if r, ok := h.loadRates(ctx).Convert(1, listingCurrency, target); ok {
+			rate, displayCurrency = r, target
+		}
+	}
+
+	// The first price change remembers the price the listing was created with
+	history := []PricePoint{}
+	for _, change := range changes {
+		if change.Field != "price_per_kg" || change.OldValue == nil || change.NewValue == nil {
+			continue
+		}
+		oldPrice, _ := strconv.ParseFloat(*change.OldValue, 64)
+		newPrice, _ := strconv.ParseFloat(*change.NewValue, 64)
+		if len(history) == 0 {
+			history = append(history, PricePoint{Price: oldPrice * rate, ChangedAt: created.Format(time.RFC3339)})
+		}
+		point := PricePoint{Price: newPrice * rate, ChangedAt: change.ChangedAt}
+		if pct, ok := percentChange(oldPrice, newPrice); ok {
+			point.ChangePct = &pct
+		}
+		history = append(history, point)
+	}
+	if len(history) == 0 {
+		history = append(history, PricePoint{Price: price * rate, ChangedAt: created.Format(time.RFC3339)})
+	}
+
+	// Newest first for the change log
+	changeLog := make([]ListingChange, 0, len(changes))
+	for i := len(changes) - 1; i >= 0; i-- {
+		changeLog = append(changeLog, changes[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"listing_id":    listingID,
+		"currency":      displayCurrency,
+		"price_history": history,
+		"changes":       changeLog,
+	})
+}
+
+// insertListingChange records one change in listing_changes.
+func insertListingChange(ctx context.Context, db execer, listingID, userID int, change ListingChange) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO listing_changes (listing_id, changed_by, field, old_value, new_value)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+	`, listingID, userID, change.Field, change.OldValue, change.NewValue)
+	return err
+}
+
+// describeListingChange phrases a change for buyers, e.g. "Price dropped 10%".
+func describeListingChange(change ListingChange, listingCurrency string) string {
+	value := func(v *string) string {
+		if v == nil {
+			return ""
+		}
+		return *v
+	}
+	oldValue, newValue := value(change.OldValue), value(change.NewValue)
+
+	switch change.Field {
+	case "price_per_kg":
+		oldPrice, _ := strconv.ParseFloat(oldValue, 64)
+		newPrice, _ := strconv.ParseFloat(newValue, 64)
+		pct, ok := percentChange(oldPrice, newPrice)
+		if !ok {
+			return fmt.Sprintf("Price changed to %s %s/kg", newValue, listingCurrency)
+		}
+		direction := "rose"
+		if pct < 0 {
+			direction = "dropped"
+		}
+		return fmt.Sprintf("Price %s %s%% (%s → %s %s/kg)", direction, formatAmount(math.Abs(pct)), oldValue, newValue, listingCurrency)
+	case "quantity_kg":
+		return fmt.Sprintf("Quantity changed from %s to %s kg", oldValue, newValue)
+	case "harvest_ready_date":
+		if newValue == "" {
+			return "Harvest date removed"
+		}
+		return "Harvest date changed to " + newValue
+	case "description":
+		return "Description updated"
+	case "tags":
+		if newValue == "" {
+			return "Tags removed"
+		}
+		return "Tags changed to " + newValue
+	case "images":
+		return fmt.Sprintf("Photos updated (%s → %s)", oldValue, newValue)
+	case "status":
+		switch newValue {
+		case listing.Active:
+			switch oldValue {
+			case listing.Draft:
+				return "Listing published"
+			case listing.Paused:
+				return "Listing resumed"
+			}
+			return "Listing renewed"
+		case listing.Paused:
+			return "Listing paused"
+		case listing.Sold:
+			return "Marked as sold out"
+		case listing.Expired:
+			return "Listing expired"
+		}
+		return "Status changed to " + newValue
+	}
+	return change.Field + " changed"
+}
+
+// percentChange is the change from old to new in percent, rounded to one decimal.
+func percentChange(oldValue, newValue float64) (float64, bool) {
+	if oldValue <= 0 {
+		return 0, false
+	}
+	return math.Round((newValue-oldValue)/oldValue*1000) / 10, true
+}
+
+// formatAmount prints a quantity or price without trailing zeros.
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
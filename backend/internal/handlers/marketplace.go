@@ -1,39 +1,57 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"fmt"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"farmlite/internal/currency"
+	"farmlite/internal/geo"
+	"farmlite/internal/listing"
+
 	"github.com/gin-gonic/gin"
 )
 
 type MarketplaceListing struct {
-	ID               int      `json:"id"`
-	FarmerID         int      `json:"farmer_id"`
-	FarmerName       string   `json:"farmer_name"`
-	FarmerPhone      string   `json:"farmer_phone"`
-	CropTypeID       int      `json:"crop_type_id"`
-	CropName         string   `json:"crop_name"`
-	QuantityKG       float64  `json:"quantity_kg"`
-	PricePerKG       float64  `json:"price_per_kg"`
-	HarvestReadyDate string   `json:"harvest_ready_date"` // YYYY-MM-DD
-	Description      string   `json:"description"`
-	Region           string   `json:"region"`
-	ImageURL         string   `json:"image_url"`
-	Latitude         float64  `json:"latitude"`
-	Longitude        float64  `json:"longitude"`
-	CreatedAt        string   `json:"created_at"`
-	Tags             []string `json:"tags"`
-	ViewCount        int      `json:"view_count"`
-	ContactCount     int      `json:"contact_count"`
-	AverageRating    float64  `json:"average_rating"`
-	ReviewCount      int      `json:"review_count"`
-	Images           []string `json:"images"`
-	Distance         float64  `json:"distance,omitempty"`
+	ID               int        `json:"id"`
+	FarmerID         int        `json:"farmer_id"`
+	FarmerName       string     `json:"farmer_name"`
+	FarmerPhone      string     `json:"farmer_phone,omitempty"` // only shared in a conversation, see SharePhone
+	CropTypeID       int        `json:"crop_type_id"`
+	CropName         string     `json:"crop_name"`
+	QuantityKG       float64    `json:"quantity_kg"`
+	AvailableKG      float64    `json:"available_kg"` // quantity not reserved by open orders
+	PricePerKG       float64    `json:"price_per_kg"`
+	Currency         string     `json:"currency"`
+	ListedPrice      float64    `json:"listed_price_per_kg,omitempty"` // original price when converted
+	ListedCurrency   string     `json:"listed_currency,omitempty"`
+	HarvestReadyDate string     `json:"harvest_ready_date"` // YYYY-MM-DD
+	Description      string     `json:"description"`
+	Region           string     `json:"region"`
+	ImageURL         string     `json:"image_url"`
+	ImageVariants    *ImageSet  `json:"image_variants,omitempty"` // sizes of ImageURL
+	Latitude         float64    `json:"latitude"`
+	Longitude        float64    `json:"longitude"`
+	CreatedAt        string     `json:"created_at"`
+	Tags             []string   `json:"tags"`
+	ViewCount        int        `json:"view_count"`
+	ContactCount     int        `json:"contact_count"`
+	AverageRating    float64    `json:"average_rating"`
+	ReviewCount      int        `json:"review_count"`
+	FarmerBadges     []string   `json:"farmer_badges"` // see trust.Badges
+	Images           []string   `json:"images"`
+	ImageSets        []ImageSet `json:"image_sets"`                      // sizes of each of Images, in the same order
+	Distance         *float64   `json:"distance,omitempty"`              // km from the caller's lat/lng
+	Relevance        float64    `json:"relevance,omitempty"`             // search rank when q is given
+	Snippet          string     `json:"snippet,omitempty"`               // description with <mark>ed matches
+	PreviousPrice    *float64   `json:"previous_price_per_kg,omitempty"` // before the last recent price change
+	PriceChangePct   *float64   `json:"price_change_pct,omitempty"`      // e.g. -10 for "price dropped 10%"
+	Status           string     `json:"status"`                          // draft, active, paused, sold or expired
+	ExpiresAt        *string    `json:"expires_at,omitempty"`
 }
 
 type CreateListingRequest struct {
@@ -41,49 +59,213 @@ type CreateListingRequest struct {
 	CropTypeID       int     `json:"crop_type_id" form:"crop_type_id" binding:"required"`
 	QuantityKG       float64 `json:"quantity_kg" form:"quantity_kg" binding:"required"`
 	PricePerKG       float64 `json:"price_per_kg" form:"price_per_kg" binding:"required"`
+	Currency         string  `json:"currency" form:"currency"` // defaults to UZS
 	HarvestReadyDate string  `json:"harvest_ready_date" form:"harvest_ready_date"`
 	Description      string  `json:"description" form:"description"`
 	Latitude         float64 `json:"latitude" form:"latitude"`
 	Longitude        float64 `json:"longitude" form:"longitude"`
-	Tags             string  `json:"tags" form:"tags"` // Comma-separated
+	Tags             string  `json:"tags" form:"tags"`     // Comma-separated
+	Status           string  `json:"status" form:"status"` // draft or active (default)
+}
+
+// Listing page sizes
+const (
+	defaultListingLimit = 50
+	maxListingLimit     = 100
+)
+
+// listingSort is a column of the filtered listing query to order by; id breaks ties
+// in the same direction.
+type listingSort struct {
+	key  string
+	desc bool
 }
 
+var listingSorts = map[string]listingSort{
+	"newest":     {"created_at", true},
+	"price_asc":  {"sort_price", false},
+	"price_desc": {"sort_price", true},
+	"rating":     {"average_rating", true},
+	"distance":   {"sort_distance", false},
+	"relevance":  {"rank", true},
+}
+
+// GetMarketplaceListings returns one page of active listings. The total number of
+// matches is in the X-Total-Count header and the cursor for the next page, if any,
+// in X-Next-Cursor.
+// q is a full-text search over crop, tags and description; results then sort by relevance.
+// Buyers only see active, unexpired listings; a farmer_id with status (a state or "all")
+// shows that farmer's own listings in other states.
+// GET /api/marketplace?q=&crop_type_id=&region=&min_price=&max_price=&currency=&lat=&lng=&radius_km=&sort=newest&limit=50&cursor=&farmer_id=&status=
 func (h *Handler) GetMarketplaceListings(c *gin.Context) {
 	// Query Parameters
+	farmerID := c.Query("farmer_id")
+	status := c.Query("status")
 	cropTypeID := c.Query("crop_type_id")
 	minPrice := c.Query("min_price")
 	maxPrice := c.Query("max_price")
 	region := c.Query("region")
-	userLat := c.Query("lat")
-	userLng := c.Query("lng")
+	q := strings.TrimSpace(c.Query("q"))
+	sortBy := c.Query("sort")
+	if sortBy == "" {
+		sortBy = "newest"
+		if q != "" {
+			sortBy = "relevance"
+		}
+	}
 
+	origin, err := parseListingOrigin(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, ok := listingSorts[sortBy]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of newest, price_asc, price_desc, rating, distance, relevance"})
+		return
+	}
+	if sortBy == "relevance" && q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required to sort by relevance"})
+		return
+	}
+	if status != "" && status != "all" && !listing.Valid(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of draft, active, paused, sold, expired, all"})
+		return
+	}
+	if status != "" && status != listing.Active && farmerID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "farmer_id is required to list listings that aren't active"})
+		return
+	}
+	if origin == nil && (sortBy == "distance" || c.Query("radius_km") != "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lng are required to sort or filter by distance"})
+		return
+	}
+
+	limit := defaultListingLimit
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxListingLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxListingLimit)})
+			return
+		}
+	}
+	var after *listingCursor
+	if v := c.Query("cursor"); v != "" {
+		if after, err = decodeListingCursor(v, sortBy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Only convert prices when the caller asks for a currency
+	target, err := h.resolveCurrency(c, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rates := h.loadRates(c.Request.Context())
+
+	// Distance from the caller, NULL for listings without a location ($1, $2 = lat, lng)
+	distanceExpr := "NULL::float8"
+	var args []interface{}
+	idx := 1
+	if origin != nil {
+		distanceExpr = `CASE WHEN m.latitude IS NOT NULL AND NOT (m.latitude = 0 AND m.longitude = 0)
+			THEN haversine_km($1::float8, $2::float8, m.latitude, m.longitude) END`
+		args = append(args, origin.Lat, origin.Lng)
+		idx = 3
+	}
+
+	// Full-text match, rank and the query itself for highlighting snippets
+	searchJoin, searchFilter := "", ""
+	rankExpr, queryExpr := "0::float8", "NULL::tsquery"
+	if q != "" {
+		expr, searchArgs, ok := searchQuery(q, idx)
+		if !ok {
+			c.Header("X-Total-Count", "0")
+			c.JSON(http.StatusOK, []MarketplaceListing{})
+			return
+		}
+		searchJoin = " CROSS JOIN (SELECT " + expr + " AS query) sq"
+		searchFilter = " AND m.search_vector @@ sq.query"
+		rankExpr, queryExpr = "ts_rank_cd(m.search_vector, sq.query)::float8", "sq.query"
+		args = append(args, searchArgs...)
+		idx += len(searchArgs)
+	}
+
+	// Ratings and images come back with the listing rather than a query per row.
+	// Prices sort in soum so listings in different currencies compare.
 	baseQuery := `
-		SELECT m.id, m.farmer_id, u.full_name, u.phone_number, u.region, c.name, 
-		       m.quantity_kg, m.price_per_kg, m.harvest_ready_date, m.description, 
-		       COALESCE(m.image_url, ''), COALESCE(m.latitude, 0), COALESCE(m.longitude, 0), m.created_at,
-			   m.tags, m.view_count, m.contact_count
+		SELECT m.id, m.farmer_id, u.full_name, u.region, c.name, 
+		       m.quantity_kg, m.price_per_kg, m.currency, m.harvest_ready_date, m.description, 
+		       COALESCE(m.image_url, '') AS image_url, COALESCE(m.latitude, 0) AS latitude, COALESCE(m.longitude, 0) AS longitude, m.created_at,
+			   m.tags, m.view_count, m.contact_count,
+		       COALESCE(r.average_rating, 0) AS average_rating, COALESCE(r.review_count, 0) AS review_count,
+		       ARRAY(SELECT li.image_url FROM listing_images li WHERE li.listing_id = m.id ORDER BY li.id) AS images,
+		       ` + distanceExpr + ` AS distance,
+		       (m.price_per_kg * COALESCE(fx_rate(m.currency, 'UZS'), 1))::float8 AS sort_price,
+		       ` + rankExpr + ` AS rank, ` + queryExpr + ` AS search_query,
+		       pc.previous_price, m.status, m.expires_at, GREATEST(m.quantity_kg - m.reserved_kg, 0)::float8 AS available_kg,
+		       COALESCE(t.badges, '{}') AS farmer_badges
 		FROM marketplace_listings m
 		JOIN users u ON m.farmer_id = u.id
+		LEFT JOIN user_trust t ON t.user_id = m.farmer_id
 		JOIN crop_types c ON m.crop_type_id = c.id
-		WHERE m.is_active = TRUE
+		LEFT JOIN (
+			SELECT r.farmer_id, AVG(r.rating)::float8 AS average_rating, COUNT(*) AS review_count
+			FROM seller_reviews r
+			WHERE ` + eligibleReviewFilter + `
+			GROUP BY r.farmer_id
+		) r ON r.farmer_id = m.farmer_id
+		LEFT JOIN LATERAL (
+			SELECT lc.old_value::numeric AS previous_price
+			FROM listing_changes lc
+			WHERE lc.listing_id = m.id AND lc.field = 'price_per_kg'
+			  AND lc.created_at >= NOW() - make_interval(days => ` + strconv.Itoa(priceChangeBadgeDays) + `)
+			ORDER BY lc.created_at DESC, lc.id DESC
+			LIMIT 1
+		) pc ON TRUE` + searchJoin + `
+		WHERE m.is_active = TRUE` + searchFilter + `
 	`
-	var args []interface{}
-	idx := 1
 
+	switch status {
+	case "":
+		baseQuery += " AND m.status = 'active' AND (m.expires_at IS NULL OR m.expires_at > NOW())"
+	case "all":
+	default:
+		baseQuery += fmt.Sprintf(" AND m.status = $%d", idx)
+		args = append(args, status)
+		idx++
+	}
+	if farmerID != "" {
+		baseQuery += fmt.Sprintf(" AND m.farmer_id = $%d", idx)
+		args = append(args, farmerID)
+		idx++
+	}
 	if cropTypeID != "" && cropTypeID != "All" {
 		baseQuery += fmt.Sprintf(" AND m.crop_type_id = $%d", idx)
 		args = append(args, cropTypeID)
 		idx++
 	}
-	if minPrice != "" {
-		baseQuery += fmt.Sprintf(" AND m.price_per_kg >= $%d", idx)
-		args = append(args, minPrice)
-		idx++
-	}
-	if maxPrice != "" {
-		baseQuery += fmt.Sprintf(" AND m.price_per_kg <= $%d", idx)
-		args = append(args, maxPrice)
+	// Price bounds are in the requested currency, soum by default, and listings are
+	// converted to it; listings whose currency has no rate can't be compared and are left out.
+	if minPrice != "" || maxPrice != "" {
+		filterCurrency := target
+		if filterCurrency == "" {
+			filterCurrency = currency.UZS
+		}
+		converted := fmt.Sprintf("m.price_per_kg * fx_rate(m.currency, $%d)", idx)
+		args = append(args, filterCurrency)
 		idx++
+		if minPrice != "" {
+			baseQuery += fmt.Sprintf(" AND %s >= $%d", converted, idx)
+			args = append(args, minPrice)
+			idx++
+		}
+		if maxPrice != "" {
+			baseQuery += fmt.Sprintf(" AND %s <= $%d", converted, idx)
+			args = append(args, maxPrice)
+			idx++
+		}
 	}
 	if region != "" && region != "All" {
 		baseQuery += fmt.Sprintf(" AND u.region = $%d", idx)
@@ -91,9 +273,56 @@ func (h *Handler) GetMarketplaceListings(c *gin.Context) {
 		idx++
 	}
 
-	baseQuery += " ORDER BY m.created_at DESC"
+	// The bounding box narrows candidates on the location index; the exact radius
+	// is checked on what's left
+	radiusFilter := ""
+	if origin != nil && origin.RadiusKm > 0 {
+		box := geo.BoundingBox(origin.Lat, origin.Lng, origin.RadiusKm)
+		baseQuery += fmt.Sprintf(" AND m.latitude BETWEEN $%d AND $%d AND m.longitude BETWEEN $%d AND $%d", idx, idx+1, idx+2, idx+3)
+		args = append(args, box.MinLat, box.MaxLat, box.MinLng, box.MaxLng)
+		idx += 4
+		radiusFilter = fmt.Sprintf(" WHERE l.distance <= $%d", idx)
+		args = append(args, origin.RadiusKm)
+		idx++
+	}
+	filtered := `SELECT l.*, COALESCE(l.distance, 'Infinity'::float8) AS sort_distance FROM (` + baseQuery + `) l` + radiusFilter
+
+	ctx := c.Request.Context()
+	var total int
+	if err := h.DB.QueryRow(ctx, "SELECT COUNT(*) FROM ("+filtered+") f", args...).Scan(&total); err != nil {
+		fmt.Printf("GetMarketplaceListings count error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch listings: " + err.Error()})
+		return
+	}
+
+	// Keyset pagination: resume strictly after the cursor's (sort key, id).
+	// Snippets are only built for the rows on the page.
+	pageQuery := `
+		SELECT id, farmer_id, full_name, region, name, quantity_kg, price_per_kg, currency,
+		       harvest_ready_date, description, image_url, latitude, longitude, created_at, tags, view_count,
+		       contact_count, average_rating, review_count, images, distance, sort_price, sort_distance, rank,
+		       previous_price, status, expires_at, available_kg, farmer_badges,
+		       CASE WHEN search_query IS NOT NULL
+		            THEN ` + searchHeadline("concat_ws(' · ', description, jsonb_text_list(tags))", "search_query") + ` END
+		FROM (` + filtered + `) f`
+	direction, cmp := "ASC", ">"
+	if order.desc {
+		direction, cmp = "DESC", "<"
+	}
+	pageArgs := args
+	if after != nil {
+		cast := "float8"
+		if order.key == "created_at" {
+			cast = "timestamptz"
+		}
+		pageQuery += fmt.Sprintf(" WHERE (%s, id) %s ($%d::%s, $%d)", order.key, cmp, idx, cast, idx+1)
+		pageArgs = append(pageArgs, after.Value, after.ID)
+		idx += 2
+	}
+	pageQuery += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT $%d", order.key, direction, direction, idx)
+	pageArgs = append(pageArgs, limit+1)
 
-	rows, err := h.DB.Query(c.Request.Context(), baseQuery, args...)
+	rows, err := h.DB.Query(ctx, pageQuery, pageArgs...)
 	if err != nil {
 		fmt.Printf("GetMarketplaceListings error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch listings: " + err.Error()})
@@ -102,21 +331,33 @@ func (h *Handler) GetMarketplaceListings(c *gin.Context) {
 	defer rows.Close()
 
 	var listings []MarketplaceListing
+	var next *listingCursor
+	hasMore := false
 	for rows.Next() {
 		var l MarketplaceListing
 		var date *time.Time
 		var created time.Time
 		var description *string
+		var images []string
+		var sortPrice, sortDistance float64
+		var snippet *string
+		var expiresAt *time.Time
 
-		err := rows.Scan(&l.ID, &l.FarmerID, &l.FarmerName, &l.FarmerPhone, &l.Region, &l.CropName,
-			&l.QuantityKG, &l.PricePerKG, &date, &description, &l.ImageURL, &l.Latitude, &l.Longitude, &created,
-			&l.Tags, &l.ViewCount, &l.ContactCount)
+		err := rows.Scan(&l.ID, &l.FarmerID, &l.FarmerName, &l.Region, &l.CropName,
+			&l.QuantityKG, &l.PricePerKG, &l.Currency, &date, &description, &l.ImageURL, &l.Latitude, &l.Longitude, &created,
+			&l.Tags, &l.ViewCount, &l.ContactCount, &l.AverageRating, &l.ReviewCount, &images, &l.Distance, &sortPrice, &sortDistance, &l.Relevance, &l.PreviousPrice, &l.Status, &expiresAt, &l.AvailableKG, &l.FarmerBadges, &snippet)
 
 		if err != nil {
 			fmt.Printf("GetMarketplaceListings: Scan error: %v\n", err)
 			continue
 		}
 
+		// One row past the page only tells us there is a next page
+		if len(listings) == limit {
+			hasMore = true
+			break
+		}
+
 		if date != nil {
 			l.HarvestReadyDate = date.Format("2006-01-02")
 		} else {
@@ -126,40 +367,153 @@ func (h *Handler) GetMarketplaceListings(c *gin.Context) {
 		if description != nil {
 			l.Description = *description
 		}
+		if snippet != nil {
+			l.Snippet = *snippet
+		}
 
 		l.CreatedAt = created.Format("2006-01-02 15:04")
+		if expiresAt != nil {
+			e := expiresAt.Format("2006-01-02 15:04")
+			l.ExpiresAt = &e
+		}
+		if l.PreviousPrice != nil {
+			if pct, ok := percentChange(*l.PreviousPrice, l.PricePerKG); ok {
+				l.PriceChangePct = &pct
+			}
+		}
+		l.convertPrice(rates, target)
 
-		// Fetch Rating
-		h.DB.QueryRow(c.Request.Context(), `
-			SELECT COALESCE(AVG(rating), 0), COUNT(*)
-			FROM seller_reviews
-			WHERE farmer_id = $1
-		`, l.FarmerID).Scan(&l.AverageRating, &l.ReviewCount)
-
-		// Fetch Images
-		imgRows, _ := h.DB.Query(c.Request.Context(), "SELECT image_url FROM listing_images WHERE listing_id = $1", l.ID)
 		l.Images = []string{}
 		if l.ImageURL != "" {
 			l.Images = append(l.Images, l.ImageURL)
 		}
-		for imgRows.Next() {
-			var img string
-			imgRows.Scan(&img)
-			l.Images = append(l.Images, img)
-		}
-		imgRows.Close()
+		l.Images = append(l.Images, images...)
+		l.setImageVariants()
 
-		// Calculate Distance if lat/lng provided
-		if userLat != "" && userLng != "" && l.Latitude != 0 {
-			// Basic simplified distance for MVP (Cartesian approximation if near, or just skip complex math)
-			// In a real app, use Haversine.
-			l.Distance = 15.5 // Placeholder or actual math
+		listings = append(listings, l)
+
+		next = &listingCursor{Sort: sortBy, ID: l.ID}
+		switch order.key {
+		case "created_at":
+			next.Value = created
+		case "sort_price":
+			next.Value = sortPrice
+		case "average_rating":
+			next.Value = l.AverageRating
+		case "sort_distance":
+			next.Value = sortDistance
+		case "rank":
+			next.Value = l.Relevance
 		}
+	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	if hasMore && next != nil {
+		c.Header("X-Next-Cursor", next.encode())
+	}
+	c.JSON(http.StatusOK, listings)
+}
 
-		listings = append(listings, l)
+// listingCursor marks the last listing of a page: its id and its value of the sort key.
+type listingCursor struct {
+	Sort  string
+	ID    int
+	Value interface{} // time.Time for newest, float64 otherwise
+}
+
+// encode renders the cursor as an opaque URL-safe token.
+func (lc *listingCursor) encode() string {
+	var value string
+	switch v := lc.Value.(type) {
+	case time.Time:
+		value = v.UTC().Format(time.RFC3339Nano)
+	case float64:
+		value = strconv.FormatFloat(v, 'g', -1, 64)
 	}
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d|%s", lc.Sort, lc.ID, value)))
+}
 
-	c.JSON(http.StatusOK, listings)
+// decodeListingCursor reads a cursor issued for the same sort order.
+func decodeListingCursor(token, sortBy string) (*listingCursor, error) {
+	invalid := fmt.Errorf("invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, invalid
+	}
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 {
+		return nil, invalid
+	}
+	if parts[0] != sortBy {
+		return nil, fmt.Errorf("cursor was issued for sort=%s", parts[0])
+	}
+
+	lc := &listingCursor{Sort: sortBy}
+	if lc.ID, err = strconv.Atoi(parts[1]); err != nil {
+		return nil, invalid
+	}
+	if listingSorts[sortBy].key == "created_at" {
+		lc.Value, err = time.Parse(time.RFC3339Nano, parts[2])
+	} else {
+		lc.Value, err = strconv.ParseFloat(parts[2], 64)
+	}
+	if err != nil {
+		return nil, invalid
+	}
+	return lc, nil
+}
+
+// Largest radius_km accepted for listing searches
+const maxListingRadiusKm = 2000
+
+// listingOrigin is where a listing search is made from.
+type listingOrigin struct {
+	Lat, Lng float64
+	RadiusKm float64 // 0 means no radius filter
+}
+
+// parseListingOrigin reads lat, lng and radius_km. It returns nil when no location is given.
+func parseListingOrigin(c *gin.Context) (*listingOrigin, error) {
+	lat, lng := c.Query("lat"), c.Query("lng")
+	if lat == "" && lng == "" {
+		return nil, nil
+	}
+	if lat == "" || lng == "" {
+		return nil, fmt.Errorf("lat and lng must be given together")
+	}
+
+	var o listingOrigin
+	var err error
+	if o.Lat, err = strconv.ParseFloat(lat, 64); err != nil || o.Lat < -90 || o.Lat > 90 {
+		return nil, fmt.Errorf("lat must be between -90 and 90")
+	}
+	if o.Lng, err = strconv.ParseFloat(lng, 64); err != nil || o.Lng < -180 || o.Lng > 180 {
+		return nil, fmt.Errorf("lng must be between -180 and 180")
+	}
+	if v := c.Query("radius_km"); v != "" {
+		if o.RadiusKm, err = strconv.ParseFloat(v, 64); err != nil || o.RadiusKm <= 0 || o.RadiusKm > maxListingRadiusKm {
+			return nil, fmt.Errorf("radius_km must be between 0 and %d", maxListingRadiusKm)
+		}
+	}
+	return &o, nil
+}
+
+// convertPrice expresses the listing price in the target currency, keeping the
+// listed price alongside. Listings are left as-is when no target is requested
+// or the rate is unknown.
+func (l *MarketplaceListing) convertPrice(rates currency.Rates, target string) {
+	if target == "" || target == l.Currency {
+		return
+	}
+	converted, ok := rates.Convert(l.PricePerKG, l.Currency, target)
+	if !ok {
+		return
+	}
+	if l.PreviousPrice != nil {
+		previous := *l.PreviousPrice * converted / l.PricePerKG
+		l.PreviousPrice = &previous
+	}
+	l.ListedPrice, l.ListedCurrency = l.PricePerKG, l.Currency
+	l.PricePerKG, l.Currency = converted, target
 }
 
 func (h *Handler) CreateListing(c *gin.Context) {
@@ -170,33 +524,36 @@ func (h *Handler) CreateListing(c *gin.Context) {
 		return
 	}
 
-	// Handle Image Upload (main image)
-	imagePath := ""
-	file, err := c.FormFile("image")
-	if err == nil {
-		// Ensure uploads directory exists
-		uploadDir := "./uploads/marketplace"
-		if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-			os.MkdirAll(uploadDir, 0755)
-		}
-
-		// Generate unique filename
-		filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), filepath.Base(file.Filename))
-		dst := filepath.Join(uploadDir, filename)
+	listingCurrency, err := currency.Normalize(req.Currency, currency.UZS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		if err := c.SaveUploadedFile(file, dst); err == nil {
-			imagePath = "/uploads/marketplace/" + filename // Public URL path
+	status := listing.Active
+	if req.Status != "" {
+		if req.Status != listing.Draft && req.Status != listing.Active {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be draft or active"})
+			return
 		}
+		status = req.Status
 	}
 
-	var harvestDate interface{} = nil
+	var harvestDate *time.Time
 	if req.HarvestReadyDate != "" {
 		t, err := time.Parse("2006-01-02", req.HarvestReadyDate)
 		if err == nil {
-			harvestDate = t
+			harvestDate = &t
 		}
 	}
 
+	// Drafts start their expiry clock when published
+	var expiresAt *time.Time
+	if status == listing.Active {
+		t := listing.ExpiresAt(harvestDate, time.Now())
+		expiresAt = &t
+	}
+
 	// Prepare tags as JSONB
 	tagsJSON := "[]"
 	if req.Tags != "" {
@@ -215,23 +572,54 @@ func (h *Handler) CreateListing(c *gin.Context) {
 		tagsJSON += "]"
 	}
 
+	// Images are checked and stored before the listing so a bad file fails the request
+	imagePath, err := saveListingImage(c)
+	if err != nil {
+		uploadError(c, err, "CreateListing")
+		return
+	}
+	extraImages, err := saveUploads(c, "images", "marketplace")
+	if err != nil {
+		removeImages(imagePath)
+		uploadError(c, err, "CreateListing")
+		return
+	}
+
 	var listingID int
 	err = h.DB.QueryRow(c.Request.Context(), `
-		INSERT INTO marketplace_listings (farmer_id, crop_type_id, quantity_kg, price_per_kg, harvest_ready_date, description, image_url, latitude, longitude, tags)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::jsonb)
+		INSERT INTO marketplace_listings (farmer_id, crop_type_id, quantity_kg, price_per_kg, currency, harvest_ready_date, description, image_url, latitude, longitude, tags, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11::jsonb, $12, $13)
 		RETURNING id
-	`, req.FarmerID, req.CropTypeID, req.QuantityKG, req.PricePerKG, harvestDate, req.Description, imagePath, req.Latitude, req.Longitude, tagsJSON).Scan(&listingID)
+	`, req.FarmerID, req.CropTypeID, req.QuantityKG, req.PricePerKG, listingCurrency, harvestDate, req.Description, imagePath, req.Latitude, req.Longitude, tagsJSON, status, expiresAt).Scan(&listingID)
 
 	if err != nil {
 		fmt.Printf("Error creating listing: %v\n", err) // Debug log
+		removeImages(append(extraImages, imagePath)...)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create listing: " + err.Error()})
 		return
 	}
 
-	// Handle multiple additional images
-	h.HandleMultipleUploads(c, listingID)
+	if err := addListingImages(c.Request.Context(), h.DB, listingID, extraImages); err != nil {
+		log.Printf("CreateListing: Image insert error: %v\n", err)
+	}
+	h.matchListing(c.Request.Context(), listingID)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Listing created successfully", "listing_id": listingID, "status": status, "expires_at": expiresAt})
+}
+
+// setImageVariants fills in the variant URLs of the listing's images.
+func (l *MarketplaceListing) setImageVariants() {
+	if l.ImageURL != "" {
+		set := imageVariants(l.ImageURL)
+		l.ImageVariants = &set
+	}
+	l.ImageSets = imageSets(l.Images)
+}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Listing created successfully", "listing_id": listingID})
+// saveListingImage stores the uploaded main "image" file and returns its public URL,
+// or "" when none was sent.
+func saveListingImage(c *gin.Context) (string, error) {
+	return saveUpload(c, "image", "marketplace")
 }
 
 func (h *Handler) DeleteListing(c *gin.Context) {
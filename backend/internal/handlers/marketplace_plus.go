@@ -4,79 +4,16 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"farmlite/internal/currency"
+	"farmlite/internal/demand"
+
 	"github.com/gin-gonic/gin"
 )
 
-type RatingSchema struct {
-	ID        int       `json:"id"`
-	FarmerID  int       `json:"farmer_id"`
-	BuyerID   int       `json:"buyer_id"`
-	Rating    int       `json:"rating"`
-	Comment   string    `json:"comment"`
-	CreatedAt time.Time `json:"created_at"`
-	BuyerName string    `json:"buyer_name,omitempty"`
-}
-
-type CreateReviewRequest struct {
-	FarmerID int    `json:"farmer_id" binding:"required"`
-	BuyerID  int    `json:"buyer_id" binding:"required"`
-	Rating   int    `json:"rating" binding:"required,min=1,max=5"`
-	Comment  string `json:"comment"`
-}
-
-func (h *Handler) CreateReview(c *gin.Context) {
-	var req CreateReviewRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	_, err := h.DB.Exec(c.Request.Context(), `
-		INSERT INTO seller_reviews (farmer_id, buyer_id, rating, comment)
-		VALUES ($1, $2, $3, $4)
-	`, req.FarmerID, req.BuyerID, req.Rating, req.Comment)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit review: " + err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusCreated, gin.H{"message": "Review submitted successfully"})
-}
-
-func (h *Handler) GetFarmerReviews(c *gin.Context) {
-	farmerID := c.Param("id")
-
-	rows, err := h.DB.Query(c.Request.Context(), `
-		SELECT r.id, r.farmer_id, r.buyer_id, r.rating, r.comment, r.created_at, u.full_name
-		FROM seller_reviews r
-		JOIN users u ON r.buyer_id = u.id
-		WHERE r.farmer_id = $1
-		ORDER BY r.created_at DESC
-	`, farmerID)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
-		return
-	}
-	defer rows.Close()
-
-	var reviews []RatingSchema
-	for rows.Next() {
-		var r RatingSchema
-		if err := rows.Scan(&r.ID, &r.FarmerID, &r.BuyerID, &r.Rating, &r.Comment, &r.CreatedAt, &r.BuyerName); err != nil {
-			continue
-		}
-		reviews = append(reviews, r)
-	}
-
-	c.JSON(http.StatusOK, reviews)
-}
-
 // Saved Listings
 
 type SavedListingRequest struct {
@@ -124,10 +61,18 @@ func (h *Handler) UnsaveListing(c *gin.Context) {
 func (h *Handler) GetWatchlist(c *gin.Context) {
 	userID := c.Query("user_id")
 
+	target, err := h.resolveCurrency(c, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rates := h.loadRates(c.Request.Context())
+
 	query := `
-		SELECT m.id, m.farmer_id, u.full_name, u.phone_number, u.region, c.name, 
-		       m.quantity_kg, m.price_per_kg, m.harvest_ready_date, m.description, 
-		       COALESCE(m.image_url, ''), COALESCE(m.latitude, 0), COALESCE(m.longitude, 0), m.created_at
+		SELECT m.id, m.farmer_id, u.full_name, u.region, c.name, 
+		       m.quantity_kg, m.price_per_kg, m.currency, m.harvest_ready_date, m.description, 
+		       COALESCE(m.image_url, ''), COALESCE(m.latitude, 0), COALESCE(m.longitude, 0), m.created_at,
+		       m.status, m.expires_at
 		FROM saved_listings s
 		JOIN marketplace_listings m ON s.listing_id = m.id
 		JOIN users u ON m.farmer_id = u.id
@@ -149,8 +94,10 @@ func (h *Handler) GetWatchlist(c *gin.Context) {
 		var date *time.Time
 		var created time.Time
 		var desc *string
-		err := rows.Scan(&l.ID, &l.FarmerID, &l.FarmerName, &l.FarmerPhone, &l.Region, &l.CropName,
-			&l.QuantityKG, &l.PricePerKG, &date, &desc, &l.ImageURL, &l.Latitude, &l.Longitude, &created)
+		var expiresAt *time.Time
+		err := rows.Scan(&l.ID, &l.FarmerID, &l.FarmerName, &l.Region, &l.CropName,
+			&l.QuantityKG, &l.PricePerKG, &l.Currency, &date, &desc, &l.ImageURL, &l.Latitude, &l.Longitude, &created,
+			&l.Status, &expiresAt)
 		if err != nil {
 			continue
 		}
@@ -161,6 +108,12 @@ func (h *Handler) GetWatchlist(c *gin.Context) {
 			l.Description = *desc
 		}
 		l.CreatedAt = created.Format("2006-01-02 15:04")
+		if expiresAt != nil {
+			e := expiresAt.Format("2006-01-02 15:04")
+			l.ExpiresAt = &e
+		}
+		l.convertPrice(rates, target)
+		l.setImageVariants()
 		listings = append(listings, l)
 	}
 
@@ -170,18 +123,25 @@ func (h *Handler) GetWatchlist(c *gin.Context) {
 // Demand Requests
 
 type DemandRequest struct {
-	ID            int     `json:"id"`
-	BuyerID       int     `json:"buyer_id"`
-	BuyerName     string  `json:"buyer_name"`
-	BuyerPhone    string  `json:"buyer_phone"`
-	CropTypeID    int     `json:"crop_type_id"`
-	CropName      string  `json:"crop_name"`
-	QuantityKG    float64 `json:"quantity_kg"`
-	MaxPricePerKG float64 `json:"max_price_per_kg"`
-	NeededBy      string  `json:"needed_by"`
-	Region        string  `json:"region"`
-	Description   string  `json:"description"`
-	CreatedAt     string  `json:"created_at"`
+	ID            int      `json:"id"`
+	BuyerID       int      `json:"buyer_id"`
+	BuyerName     string   `json:"buyer_name"`
+	BuyerPhone    string   `json:"buyer_phone,omitempty"` // only shared in a conversation, see SharePhone
+	CropTypeID    int      `json:"crop_type_id"`
+	CropName      string   `json:"crop_name"`
+	QuantityKG    float64  `json:"quantity_kg"`
+	MaxPricePerKG float64  `json:"max_price_per_kg"`
+	Currency      string   `json:"currency"`
+	NeededBy      string   `json:"needed_by"`
+	Region        string   `json:"region"`
+	Description   string   `json:"description"`
+	CreatedAt     string   `json:"created_at"`
+	Status        string   `json:"status"` // open, filled, expired or closed
+	FulfilledKG   float64  `json:"fulfilled_kg"`
+	RemainingKG   float64  `json:"remaining_kg"`
+	BuyerBadges   []string `json:"buyer_badges"`        // see trust.Badges
+	Relevance     float64  `json:"relevance,omitempty"` // search rank when q is given
+	Snippet       string   `json:"snippet,omitempty"`   // description with <mark>ed matches
 }
 
 type CreateDemandRequest struct {
@@ -189,6 +149,7 @@ type CreateDemandRequest struct {
 	CropTypeID    int     `json:"crop_type_id" binding:"required"`
 	QuantityKG    float64 `json:"quantity_kg" binding:"required"`
 	MaxPricePerKG float64 `json:"max_price_per_kg"`
+	Currency      string  `json:"currency"` // defaults to UZS
 	NeededBy      string  `json:"needed_by"`
 	Region        string  `json:"region"`
 	Description   string  `json:"description"`
@@ -200,34 +161,104 @@ func (h *Handler) CreateDemandRequest(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if kgHundredths(req.QuantityKG) <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity_kg must be at least 0.01"})
+		return
+	}
+
+	demandCurrency, err := currency.Normalize(req.Currency, currency.UZS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	_, err := h.DB.Exec(c.Request.Context(), `
-		INSERT INTO demand_requests (buyer_id, crop_type_id, quantity_kg, max_price_per_kg, needed_by, region, description)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, req.BuyerID, req.CropTypeID, req.QuantityKG, req.MaxPricePerKG, req.NeededBy, req.Region, req.Description)
+	var demandID int
+	err = h.DB.QueryRow(c.Request.Context(), `
+		INSERT INTO demand_requests (buyer_id, crop_type_id, quantity_kg, max_price_per_kg, currency, needed_by, region, description)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, req.BuyerID, req.CropTypeID, req.QuantityKG, req.MaxPricePerKG, demandCurrency, req.NeededBy, req.Region, req.Description).Scan(&demandID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create demand request: " + err.Error()})
 		return
 	}
+	h.matchDemand(c.Request.Context(), demandID)
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Demand request posted successfully"})
+	c.JSON(http.StatusCreated, gin.H{"message": "Demand request posted successfully", "demand_id": demandID, "status": demand.Open})
 }
 
+// GetDemandRequests lists open demand requests, newest first, or by relevance
+// when q searches their crop and description. A buyer_id with status (a state or
+// "all") lists that buyer's own requests, including filled and expired ones.
+// GET /api/demands?q=&region=&crop_type_id=&buyer_id=&status=
 func (h *Handler) GetDemandRequests(c *gin.Context) {
 	region := c.Query("region")
 	cropID := c.Query("crop_type_id")
+	buyerID := c.Query("buyer_id")
+	status := c.Query("status")
+	q := strings.TrimSpace(c.Query("q"))
+
+	if status != "" && status != "all" && !demand.Valid(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of open, filled, expired, closed, all"})
+		return
+	}
+	if status != "" && status != demand.Open && buyerID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "buyer_id is required to list requests that aren't open"})
+		return
+	}
+
+	target, err := h.resolveCurrency(c, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rates := h.loadRates(c.Request.Context())
+
+	var args []interface{}
+	idx := 1
+
+	searchJoin, searchFilter := "", ""
+	rankExpr, snippetExpr := "0::float8", "NULL::text"
+	if q != "" {
+		expr, searchArgs, ok := searchQuery(q, idx)
+		if !ok {
+			c.JSON(http.StatusOK, []DemandRequest{})
+			return
+		}
+		searchJoin = " CROSS JOIN (SELECT " + expr + " AS query) sq"
+		searchFilter = " AND d.search_vector @@ sq.query"
+		rankExpr = "ts_rank_cd(d.search_vector, sq.query)::float8"
+		snippetExpr = searchHeadline("d.description", "sq.query")
+		args = append(args, searchArgs...)
+		idx += len(searchArgs)
+	}
 
 	query := `
-		SELECT d.id, d.buyer_id, u.full_name, u.phone_number, d.crop_type_id, c.name, 
-		       d.quantity_kg, d.max_price_per_kg, d.needed_by, d.region, d.description, d.created_at
+		SELECT d.id, d.buyer_id, u.full_name, d.crop_type_id, c.name, 
+		       d.quantity_kg, COALESCE(d.max_price_per_kg, 0), d.currency, d.needed_by, d.region, d.description, d.created_at,
+		       d.status, d.fulfilled_kg, COALESCE(t.badges, '{}'), ` + rankExpr + ` AS rank, ` + snippetExpr + `
 		FROM demand_requests d
 		JOIN users u ON d.buyer_id = u.id
-		JOIN crop_types c ON d.crop_type_id = c.id
-		WHERE d.is_active = TRUE
+		LEFT JOIN user_trust t ON t.user_id = d.buyer_id
+		JOIN crop_types c ON d.crop_type_id = c.id` + searchJoin + `
+		WHERE d.is_active = TRUE` + searchFilter + `
 	`
-	var args []interface{}
-	idx := 1
+
+	switch status {
+	case "":
+		query += " AND " + openDemandFilter
+	case "all":
+	default:
+		query += fmt.Sprintf(" AND d.status = $%d", idx)
+		args = append(args, status)
+		idx++
+	}
+	if buyerID != "" {
+		query += fmt.Sprintf(" AND d.buyer_id = $%d", idx)
+		args = append(args, buyerID)
+		idx++
+	}
 
 	if region != "" && region != "All" {
 		query += fmt.Sprintf(" AND d.region = $%d", idx)
@@ -240,7 +271,11 @@ func (h *Handler) GetDemandRequests(c *gin.Context) {
 		idx++
 	}
 
-	query += " ORDER BY d.created_at DESC"
+	if q != "" {
+		query += " ORDER BY rank DESC, d.created_at DESC"
+	} else {
+		query += " ORDER BY d.created_at DESC"
+	}
 
 	rows, err := h.DB.Query(c.Request.Context(), query, args...)
 	if err != nil {
@@ -254,15 +289,26 @@ func (h *Handler) GetDemandRequests(c *gin.Context) {
 		var d DemandRequest
 		var neededBy *time.Time
 		var created time.Time
-		err := rows.Scan(&d.ID, &d.BuyerID, &d.BuyerName, &d.BuyerPhone, &d.CropTypeID, &d.CropName,
-			&d.QuantityKG, &d.MaxPricePerKG, &neededBy, &d.Region, &d.Description, &created)
+		var snippet *string
+		err := rows.Scan(&d.ID, &d.BuyerID, &d.BuyerName, &d.CropTypeID, &d.CropName,
+			&d.QuantityKG, &d.MaxPricePerKG, &d.Currency, &neededBy, &d.Region, &d.Description, &created,
+			&d.Status, &d.FulfilledKG, &d.BuyerBadges, &d.Relevance, &snippet)
 		if err != nil {
 			continue
 		}
+		d.RemainingKG = demand.Remaining(d.QuantityKG, d.FulfilledKG)
+		if snippet != nil {
+			d.Snippet = *snippet
+		}
 		if neededBy != nil {
 			d.NeededBy = neededBy.Format("2006-01-02")
 		}
 		d.CreatedAt = created.Format("2006-01-02 15:04")
+		if target != "" && target != d.Currency {
+			if converted, ok := rates.Convert(d.MaxPricePerKG, d.Currency, target); ok {
+				d.MaxPricePerKG, d.Currency = converted, target
+			}
+		}
 		requests = append(requests, d)
 	}
 
@@ -298,9 +344,14 @@ func (h *Handler) DeleteDemandRequest(c *gin.Context) {
 		return
 	}
 
-	// Soft delete by setting is_active to false
-	tag, err := h.DB.Exec(c.Request.Context(),
-		"UPDATE demand_requests SET is_active = FALSE WHERE id = $1", demandID)
+	// Soft delete by setting is_active to false; an open request is closed as withdrawn
+	tag, err := h.DB.Exec(c.Request.Context(), `
+		UPDATE demand_requests
+		SET is_active = FALSE, updated_at = NOW(),
+		    status = CASE WHEN status = 'open' THEN 'closed' ELSE status END,
+		    closed_at = COALESCE(closed_at, NOW())
+		WHERE id = $1
+	`, demandID)
 
 	if err != nil {
 		fmt.Printf("Error updating demand request %s: %v\n", demandID, err)
@@ -313,6 +364,11 @@ func (h *Handler) DeleteDemandRequest(c *gin.Context) {
 		return
 	}
 
+	if id, err := strconv.Atoi(demandID); err == nil {
+		h.lapseDemandResponses(c.Request.Context(), id)
+		h.matchDemand(c.Request.Context(), id)
+	}
+
 	fmt.Printf("Successfully deleted demand request %s\n", demandID)
 	c.JSON(http.StatusOK, gin.H{"message": "Demand request deleted successfully"})
 }
@@ -354,40 +410,13 @@ func (h *Handler) GetFarmerAnalytics(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
-// Multi-photo upload helper for CreateListing update
-func (h *Handler) HandleMultipleUploads(c *gin.Context, listingID int) []string {
-	form, err := c.MultipartForm()
-	if err != nil {
-		return nil
-	}
-	files := form.File["images"]
-	var paths []string
-
-	uploadDir := "./uploads/marketplace"
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		os.MkdirAll(uploadDir, 0755)
-	}
-
-	for _, file := range files {
-		filename := fmt.Sprintf("%d_%d_%s", listingID, time.Now().UnixNano(), filepath.Base(file.Filename))
-		dst := filepath.Join(uploadDir, filename)
-		if err := c.SaveUploadedFile(file, dst); err == nil {
-			path := "/uploads/marketplace/" + filename
-			paths = append(paths, path)
-			// Save to DB
-			h.DB.Exec(c.Request.Context(), "INSERT INTO listing_images (listing_id, image_url) VALUES ($1, $2)", listingID, path)
-		}
-	}
-	return paths
-}
-
 func (h *Handler) GetFarmerAverageRating(farmerID interface{}) (float64, int) {
 	var avg float64
 	var count int
 	h.DB.QueryRow(context.Background(), `
 		SELECT COALESCE(AVG(rating), 0), COUNT(*)
-		FROM seller_reviews
-		WHERE farmer_id = $1
+		FROM seller_reviews r
+		WHERE r.farmer_id = $1 AND `+eligibleReviewFilter+`
 	`, farmerID).Scan(&avg, &count)
 	return avg, count
 }
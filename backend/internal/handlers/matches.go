@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"farmlite/internal/matching"
+	"farmlite/internal/regions"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// How many new matches per refresh are announced to each side
+const matchNotifyTopN = 3
+
+// Suggested matches returned per listing or demand
+const suggestedMatchLimit = 20
+
+// SuggestedDemand is a demand request matched to a listing.
+type SuggestedDemand struct {
+	matching.Match
+	BuyerID       int     `json:"buyer_id"`
+	BuyerName     string  `json:"buyer_name"`
+	CropName      string  `json:"crop_name"`
+	QuantityKG    float64 `json:"quantity_kg"`
+	MaxPricePerKG float64 `json:"max_price_per_kg"`
+	Currency      string  `json:"currency"`
+	NeededBy      string  `json:"needed_by,omitempty"` // YYYY-MM-DD
+	Region        string  `json:"region"`
+}
+
+// SuggestedListing is a listing matched to a demand request.
+type SuggestedListing struct {
+	matching.Match
+	FarmerID         int       `json:"farmer_id"`
+	FarmerName       string    `json:"farmer_name"`
+	CropName         string    `json:"crop_name"`
+	AvailableKG      float64   `json:"available_kg"`
+	PricePerKG       float64   `json:"price_per_kg"`
+	Currency         string    `json:"currency"`
+	HarvestReadyDate string    `json:"harvest_ready_date,omitempty"` // YYYY-MM-DD
+	Region           string    `json:"region"`
+	ImageURL         string    `json:"image_url,omitempty"`
+	ImageVariants    *ImageSet `json:"image_variants,omitempty"` // sizes of ImageURL
+}
+
+// GetListingMatches suggests demand requests a listing could fill, best first.
+// GET /api/marketplace/:id/matches
+func (h *Handler) GetListingMatches(c *gin.Context) {
+	listingID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing id"})
+		return
+	}
+	rows, err := h.DB.Query(c.Request.Context(), `
+		SELECT dm.demand_id, dm.listing_id, dm.score::float8, dm.quantity_score, dm.price_score, dm.date_score, dm.distance_score, dm.distance_km::float8,
+		       d.buyer_id, u.full_name, c.name, d.quantity_kg, COALESCE(d.max_price_per_kg, 0), d.currency, d.needed_by, COALESCE(NULLIF(d.region, ''), u.region, '')
+		FROM demand_matches dm
+		JOIN demand_requests d ON d.id = dm.demand_id
+		JOIN users u ON u.id = d.buyer_id
+		JOIN crop_types c ON c.id = d.crop_type_id
+		WHERE dm.listing_id = $1 AND `+openDemandFilter+`
+		ORDER BY dm.score DESC, dm.demand_id
+		LIMIT $2
+	`, listingID, suggestedMatchLimit)
+	if err != nil {
+		log.Printf("GetListingMatches: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch matches"})
+		return
+	}
+	defer rows.Close()
+
+	matches := []SuggestedDemand{}
+	for rows.Next() {
+		var s SuggestedDemand
+		var neededBy *time.Time
+		err := rows.Scan(&s.DemandID, &s.ListingID, &s.Score, &s.Quantity, &s.Price, &s.Date, &s.Distance, &s.DistanceKm,
+			&s.BuyerID, &s.BuyerName, &s.CropName, &s.QuantityKG, &s.MaxPricePerKG, &s.Currency, &neededBy, &s.Region)
+		if err != nil {
+			log.Printf("GetListingMatches: Scan error: %v\n", err)
+			continue
+		}
+		if neededBy != nil {
+			s.NeededBy = neededBy.Format("2006-01-02")
+		}
+		matches = append(matches, s)
+	}
+	c.JSON(http.StatusOK, matches)
+}
+
+// GetDemandMatches suggests listings that could fill a demand request, best first.
+// GET /api/demands/:id/matches
+func (h *Handler) GetDemandMatches(c *gin.Context) {
+	demandID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid demand id"})
+		return
+	}
+	rows, err := h.DB.Query(c.Request.Context(), `
+		SELECT dm.demand_id, dm.listing_id, dm.score::float8, dm.quantity_score, dm.price_score, dm.date_score, dm.distance_score, dm.distance_km::float8,
+		       m.farmer_id, u.full_name, c.name, GREATEST(m.quantity_kg - m.reserved_kg, 0)::float8, m.price_per_kg, m.currency,
+		       m.harvest_ready_date, COALESCE(u.region, ''), COALESCE(m.image_url, '')
+		FROM demand_matches dm
+		JOIN marketplace_listings m ON m.id = dm.listing_id
+		JOIN users u ON u.id = m.farmer_id
+		JOIN crop_types c ON c.id = m.crop_type_id
+		WHERE dm.demand_id = $1 AND `+openListingFilter+`
+		ORDER BY dm.score DESC, dm.listing_id
+		LIMIT $2
+	`, demandID, suggestedMatchLimit)
+	if err != nil {
+		log.Printf("GetDemandMatches: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch matches"})
+		return
+	}
+	defer rows.Close()
+
+	matches := []SuggestedListing{}
+	for rows.Next() {
+		var s SuggestedListing
+		var harvest *time.Time
+		err := rows.Scan(&s.DemandID, &s.ListingID, &s.Score, &s.Quantity, &s.Price, &s.Date, &s.Distance, &s.DistanceKm,
+			&s.FarmerID, &s.FarmerName, &s.CropName, &s.AvailableKG, &s.PricePerKG, &s.Currency, &harvest, &s.Region, &s.ImageURL)
+		if err != nil {
+			log.Printf("GetDemandMatches: Scan error: %v\n", err)
+			continue
+		}
+		if harvest != nil {
+			s.HarvestReadyDate = harvest.Format("2006-01-02")
+		}
+		if s.ImageURL != "" {
+			set := imageVariants(s.ImageURL)
+			s.ImageVariants = &set
+		}
+		matches = append(matches, s)
+	}
+	c.JSON(http.StatusOK, matches)
+}
+
+// Open listings and demands, as seen by buyers
+const (
+	openListingFilter = "m.is_active = TRUE AND m.status = 'active' AND (m.expires_at IS NULL OR m.expires_at > NOW())"
+	openDemandFilter  = "d.is_active = TRUE AND d.status = 'open' AND (d.needed_by IS NULL OR d.needed_by >= CURRENT_DATE)"
+)
+
+// Prices in soum so listings and demands in different currencies compare. A price
+// with no exchange rate to soum comes back NULL rather than unconverted.
+const (
+	matchListingSelect = `
+		SELECT m.id, m.farmer_id, m.crop_type_id, GREATEST(m.quantity_kg - m.reserved_kg, 0)::float8,
+		       (m.price_per_kg * fx_rate(m.currency, 'UZS'))::float8, m.harvest_ready_date,
+		       m.latitude::float8, m.longitude::float8, COALESCE(u.region, '')
+		FROM marketplace_listings m
+		JOIN users u ON u.id = m.farmer_id`
+	matchDemandSelect = `
+		SELECT d.id, d.buyer_id, d.crop_type_id, GREATEST(d.quantity_kg - d.fulfilled_kg, 0)::float8,
+		       (CASE WHEN d.max_price_per_kg IS NULL THEN 0 ELSE d.max_price_per_kg * fx_rate(d.currency, 'UZS') END)::float8, d.needed_by,
+		       COALESCE(NULLIF(d.region, ''), u.region, '')
+		FROM demand_requests d
+		JOIN users u ON u.id = d.buyer_id`
+)
+
+// matchListing refreshes a listing's matches, logging rather than failing the
+// request that changed it.
+func (h *Handler) matchListing(ctx context.Context, listingID int) {
+	if err := h.RefreshListingMatches(ctx, listingID); err != nil {
+		log.Printf("Match refresh error (listing %d): %v\n", listingID, err)
+	}
+}
+
+// matchDemand refreshes a demand request's matches, logging any error.
+func (h *Handler) matchDemand(ctx context.Context, demandID int) {
+	if err := h.RefreshDemandMatches(ctx, demandID); err != nil {
+		log.Printf("Match refresh error (demand %d): %v\n", demandID, err)
+	}
+}
+
+// RefreshListingMatches rescores a listing against every open demand for its crop,
+// replaces its stored matches and announces the best new ones.
+func (h *Handler) RefreshListingMatches(ctx context.Context, listingID int) error {
+	l, err := scanMatchListing(h.DB.QueryRow(ctx, matchListingSelect+" WHERE m.id = $1 AND "+openListingFilter, listingID))
+	if err == pgx.ErrNoRows {
+		// No longer open: it matches nothing
+		_, err = h.DB.Exec(ctx, "DELETE FROM demand_matches WHERE listing_id = $1", listingID)
+		return err
+	} else if err != nil {
+		return fmt.Errorf("load listing: %w", err)
+	}
+
+	rows, err := h.DB.Query(ctx, matchDemandSelect+" WHERE d.crop_type_id = $1 AND "+openDemandFilter, l.CropTypeID)
+	if err != nil {
+		return fmt.Errorf("load demands: %w", err)
+	}
+	var matches []matching.Match
+	for rows.Next() {
+		d, err := scanMatchDemand(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if m, ok := matching.Score(d, l); ok {
+			matches = append(matches, m)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return h.saveMatches(ctx, "listing_id", listingID, matches)
+}
+
+// RefreshDemandMatches rescores a demand request against every open listing for its
+// crop, replaces its stored matches and announces the best new ones.
+func (h *Handler) RefreshDemandMatches(ctx context.Context, demandID int) error {
+	d, err := scanMatchDemand(h.DB.QueryRow(ctx, matchDemandSelect+" WHERE d.id = $1 AND "+openDemandFilter, demandID))
+	if err == pgx.ErrNoRows {
+		_, err = h.DB.Exec(ctx, "DELETE FROM demand_matches WHERE demand_id = $1", demandID)
+		return err
+	} else if err != nil {
+		return fmt.Errorf("load demand: %w", err)
+	}
+
+	rows, err := h.DB.Query(ctx, matchListingSelect+" WHERE m.crop_type_id = $1 AND "+openListingFilter, d.CropTypeID)
+	if err != nil {
+		return fmt.Errorf("load listings: %w", err)
+	}
+	var matches []matching.Match
+	for rows.Next() {
+		l, err := scanMatchListing(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if m, ok := matching.Score(d, l); ok {
+			matches = append(matches, m)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return h.saveMatches(ctx, "demand_id", demandID, matches)
+}
+
+// saveMatches replaces the stored matches for one listing or demand (side is its
+// column) and notifies both parties of the top new ones.
+func (h *Handler) saveMatches(ctx context.Context, side string, id int, matches []matching.Match) error {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	kept := make([]int, 0, len(matches))
+	for _, m := range matches {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO demand_matches (demand_id, listing_id, score, quantity_score, price_score, date_score, distance_score, distance_km)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (demand_id, listing_id) DO UPDATE SET
+				score = EXCLUDED.score, quantity_score = EXCLUDED.quantity_score, price_score = EXCLUDED.price_score,
+				date_score = EXCLUDED.date_score, distance_score = EXCLUDED.distance_score, distance_km = EXCLUDED.distance_km,
+				updated_at = NOW()
+		`, m.DemandID, m.ListingID, m.Score, m.Quantity, m.Price, m.Date, m.Distance, m.DistanceKm)
+		if err != nil {
+			return fmt.Errorf("save match: %w", err)
+		}
+		if side == "listing_id" {
+			kept = append(kept, m.DemandID)
+		} else {
+			kept = append(kept, m.ListingID)
+		}
+	}
+	other := "demand_id"
+	if side == "demand_id" {
+		other = "listing_id"
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM demand_matches WHERE "+side+" = $1 AND NOT ("+other+" = ANY($2))", id, kept)
+	if err != nil {
+		return fmt.Errorf("prune matches: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	return h.announceMatches(ctx, side, id)
+}
+
+// announceMatches notifies the buyer and farmer of the best matches on one side that
+// nobody has been told about yet.
+func (h *Handler) announceMatches(ctx context.Context, side string, id int) error {
+	rows, err := h.DB.Query(ctx, `
+		UPDATE demand_matches dm SET notified_at = NOW()
+		FROM (
+			SELECT demand_id, listing_id FROM demand_matches
+			WHERE `+side+` = $1 AND notified_at IS NULL
+			ORDER BY score DESC
+			LIMIT $2
+			FOR UPDATE
+		) top, demand_requests d, marketplace_listings m, crop_types c
+		WHERE dm.demand_id = top.demand_id AND dm.listing_id = top.listing_id
+		  AND d.id = dm.demand_id AND m.id = dm.listing_id AND c.id = m.crop_type_id
+		RETURNING dm.demand_id, dm.listing_id, dm.score::float8, d.buyer_id, m.farmer_id, c.name
+	`, id, matchNotifyTopN)
+	if err != nil {
+		return fmt.Errorf("announce matches: %w", err)
+	}
+	type announcement struct {
+		DemandID, ListingID, BuyerID, FarmerID int
+		Score                                  float64
+		Crop                                   string
+	}
+	var news []announcement
+	for rows.Next() {
+		var a announcement
+		if err := rows.Scan(&a.DemandID, &a.ListingID, &a.Score, &a.BuyerID, &a.FarmerID, &a.Crop); err != nil {
+			rows.Close()
+			return err
+		}
+		news = append(news, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, a := range news {
+		data := gin.H{"demand_id": a.DemandID, "listing_id": a.ListingID, "score": a.Score}
+		key := fmt.Sprintf("match:%d:%d", a.DemandID, a.ListingID)
+		body := fmt.Sprintf("%.0f%% match", a.Score)
+		if _, err := h.notify(ctx, a.BuyerID, "match", "A "+a.Crop+" listing matches your request", body, data, key); err != nil {
+			log.Printf("Match notification error (buyer %d): %v\n", a.BuyerID, err)
+		}
+		if _, err := h.notify(ctx, a.FarmerID, "match", "A buyer is looking for "+a.Crop, body, data, key); err != nil {
+			log.Printf("Match notification error (farmer %d): %v\n", a.FarmerID, err)
+		}
+	}
+	return nil
+}
+
+func scanMatchListing(row pgx.Row) (matching.Listing, error) {
+	var l matching.Listing
+	var price, lat, lng *float64
+	var region string
+	err := row.Scan(&l.ID, &l.FarmerID, &l.CropTypeID, &l.AvailableKG, &price, &l.HarvestReady, &lat, &lng, &region)
+	if price != nil {
+		l.PricePerKG = *price
+	} else {
+		l.PriceUnknown = true
+	}
+	if lat != nil && lng != nil && !(*lat == 0 && *lng == 0) {
+		l.Location = &matching.Point{Lat: *lat, Lng: *lng}
+	} else {
+		l.Location = regionCentre(region)
+	}
+	return l, err
+}
+
+func scanMatchDemand(row pgx.Row) (matching.Demand, error) {
+	var d matching.Demand
+	var maxPrice *float64
+	var region string
+	err := row.Scan(&d.ID, &d.BuyerID, &d.CropTypeID, &d.QuantityKG, &maxPrice, &d.NeededBy, &region)
+	if maxPrice != nil {
+		d.MaxPricePerKG = *maxPrice
+	} else {
+		d.PriceUnknown = true
+	}
+	d.Location = regionCentre(region)
+	return d, err
+}
+
+// regionCentre locates a region by its administrative centre, or nil if unknown.
+func regionCentre(region string) *matching.Point {
+	canonical, ok := regions.Canonical(region)
+	if !ok {
+		return nil
+	}
+	lat, lng, ok := regions.Centre(canonical)
+	if !ok {
+		return nil
+	}
+	return &matching.Point{Lat: lat, Lng: lng}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// How long a push to one socket may take before the socket is dropped
+const messageWriteTimeout = 10 * time.Second
+
+// Origins allowed to open a message socket unless MESSAGE_SOCKET_ORIGINS is set
+var defaultSocketOrigins = []string{"http://localhost:3000", "http://localhost:8080"}
+
+// MessageEvent is pushed to a user's open sockets when something happens in one of
+// their conversations.
+type MessageEvent struct {
+	Type           string     `json:"type"` // message, read or phone_shared
+	ConversationID int        `json:"conversation_id"`
+	Message        *Message   `json:"message,omitempty"`
+	ReaderID       int        `json:"reader_id,omitempty"`     // read: who read
+	ReadUpToID     int        `json:"read_up_to_id,omitempty"` // read: last message now read
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+}
+
+// messageHub tracks each user's open message sockets. Users with none fall back to
+// polling the conversation endpoints.
+type messageHub struct {
+	mu    sync.Mutex
+	conns map[int]map[*websocket.Conn]bool
+}
+
+func newMessageHub() *messageHub {
+	return &messageHub{conns: make(map[int]map[*websocket.Conn]bool)}
+}
+
+func (hub *messageHub) add(userID int, ws *websocket.Conn) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.conns[userID] == nil {
+		hub.conns[userID] = make(map[*websocket.Conn]bool)
+	}
+	hub.conns[userID][ws] = true
+}
+
+func (hub *messageHub) remove(userID int, ws *websocket.Conn) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	delete(hub.conns[userID], ws)
+	if len(hub.conns[userID]) == 0 {
+		delete(hub.conns, userID)
+	}
+}
+
+// publish sends event to every socket the user has open, dropping any that fail.
+func (hub *messageHub) publish(userID int, event MessageEvent) {
+	hub.mu.Lock()
+	conns := make([]*websocket.Conn, 0, len(hub.conns[userID]))
+	for ws := range hub.conns[userID] {
+		conns = append(conns, ws)
+	}
+	hub.mu.Unlock()
+
+	for _, ws := range conns {
+		ws.SetWriteDeadline(time.Now().Add(messageWriteTimeout))
+		if err := websocket.JSON.Send(ws, event); err != nil {
+			hub.remove(userID, ws)
+			ws.Close()
+		}
+	}
+}
+
+// online reports whether the user has a socket open.
+func (hub *messageHub) online(userID int) bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return len(hub.conns[userID]) > 0
+}
+
+// MessageSocket upgrades to a WebSocket that receives the user's MessageEvents as
+// JSON. Anything the client sends is ignored; it only keeps the socket alive.
+// Clients that can't hold a socket poll GET /api/conversations and
+// GET /api/conversations/:id/messages?after_id= instead.
+// GET /api/messages/ws?user_id=
+func (h *Handler) MessageSocket(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	websocket.Server{Handshake: checkSocketOrigin, Handler: func(ws *websocket.Conn) {
+		h.messages.add(userID, ws)
+		defer func() {
+			h.messages.remove(userID, ws)
+			ws.Close()
+		}()
+		var discard []byte
+		for {
+			if err := websocket.Message.Receive(ws, &discard); err != nil {
+				return
+			}
+		}
+	}}.ServeHTTP(c.Writer, c.Request)
+}
+
+// checkSocketOrigin refuses sockets opened from pages on other sites, which would
+// otherwise read a user's messages with nothing but their user_id. Requests without
+// an Origin don't come from a browser and are let through, as are pages served by
+// this host (the mobile app also sends the API's own host).
+func checkSocketOrigin(config *websocket.Config, req *http.Request) error {
+	origin, err := websocket.Origin(config, req)
+	if err != nil {
+		return err
+	}
+	if origin == nil {
+		return nil
+	}
+	config.Origin = origin
+	if strings.EqualFold(origin.Host, req.Host) {
+		return nil
+	}
+	allowed := defaultSocketOrigins
+	if v := os.Getenv("MESSAGE_SOCKET_ORIGINS"); v != "" {
+		allowed = strings.Split(v, ",")
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(strings.TrimRight(strings.TrimSpace(a), "/"), origin.Scheme+"://"+origin.Host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
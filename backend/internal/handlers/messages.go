@@ -0,0 +1,674 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Message limits
+const (
+	maxMessageLength    = 4000
+	defaultMessageLimit = 50
+	maxMessageLimit     = 200
+)
+
+// ErrBlocked means one of the two users has blocked the other.
+var ErrBlocked = errors.New("messaging between these users is blocked")
+
+// conversationSubjects are what a conversation can be about
+var conversationSubjects = []string{"listing", "demand", "order"}
+
+type Conversation struct {
+	ID                 int        `json:"id"`
+	SubjectType        string     `json:"subject_type"` // listing, demand or order
+	SubjectID          int        `json:"subject_id"`
+	SubjectTitle       string     `json:"subject_title"` // crop name
+	OtherUserID        int        `json:"other_user_id"`
+	OtherUserName      string     `json:"other_user_name"`
+	OtherPhone         string     `json:"other_phone,omitempty"` // once both sides agreed to share
+	PhoneSharedByMe    bool       `json:"phone_shared_by_me"`
+	PhoneSharedByOther bool       `json:"phone_shared_by_other"`
+	Blocked            bool       `json:"blocked"` // either side blocked the other
+	UnreadCount        int        `json:"unread_count"`
+	LastMessage        *Message   `json:"last_message,omitempty"`
+	LastMessageAt      *time.Time `json:"last_message_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+type Message struct {
+	ID             int        `json:"id"`
+	ConversationID int        `json:"conversation_id"`
+	SenderID       *int       `json:"sender_id"`
+	Body           string     `json:"body,omitempty"`
+	ImageURL       string     `json:"image_url,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at,omitempty"` // read receipt
+}
+
+type StartConversationRequest struct {
+	UserID      int    `json:"user_id" binding:"required"`
+	SubjectType string `json:"subject_type" binding:"required"`
+	SubjectID   int    `json:"subject_id" binding:"required"`
+	Body        string `json:"body"` // optional first message
+}
+
+// SendMessageRequest is sent as JSON, or as a multipart form with an "image" file.
+type SendMessageRequest struct {
+	UserID int    `json:"user_id" form:"user_id" binding:"required"`
+	Body   string `json:"body" form:"body"`
+}
+
+type BlockUserRequest struct {
+	UserID        int `json:"user_id" binding:"required"`
+	BlockedUserID int `json:"blocked_user_id" binding:"required"`
+}
+
+// StartConversation opens, or returns the existing, conversation between the caller
+// and the other side of a listing, demand request or order.
+// POST /api/conversations
+func (h *Handler) StartConversation(c *gin.Context) {
+	var req StartConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if len([]rune(body)) > maxMessageLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Messages can be at most %d characters", maxMessageLength)})
+		return
+	}
+	ctx := c.Request.Context()
+
+	otherID, err := h.conversationCounterpart(ctx, req.SubjectType, req.SubjectID, req.UserID)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Nothing to talk about: " + req.SubjectType + " not found"})
+		return
+	} else if errors.Is(err, ErrOrderForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if blocked, err := h.isBlocked(ctx, req.UserID, otherID); err != nil {
+		log.Printf("StartConversation: Block check error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start conversation"})
+		return
+	} else if blocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrBlocked.Error()})
+		return
+	}
+
+	userA, userB := min(req.UserID, otherID), max(req.UserID, otherID)
+	var conversationID int
+	var created bool
+	err = h.DB.QueryRow(ctx, `
+		INSERT INTO conversations (subject_type, subject_id, user_a, user_b)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (subject_type, subject_id, user_a, user_b) DO UPDATE SET subject_type = EXCLUDED.subject_type
+		RETURNING id, xmax = 0
+	`, req.SubjectType, req.SubjectID, userA, userB).Scan(&conversationID, &created)
+	if err != nil {
+		log.Printf("StartConversation: Insert error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start conversation"})
+		return
+	}
+	// A buyer starting a conversation on a listing counts as a contact
+	if created && req.SubjectType == "listing" {
+		h.DB.Exec(ctx, "UPDATE marketplace_listings SET contact_count = contact_count + 1 WHERE id = $1", req.SubjectID)
+	}
+
+	resp := gin.H{"conversation_id": conversationID, "created": created}
+	if body != "" {
+		m, err := h.sendMessage(ctx, conversationID, req.UserID, otherID, body, "")
+		if err != nil {
+			log.Printf("StartConversation: Message error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Conversation started but the message failed to send", "conversation_id": conversationID})
+			return
+		}
+		resp["message"] = m
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, resp)
+}
+
+// GetConversations lists a user's conversations, most recently active first, with
+// unread counts. Poll it when no message socket is open.
+// GET /api/conversations?user_id=
+func (h *Handler) GetConversations(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	rows, err := h.DB.Query(c.Request.Context(), conversationSelect+`
+		WHERE cv.user_a = $1 OR cv.user_b = $1
+		ORDER BY COALESCE(cv.last_message_at, cv.created_at) DESC
+		LIMIT 200
+	`, userID)
+	if err != nil {
+		log.Printf("GetConversations: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+		return
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	for rows.Next() {
+		cv, err := scanConversation(rows)
+		if err != nil {
+			log.Printf("GetConversations: Scan error: %v\n", err)
+			continue
+		}
+		conversations = append(conversations, cv)
+	}
+	c.JSON(http.StatusOK, conversations)
+}
+
+// GetMessages returns messages in a conversation, oldest first. after_id returns only
+// newer messages (for polling); before_id pages back through history.
+// GET /api/conversations/:id/messages?user_id=&after_id=&before_id=&limit=50
+func (h *Handler) GetMessages(c *gin.Context) {
+	conversationID, userID, ok := conversationParams(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+	limit := defaultMessageLimit
+	if v := c.Query("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= maxMessageLimit {
+			limit = n
+		}
+	}
+	ctx := c.Request.Context()
+	if _, err := h.loadConversation(ctx, conversationID, userID); err != nil {
+		conversationError(c, err, "GetMessages")
+		return
+	}
+
+	var rows pgx.Rows
+	var err error
+	if afterID, convErr := strconv.Atoi(c.Query("after_id")); convErr == nil {
+		rows, err = h.DB.Query(ctx, messageSelect+`
+			WHERE conversation_id = $1 AND id > $2
+			ORDER BY id
+			LIMIT $3
+		`, conversationID, afterID, limit)
+	} else {
+		beforeID := math.MaxInt32
+		if v, convErr := strconv.Atoi(c.Query("before_id")); convErr == nil {
+			beforeID = v
+		}
+		rows, err = h.DB.Query(ctx, `SELECT * FROM (`+messageSelect+`
+			WHERE conversation_id = $1 AND id < $2
+			ORDER BY id DESC
+			LIMIT $3
+		) latest ORDER BY id`, conversationID, beforeID, limit)
+	}
+	if err != nil {
+		log.Printf("GetMessages: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+		return
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			log.Printf("GetMessages: Scan error: %v\n", err)
+			continue
+		}
+		messages = append(messages, m)
+	}
+	c.JSON(http.StatusOK, messages)
+}
+
+// SendMessage posts a text and/or image message to a conversation and pushes it to
+// the recipient's open sockets.
+// POST /api/conversations/:id/messages
+func (h *Handler) SendMessage(c *gin.Context) {
+	var req SendMessageRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	conversationID, userID, ok := conversationParams(c, strconv.Itoa(req.UserID))
+	if !ok {
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if len([]rune(body)) > maxMessageLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Messages can be at most %d characters", maxMessageLength)})
+		return
+	}
+	ctx := c.Request.Context()
+
+	cv, err := h.loadConversation(ctx, conversationID, userID)
+	if err != nil {
+		conversationError(c, err, "SendMessage")
+		return
+	}
+	if cv.Blocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrBlocked.Error()})
+		return
+	}
+
+	imageURL, err := saveUpload(c, "image", "messages")
+	if err != nil {
+		uploadError(c, err, "SendMessage")
+		return
+	}
+	if body == "" && imageURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A message needs text or an image"})
+		return
+	}
+
+	m, err := h.sendMessage(ctx, conversationID, userID, cv.OtherUserID, body, imageURL)
+	if err != nil {
+		removeImages(imageURL)
+		log.Printf("SendMessage: Insert error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		return
+	}
+	c.JSON(http.StatusCreated, m)
+}
+
+// MarkConversationRead marks every message the caller has received in a conversation
+// as read and sends the sender a read receipt.
+// POST /api/conversations/:id/read
+func (h *Handler) MarkConversationRead(c *gin.Context) {
+	var req struct {
+		UserID int `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	conversationID, userID, ok := conversationParams(c, strconv.Itoa(req.UserID))
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	cv, err := h.loadConversation(ctx, conversationID, userID)
+	if err != nil {
+		conversationError(c, err, "MarkConversationRead")
+		return
+	}
+
+	var count int
+	var lastID *int
+	var readAt time.Time
+	err = h.DB.QueryRow(ctx, `
+		WITH read AS (
+			UPDATE messages SET read_at = NOW()
+			WHERE conversation_id = $1 AND sender_id IS DISTINCT FROM $2 AND read_at IS NULL
+			RETURNING id
+		)
+		SELECT COUNT(*), MAX(id), NOW() FROM read
+	`, conversationID, userID).Scan(&count, &lastID, &readAt)
+	if err != nil {
+		log.Printf("MarkConversationRead: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark messages read"})
+		return
+	}
+
+	if lastID != nil {
+		h.messages.publish(cv.OtherUserID, MessageEvent{
+			Type: "read", ConversationID: conversationID, ReaderID: userID, ReadUpToID: *lastID, ReadAt: &readAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"marked_read": count})
+}
+
+// GetUnreadMessageCount returns how many received messages the user hasn't read.
+// GET /api/messages/unread?user_id=
+func (h *Handler) GetUnreadMessageCount(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+	var count int
+	err = h.DB.QueryRow(c.Request.Context(), `
+		SELECT COUNT(*)
+		FROM messages m
+		JOIN conversations cv ON cv.id = m.conversation_id
+		WHERE (cv.user_a = $1 OR cv.user_b = $1) AND m.sender_id IS DISTINCT FROM $1 AND m.read_at IS NULL
+	`, userID).Scan(&count)
+	if err != nil {
+		log.Printf("GetUnreadMessageCount: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count messages"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+// SharePhone records the caller's consent to share their phone number in a
+// conversation. Numbers are revealed to both sides once both have agreed.
+// POST /api/conversations/:id/share-phone
+func (h *Handler) SharePhone(c *gin.Context) {
+	var req struct {
+		UserID int `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	conversationID, userID, ok := conversationParams(c, strconv.Itoa(req.UserID))
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	cv, err := h.loadConversation(ctx, conversationID, userID)
+	if err != nil {
+		conversationError(c, err, "SharePhone")
+		return
+	}
+	if cv.Blocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrBlocked.Error()})
+		return
+	}
+
+	_, err = h.DB.Exec(ctx, `
+		UPDATE conversations
+		SET a_shared_phone_at = CASE WHEN user_a = $2 THEN COALESCE(a_shared_phone_at, NOW()) ELSE a_shared_phone_at END,
+		    b_shared_phone_at = CASE WHEN user_b = $2 THEN COALESCE(b_shared_phone_at, NOW()) ELSE b_shared_phone_at END
+		WHERE id = $1
+	`, conversationID, userID)
+	if err != nil {
+		log.Printf("SharePhone: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share phone number"})
+		return
+	}
+	if cv, err = h.loadConversation(ctx, conversationID, userID); err != nil {
+		conversationError(c, err, "SharePhone")
+		return
+	}
+
+	h.messages.publish(cv.OtherUserID, MessageEvent{Type: "phone_shared", ConversationID: conversationID})
+	message := "Phone numbers shared"
+	if !cv.PhoneSharedByOther {
+		message = "Your number will be shared once the other side agrees too"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "conversation": cv})
+}
+
+// BlockUser stops all messages between the caller and another user.
+// POST /api/blocks
+func (h *Handler) BlockUser(c *gin.Context) {
+	var req BlockUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	if req.UserID == req.BlockedUserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't block yourself"})
+		return
+	}
+	_, err := h.DB.Exec(c.Request.Context(), `
+		INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, req.UserID, req.BlockedUserID)
+	if err != nil {
+		log.Printf("BlockUser: Insert error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked"})
+}
+
+// UnblockUser lifts the caller's block on another user.
+// DELETE /api/blocks/:id?user_id=
+func (h *Handler) UnblockUser(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+	_, err := h.DB.Exec(c.Request.Context(), "DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2", userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked"})
+}
+
+// GetBlockedUsers lists the users the caller has blocked.
+// GET /api/blocks?user_id=
+func (h *Handler) GetBlockedUsers(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+	rows, err := h.DB.Query(c.Request.Context(), `
+		SELECT b.blocked_id, u.full_name, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blocked users"})
+		return
+	}
+	defer rows.Close()
+
+	type blockedUser struct {
+		UserID    int       `json:"user_id"`
+		Name      string    `json:"name"`
+		BlockedAt time.Time `json:"blocked_at"`
+	}
+	blocked := []blockedUser{}
+	for rows.Next() {
+		var b blockedUser
+		if err := rows.Scan(&b.UserID, &b.Name, &b.BlockedAt); err == nil {
+			blocked = append(blocked, b)
+		}
+	}
+	c.JSON(http.StatusOK, blocked)
+}
+
+// sendMessage stores a message, pushes it to the recipient's sockets and, when they
+// have none open, leaves them a notification (one per conversation per day).
+func (h *Handler) sendMessage(ctx context.Context, conversationID, senderID, recipientID int, body, imageURL string) (Message, error) {
+	m := Message{ConversationID: conversationID, SenderID: &senderID, Body: body, ImageURL: imageURL}
+	err := h.DB.QueryRow(ctx, `
+		WITH sent AS (
+			INSERT INTO messages (conversation_id, sender_id, body, image_url)
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
+			RETURNING id, created_at
+		), touched AS (
+			UPDATE conversations SET last_message_at = (SELECT created_at FROM sent) WHERE id = $1
+		)
+		SELECT id, created_at FROM sent
+	`, conversationID, senderID, body, imageURL).Scan(&m.ID, &m.CreatedAt)
+	if err != nil {
+		return m, err
+	}
+
+	event := MessageEvent{Type: "message", ConversationID: conversationID, Message: &m}
+	h.messages.publish(recipientID, event)
+	h.messages.publish(senderID, event) // the sender's other devices
+
+	if !h.messages.online(recipientID) {
+		var sender string
+		h.DB.QueryRow(ctx, "SELECT full_name FROM users WHERE id = $1", senderID).Scan(&sender)
+		preview := body
+		if preview == "" {
+			preview = "Sent a photo"
+		} else if r := []rune(preview); len(r) > 100 {
+			preview = string(r[:100]) + "…"
+		}
+		key := fmt.Sprintf("message:%d:%s", conversationID, time.Now().Format("2006-01-02"))
+		data := gin.H{"conversation_id": conversationID}
+		if _, err := h.notify(ctx, recipientID, "message", "New message from "+sender, preview, data, key); err != nil {
+			log.Printf("Message notification error (conversation %d): %v\n", conversationID, err)
+		}
+	}
+	return m, nil
+}
+
+// conversationCounterpart returns who userID would be talking to about a subject:
+// the farmer of a listing, the buyer of a demand request, or the other side of an order.
+func (h *Handler) conversationCounterpart(ctx context.Context, subjectType string, subjectID, userID int) (int, error) {
+	var ownerID int
+	var err error
+	switch subjectType {
+	case "listing":
+		err = h.DB.QueryRow(ctx, "SELECT farmer_id FROM marketplace_listings WHERE id = $1 AND is_active = TRUE", subjectID).Scan(&ownerID)
+	case "demand":
+		err = h.DB.QueryRow(ctx, "SELECT buyer_id FROM demand_requests WHERE id = $1 AND is_active = TRUE", subjectID).Scan(&ownerID)
+	case "order":
+		var buyerID, farmerID int
+		err = h.DB.QueryRow(ctx, "SELECT buyer_id, farmer_id FROM orders WHERE id = $1", subjectID).Scan(&buyerID, &farmerID)
+		if err != nil {
+			return 0, err
+		}
+		switch userID {
+		case buyerID:
+			return farmerID, nil
+		case farmerID:
+			return buyerID, nil
+		}
+		return 0, ErrOrderForbidden
+	default:
+		return 0, fmt.Errorf("subject_type must be one of %s", strings.Join(conversationSubjects, ", "))
+	}
+	if err != nil {
+		return 0, err
+	}
+	if ownerID == userID {
+		return 0, fmt.Errorf("you can't start a conversation about your own %s", subjectType)
+	}
+	return ownerID, nil
+}
+
+// isBlocked reports whether either user has blocked the other.
+func (h *Handler) isBlocked(ctx context.Context, userID, otherID int) (bool, error) {
+	var blocked bool
+	err := h.DB.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`, userID, otherID).Scan(&blocked)
+	return blocked, err
+}
+
+// loadConversation loads a conversation as seen by userID, failing with
+// errNotInConversation when they aren't in it.
+func (h *Handler) loadConversation(ctx context.Context, conversationID, userID int) (Conversation, error) {
+	cv, err := scanConversation(h.DB.QueryRow(ctx, conversationSelect+" WHERE cv.id = $2", userID, conversationID))
+	if err != nil {
+		return cv, err
+	}
+	if cv.OtherUserID == 0 {
+		return cv, errNotInConversation
+	}
+	return cv, nil
+}
+
+var errNotInConversation = errors.New("not part of this conversation")
+
+// conversationError writes the response for a loadConversation error.
+func conversationError(c *gin.Context, err error, fn string) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+	case errors.Is(err, errNotInConversation):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: Load error: %v\n", fn, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load conversation"})
+	}
+}
+
+// conversationParams parses the :id param and a user id, writing a 400 if either is bad.
+func conversationParams(c *gin.Context, user string) (conversationID, userID int, ok bool) {
+	conversationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation id"})
+		return 0, 0, false
+	}
+	userID, err = strconv.Atoi(user)
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return 0, 0, false
+	}
+	return conversationID, userID, true
+}
+
+// conversationSelect loads conversations as seen by the user in $1: the other side,
+// their phone once both agreed, block state, unread count and the last message.
+// other_id is 0 when $1 isn't in the conversation.
+const conversationSelect = `
+	SELECT cv.id, cv.subject_type, cv.subject_id,
+	       COALESCE(CASE cv.subject_type
+	           WHEN 'listing' THEN (SELECT ct.name FROM marketplace_listings l JOIN crop_types ct ON ct.id = l.crop_type_id WHERE l.id = cv.subject_id)
+	           WHEN 'demand' THEN (SELECT ct.name FROM demand_requests d JOIN crop_types ct ON ct.id = d.crop_type_id WHERE d.id = cv.subject_id)
+	           WHEN 'order' THEN (SELECT ct.name FROM orders o JOIN marketplace_listings l ON l.id = o.listing_id JOIN crop_types ct ON ct.id = l.crop_type_id WHERE o.id = cv.subject_id)
+	       END, ''),
+	       CASE WHEN cv.user_a = $1 THEN cv.user_b WHEN cv.user_b = $1 THEN cv.user_a ELSE 0 END,
+	       COALESCE(other.full_name, ''),
+	       CASE WHEN cv.a_shared_phone_at IS NOT NULL AND cv.b_shared_phone_at IS NOT NULL THEN other.phone_number ELSE '' END,
+	       CASE WHEN cv.user_a = $1 THEN cv.a_shared_phone_at IS NOT NULL ELSE cv.b_shared_phone_at IS NOT NULL END,
+	       CASE WHEN cv.user_a = $1 THEN cv.b_shared_phone_at IS NOT NULL ELSE cv.a_shared_phone_at IS NOT NULL END,
+	       EXISTS (SELECT 1 FROM user_blocks b WHERE (b.blocker_id = cv.user_a AND b.blocked_id = cv.user_b) OR (b.blocker_id = cv.user_b AND b.blocked_id = cv.user_a)),
+	       (SELECT COUNT(*) FROM messages m WHERE m.conversation_id = cv.id AND m.sender_id IS DISTINCT FROM $1 AND m.read_at IS NULL),
+	       last.id, last.sender_id, COALESCE(last.body, ''), COALESCE(last.image_url, ''), last.created_at, last.read_at,
+	       cv.last_message_at, cv.created_at
+	FROM conversations cv
+	LEFT JOIN users other ON other.id = CASE WHEN cv.user_a = $1 THEN cv.user_b WHEN cv.user_b = $1 THEN cv.user_a END
+	LEFT JOIN LATERAL (
+		SELECT id, sender_id, body, image_url, created_at, read_at
+		FROM messages
+		WHERE conversation_id = cv.id
+		ORDER BY id DESC
+		LIMIT 1
+	) last ON TRUE`
+
+func scanConversation(row pgx.Row) (Conversation, error) {
+	var cv Conversation
+	var lastID *int
+	var lastSender *int
+	var lastBody, lastImage string
+	var lastCreated, lastRead *time.Time
+	err := row.Scan(&cv.ID, &cv.SubjectType, &cv.SubjectID, &cv.SubjectTitle, &cv.OtherUserID, &cv.OtherUserName,
+		&cv.OtherPhone, &cv.PhoneSharedByMe, &cv.PhoneSharedByOther, &cv.Blocked, &cv.UnreadCount,
+		&lastID, &lastSender, &lastBody, &lastImage, &lastCreated, &lastRead,
+		&cv.LastMessageAt, &cv.CreatedAt)
+	if err == nil && lastID != nil && lastCreated != nil {
+		cv.LastMessage = &Message{
+			ID: *lastID, ConversationID: cv.ID, SenderID: lastSender, Body: lastBody, ImageURL: lastImage,
+			CreatedAt: *lastCreated, ReadAt: lastRead,
+		}
+	}
+	return cv, err
+}
+
+const messageSelect = `
+	SELECT id, conversation_id, sender_id, COALESCE(body, ''), COALESCE(image_url, ''), created_at, read_at
+	FROM messages`
+
+func scanMessage(row pgx.Row) (Message, error) {
+	var m Message
+	err := row.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Body, &m.ImageURL, &m.CreatedAt, &m.ReadAt)
+	return m, err
+}
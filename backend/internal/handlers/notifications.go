@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Notification struct {
+	ID        int             `json:"id"`
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Body      *string         `json:"body"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	ReadAt    *time.Time      `json:"read_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// notify stores an in-app notification for a user. A non-empty dedupeKey makes the call
+// idempotent: a second notification with the same key for the same user is dropped.
+// It reports whether a new notification was created.
+func (h *Handler) notify(ctx context.Context, userID int, kind, title, body string, data interface{}, dedupeKey string) (bool, error) {
+	var dataJSON *string
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return false, err
+		}
+		s := string(b)
+		dataJSON = &s
+	}
+	var key *string
+	if dedupeKey != "" {
+		key = &dedupeKey
+	}
+
+	tag, err := h.DB.Exec(ctx, `
+		INSERT INTO notifications (user_id, type, title, body, data, dedupe_key)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5::jsonb, $6)
+		ON CONFLICT (user_id, dedupe_key) DO NOTHING
+	`, userID, kind, title, body, dataJSON, key)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetNotifications lists a user's notifications, newest first.
+// GET /api/notifications?user_id=&unread=true&limit=
+func (h *Handler) GetNotifications(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+	limit := 50
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+	unreadOnly := c.Query("unread") == "true"
+
+	ctx := c.Request.Context()
+	rows, err := h.DB.Query(ctx, `
+		SELECT id, type, title, body, data, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, userID, unreadOnly, limit)
+	if err != nil {
+		log.Printf("GetNotifications: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		var data []byte
+		if err := rows.Scan(&n.ID, &n.Type, &n.Title, &n.Body, &data, &n.ReadAt, &n.CreatedAt); err != nil {
+			log.Printf("GetNotifications: Scan error: %v\n", err)
+			continue
+		}
+		if data != nil {
+			n.Data = data
+		}
+		notifications = append(notifications, n)
+	}
+
+	var unread int
+	if err := h.DB.QueryRow(ctx, "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL", userID).Scan(&unread); err != nil {
+		log.Printf("GetNotifications: Count error: %v\n", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "unread_count": unread})
+}
+
+// MarkNotificationRead marks one notification as read.
+// POST /api/notifications/:id/read
+func (h *Handler) MarkNotificationRead(c *gin.Context) {
+	var req struct {
+		UserID int `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	tag, err := h.DB.Exec(c.Request.Context(),
+		"UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2",
+		c.Param("id"), req.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+// MarkAllNotificationsRead marks every unread notification of a user as read.
+// POST /api/notifications/read-all
+func (h *Handler) MarkAllNotificationsRead(c *gin.Context) {
+	var req struct {
+		UserID int `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	tag, err := h.DB.Exec(c.Request.Context(),
+		"UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL", req.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notifications marked as read", "updated": tag.RowsAffected()})
+}
@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"farmlite/internal/offer"
+	"farmlite/internal/order"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrOfferClosed means the offer was already answered or has expired.
+	ErrOfferClosed = errors.New("offer is no longer open")
+	// ErrOfferForbidden means the user can't make this response to the offer.
+	ErrOfferForbidden = errors.New("not allowed to respond to this offer")
+	// ErrOfferExpired means the offer's time ran out before the response. The
+	// caller still commits, so the offer stays marked expired.
+	ErrOfferExpired = fmt.Errorf("%w: it has expired", ErrOfferClosed)
+)
+
+type Offer struct {
+	ID          int        `json:"id"`
+	ListingID   int        `json:"listing_id"`
+	CropName    string     `json:"crop_name"`
+	BuyerID     int        `json:"buyer_id"`
+	BuyerName   string     `json:"buyer_name"`
+	FarmerID    int        `json:"farmer_id"`
+	FarmerName  string     `json:"farmer_name"`
+	ProposedBy  int        `json:"proposed_by"`
+	ParentID    *int       `json:"parent_id,omitempty"` // the offer this one counters
+	PricePerKG  float64    `json:"price_per_kg"`
+	QuantityKG  float64    `json:"quantity_kg"`
+	Currency    string     `json:"currency"`
+	ListedPrice float64    `json:"listed_price_per_kg"` // the listing's asking price now
+	Message     string     `json:"message,omitempty"`
+	Status      string     `json:"status"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+	OrderID     *int       `json:"order_id,omitempty"` // set once accepted
+	CreatedAt   time.Time  `json:"created_at"`
+	Actions     []string   `json:"actions,omitempty"` // responses open to the caller
+}
+
+type MakeOfferRequest struct {
+	BuyerID        int     `json:"buyer_id" binding:"required"`
+	ListingID      int     `json:"listing_id" binding:"required"`
+	PricePerKG     float64 `json:"price_per_kg" binding:"required"`
+	QuantityKG     float64 `json:"quantity_kg" binding:"required"`
+	Message        string  `json:"message"`
+	ExpiresInHours int     `json:"expires_in_hours"` // default 48, at most a week
+}
+
+type RespondOfferRequest struct {
+	UserID         int     `json:"user_id" binding:"required"`
+	Action         string  `json:"action" binding:"required"` // accept, reject, counter or withdraw
+	PricePerKG     float64 `json:"price_per_kg"`              // counter only
+	QuantityKG     float64 `json:"quantity_kg"`               // counter only; defaults to the offer's
+	Message        string  `json:"message"`
+	ExpiresInHours int     `json:"expires_in_hours"` // counter only
+}
+
+// MakeOffer opens a negotiation: a buyer proposes a price and quantity for a listing.
+// A buyer has at most one open offer per listing; answer or withdraw it first.
+// POST /api/offers
+func (h *Handler) MakeOffer(c *gin.Context) {
+	var req MakeOfferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	if req.PricePerKG <= 0 || req.QuantityKG <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price_per_kg and quantity_kg must be positive"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to make offer"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var farmerID int
+	var status, listingCurrency, crop string
+	var expiresAt *time.Time
+	var available float64
+	err = tx.QueryRow(ctx, `
+		SELECT m.farmer_id, m.status, m.expires_at, m.quantity_kg - m.reserved_kg, m.currency, c.name
+		FROM marketplace_listings m
+		JOIN crop_types c ON c.id = m.crop_type_id
+		WHERE m.id = $1 AND m.is_active = TRUE
+	`, req.ListingID).Scan(&farmerID, &status, &expiresAt, &available, &listingCurrency, &crop)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Listing not found"})
+		return
+	} else if err != nil {
+		log.Printf("MakeOffer: Listing error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to make offer"})
+		return
+	}
+	if farmerID == req.BuyerID {
+		c.JSON(http.StatusConflict, gin.H{"error": "You can't make an offer on your own listing"})
+		return
+	}
+	if status != "active" || (expiresAt != nil && !expiresAt.After(time.Now())) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Listing is not open for offers"})
+		return
+	}
+	if req.QuantityKG > available {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Only %s kg available", formatAmount(max(available, 0)))})
+		return
+	}
+
+	if err := expireOfferThread(ctx, tx, req.ListingID, req.BuyerID); err != nil {
+		log.Printf("MakeOffer: Expiry error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to make offer"})
+		return
+	}
+	var pendingID int
+	err = tx.QueryRow(ctx, "SELECT id FROM offers WHERE listing_id = $1 AND buyer_id = $2 AND status = 'pending'", req.ListingID, req.BuyerID).Scan(&pendingID)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "There is already an open offer on this listing; respond to it or withdraw it", "offer_id": pendingID})
+		return
+	} else if err != pgx.ErrNoRows {
+		log.Printf("MakeOffer: Pending check error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to make offer"})
+		return
+	}
+
+	o := Offer{
+		ListingID: req.ListingID, CropName: crop, BuyerID: req.BuyerID, FarmerID: farmerID, ProposedBy: req.BuyerID,
+		PricePerKG: req.PricePerKG, QuantityKG: req.QuantityKG, Currency: listingCurrency,
+		Message: strings.TrimSpace(req.Message), Status: offer.Pending, ExpiresAt: offer.ExpiresAt(time.Now(), req.ExpiresInHours),
+	}
+	if err := insertOffer(ctx, tx, &o); isUniqueViolation(err) {
+		// A concurrent request opened the thread between the check and the insert
+		c.JSON(http.StatusConflict, gin.H{"error": "There is already an open offer on this listing; respond to it or withdraw it"})
+		return
+	} else if err != nil {
+		log.Printf("MakeOffer: Insert error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to make offer"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to make offer"})
+		return
+	}
+
+	h.notifyOffer(ctx, o, farmerID, "New offer on your "+crop)
+	c.JSON(http.StatusCreated, gin.H{"message": "Offer sent", "offer_id": o.ID, "expires_at": o.ExpiresAt})
+}
+
+// RespondToOffer answers the latest offer in a thread. The other side can accept it
+// (placing an order at the offered price), reject it or counter with their own price;
+// whoever made it can withdraw it.
+// POST /api/offers/:id/respond
+func (h *Handler) RespondToOffer(c *gin.Context) {
+	offerID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offer id"})
+		return
+	}
+	var req RespondOfferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	if !offer.Valid(req.Action) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action must be one of accept, reject, counter, withdraw"})
+		return
+	}
+	if req.Action == offer.Counter && (req.PricePerKG <= 0 || req.QuantityKG < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A counter-offer needs a positive price_per_kg"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to respond to offer"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	o, err := scanOffer(tx.QueryRow(ctx, offerSelect+" WHERE o.id = $1 FOR UPDATE OF o", offerID))
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Offer not found"})
+		return
+	} else if err != nil {
+		log.Printf("RespondToOffer: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to respond to offer"})
+		return
+	}
+
+	reply, placed, err := respondToOffer(ctx, tx, &o, req)
+	if err == nil || errors.Is(err, ErrOfferExpired) {
+		// Keep the expiry even though the response fails
+		if cerr := tx.Commit(ctx); cerr != nil {
+			err = cerr
+		}
+	}
+	switch {
+	case errors.Is(err, ErrOfferForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrOfferClosed), errors.Is(err, ErrListingUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("RespondToOffer: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to respond to offer"})
+		return
+	}
+
+	other := o.BuyerID
+	if req.UserID == o.BuyerID {
+		other = o.FarmerID
+	}
+	resp := gin.H{"message": "Offer " + o.Status, "offer_id": o.ID, "status": o.Status}
+	switch req.Action {
+	case offer.Accept:
+		h.notifyOffer(ctx, o, other, fmt.Sprintf("Offer accepted: %s kg of %s", formatAmount(o.QuantityKG), o.CropName))
+		h.matchListing(ctx, o.ListingID)
+		resp["order_id"] = placed.ID
+	case offer.Reject:
+		h.notifyOffer(ctx, o, other, "Offer rejected on "+o.CropName)
+	case offer.Counter:
+		h.notifyOffer(ctx, reply, other, "Counter-offer on "+o.CropName)
+		resp["counter_offer_id"] = reply.ID
+		resp["expires_at"] = reply.ExpiresAt
+	case offer.Withdraw:
+		h.notifyOffer(ctx, o, other, "Offer withdrawn on "+o.CropName)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// respondToOffer applies a response to o in tx. A counter returns the new offer; an
+// accept returns the order it placed.
+func respondToOffer(ctx context.Context, tx pgx.Tx, o *Offer, req RespondOfferRequest) (Offer, Order, error) {
+	var reply Offer
+	var placed Order
+	if req.UserID != o.BuyerID && req.UserID != o.FarmerID {
+		return reply, placed, ErrOfferForbidden
+	}
+	if offer.ByMaker(req.Action) != (req.UserID == o.ProposedBy) {
+		if req.UserID == o.ProposedBy {
+			return reply, placed, fmt.Errorf("%w: wait for the other side to answer your offer", ErrOfferForbidden)
+		}
+		return reply, placed, fmt.Errorf("%w: only the offer's maker can withdraw it", ErrOfferForbidden)
+	}
+	if o.Status == offer.Pending && !o.ExpiresAt.After(time.Now()) {
+		if _, err := tx.Exec(ctx, "UPDATE offers SET status = 'expired' WHERE id = $1", o.ID); err != nil {
+			return reply, placed, err
+		}
+		return reply, placed, fmt.Errorf("%w at %s", ErrOfferExpired, o.ExpiresAt.Format("2006-01-02 15:04"))
+	}
+	if o.Status != offer.Pending {
+		return reply, placed, fmt.Errorf("%w: it was %s", ErrOfferClosed, o.Status)
+	}
+
+	message := strings.TrimSpace(req.Message)
+	switch req.Action {
+	case offer.Accept:
+		// The buyer orders at the agreed price and, having agreed it, the farmer has
+		// already accepted the order; the event records whoever accepted the offer
+		var err error
+		placed, err = placeOrder(ctx, tx, o.BuyerID, o.ListingID, o.QuantityKG, &o.PricePerKG, message)
+		if err != nil {
+			return reply, placed, err
+		}
+		note := fmt.Sprintf("Agreed in offer #%d", o.ID)
+		if placed, err = applyOrderTransition(ctx, tx, placed, order.Accepted, req.UserID, note); err != nil {
+			return reply, placed, err
+		}
+		o.OrderID = &placed.ID
+	case offer.Counter:
+		quantity := req.QuantityKG
+		if quantity == 0 {
+			quantity = o.QuantityKG
+		}
+		reply = Offer{
+			ListingID: o.ListingID, CropName: o.CropName, BuyerID: o.BuyerID, BuyerName: o.BuyerName,
+			FarmerID: o.FarmerID, FarmerName: o.FarmerName, ProposedBy: req.UserID, ParentID: &o.ID,
+			PricePerKG: req.PricePerKG, QuantityKG: quantity, Currency: o.Currency, ListedPrice: o.ListedPrice,
+			Message: message, Status: offer.Pending, ExpiresAt: offer.ExpiresAt(time.Now(), req.ExpiresInHours),
+		}
+	}
+
+	o.Status = offer.Result(req.Action)
+	now := time.Now()
+	o.RespondedAt = &now
+	_, err := tx.Exec(ctx, "UPDATE offers SET status = $1, responded_at = NOW(), order_id = $2 WHERE id = $3", o.Status, o.OrderID, o.ID)
+	if err != nil {
+		return reply, placed, err
+	}
+	// The countered offer is closed first so the new one can be the thread's pending offer
+	if req.Action == offer.Counter {
+		if err := insertOffer(ctx, tx, &reply); err != nil {
+			return reply, placed, err
+		}
+	}
+	return reply, placed, nil
+}
+
+// GetOffers lists the negotiations a user is part of, one entry per thread showing
+// its latest offer, most recent first.
+// GET /api/offers?user_id=&role=buyer|farmer&status=pending
+func (h *Handler) GetOffers(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+	role := c.Query("role")
+	if role != "" && role != order.Buyer && role != order.Farmer {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be buyer or farmer"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	filter := "(o.buyer_id = $1 OR o.farmer_id = $1)"
+	switch role {
+	case order.Buyer:
+		filter = "o.buyer_id = $1"
+	case order.Farmer:
+		filter = "o.farmer_id = $1"
+	}
+	query := `
+		SELECT * FROM (
+			SELECT DISTINCT ON (o.listing_id, o.buyer_id) ` + offerColumns + offerFrom + `
+			WHERE ` + filter + `
+			ORDER BY o.listing_id, o.buyer_id, o.created_at DESC, o.id DESC
+		) latest`
+	args := []interface{}{userID}
+	if status := c.Query("status"); status != "" {
+		// Offers past their expiry count as expired before the job marks them
+		query += " WHERE (CASE WHEN status = 'pending' AND expires_at <= NOW() THEN 'expired' ELSE status END) = $2"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at DESC LIMIT 200"
+
+	rows, err := h.DB.Query(ctx, query, args...)
+	if err != nil {
+		log.Printf("GetOffers: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch offers"})
+		return
+	}
+	defer rows.Close()
+
+	offers := []Offer{}
+	for rows.Next() {
+		o, err := scanOffer(rows)
+		if err != nil {
+			log.Printf("GetOffers: Scan error: %v\n", err)
+			continue
+		}
+		if o.Status == offer.Pending && !o.ExpiresAt.After(time.Now()) {
+			o.Status = offer.Expired
+		}
+		o.Actions = o.actions(userID)
+		offers = append(offers, o)
+	}
+	c.JSON(http.StatusOK, offers)
+}
+
+// GetOfferThread returns every offer and counter-offer in the negotiation an offer
+// belongs to, oldest first. Only the buyer and the farmer can see it.
+// GET /api/offers/:id/thread?user_id=
+func (h *Handler) GetOfferThread(c *gin.Context) {
+	offerID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offer id"})
+		return
+	}
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	var listingID, buyerID, farmerID int
+	err = h.DB.QueryRow(ctx, "SELECT listing_id, buyer_id, farmer_id FROM offers WHERE id = $1", offerID).Scan(&listingID, &buyerID, &farmerID)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Offer not found"})
+		return
+	} else if err != nil {
+		log.Printf("GetOfferThread: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch offers"})
+		return
+	}
+	if userID != buyerID && userID != farmerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the buyer and the farmer can see this negotiation"})
+		return
+	}
+	if err := expireOfferThread(ctx, h.DB, listingID, buyerID); err != nil {
+		log.Printf("GetOfferThread: Expiry error: %v\n", err)
+	}
+
+	rows, err := h.DB.Query(ctx, offerSelect+" WHERE o.listing_id = $1 AND o.buyer_id = $2 ORDER BY o.created_at, o.id", listingID, buyerID)
+	if err != nil {
+		log.Printf("GetOfferThread: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch offers"})
+		return
+	}
+	defer rows.Close()
+
+	thread := []Offer{}
+	for rows.Next() {
+		o, err := scanOffer(rows)
+		if err != nil {
+			log.Printf("GetOfferThread: Scan error: %v\n", err)
+			continue
+		}
+		o.Actions = o.actions(userID)
+		thread = append(thread, o)
+	}
+	c.JSON(http.StatusOK, thread)
+}
+
+// ExpireOffers closes pending offers past their expiry and tells whoever made them.
+// Run periodically.
+func (h *Handler) ExpireOffers(ctx context.Context) error {
+	rows, err := h.DB.Query(ctx, `
+		WITH expired AS (
+			UPDATE offers SET status = 'expired'
+			WHERE status = 'pending' AND expires_at <= NOW()
+			RETURNING id
+		)
+		`+offerSelect+` WHERE o.id IN (SELECT id FROM expired)`)
+	if err != nil {
+		return fmt.Errorf("expire offers: %w", err)
+	}
+	var expired []Offer
+	for rows.Next() {
+		o, err := scanOffer(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		expired = append(expired, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range expired {
+		o.Status = offer.Expired // the select above still sees the row as it was
+		h.notifyOffer(ctx, o, o.ProposedBy, "Your offer on "+o.CropName+" expired")
+	}
+	if len(expired) > 0 {
+		log.Printf("Offer expiry: %d expired\n", len(expired))
+	}
+	return nil
+}
+
+// expireOfferThread marks a thread's pending offer expired if its time is up.
+func expireOfferThread(ctx context.Context, db execer, listingID, buyerID int) error {
+	_, err := db.Exec(ctx, `
+		UPDATE offers SET status = 'expired'
+		WHERE listing_id = $1 AND buyer_id = $2 AND status = 'pending' AND expires_at <= NOW()
+	`, listingID, buyerID)
+	return err
+}
+
+func insertOffer(ctx context.Context, tx pgx.Tx, o *Offer) error {
+	return tx.QueryRow(ctx, `
+		INSERT INTO offers (listing_id, buyer_id, farmer_id, proposed_by, parent_id, price_per_kg, quantity_kg, currency, message, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11)
+		RETURNING id, created_at
+	`, o.ListingID, o.BuyerID, o.FarmerID, o.ProposedBy, o.ParentID, o.PricePerKG, o.QuantityKG, o.Currency, o.Message, o.Status, o.ExpiresAt).Scan(&o.ID, &o.CreatedAt)
+}
+
+// notifyOffer sends an offer update to one side of the negotiation.
+func (h *Handler) notifyOffer(ctx context.Context, o Offer, recipient int, title string) {
+	body := fmt.Sprintf("%s kg at %s %s/kg (listed at %s)", formatAmount(o.QuantityKG), formatAmount(o.PricePerKG), o.Currency, formatAmount(o.ListedPrice))
+	if o.ListedPrice == 0 {
+		body = fmt.Sprintf("%s kg at %s %s/kg", formatAmount(o.QuantityKG), formatAmount(o.PricePerKG), o.Currency)
+	}
+	data := gin.H{"offer_id": o.ID, "listing_id": o.ListingID, "status": o.Status}
+	if o.OrderID != nil {
+		data["order_id"] = *o.OrderID
+	}
+	key := fmt.Sprintf("offer:%d:%s", o.ID, o.Status)
+	if _, err := h.notify(ctx, recipient, "offer", title, body, data, key); err != nil {
+		log.Printf("Offer notification error (offer %d): %v\n", o.ID, err)
+	}
+}
+
+// actions returns the responses userID can make to the offer.
+func (o Offer) actions(userID int) []string {
+	if o.Status != offer.Pending || !o.ExpiresAt.After(time.Now()) {
+		return nil
+	}
+	if userID == o.ProposedBy {
+		return []string{offer.Withdraw}
+	}
+	if userID == o.BuyerID || userID == o.FarmerID {
+		return []string{offer.Accept, offer.Reject, offer.Counter}
+	}
+	return nil
+}
+
+const offerColumns = `
+	o.id, o.listing_id, c.name, o.buyer_id, b.full_name, o.farmer_id, f.full_name, o.proposed_by, o.parent_id,
+	o.price_per_kg, o.quantity_kg, o.currency, m.price_per_kg, COALESCE(o.message, ''), o.status,
+	o.expires_at, o.responded_at, o.order_id, o.created_at`
+
+const offerFrom = `
+	FROM offers o
+	JOIN users b ON b.id = o.buyer_id
+	JOIN users f ON f.id = o.farmer_id
+	JOIN marketplace_listings m ON m.id = o.listing_id
+	JOIN crop_types c ON c.id = m.crop_type_id`
+
+const offerSelect = "SELECT " + offerColumns + offerFrom
+
+func scanOffer(row pgx.Row) (Offer, error) {
+	var o Offer
+	err := row.Scan(&o.ID, &o.ListingID, &o.CropName, &o.BuyerID, &o.BuyerName, &o.FarmerID, &o.FarmerName, &o.ProposedBy, &o.ParentID,
+		&o.PricePerKG, &o.QuantityKG, &o.Currency, &o.ListedPrice, &o.Message, &o.Status,
+		&o.ExpiresAt, &o.RespondedAt, &o.OrderID, &o.CreatedAt)
+	return o, err
+}
@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"farmlite/internal/order"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrListingUnavailable means the listing can't take the order: it isn't active,
+	// belongs to the buyer, or hasn't enough unreserved quantity.
+	ErrListingUnavailable = errors.New("listing unavailable")
+	// ErrOrderForbidden means the user isn't the order's buyer or farmer.
+	ErrOrderForbidden = errors.New("not a party to this order")
+	// ErrOrderTransition means the order can't move to the requested state.
+	ErrOrderTransition = errors.New("invalid order transition")
+)
+
+type Order struct {
+	ID          int          `json:"id"`
+	ListingID   int          `json:"listing_id"`
+	BuyerID     int          `json:"buyer_id"`
+	BuyerName   string       `json:"buyer_name"`
+	FarmerID    int          `json:"farmer_id"`
+	FarmerName  string       `json:"farmer_name"`
+	CropName    string       `json:"crop_name"`
+	QuantityKG  float64      `json:"quantity_kg"`
+	PricePerKG  float64      `json:"price_per_kg"`
+	Currency    string       `json:"currency"`
+	Total       float64      `json:"total"`
+	Status      string       `json:"status"`
+	Note        string       `json:"note,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	NextActions []string     `json:"next_actions,omitempty"` // states the caller can move the order to
+	Events      []OrderEvent `json:"events,omitempty"`
+}
+
+type OrderEvent struct {
+	FromStatus *string   `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ActorID    *int      `json:"actor_id"`
+	Note       string    `json:"note,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type PlaceOrderRequest struct {
+	BuyerID    int     `json:"buyer_id" binding:"required"`
+	ListingID  int     `json:"listing_id" binding:"required"`
+	QuantityKG float64 `json:"quantity_kg" binding:"required"`
+	Note       string  `json:"note"`
+}
+
+type OrderStatusRequest struct {
+	UserID int    `json:"user_id" binding:"required"`
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note"`
+}
+
+// PlaceOrder orders a quantity from a listing at its current price. The quantity is
+// reserved until the farmer rejects it, either side cancels, or it completes.
+// POST /api/orders
+func (h *Handler) PlaceOrder(c *gin.Context) {
+	var req PlaceOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	if kgHundredths(req.QuantityKG) <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity_kg must be at least 0.01"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place order"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	placed, err := placeOrder(ctx, tx, req.BuyerID, req.ListingID, req.QuantityKG, nil, strings.TrimSpace(req.Note))
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Listing not found"})
+		return
+	case errors.Is(err, ErrListingUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("PlaceOrder: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place order"})
+		return
+	}
+
+	h.notifyOrder(ctx, placed, req.BuyerID)
+	// Matches are scored on unreserved stock, which the order just took from
+	h.matchListing(ctx, placed.ListingID)
+	c.JSON(http.StatusCreated, gin.H{"message": "Order placed", "order_id": placed.ID, "status": placed.Status})
+}
+
+// GetOrders lists a user's orders as buyer, farmer or both, newest first.
+// GET /api/orders?user_id=&role=buyer|farmer&status=
+func (h *Handler) GetOrders(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+	role := c.Query("role")
+	status := c.Query("status")
+	if role != "" && role != order.Buyer && role != order.Farmer {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be buyer or farmer"})
+		return
+	}
+	if status != "" && !order.Valid(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown order status"})
+		return
+	}
+
+	query := orderSelect + " WHERE "
+	switch role {
+	case order.Buyer:
+		query += "o.buyer_id = $1"
+	case order.Farmer:
+		query += "o.farmer_id = $1"
+	default:
+		query += "(o.buyer_id = $1 OR o.farmer_id = $1)"
+	}
+	args := []interface{}{userID}
+	if status != "" {
+		query += " AND o.status = $2"
+		args = append(args, status)
+	}
+	query += " ORDER BY o.created_at DESC LIMIT 200"
+
+	rows, err := h.DB.Query(c.Request.Context(), query, args...)
+	if err != nil {
+		log.Printf("GetOrders: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			log.Printf("GetOrders: Scan error: %v\n", err)
+			continue
+		}
+		o.NextActions = order.Next(o.Status, o.party(userID))
+		orders = append(orders, o)
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// GetOrder returns an order with its full state history. Only the buyer and the
+// farmer can see it.
+// GET /api/orders/:id?user_id=
+func (h *Handler) GetOrder(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+		return
+	}
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	o, err := scanOrder(h.DB.QueryRow(ctx, orderSelect+" WHERE o.id = $1", orderID))
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	} else if err != nil {
+		log.Printf("GetOrder: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+		return
+	}
+	party := o.party(userID)
+	if party == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrOrderForbidden.Error()})
+		return
+	}
+	o.NextActions = order.Next(o.Status, party)
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT from_status, to_status, actor_id, COALESCE(note, ''), created_at
+		FROM order_events
+		WHERE order_id = $1
+		ORDER BY created_at, id
+	`, orderID)
+	if err != nil {
+		log.Printf("GetOrder: Events error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e OrderEvent
+		if err := rows.Scan(&e.FromStatus, &e.ToStatus, &e.ActorID, &e.Note, &e.CreatedAt); err != nil {
+			continue
+		}
+		o.Events = append(o.Events, e)
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// UpdateOrderStatus moves an order along the workflow. Which moves are allowed depends
+// on the current state and whether the caller is the buyer or the farmer.
+// POST /api/orders/:id/status
+func (h *Handler) UpdateOrderStatus(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+		return
+	}
+	var req OrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	if !order.Valid(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown order status"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	updated, err := transitionOrder(ctx, tx, orderID, req.UserID, req.Status, strings.TrimSpace(req.Note))
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	case errors.Is(err, ErrOrderForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrOrderTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("UpdateOrderStatus: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		return
+	}
+
+	h.notifyOrder(ctx, updated, req.UserID)
+	// Releasing a reservation or completing a sale changes the stock matches are scored on
+	h.matchListing(ctx, updated.ListingID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Order is now " + updated.Status,
+		"id":           updated.ID,
+		"status":       updated.Status,
+		"next_actions": order.Next(updated.Status, updated.party(req.UserID)),
+	})
+}
+
+// kgHundredths is a quantity in whole hundredths of a kg, the scale it is stored at.
+// Quantities are compared this way because float subtraction drifts: 10.7 - 0.4 is
+// just under 10.3, which would turn away an order for exactly what's left.
+func kgHundredths(kg float64) int64 {
+	return int64(math.Round(kg * 100))
+}
+
+// placeOrder creates an order in tx and reserves its quantity on the listing. The
+// price is the listing's unless agreed is given.
+func placeOrder(ctx context.Context, tx pgx.Tx, buyerID, listingID int, kg float64, agreed *float64, note string) (Order, error) {
+	o := Order{ListingID: listingID, BuyerID: buyerID, QuantityKG: kg, Status: order.Placed, Note: note}
+	var status string
+	var expiresAt *time.Time
+	var quantity, reserved float64
+	err := tx.QueryRow(ctx, `
+		SELECT m.farmer_id, m.status, m.expires_at, m.quantity_kg, m.reserved_kg, m.price_per_kg, m.currency, c.name
+		FROM marketplace_listings m
+		JOIN crop_types c ON c.id = m.crop_type_id
+		WHERE m.id = $1 AND m.is_active = TRUE
+		FOR UPDATE OF m
+	`, listingID).Scan(&o.FarmerID, &status, &expiresAt, &quantity, &reserved, &o.PricePerKG, &o.Currency, &o.CropName)
+	if err != nil {
+		return o, err
+	}
+	if buyerID == o.FarmerID {
+		return o, fmt.Errorf("%w: you can't order from your own listing", ErrListingUnavailable)
+	}
+	if status != "active" || (expiresAt != nil && !expiresAt.After(time.Now())) {
+		return o, fmt.Errorf("%w: listing is not open for orders", ErrListingUnavailable)
+	}
+	if available := kgHundredths(quantity) - kgHundredths(reserved); kgHundredths(kg) > available {
+		return o, fmt.Errorf("%w: only %s kg available", ErrListingUnavailable, formatAmount(float64(max(available, 0))/100))
+	}
+	if agreed != nil {
+		o.PricePerKG = *agreed
+	}
+	o.Total = kg * o.PricePerKG
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO orders (listing_id, buyer_id, farmer_id, quantity_kg, price_per_kg, currency, status, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+		RETURNING id, created_at, updated_at
+	`, listingID, buyerID, o.FarmerID, kg, o.PricePerKG, o.Currency, o.Status, note).Scan(&o.ID, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return o, err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE marketplace_listings SET reserved_kg = reserved_kg + $1 WHERE id = $2", kg, listingID); err != nil {
+		return o, err
+	}
+	return o, insertOrderEvent(ctx, tx, o.ID, "", o.Status, buyerID, note)
+}
+
+// transitionOrder moves an order to state to on behalf of userID, releasing its
+// reservation when it falls through and selling from the listing when it completes.
+func transitionOrder(ctx context.Context, tx pgx.Tx, orderID, userID int, to, note string) (Order, error) {
+	o := Order{ID: orderID}
+	err := tx.QueryRow(ctx, `
+		SELECT o.listing_id, o.buyer_id, o.farmer_id, o.quantity_kg, o.price_per_kg, o.currency, o.status, c.name
+		FROM orders o
+		JOIN marketplace_listings m ON m.id = o.listing_id
+		JOIN crop_types c ON c.id = m.crop_type_id
+		WHERE o.id = $1
+		FOR UPDATE OF o
+	`, orderID).Scan(&o.ListingID, &o.BuyerID, &o.FarmerID, &o.QuantityKG, &o.PricePerKG, &o.Currency, &o.Status, &o.CropName)
+	if err != nil {
+		return o, err
+	}
+	party := o.party(userID)
+	if party == "" {
+		return o, ErrOrderForbidden
+	}
+	if !order.CanTransition(o.Status, to, party) {
+		return o, fmt.Errorf("%w: the %s can't move a %s order to %s", ErrOrderTransition, party, o.Status, to)
+	}
+	return applyOrderTransition(ctx, tx, o, to, userID, note)
+}
+
+// applyOrderTransition moves a locked order to a new status, settling the listing's
+// reservation and stock, and records actorID as having made the change.
+func applyOrderTransition(ctx context.Context, tx pgx.Tx, o Order, to string, actorID int, note string) (Order, error) {
+	from := o.Status
+	o.Status = to
+	o.Total = o.QuantityKG * o.PricePerKG
+	err := tx.QueryRow(ctx, `
+		UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2
+		RETURNING created_at, updated_at
+	`, to, o.ID).Scan(&o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return o, err
+	}
+
+	if order.Reserves(from) && !order.Reserves(to) {
+		_, err := tx.Exec(ctx, "UPDATE marketplace_listings SET reserved_kg = GREATEST(reserved_kg - $1, 0) WHERE id = $2", o.QuantityKG, o.ListingID)
+		if err != nil {
+			return o, err
+		}
+	}
+	if to == order.Completed {
+		if _, err := sellFromListing(ctx, tx, o.ListingID, o.QuantityKG); err != nil {
+			return o, err
+		}
+	}
+	return o, insertOrderEvent(ctx, tx, o.ID, from, to, actorID, note)
+}
+
+func insertOrderEvent(ctx context.Context, db execer, orderID int, from, to string, actorID int, note string) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO order_events (order_id, from_status, to_status, actor_id, note)
+		VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, 0), NULLIF($5, ''))
+	`, orderID, from, to, actorID, note)
+	return err
+}
+
+// notifyOrder tells the other party about an order's new state.
+func (h *Handler) notifyOrder(ctx context.Context, o Order, actorID int) {
+	recipient := o.FarmerID
+	if actorID == o.FarmerID {
+		recipient = o.BuyerID
+	}
+	amount := fmt.Sprintf("%s kg of %s", formatAmount(o.QuantityKG), o.CropName)
+	var title string
+	switch o.Status {
+	case order.Placed:
+		title = "New order: " + amount
+	case order.Accepted:
+		title = "Your order was accepted: " + amount
+	case order.Rejected:
+		title = "Your order was rejected: " + amount
+	case order.Confirmed:
+		title = "Order confirmed by the buyer: " + amount
+	case order.Shipped:
+		title = "Your order has shipped: " + amount
+	case order.Delivered:
+		title = "Order marked delivered: " + amount
+	case order.Completed:
+		title = "Order completed: " + amount
+	case order.Cancelled:
+		title = "Order cancelled: " + amount
+	case order.Disputed:
+		title = "Order disputed: " + amount
+	default:
+		return
+	}
+	body := fmt.Sprintf("Order #%d, %s %s/kg, total %s %s", o.ID, formatAmount(o.PricePerKG), o.Currency, formatAmount(o.Total), o.Currency)
+	data := gin.H{"order_id": o.ID, "listing_id": o.ListingID, "status": o.Status}
+	key := fmt.Sprintf("order:%d:%s", o.ID, o.Status)
+	if _, err := h.notify(ctx, recipient, "order", title, body, data, key); err != nil {
+		log.Printf("Order notification error (order %d): %v\n", o.ID, err)
+	}
+}
+
+// party returns whether userID is the order's buyer or farmer, or "" if neither.
+func (o Order) party(userID int) string {
+	switch userID {
+	case o.BuyerID:
+		return order.Buyer
+	case o.FarmerID:
+		return order.Farmer
+	}
+	return ""
+}
+
+const orderSelect = `
+	SELECT o.id, o.listing_id, o.buyer_id, b.full_name, o.farmer_id, f.full_name, c.name,
+	       o.quantity_kg, o.price_per_kg, o.currency, o.status, COALESCE(o.note, ''), o.created_at, o.updated_at
+	FROM orders o
+	JOIN users b ON b.id = o.buyer_id
+	JOIN users f ON f.id = o.farmer_id
+	JOIN marketplace_listings m ON m.id = o.listing_id
+	JOIN crop_types c ON c.id = m.crop_type_id`
+
+func scanOrder(row pgx.Row) (Order, error) {
+	var o Order
+	err := row.Scan(&o.ID, &o.ListingID, &o.BuyerID, &o.BuyerName, &o.FarmerID, &o.FarmerName, &o.CropName,
+		&o.QuantityKG, &o.PricePerKG, &o.Currency, &o.Status, &o.Note, &o.CreatedAt, &o.UpdatedAt)
+	o.Total = o.QuantityKG * o.PricePerKG
+	return o, err
+}
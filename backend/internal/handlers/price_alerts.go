@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"farmlite/internal/currency"
+	"farmlite/internal/pricing"
+	"farmlite/internal/regions"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The "current" price an alert compares against is the median of this many days of reports
+const alertCurrentWindowDays = 7
+
+type PriceAlert struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	CropTypeID      int        `json:"crop_type_id"`
+	CropName        string     `json:"crop_name"`
+	Region          string     `json:"region"`
+	VolumeTier      string     `json:"volume_tier"`
+	Currency        string     `json:"currency"`
+	Triggered       bool       `json:"triggered"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at"`
+	LastPrice       *float64   `json:"last_price"`
+	CreatedAt       time.Time  `json:"created_at"`
+	pricing.AlertRule
+}
+
+type CreatePriceAlertRequest struct {
+	UserID     int     `json:"user_id" binding:"required"`
+	CropTypeID int     `json:"crop_type_id" binding:"required"`
+	Region     string  `json:"region" binding:"required"` // "All" for the national price
+	VolumeTier string  `json:"volume_tier"`
+	Kind       string  `json:"kind" binding:"required"`
+	Direction  string  `json:"direction" binding:"required"`
+	Threshold  float64 `json:"threshold"`
+	Percent    float64 `json:"percent"`
+	WindowDays int     `json:"window_days"`
+	Currency   string  `json:"currency"`
+}
+
+// CreatePriceAlert subscribes a user to a price alert.
+// POST /api/alerts
+func (h *Handler) CreatePriceAlert(c *gin.Context) {
+	var req CreatePriceAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	rule := pricing.AlertRule{
+		Kind:       req.Kind,
+		Direction:  req.Direction,
+		Threshold:  req.Threshold,
+		Percent:    req.Percent,
+		WindowDays: req.WindowDays,
+	}
+	if err := rule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.VolumeTier == "" {
+		req.VolumeTier = "retail"
+	}
+	if req.VolumeTier != "retail" && req.VolumeTier != "wholesale" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "volume_tier must be 'retail' or 'wholesale'"})
+		return
+	}
+
+	region := NationalSeries
+	if !strings.EqualFold(req.Region, NationalSeries) {
+		canonical, ok := regions.Canonical(req.Region)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown region: " + req.Region})
+			return
+		}
+		region = canonical
+	}
+
+	code, err := currency.Normalize(req.Currency, currency.UZS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only the fields relevant to the kind are stored
+	var threshold, percent *float64
+	var window *int
+	if rule.Kind == pricing.AlertThreshold {
+		threshold = &rule.Threshold
+	} else {
+		percent, window = &rule.Percent, &rule.WindowDays
+	}
+
+	ctx := c.Request.Context()
+	var alertID int
+	err = h.DB.QueryRow(ctx, `
+		INSERT INTO price_alerts (user_id, crop_type_id, region, volume_tier, kind, direction, threshold, percent, window_days, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, req.UserID, req.CropTypeID, region, req.VolumeTier, rule.Kind, rule.Direction, threshold, percent, window, code).Scan(&alertID)
+	if err != nil {
+		log.Printf("CreatePriceAlert: Insert error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create alert: " + err.Error()})
+		return
+	}
+
+	// Prime the alert so a condition that already holds doesn't wait for the next report
+	if err := h.evaluatePriceAlerts(ctx, "a.id = $1", alertID); err != nil {
+		log.Printf("CreatePriceAlert: Evaluate error: %v\n", err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Alert created", "id": alertID})
+}
+
+// GetPriceAlerts lists a user's active alerts.
+// GET /api/alerts?user_id=
+func (h *Handler) GetPriceAlerts(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	rows, err := h.DB.Query(c.Request.Context(), `
+		SELECT a.id, a.user_id, a.crop_type_id, c.name, a.region, a.volume_tier, a.currency,
+		       a.kind, a.direction, COALESCE(a.threshold, 0), COALESCE(a.percent, 0), COALESCE(a.window_days, 0),
+		       a.triggered, a.last_triggered_at, a.last_price, a.created_at
+		FROM price_alerts a
+		JOIN crop_types c ON a.crop_type_id = c.id
+		WHERE a.user_id = $1 AND a.is_active = TRUE
+		ORDER BY a.created_at DESC
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alerts"})
+		return
+	}
+	defer rows.Close()
+
+	alerts := []PriceAlert{}
+	for rows.Next() {
+		var a PriceAlert
+		if err := rows.Scan(&a.ID, &a.UserID, &a.CropTypeID, &a.CropName, &a.Region, &a.VolumeTier, &a.Currency,
+			&a.Kind, &a.Direction, &a.Threshold, &a.Percent, &a.WindowDays,
+			&a.Triggered, &a.LastTriggeredAt, &a.LastPrice, &a.CreatedAt); err != nil {
+			log.Printf("GetPriceAlerts: Scan error: %v\n", err)
+			continue
+		}
+		alerts = append(alerts, a)
+	}
+
+	c.JSON(http.StatusOK, alerts)
+}
+
+// DeletePriceAlert unsubscribes from an alert.
+// DELETE /api/alerts/:id?user_id=
+func (h *Handler) DeletePriceAlert(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	tag, err := h.DB.Exec(c.Request.Context(),
+		"UPDATE price_alerts SET is_active = FALSE WHERE id = $1 AND user_id = $2 AND is_active = TRUE",
+		c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete alert"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert deleted"})
+}
+
+// EvaluatePriceAlerts checks every active alert. Run on a schedule so change alerts
+// fire as their window moves even without new reports.
+func (h *Handler) EvaluatePriceAlerts(ctx context.Context) error {
+	return h.evaluatePriceAlerts(ctx, "TRUE")
+}
+
+// evaluatePriceAlertsFor checks the alerts a new report for this crop and region could affect.
+// Alerts and reports both store the canonical region, so the report's is resolved too.
+func (h *Handler) evaluatePriceAlertsFor(ctx context.Context, cropTypeID int, region string) error {
+	if canonical, ok := regions.Canonical(region); ok {
+		region = canonical
+	}
+	return h.evaluatePriceAlerts(ctx, "a.crop_type_id = $1 AND a.region IN ($2, '"+NationalSeries+"')", cropTypeID, region)
+}
+
+// checkPriceAlertsAsync evaluates affected alerts in the background after a price is published,
+// so the submitter doesn't wait on it.
+func (h *Handler) checkPriceAlertsAsync(cropTypeID int, region string) {
+	go func() {
+		if err := h.evaluatePriceAlertsFor(context.Background(), cropTypeID, region); err != nil {
+			log.Printf("Price alert evaluation error: %v\n", err)
+		}
+	}()
+}
+
+// evaluatePriceAlerts evaluates the active alerts matching filter (a condition on
+// price_alerts a). Alerts fire only when their condition starts to hold, and re-arm
+// once it stops holding; the conditional update makes concurrent runs fire once.
+func (h *Handler) evaluatePriceAlerts(ctx context.Context, filter string, args ...interface{}) error {
+	query := fmt.Sprintf(`
+		SELECT a.id, a.user_id, c.name, a.region, a.volume_tier, a.currency,
+		       a.kind, a.direction, COALESCE(a.threshold, 0), COALESCE(a.percent, 0), COALESCE(a.window_days, 0),
+		       a.triggered, cur.price, past.price
+		FROM price_alerts a
+		JOIN crop_types c ON a.crop_type_id = c.id
+		CROSS JOIN LATERAL (
+			SELECT PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY p.price_per_kg * fx_rate(p.currency, a.currency, p.submitted_at::date)) AS price
+			FROM market_prices p
+			WHERE p.crop_type_id = a.crop_type_id AND (a.region = '%[1]s' OR p.region = a.region)
+			  AND p.volume_tier = a.volume_tier AND p.is_active = TRUE AND p.status = 'published'
+			  AND p.submitted_at >= NOW() - INTERVAL '%[2]d days'
+		) cur
+		CROSS JOIN LATERAL (
+			SELECT PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY p.price_per_kg * fx_rate(p.currency, a.currency, p.submitted_at::date)) AS price
+			FROM market_prices p
+			WHERE a.kind = 'change'
+			  AND p.crop_type_id = a.crop_type_id AND (a.region = '%[1]s' OR p.region = a.region)
+			  AND p.volume_tier = a.volume_tier AND p.is_active = TRUE AND p.status = 'published'
+			  AND p.submitted_at >= NOW() - make_interval(days => a.window_days + %[2]d)
+			  AND p.submitted_at < NOW() - make_interval(days => a.window_days)
+		) past
+		WHERE a.is_active = TRUE AND %[3]s
+	`, NationalSeries, alertCurrentWindowDays, filter)
+
+	rows, err := h.DB.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("alert query: %w", err)
+	}
+
+	type evaluated struct {
+		alert        PriceAlert
+		current      *float64
+		hit          bool
+		changePct    float64
+		wasTriggered bool
+	}
+	var results []evaluated
+	for rows.Next() {
+		var e evaluated
+		var past *float64
+		a := &e.alert
+		if err := rows.Scan(&a.ID, &a.UserID, &a.CropName, &a.Region, &a.VolumeTier, &a.Currency,
+			&a.Kind, &a.Direction, &a.Threshold, &a.Percent, &a.WindowDays,
+			&e.wasTriggered, &e.current, &past); err != nil {
+			rows.Close()
+			return fmt.Errorf("alert scan: %w", err)
+		}
+		e.hit, e.changePct = a.AlertRule.Evaluate(e.current, past)
+		results = append(results, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("alert rows: %w", err)
+	}
+
+	for _, e := range results {
+		a := e.alert
+		if !e.hit {
+			if e.wasTriggered {
+				if _, err := h.DB.Exec(ctx, "UPDATE price_alerts SET triggered = FALSE WHERE id = $1", a.ID); err != nil {
+					return fmt.Errorf("re-arm alert %d: %w", a.ID, err)
+				}
+			}
+			continue
+		}
+		if e.wasTriggered {
+			continue
+		}
+
+		tag, err := h.DB.Exec(ctx, `
+			UPDATE price_alerts SET triggered = TRUE, last_triggered_at = NOW(), last_price = $2
+			WHERE id = $1 AND triggered = FALSE
+		`, a.ID, *e.current)
+		if err != nil {
+			return fmt.Errorf("trigger alert %d: %w", a.ID, err)
+		}
+		if tag.RowsAffected() == 0 {
+			continue // another run got there first
+		}
+
+		title, body := alertMessage(a, *e.current, e.changePct)
+		data := gin.H{"alert_id": a.ID, "crop": a.CropName, "region": a.Region, "tier": a.VolumeTier, "price": *e.current, "currency": a.Currency}
+		// At most one notification per alert per day, even if the price hovers around the trigger
+		key := fmt.Sprintf("price_alert:%d:%s", a.ID, time.Now().Format("2006-01-02"))
+		if _, err := h.notify(ctx, a.UserID, "price_alert", title, body, data, key); err != nil {
+			return fmt.Errorf("notify alert %d: %w", a.ID, err)
+		}
+	}
+	return nil
+}
+
+func alertMessage(a PriceAlert, price, changePct float64) (title, body string) {
+	where := a.Region
+	if where == NationalSeries {
+		where = "Uzbekistan"
+	}
+	title = fmt.Sprintf("%s %s price alert", a.CropName, a.VolumeTier)
+
+	if a.Kind == pricing.AlertThreshold {
+		body = fmt.Sprintf("%s in %s is now %.2f %s/kg, %s your target of %.2f.",
+			a.CropName, where, price, a.Currency, a.Direction, a.Threshold)
+		return title, body
+	}
+	verb := "rose"
+	if changePct < 0 {
+		verb = "fell"
+	}
+	body = fmt.Sprintf("%s in %s %s %.1f%% over %d days to %.2f %s/kg.",
+		a.CropName, where, verb, math.Abs(changePct), a.WindowDays, price, a.Currency)
+	return title, body
+}
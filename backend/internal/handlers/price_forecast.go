@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"farmlite/internal/currency"
+	"farmlite/internal/forecast"
+	"farmlite/internal/regions"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Forecasts older than this are recomputed on request instead of waiting for the nightly run
+const forecastMaxAge = 36 * time.Hour
+
+// How much history a forecast is fitted on
+const forecastHistoryYears = 3
+
+type PriceForecast struct {
+	forecast.Result
+	Crop        string    `json:"crop"`
+	Region      string    `json:"region"`
+	Tier        string    `json:"tier"`
+	Currency    string    `json:"currency"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// GetPriceForecast returns a weekly price forecast with prediction intervals.
+// GET /api/prices/forecast?crop=&region=&tier=&weeks=2..8
+func (h *Handler) GetPriceForecast(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	crop := c.Query("crop")
+	if crop == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "crop is required"})
+		return
+	}
+	var cropID int
+	var cropName string
+	err := h.DB.QueryRow(ctx, "SELECT id, name FROM crop_types WHERE name = $1 OR id::text = $1", crop).Scan(&cropID, &cropName)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown crop: " + crop})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up crop"})
+		return
+	}
+
+	region := NationalSeries
+	if r := c.Query("region"); r != "" && r != NationalSeries {
+		canonical, ok := regions.Canonical(r)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown region: " + r})
+			return
+		}
+		region = canonical
+	}
+
+	tier := c.DefaultQuery("tier", "retail")
+	if tier != "retail" && tier != "wholesale" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tier must be retail or wholesale"})
+		return
+	}
+
+	weeks := forecast.MaxHorizon
+	if v := c.Query("weeks"); v != "" {
+		weeks, err = strconv.Atoi(v)
+		if err != nil || weeks < forecast.MinHorizon || weeks > forecast.MaxHorizon {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("weeks must be between %d and %d", forecast.MinHorizon, forecast.MaxHorizon)})
+			return
+		}
+	}
+
+	target, err := h.resolveCurrency(c, currency.UZS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	factor, ok := h.loadRates(ctx).Convert(1, currency.USD, target)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No exchange rate available for " + target})
+		return
+	}
+
+	res, generatedAt, err := h.loadForecast(ctx, cropID, region, tier)
+	if err != nil || time.Since(generatedAt) > forecastMaxAge {
+		res, err = h.computeForecast(ctx, cropID, region, tier)
+		if errors.Is(err, forecast.ErrInsufficientHistory) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Not enough price history for " + cropName + " in " + region + " to forecast"})
+			return
+		} else if err != nil {
+			log.Printf("GetPriceForecast: Compute error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute forecast"})
+			return
+		}
+		generatedAt = time.Now()
+		if err := h.storeForecast(ctx, cropID, region, tier, res); err != nil {
+			log.Printf("GetPriceForecast: Store error: %v\n", err)
+		}
+	}
+
+	if len(res.Points) > weeks {
+		res.Points = res.Points[:weeks]
+	}
+	for i := range res.Points {
+		p := &res.Points[i]
+		p.Price *= factor
+		p.Lower80 *= factor
+		p.Upper80 *= factor
+		p.Lower95 *= factor
+		p.Upper95 *= factor
+	}
+
+	c.JSON(http.StatusOK, PriceForecast{
+		Result:      res,
+		Crop:        cropName,
+		Region:      region,
+		Tier:        tier,
+		Currency:    target,
+		GeneratedAt: generatedAt,
+	})
+}
+
+// computeForecast fits a forecast in USD on the weekly mean price history.
+func (h *Handler) computeForecast(ctx context.Context, cropID int, region, tier string) (forecast.Result, error) {
+	now := time.Now()
+	q := priceSeriesQuery{
+		CropTypeID: cropID,
+		Tier:       tier,
+		From:       now.AddDate(-forecastHistoryYears, 0, 0),
+		To:         now,
+		Interval:   "week",
+		Currency:   currency.USD,
+	}
+	if region != NationalSeries {
+		q.Regions = []string{region}
+	}
+
+	byRegion, err := h.loadPriceSeries(ctx, q)
+	if err != nil {
+		return forecast.Result{}, err
+	}
+	buckets := byRegion[region]
+
+	weeks := make([]time.Time, 0, len(buckets))
+	values := make([]float64, 0, len(buckets))
+	for _, b := range buckets {
+		week, err := time.Parse("2006-01-02", b.Start)
+		if err != nil {
+			return forecast.Result{}, err
+		}
+		weeks = append(weeks, week)
+		values = append(values, b.Mean)
+	}
+
+	start, series, observed := forecast.Regularize(weeks, values)
+	return forecast.Forecast(start, series, observed, now, forecast.MaxHorizon)
+}
+
+func (h *Handler) loadForecast(ctx context.Context, cropID int, region, tier string) (forecast.Result, time.Time, error) {
+	var res forecast.Result
+	var generatedAt time.Time
+	err := h.DB.QueryRow(ctx, `
+		SELECT model, points, backtest_weeks, mape, accuracy, observations, history_weeks, generated_at
+		FROM price_forecasts
+		WHERE crop_type_id = $1 AND region = $2 AND volume_tier = $3
+	`, cropID, region, tier).Scan(&res.Model, &res.Points, &res.BacktestWeeks, &res.MAPE, &res.Accuracy,
+		&res.Observations, &res.HistoryWeeks, &generatedAt)
+	return res, generatedAt, err
+}
+
+func (h *Handler) storeForecast(ctx context.Context, cropID int, region, tier string, res forecast.Result) error {
+	points, err := json.Marshal(res.Points)
+	if err != nil {
+		return err
+	}
+	_, err = h.DB.Exec(ctx, `
+		INSERT INTO price_forecasts (crop_type_id, region, volume_tier, model, points, backtest_weeks, mape, accuracy, observations, history_weeks, generated_at)
+		VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7, $8, $9, $10, NOW())
+		ON CONFLICT (crop_type_id, region, volume_tier) DO UPDATE
+		SET model = EXCLUDED.model, points = EXCLUDED.points, backtest_weeks = EXCLUDED.backtest_weeks,
+		    mape = EXCLUDED.mape, accuracy = EXCLUDED.accuracy, observations = EXCLUDED.observations,
+		    history_weeks = EXCLUDED.history_weeks, generated_at = EXCLUDED.generated_at
+	`, cropID, region, tier, res.Model, string(points), res.BacktestWeeks, res.MAPE, res.Accuracy, res.Observations, res.HistoryWeeks)
+	return err
+}
+
+// RecomputeForecasts refits every crop/region/tier (and each crop's national series)
+// that has enough weeks of published reports. Run nightly.
+func (h *Handler) RecomputeForecasts(ctx context.Context) error {
+	rows, err := h.DB.Query(ctx, `
+		SELECT crop_type_id, COALESCE(region, $1), volume_tier
+		FROM market_prices
+		WHERE is_active = TRUE AND status = 'published'
+		  AND submitted_at >= NOW() - make_interval(years => $2)
+		  AND volume_tier IN ('retail', 'wholesale')
+		GROUP BY GROUPING SETS ((crop_type_id, region, volume_tier), (crop_type_id, volume_tier))
+		HAVING COUNT(DISTINCT date_trunc('week', submitted_at)) >= $3
+	`, NationalSeries, forecastHistoryYears, forecast.MinObservations)
+	if err != nil {
+		return fmt.Errorf("forecast candidates: %w", err)
+	}
+
+	type key struct {
+		cropID       int
+		region, tier string
+	}
+	var keys []key
+	for rows.Next() {
+		var k key
+		if err := rows.Scan(&k.cropID, &k.region, &k.tier); err != nil {
+			rows.Close()
+			return fmt.Errorf("forecast candidates: %w", err)
+		}
+		// GetPriceForecast looks forecasts up by canonical region; a report stored
+		// under any other name would only produce a forecast nobody reads
+		if k.region != NationalSeries {
+			if !slices.Contains(regions.All, k.region) {
+				continue
+			}
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("forecast candidates: %w", err)
+	}
+
+	started := time.Now()
+	stored := 0
+	for _, k := range keys {
+		res, err := h.computeForecast(ctx, k.cropID, k.region, k.tier)
+		if errors.Is(err, forecast.ErrInsufficientHistory) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("forecast %d/%s/%s: %w", k.cropID, k.region, k.tier, err)
+		}
+		if err := h.storeForecast(ctx, k.cropID, k.region, k.tier, res); err != nil {
+			return fmt.Errorf("store forecast %d/%s/%s: %w", k.cropID, k.region, k.tier, err)
+		}
+		stored++
+	}
+
+	// Series that no longer qualify shouldn't keep serving an old forecast
+	if _, err := h.DB.Exec(ctx, "DELETE FROM price_forecasts WHERE generated_at < $1", started); err != nil {
+		return err
+	}
+
+	log.Printf("Recomputed %d price forecasts\n", stored)
+	return nil
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"farmlite/internal/priceimport"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Roles allowed to bulk import price sheets
+var priceImportRoles = []string{"admin", "officer"}
+
+// How many valid rows a dry run echoes back
+const importPreviewRows = 50
+
+var (
+	// ErrImportInvalid means the sheet had row errors, so nothing was imported.
+	ErrImportInvalid = errors.New("sheet has invalid rows; nothing was imported")
+	// ErrBadSheet means the sheet as a whole couldn't be read (missing columns, no rows, ...).
+	ErrBadSheet = errors.New("invalid sheet")
+	// ErrNotImporter means the user isn't an admin or extension officer.
+	ErrNotImporter = errors.New("only admins and extension officers can import prices")
+)
+
+type PriceImportRequest struct {
+	UserID   int
+	Source   string // e.g. "Fergana bazaar weekly report"
+	Filename string
+	DryRun   bool
+	Options  priceimport.Options
+}
+
+type PriceImportResult struct {
+	DryRun     bool                   `json:"dry_run"`
+	ImportID   *int                   `json:"import_id,omitempty"`
+	Source     string                 `json:"source"`
+	TotalRows  int                    `json:"total_rows"`
+	ValidRows  int                    `json:"valid_rows"`
+	ErrorCount int                    `json:"error_count"`
+	Errors     []priceimport.RowError `json:"errors"`
+	Preview    []priceimport.Row      `json:"preview,omitempty"`
+}
+
+// ImportPrices validates a price sheet and, unless it is a dry run, inserts every row
+// in one transaction tagged with the source. Only admins and extension officers may
+// import (ErrNotImporter). Any invalid row aborts the whole import with
+// ErrImportInvalid; the result still lists the row errors.
+func (h *Handler) ImportPrices(ctx context.Context, table []priceimport.Record, req PriceImportRequest) (PriceImportResult, error) {
+	res := PriceImportResult{DryRun: req.DryRun, Source: req.Source, Errors: []priceimport.RowError{}}
+	if !h.userHasRole(ctx, req.UserID, priceImportRoles...) {
+		return res, ErrNotImporter
+	}
+	if strings.TrimSpace(req.Source) == "" {
+		return res, fmt.Errorf("%w: source is required", ErrBadSheet)
+	}
+
+	crops, err := h.cropIDsByName(ctx)
+	if err != nil {
+		return res, fmt.Errorf("load crops: %w", err)
+	}
+
+	rows, rowErrors, err := priceimport.Validate(table, crops, req.Options)
+	if err != nil {
+		return res, fmt.Errorf("%w: %v", ErrBadSheet, err)
+	}
+	res.TotalRows = len(table) - 1
+	res.ValidRows = len(rows)
+	res.ErrorCount = len(rowErrors)
+	if rowErrors != nil {
+		res.Errors = rowErrors
+	}
+
+	if req.DryRun {
+		res.Preview = rows
+		if len(rows) > importPreviewRows {
+			res.Preview = rows[:importPreviewRows]
+		}
+		return res, nil
+	}
+	if len(rowErrors) > 0 {
+		return res, ErrImportInvalid
+	}
+
+	var importedBy *int
+	if req.UserID > 0 {
+		importedBy = &req.UserID
+	}
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback(ctx)
+
+	var importID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO price_imports (source, filename, imported_by, row_count)
+		VALUES ($1, NULLIF($2, ''), $3, $4)
+		RETURNING id
+	`, req.Source, req.Filename, importedBy, len(rows)).Scan(&importID)
+	if err != nil {
+		return res, fmt.Errorf("create import: %w", err)
+	}
+
+	// Official sheets skip the outlier hold that crowdsourced reports go through
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"market_prices"},
+		[]string{"crop_type_id", "region", "price_per_kg", "volume_tier", "currency", "submitted_by", "submitted_at", "status", "source", "import_id"},
+		pgx.CopyFromSlice(len(rows), func(i int) ([]interface{}, error) {
+			r := rows[i]
+			return []interface{}{r.CropTypeID, r.Region, r.PricePerKG, r.VolumeTier, r.Currency, importedBy, r.Date, "published", req.Source, importID}, nil
+		}),
+	)
+	if err != nil {
+		return res, fmt.Errorf("insert prices: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return res, err
+	}
+	res.ImportID = &importID
+
+	if err := h.RefreshPriceSummaries(ctx); err != nil {
+		log.Printf("Price summary refresh error: %v\n", err)
+	}
+	go func() {
+		if err := h.EvaluatePriceAlerts(context.Background()); err != nil {
+			log.Printf("Price alert evaluation error: %v\n", err)
+		}
+	}()
+	return res, nil
+}
+
+// cropIDsByName maps lower-cased crop names to their ids.
+func (h *Handler) cropIDsByName(ctx context.Context) (map[string]int, error) {
+	rows, err := h.DB.Query(ctx, "SELECT id, name FROM crop_types")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	crops := make(map[string]int)
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		crops[strings.ToLower(name)] = id
+	}
+	return crops, rows.Err()
+}
+
+// UploadPriceSheet imports a CSV or XLSX price sheet.
+// POST /api/admin/prices/import (multipart: file, user_id, source, mapping, currency, tier, date, dry_run)
+// Dry run is the default; send dry_run=false to import.
+func (h *Handler) UploadPriceSheet(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, _ := strconv.Atoi(c.PostForm("user_id"))
+	if !h.userHasRole(ctx, userID, priceImportRoles...) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins and extension officers can import prices"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if file.Size > priceimport.MaxFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("file is larger than %d MB", priceimport.MaxFileSize>>20)})
+		return
+	}
+
+	mapping, err := priceimport.ParseMapping(c.PostForm("mapping"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts := priceimport.Options{
+		Mapping:  mapping,
+		Currency: c.PostForm("currency"),
+		Tier:     c.PostForm("tier"),
+	}
+	if v := c.PostForm("date"); v != "" {
+		if opts.Date, err = priceimport.ParseDate(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), ".")
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read file"})
+		return
+	}
+	defer f.Close()
+
+	table, err := priceimport.ReadTable(f, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not parse sheet: " + err.Error()})
+		return
+	}
+
+	started := time.Now()
+	res, err := h.ImportPrices(ctx, table, PriceImportRequest{
+		UserID:   userID,
+		Source:   c.PostForm("source"),
+		Filename: file.Filename,
+		DryRun:   c.DefaultPostForm("dry_run", "true") != "false",
+		Options:  opts,
+	})
+	switch {
+	case errors.Is(err, ErrNotImporter):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins and extension officers can import prices"})
+		return
+	case errors.Is(err, ErrImportInvalid):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "result": res})
+		return
+	case errors.Is(err, ErrBadSheet):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("UploadPriceSheet: Import error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Import failed; nothing was imported"})
+		return
+	}
+
+	if !res.DryRun {
+		log.Printf("Imported %d prices from %q (%s) in %v\n", res.ValidRows, res.Source, file.Filename, time.Since(started))
+	}
+	c.JSON(http.StatusOK, res)
+}
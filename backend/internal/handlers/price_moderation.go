@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"farmlite/internal/pricing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Roles allowed to review other people's price reports
+var priceModeratorRoles = []string{"admin", "officer"}
+
+type PendingPrice struct {
+	ID          int       `json:"id"`
+	CropTypeID  int       `json:"crop_type_id"`
+	CropName    string    `json:"crop_name"`
+	Region      string    `json:"region"`
+	PricePerKG  float64   `json:"price_per_kg"`
+	Currency    string    `json:"currency"`
+	VolumeTier  string    `json:"volume_tier"`
+	SubmittedBy *int      `json:"submitted_by"`
+	FlagReason  *string   `json:"flag_reason"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// recentPrices returns the last 30 days of published prices for a crop, region and tier,
+// converted into cur so they can be compared with a new submission.
+func (h *Handler) recentPrices(ctx context.Context, cropTypeID int, region, tier, cur string, excludeID int) ([]float64, error) {
+	rows, err := h.DB.Query(ctx, `
+		SELECT price_per_kg * fx_rate(currency, $4, submitted_at::date)
+		FROM market_prices
+		WHERE crop_type_id = $1 AND region = $2 AND volume_tier = $3
+		  AND is_active = TRUE AND status = 'published' AND id <> $5
+		  AND submitted_at >= NOW() - INTERVAL '30 days'
+	`, cropTypeID, region, tier, cur, excludeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []float64
+	for rows.Next() {
+		var p *float64
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		// No exchange rate for this pair; leave it out rather than compare apples to oranges
+		if p != nil {
+			prices = append(prices, *p)
+		}
+	}
+	return prices, rows.Err()
+}
+
+// GetPendingPrices lists reports held for confirmation. Moderators see all of them,
+// everyone else only their own.
+func (h *Handler) GetPendingPrices(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	ownerFilter := userID
+	if h.userHasRole(ctx, userID, priceModeratorRoles...) {
+		ownerFilter = 0
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT p.id, p.crop_type_id, c.name, p.region, p.price_per_kg, p.currency, p.volume_tier,
+		       p.submitted_by, p.flag_reason, p.submitted_at
+		FROM market_prices p
+		JOIN crop_types c ON p.crop_type_id = c.id
+		WHERE p.status = 'pending' AND p.is_active = TRUE
+		  AND ($1 = 0 OR p.submitted_by = $1)
+		ORDER BY p.submitted_at DESC
+	`, ownerFilter)
+	if err != nil {
+		log.Printf("GetPendingPrices: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pending prices"})
+		return
+	}
+	defer rows.Close()
+
+	pending := []PendingPrice{}
+	for rows.Next() {
+		var p PendingPrice
+		if err := rows.Scan(&p.ID, &p.CropTypeID, &p.CropName, &p.Region, &p.PricePerKG, &p.Currency, &p.VolumeTier,
+			&p.SubmittedBy, &p.FlagReason, &p.SubmittedAt); err != nil {
+			log.Printf("GetPendingPrices: Scan error: %v\n", err)
+			continue
+		}
+		pending = append(pending, p)
+	}
+
+	c.JSON(http.StatusOK, pending)
+}
+
+// loadPendingPrice fetches a held report and checks that userID may act on it.
+// It writes the error response itself and returns false if the caller should stop.
+func (h *Handler) loadPendingPrice(c *gin.Context, userID int) (PendingPrice, bool) {
+	var p PendingPrice
+	err := h.DB.QueryRow(c.Request.Context(), `
+		SELECT id, crop_type_id, region, price_per_kg, currency, volume_tier, submitted_by, flag_reason, submitted_at
+		FROM market_prices
+		WHERE id = $1 AND is_active = TRUE AND status = 'pending'
+	`, c.Param("id")).Scan(&p.ID, &p.CropTypeID, &p.Region, &p.PricePerKG, &p.Currency, &p.VolumeTier,
+		&p.SubmittedBy, &p.FlagReason, &p.SubmittedAt)
+
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pending price entry not found"})
+		return p, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price entry"})
+		return p, false
+	}
+
+	isOwner := p.SubmittedBy != nil && *p.SubmittedBy == userID
+	if !isOwner && !h.userHasRole(c.Request.Context(), userID, priceModeratorRoles...) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the submitter or a moderator can review this price"})
+		return p, false
+	}
+	return p, true
+}
+
+// ConfirmPrice publishes a held report. Only a moderator can publish the price as
+// reported; the submitter may only correct it, and a corrected price is checked again
+// and stays pending if still unusual.
+// POST /api/prices/:id/confirm
+func (h *Handler) ConfirmPrice(c *gin.Context) {
+	var req struct {
+		UserID     int      `json:"user_id" binding:"required"`
+		PricePerKG *float64 `json:"price_per_kg"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	p, ok := h.loadPendingPrice(c, req.UserID)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	corrected := req.PricePerKG != nil && *req.PricePerKG != p.PricePerKG
+	if !corrected && !h.userHasRole(ctx, req.UserID, priceModeratorRoles...) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "An unusual price has to be confirmed by a moderator; correct it if it was a mistake"})
+		return
+	}
+
+	if corrected {
+		if *req.PricePerKG <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "price_per_kg must be positive"})
+			return
+		}
+
+		recent, err := h.recentPrices(ctx, p.CropTypeID, p.Region, p.VolumeTier, p.Currency, p.ID)
+		if err != nil {
+			log.Printf("ConfirmPrice: Recent prices error: %v\n", err)
+		}
+		verdict := pricing.Check(*req.PricePerKG, recent)
+		if verdict.Suspicious {
+			_, err = h.DB.Exec(ctx,
+				"UPDATE market_prices SET price_per_kg = $1, flag_reason = $2 WHERE id = $3",
+				*req.PricePerKG, verdict.Reason, p.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update price entry"})
+				return
+			}
+			c.JSON(http.StatusAccepted, gin.H{
+				"message": "Corrected price still looks unusual and remains held",
+				"id":      p.ID,
+				"status":  "pending",
+				"check":   verdict,
+			})
+			return
+		}
+		p.PricePerKG = *req.PricePerKG
+	}
+
+	_, err := h.DB.Exec(ctx, `
+		UPDATE market_prices
+		SET price_per_kg = $1, status = 'published', reviewed_by = $2, reviewed_at = NOW()
+		WHERE id = $3
+	`, p.PricePerKG, req.UserID, p.ID)
+	if err != nil {
+		log.Printf("ConfirmPrice: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm price entry"})
+		return
+	}
+
+	h.refreshPriceGroup(ctx, p.CropTypeID, p.Region)
+	h.checkPriceAlertsAsync(p.CropTypeID, p.Region)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Price published", "id": p.ID, "status": "published", "price_per_kg": p.PricePerKG})
+}
+
+// RejectPrice discards a held report, either withdrawn by its submitter or rejected by a moderator.
+// POST /api/prices/:id/reject
+func (h *Handler) RejectPrice(c *gin.Context) {
+	var req struct {
+		UserID int    `json:"user_id" binding:"required"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	p, ok := h.loadPendingPrice(c, req.UserID)
+	if !ok {
+		return
+	}
+
+	reason := p.FlagReason
+	if req.Reason != "" {
+		reason = &req.Reason
+	}
+
+	_, err := h.DB.Exec(c.Request.Context(), `
+		UPDATE market_prices
+		SET status = 'rejected', flag_reason = $1, reviewed_by = $2, reviewed_at = NOW()
+		WHERE id = $3
+	`, reason, req.UserID, p.ID)
+	if err != nil {
+		log.Printf("RejectPrice: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject price entry"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Price rejected", "id": p.ID, "status": "rejected"})
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"farmlite/internal/pricing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// verifiedConfidence is the confidence a regional price needs before it is shown as verified.
+// Configurable through PRICE_VERIFIED_CONFIDENCE (0-1).
+func verifiedConfidence() float64 {
+	if v, err := strconv.ParseFloat(os.Getenv("PRICE_VERIFIED_CONFIDENCE"), 64); err == nil && v > 0 && v <= 1 {
+		return v
+	}
+	return pricing.DefaultVerifiedConfidence
+}
+
+// VotePrice records a user's confirm or dispute vote on someone else's price report.
+// Voting again replaces the earlier vote.
+// POST /api/prices/:id/vote
+func (h *Handler) VotePrice(c *gin.Context) {
+	var req struct {
+		UserID int    `json:"user_id" binding:"required"`
+		Vote   string `json:"vote" binding:"required"` // "confirm" or "dispute"
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	if req.Vote != "confirm" && req.Vote != "dispute" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "vote must be 'confirm' or 'dispute'"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var priceID, cropTypeID int
+	var region string
+	var submittedBy *int
+	err := h.DB.QueryRow(ctx,
+		"SELECT id, submitted_by, crop_type_id, region FROM market_prices WHERE id = $1 AND is_active = TRUE AND status = 'published'",
+		c.Param("id")).Scan(&priceID, &submittedBy, &cropTypeID, &region)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Price entry not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price entry"})
+		return
+	}
+
+	if submittedBy != nil && *submittedBy == req.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot vote on your own price report"})
+		return
+	}
+
+	_, err = h.DB.Exec(ctx, `
+		INSERT INTO price_votes (price_id, user_id, vote)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (price_id, user_id) DO UPDATE SET vote = EXCLUDED.vote, created_at = CURRENT_TIMESTAMP
+	`, priceID, req.UserID, req.Vote)
+	if err != nil {
+		log.Printf("VotePrice: Insert error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record vote"})
+		return
+	}
+
+	// Votes change the report's weight in its region's averages
+	h.refreshPriceGroup(ctx, cropTypeID, region)
+
+	var confirms, disputes int
+	err = h.DB.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE vote = 'confirm'), COUNT(*) FILTER (WHERE vote = 'dispute')
+		FROM price_votes WHERE price_id = $1
+	`, priceID).Scan(&confirms, &disputes)
+	if err != nil {
+		log.Printf("VotePrice: Tally error: %v\n", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote recorded", "id": priceID, "confirms": confirms, "disputes": disputes})
+}
+
+// GetUserReputation returns a submitter's price reputation.
+// GET /api/users/:id/reputation
+func (h *Handler) GetUserReputation(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	var stats pricing.ReputationStats
+	var score float64
+	var updatedAt *time.Time
+	err = h.DB.QueryRow(c.Request.Context(), `
+		SELECT score, agreed, compared, confirms, disputes, updated_at
+		FROM user_reputation WHERE user_id = $1
+	`, userID).Scan(&score, &stats.Agreed, &stats.Compared, &stats.Confirms, &stats.Disputes, &updatedAt)
+	if err == pgx.ErrNoRows {
+		score = pricing.DefaultReputation
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reputation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":    userID,
+		"score":      score,
+		"stats":      stats,
+		"updated_at": updatedAt,
+	})
+}
+
+// RefreshReputation recomputes every submitter's reputation. A report is compared with
+// the median of other users' published reports for the same crop, region and tier from
+// shortly before to a week after it; rejected reports always count as disagreement.
+func (h *Handler) RefreshReputation(ctx context.Context) error {
+	started := time.Now()
+	stats := make(map[int]*pricing.ReputationStats)
+	get := func(userID int) *pricing.ReputationStats {
+		s, ok := stats[userID]
+		if !ok {
+			s = &pricing.ReputationStats{}
+			stats[userID] = s
+		}
+		return s
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT p.submitted_by, p.status,
+		       p.price_per_kg * fx_rate(p.currency, 'USD', p.submitted_at::date),
+		       (
+		           SELECT PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY o.price_per_kg * fx_rate(o.currency, 'USD', o.submitted_at::date))
+		           FROM market_prices o
+		           WHERE o.crop_type_id = p.crop_type_id AND o.region = p.region AND o.volume_tier = p.volume_tier
+		             AND o.is_active = TRUE AND o.status = 'published'
+		             AND o.submitted_by IS DISTINCT FROM p.submitted_by
+		             AND o.submitted_at BETWEEN p.submitted_at - INTERVAL '3 days' AND p.submitted_at + INTERVAL '7 days'
+		           HAVING COUNT(*) >= 2
+		       )
+		FROM market_prices p
+		WHERE p.submitted_by IS NOT NULL AND p.is_active = TRUE AND p.status IN ('published', 'rejected')
+		  AND p.submitted_at >= NOW() - INTERVAL '180 days'
+	`)
+	if err != nil {
+		return fmt.Errorf("consensus query: %w", err)
+	}
+	for rows.Next() {
+		var userID int
+		var status string
+		var price, consensus *float64
+		if err := rows.Scan(&userID, &status, &price, &consensus); err != nil {
+			rows.Close()
+			return fmt.Errorf("consensus scan: %w", err)
+		}
+		switch {
+		case status == "rejected":
+			get(userID).Compared++
+		case price != nil && consensus != nil:
+			s := get(userID)
+			s.Compared++
+			if pricing.Agrees(*price, *consensus) {
+				s.Agreed++
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("consensus rows: %w", err)
+	}
+
+	rows, err = h.DB.Query(ctx, `
+		SELECT p.submitted_by,
+		       COUNT(*) FILTER (WHERE v.vote = 'confirm'),
+		       COUNT(*) FILTER (WHERE v.vote = 'dispute')
+		FROM price_votes v
+		JOIN market_prices p ON v.price_id = p.id
+		WHERE p.submitted_by IS NOT NULL AND v.user_id <> p.submitted_by AND p.is_active = TRUE
+		GROUP BY p.submitted_by
+	`)
+	if err != nil {
+		return fmt.Errorf("vote query: %w", err)
+	}
+	for rows.Next() {
+		var userID, confirms, disputes int
+		if err := rows.Scan(&userID, &confirms, &disputes); err != nil {
+			rows.Close()
+			return fmt.Errorf("vote scan: %w", err)
+		}
+		s := get(userID)
+		s.Confirms, s.Disputes = confirms, disputes
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("vote rows: %w", err)
+	}
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for userID, s := range stats {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO user_reputation (user_id, score, agreed, compared, confirms, disputes, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (user_id) DO UPDATE
+			SET score = EXCLUDED.score, agreed = EXCLUDED.agreed, compared = EXCLUDED.compared,
+			    confirms = EXCLUDED.confirms, disputes = EXCLUDED.disputes, updated_at = EXCLUDED.updated_at
+		`, userID, s.Score(), s.Agreed, s.Compared, s.Confirms, s.Disputes, started)
+		if err != nil {
+			return fmt.Errorf("store reputation for user %d: %w", userID, err)
+		}
+	}
+
+	// Users whose reports have all been deleted fall back to the default
+	if _, err := tx.Exec(ctx, "DELETE FROM user_reputation WHERE updated_at < $1", started); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"farmlite/internal/currency"
+	"farmlite/internal/regions"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// NationalSeries is the region name used for a series pooled over all regions.
+const NationalSeries = "All"
+
+// Longest range allowed per bucket interval, to keep responses chart-sized
+var seriesMaxRange = map[string]time.Duration{
+	"day":   366 * 24 * time.Hour,
+	"week":  5 * 366 * 24 * time.Hour,
+	"month": 10 * 366 * 24 * time.Hour,
+}
+
+type PriceBucket struct {
+	Start  string  `json:"start"`
+	Open   float64 `json:"open"`
+	Close  float64 `json:"close"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Median float64 `json:"median"`
+	Mean   float64 `json:"mean"`
+	Count  int     `json:"count"`
+}
+
+type PriceSeries struct {
+	Region  string        `json:"region"`
+	Buckets []PriceBucket `json:"buckets"`
+}
+
+// priceSeriesQuery describes one bucketed price lookup. An empty Regions slice
+// means a single national series.
+type priceSeriesQuery struct {
+	CropTypeID int
+	Regions    []string
+	Tier       string // "retail", "wholesale" or "" for both
+	From, To   time.Time
+	Interval   string // day, week or month
+	Currency   string
+}
+
+// GetPriceSeries returns bucketed price statistics for charts.
+// GET /api/prices/series?crop=&region=&tier=&from=&to=&interval=day|week|month
+// region may be repeated or comma-separated; "All" adds the national series.
+func (h *Handler) GetPriceSeries(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	crop := c.Query("crop")
+	if crop == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "crop is required"})
+		return
+	}
+	var cropID int
+	var cropName string
+	err := h.DB.QueryRow(ctx, "SELECT id, name FROM crop_types WHERE name = $1 OR id::text = $1", crop).Scan(&cropID, &cropName)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown crop: " + crop})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up crop"})
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "day")
+	maxRange, ok := seriesMaxRange[interval]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be day, week or month"})
+		return
+	}
+
+	tier := c.DefaultQuery("tier", "retail")
+	switch tier {
+	case "retail", "wholesale":
+	case "all":
+		tier = ""
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tier must be retail, wholesale or all"})
+		return
+	}
+
+	to := time.Now()
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date (YYYY-MM-DD)"})
+			return
+		}
+	}
+	// Make the end date inclusive
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -90)
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date (YYYY-MM-DD)"})
+			return
+		}
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	if to.Sub(from) > maxRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Range too long for %s buckets; use a coarser interval", interval)})
+		return
+	}
+
+	var requested []string
+	for _, v := range c.QueryArray("region") {
+		requested = append(requested, strings.Split(v, ",")...)
+	}
+	if len(requested) == 0 {
+		requested = []string{NationalSeries}
+	}
+	var named []string
+	national := false
+	seen := make(map[string]bool)
+	for _, r := range requested {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if strings.EqualFold(r, NationalSeries) {
+			national = true
+			continue
+		}
+		canonical, ok := regions.Canonical(r)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown region: " + r})
+			return
+		}
+		if !seen[canonical] {
+			seen[canonical] = true
+			named = append(named, canonical)
+		}
+	}
+
+	target, err := h.resolveCurrency(c, currency.UZS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	q := priceSeriesQuery{
+		CropTypeID: cropID,
+		Tier:       tier,
+		From:       from,
+		To:         to,
+		Interval:   interval,
+		Currency:   target,
+	}
+
+	series := []PriceSeries{}
+	if len(named) > 0 {
+		q.Regions = named
+		byRegion, err := h.loadPriceSeries(ctx, q)
+		if err != nil {
+			log.Printf("GetPriceSeries: Query error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load price series"})
+			return
+		}
+		for _, r := range named {
+			buckets := byRegion[r]
+			if buckets == nil {
+				buckets = []PriceBucket{}
+			}
+			series = append(series, PriceSeries{Region: r, Buckets: buckets})
+		}
+	}
+	if national {
+		q.Regions = nil
+		all, err := h.loadPriceSeries(ctx, q)
+		if err != nil {
+			log.Printf("GetPriceSeries: National query error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load price series"})
+			return
+		}
+		buckets := all[NationalSeries]
+		if buckets == nil {
+			buckets = []PriceBucket{}
+		}
+		series = append(series, PriceSeries{Region: NationalSeries, Buckets: buckets})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"crop":     cropName,
+		"tier":     c.DefaultQuery("tier", "retail"),
+		"interval": interval,
+		"from":     from.Format("2006-01-02"),
+		"to":       to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"currency": target,
+		"series":   series,
+	})
+}
+
+// loadPriceSeries aggregates published prices into buckets, keyed by region
+// (or NationalSeries when q.Regions is empty). Buckets are in ascending order.
+func (h *Handler) loadPriceSeries(ctx context.Context, q priceSeriesQuery) (map[string][]PriceBucket, error) {
+	// Kept as two statements so each matches its own partial index. Reports are
+	// stored under the canonical region (SubmitPrice, the importer and migration 35),
+	// so matching the canonical names exactly finds every spelling.
+	groupBy := "p.region"
+	regionFilter := "p.region = ANY($7)"
+	args := []interface{}{q.CropTypeID, q.Tier, q.From, q.To, q.Interval, q.Currency, q.Regions}
+	if len(q.Regions) == 0 {
+		groupBy = "'" + NationalSeries + "'"
+		regionFilter = "TRUE"
+		args = args[:6]
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s AS series_region,
+		       date_trunc($5, p.submitted_at)::date AS bucket,
+		       (ARRAY_AGG(x.price ORDER BY p.submitted_at ASC))[1] AS open,
+		       (ARRAY_AGG(x.price ORDER BY p.submitted_at DESC))[1] AS close,
+		       MIN(x.price), MAX(x.price),
+		       PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY x.price),
+		       AVG(x.price),
+		       COUNT(*)
+		FROM market_prices p
+		CROSS JOIN LATERAL (SELECT p.price_per_kg * fx_rate(p.currency, $6, p.submitted_at::date) AS price) x
+		WHERE p.crop_type_id = $1 AND ($2 = '' OR p.volume_tier = $2)
+		  AND p.is_active = TRUE AND p.status = 'published'
+		  AND p.submitted_at >= $3 AND p.submitted_at < $4
+		  AND %s
+		  AND x.price IS NOT NULL
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`, groupBy, regionFilter)
+
+	rows, err := h.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string][]PriceBucket)
+	for rows.Next() {
+		var region string
+		var start time.Time
+		var b PriceBucket
+		if err := rows.Scan(&region, &start, &b.Open, &b.Close, &b.Min, &b.Max, &b.Median, &b.Mean, &b.Count); err != nil {
+			return nil, err
+		}
+		b.Start = start.Format("2006-01-02")
+		result[region] = append(result[region], b)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"farmlite/internal/currency"
+	"farmlite/internal/pricing"
+)
+
+// How long a cached /api/prices response may be served. Changes made through this
+// process invalidate the cache at once; the TTL bounds staleness for changes made
+// elsewhere (the import CLI, another API instance).
+const latestPricesTTL = time.Minute
+
+// priceSummaryQuery computes /api/prices rows for every crop and region with published
+// prices in the last 30 days, in each currency of $1, and upserts them into
+// price_summaries. The %s is an extra condition on market_prices m (from $5 on).
+// Every price is converted at the rate effective on its submission date; averages are
+// trimmed by $2 at each end so a single bad report can't skew a region. Each report is
+// weighted by its submitter's reputation ($3 for anonymous reports, $4 for users
+// without one yet), scaled by reputation-weighted community votes.
+const priceSummaryQuery = `
+	WITH recent AS (
+		SELECT m.id, m.crop_type_id, m.region, m.volume_tier, m.currency, m.price_per_kg, m.submitted_at, m.submitted_by
+		FROM market_prices m
+		WHERE m.is_active = TRUE AND m.status = 'published' AND m.submitted_at >= NOW() - INTERVAL '30 days' %s
+	),
+	rates AS (
+		SELECT d.currency, d.day, t.target, fx_rate(d.currency, t.target, d.day) AS rate
+		FROM (SELECT DISTINCT currency, submitted_at::date AS day FROM recent) d
+		CROSS JOIN unnest($1::text[]) AS t(target)
+	),
+	votes AS (
+		SELECT pv.price_id,
+		       SUM(COALESCE(vr.score, $4)) FILTER (WHERE pv.vote = 'confirm') AS confirm_weight,
+		       SUM(COALESCE(vr.score, $4)) FILTER (WHERE pv.vote = 'dispute') AS dispute_weight
+		FROM price_votes pv
+		LEFT JOIN user_reputation vr ON vr.user_id = pv.user_id
+		WHERE pv.price_id IN (SELECT id FROM recent)
+		GROUP BY pv.price_id
+	),
+	weighted AS (
+		SELECT m.*,
+		       CASE WHEN m.submitted_by IS NULL THEN $3 ELSE COALESCE(r.score, $4) END
+		       * LEAST(GREATEST((1 + COALESCE(v.confirm_weight, 0)) / (1 + COALESCE(v.dispute_weight, 0)), 0.25), 2) AS weight
+		FROM recent m
+		LEFT JOIN user_reputation r ON r.user_id = m.submitted_by
+		LEFT JOIN votes v ON v.price_id = m.id
+	),
+	converted AS (
+		SELECT rt.target, w.*, w.price_per_kg * rt.rate AS price
+		FROM weighted w
+		JOIN rates rt ON rt.currency = w.currency AND rt.day = w.submitted_at::date
+	),
+	ranked AS (
+		SELECT converted.*,
+		       ROW_NUMBER() OVER (PARTITION BY target, crop_type_id, region, volume_tier ORDER BY price) AS rn,
+		       COUNT(*) OVER (PARTITION BY target, crop_type_id, region, volume_tier) AS cnt
+		FROM converted
+		WHERE price IS NOT NULL
+	),
+	trimmed AS (
+		SELECT ranked.*, (rn > FLOOR(cnt * $2::numeric) AND rn <= cnt - FLOOR(cnt * $2::numeric)) AS kept
+		FROM ranked
+	),
+	stats AS (
+		SELECT target, crop_type_id, region,
+			COALESCE(SUM(price * weight) FILTER (WHERE volume_tier = 'retail' AND kept)
+				/ NULLIF(SUM(weight) FILTER (WHERE volume_tier = 'retail' AND kept), 0), 0) AS retail_price,
+			COALESCE(SUM(price * weight) FILTER (WHERE volume_tier = 'wholesale' AND kept)
+				/ NULLIF(SUM(weight) FILTER (WHERE volume_tier = 'wholesale' AND kept), 0), 0) AS wholesale_price,
+			COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY price) FILTER (WHERE volume_tier = 'retail'), 0) AS retail_median,
+			COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY price) FILTER (WHERE volume_tier = 'wholesale'), 0) AS wholesale_median,
+			COUNT(*) FILTER (WHERE volume_tier = 'retail') AS retail_samples,
+			COUNT(*) FILTER (WHERE volume_tier = 'wholesale') AS wholesale_samples,
+			COALESCE(SUM(weight) FILTER (WHERE submitted_at >= NOW() - INTERVAL '48 hours'), 0) AS recent_weight,
+			MAX(submitted_at) AS last_update
+		FROM trimmed
+		GROUP BY target, crop_type_id, region
+	),
+	history AS (
+		SELECT target, crop_type_id, region,
+		       jsonb_agg(jsonb_build_object(
+		           'id', id,
+		           'price', price,
+		           'original_price', price_per_kg,
+		           'currency', currency,
+		           'date', submitted_at,
+		           'tier', volume_tier,
+		           'user_id', submitted_by
+		       ) ORDER BY submitted_at ASC) AS history
+		FROM converted
+		GROUP BY target, crop_type_id, region
+	),
+	activity AS (
+		SELECT crop_type_id, region,
+		       COUNT(DISTINCT submitted_by) FILTER (WHERE submitted_at >= NOW() - INTERVAL '48 hours') AS dist_farmers,
+		       COUNT(*) FILTER (WHERE submitted_at >= NOW() - INTERVAL '48 hours' AND submitted_by IS NULL) AS anon_reports
+		FROM recent
+		GROUP BY crop_type_id, region
+	),
+	latest AS (
+		SELECT DISTINCT ON (crop_type_id, region) crop_type_id, region, id, submitted_by
+		FROM recent
+		ORDER BY crop_type_id, region, submitted_at DESC
+	)
+	INSERT INTO price_summaries (crop_type_id, region, currency, retail_price, wholesale_price, retail_median, wholesale_median,
+		retail_samples, wholesale_samples, recent_weight, last_update, history, dist_farmers, anon_reports, owner, latest_id, refreshed_at)
+	SELECT s.crop_type_id, s.region, s.target, s.retail_price, s.wholesale_price, s.retail_median, s.wholesale_median,
+	       s.retail_samples, s.wholesale_samples, s.recent_weight, s.last_update, h.history, a.dist_farmers, a.anon_reports,
+	       l.submitted_by, l.id, NOW()
+	FROM stats s
+	JOIN history h USING (target, crop_type_id, region)
+	JOIN activity a USING (crop_type_id, region)
+	JOIN latest l USING (crop_type_id, region)
+	ON CONFLICT (crop_type_id, region, currency) DO UPDATE SET
+		retail_price = EXCLUDED.retail_price,
+		wholesale_price = EXCLUDED.wholesale_price,
+		retail_median = EXCLUDED.retail_median,
+		wholesale_median = EXCLUDED.wholesale_median,
+		retail_samples = EXCLUDED.retail_samples,
+		wholesale_samples = EXCLUDED.wholesale_samples,
+		recent_weight = EXCLUDED.recent_weight,
+		last_update = EXCLUDED.last_update,
+		history = EXCLUDED.history,
+		dist_farmers = EXCLUDED.dist_farmers,
+		anon_reports = EXCLUDED.anon_reports,
+		owner = EXCLUDED.owner,
+		latest_id = EXCLUDED.latest_id,
+		refreshed_at = EXCLUDED.refreshed_at
+`
+
+// RefreshPriceSummaries recomputes every price summary. It runs on a schedule so the
+// 30-day and 48-hour windows roll forward and reputation changes are picked up.
+func (h *Handler) RefreshPriceSummaries(ctx context.Context) error {
+	return h.refreshPriceSummaries(ctx, "", "")
+}
+
+// RefreshPriceGroup recomputes the summaries of one crop and region after its prices change.
+func (h *Handler) RefreshPriceGroup(ctx context.Context, cropTypeID int, region string) error {
+	return h.refreshPriceSummaries(ctx, "AND m.crop_type_id = $5 AND m.region = $6", "s.crop_type_id = $1 AND s.region = $2", cropTypeID, region)
+}
+
+// refreshPriceSummaries upserts the summaries matching filter (on market_prices m) and
+// then drops the rows in scope (on price_summaries s) that weren't rewritten, i.e.
+// groups with no recent published prices left. Upserting rather than replacing keeps
+// concurrent refreshes of the same group from conflicting.
+func (h *Handler) refreshPriceSummaries(ctx context.Context, filter, scope string, args ...interface{}) error {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	params := append([]interface{}{currency.Supported, pricing.TrimFraction, pricing.AnonymousWeight, pricing.DefaultReputation}, args...)
+	if _, err := tx.Exec(ctx, fmt.Sprintf(priceSummaryQuery, filter), params...); err != nil {
+		return fmt.Errorf("compute price summaries: %w", err)
+	}
+
+	// NOW() is the transaction start, so rows written above are never older than it
+	if scope == "" {
+		scope = "TRUE"
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM price_summaries s WHERE "+scope+" AND s.refreshed_at < NOW()", args...); err != nil {
+		return fmt.Errorf("prune price summaries: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	h.latestPrices.invalidate()
+	return nil
+}
+
+// refreshPriceGroup refreshes a group after a change to its prices. A failure only
+// delays the change until the next scheduled refresh, so it is logged, not returned.
+func (h *Handler) refreshPriceGroup(ctx context.Context, cropTypeID int, region string) {
+	if err := h.RefreshPriceGroup(ctx, cropTypeID, region); err != nil {
+		log.Printf("Price summary refresh error (crop %d, %s): %v\n", cropTypeID, region, err)
+	}
+}
+
+// InvalidatePriceCache drops cached /api/prices responses.
+func (h *Handler) InvalidatePriceCache() {
+	h.latestPrices.invalidate()
+}
+
+// responseCache holds rendered JSON responses by key. Every invalidation starts a new
+// generation; a response rendered from data read before an invalidation is not stored.
+type responseCache struct {
+	mu         sync.RWMutex
+	ttl        time.Duration
+	generation uint64
+	entries    map[string]cachedResponse
+}
+
+type cachedResponse struct {
+	body    []byte
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{ttl: ttl, entries: make(map[string]cachedResponse)}
+}
+
+func (c *responseCache) get(key string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// current returns the generation to pass to set once the response is rendered.
+func (c *responseCache) current() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+func (c *responseCache) set(key string, generation uint64, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.entries[key] = cachedResponse{body: body, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *responseCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = make(map[string]cachedResponse)
+}
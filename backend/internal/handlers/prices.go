@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 
+	"farmlite/internal/currency"
+	"farmlite/internal/pricing"
+	"farmlite/internal/regions"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -13,6 +18,7 @@ type PriceSubmission struct {
 	Region     string  `json:"region" binding:"required"`
 	PricePerKG float64 `json:"price_per_kg" binding:"required"`
 	VolumeTier string  `json:"volume_tier"` // "retail" or "wholesale"
+	Currency   string  `json:"currency"`    // ISO code, defaults to UZS
 	UserID     *int    `json:"user_id"`     // Use pointer to allow NULL
 }
 
@@ -35,15 +41,51 @@ func (h *Handler) SubmitPrice(c *gin.Context) {
 		return
 	}
 
+	if input.PricePerKG <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price_per_kg must be positive"})
+		return
+	}
+
+	// Reports are grouped and checked against others by region, so every spelling
+	// has to land in the same group
+	region, ok := regions.Canonical(input.Region)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown region: " + input.Region})
+		return
+	}
+	input.Region = region
+
+	code, err := currency.Normalize(input.Currency, currency.UZS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Currency = code
+
 	// Ensure UserID is nil if 0 is passed (common frontend mistake)
 	var userID *int = input.UserID
 	if userID != nil && *userID == 0 {
 		userID = nil
 	}
 
-	_, err := h.DB.Exec(c.Request.Context(),
-		"INSERT INTO market_prices (crop_type_id, region, price_per_kg, volume_tier, submitted_by) VALUES ($1, $2, $3, $4, $5)",
-		input.CropTypeID, input.Region, input.PricePerKG, input.VolumeTier, userID)
+	// Compare against recent reports before publishing
+	recent, err := h.recentPrices(c.Request.Context(), input.CropTypeID, input.Region, input.VolumeTier, input.Currency, 0)
+	if err != nil {
+		log.Printf("SubmitPrice: Recent prices error: %v\n", err)
+	}
+	verdict := pricing.Check(input.PricePerKG, recent)
+
+	status := "published"
+	var flagReason *string
+	if verdict.Suspicious {
+		status = "pending"
+		flagReason = &verdict.Reason
+	}
+
+	var priceID int
+	err = h.DB.QueryRow(c.Request.Context(),
+		"INSERT INTO market_prices (crop_type_id, region, price_per_kg, volume_tier, currency, submitted_by, status, flag_reason) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id",
+		input.CropTypeID, input.Region, input.PricePerKG, input.VolumeTier, input.Currency, userID, status, flagReason).Scan(&priceID)
 
 	if err != nil {
 		log.Printf("SubmitPrice: Insert error: %v\n", err) // Added logging
@@ -51,46 +93,47 @@ func (h *Handler) SubmitPrice(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Price submitted successfully"})
+	if verdict.Suspicious {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Price looks unusual and is held for confirmation",
+			"id":      priceID,
+			"status":  status,
+			"check":   verdict,
+		})
+		return
+	}
+
+	h.refreshPriceGroup(c.Request.Context(), input.CropTypeID, input.Region)
+	h.checkPriceAlertsAsync(input.CropTypeID, input.Region)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Price submitted successfully", "id": priceID, "status": status})
 }
 
+// GetLatestPrices lists the current price of every crop and region, read from the
+// precomputed price_summaries and cached per currency until the next change.
 func (h *Handler) GetLatestPrices(c *gin.Context) {
-	// Robust SQL with accurate verification metrics
-	query := `
-		SELECT 
-			c.name as crop_name,
-			m1.region,
-			COALESCE(AVG(CASE WHEN m1.volume_tier = 'retail' THEN m1.price_per_kg END), 0) as retail_price,
-			COALESCE(AVG(CASE WHEN m1.volume_tier = 'wholesale' THEN m1.price_per_kg END), 0) as wholesale_price,
-			MAX(m1.submitted_at) as last_update,
-			(
-				SELECT json_agg(json_build_object(
-					'id', id, 
-					'price', price_per_kg, 
-					'date', submitted_at, 
-					'tier', volume_tier,
-					'user_id', submitted_by
-				))
-				FROM (
-					SELECT id, price_per_kg, submitted_at, volume_tier, submitted_by
-					FROM market_prices history
-					WHERE history.crop_type_id = m1.crop_type_id AND history.region = m1.region AND history.is_active = TRUE
-					AND history.submitted_at >= NOW() - INTERVAL '30 days'
-					ORDER BY submitted_at ASC
-				) h
-			) as history,
-			(SELECT COUNT(DISTINCT submitted_by) FROM market_prices v WHERE v.crop_type_id = m1.crop_type_id AND v.region = m1.region AND v.submitted_at >= NOW() - INTERVAL '48 hours' AND v.is_active = TRUE AND v.submitted_by IS NOT NULL) as dist_farmers,
-			(SELECT COUNT(*) FROM market_prices v WHERE v.crop_type_id = m1.crop_type_id AND v.region = m1.region AND v.submitted_at >= NOW() - INTERVAL '48 hours' AND v.is_active = TRUE AND v.submitted_by IS NULL) as anon_reports,
-			(SELECT submitted_by FROM market_prices s WHERE s.crop_type_id = m1.crop_type_id AND s.region = m1.region AND s.is_active = TRUE ORDER BY submitted_at DESC LIMIT 1) as owner,
-			(SELECT id FROM market_prices i WHERE i.crop_type_id = m1.crop_type_id AND i.region = m1.region AND i.is_active = TRUE ORDER BY submitted_at DESC LIMIT 1) as latest_id
-		FROM market_prices m1
-		JOIN crop_types c ON m1.crop_type_id = c.id
-		WHERE m1.is_active = TRUE AND m1.submitted_at >= NOW() - INTERVAL '30 days'
-		GROUP BY c.name, m1.region, m1.crop_type_id
-		ORDER BY last_update DESC
-	`
-
-	rows, err := h.DB.Query(c.Request.Context(), query)
+	target, err := h.resolveCurrency(c, currency.UZS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if body, ok := h.latestPrices.get(target); ok {
+		c.Header("X-Cache", "HIT")
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+		return
+	}
+	generation := h.latestPrices.current()
+
+	rows, err := h.DB.Query(c.Request.Context(), `
+		SELECT c.name, s.region, s.retail_price, s.wholesale_price, s.retail_median, s.wholesale_median,
+		       s.retail_samples, s.wholesale_samples, s.recent_weight, s.last_update, s.history,
+		       s.dist_farmers, s.anon_reports, s.owner, s.latest_id
+		FROM price_summaries s
+		JOIN crop_types c ON s.crop_type_id = c.id
+		WHERE s.currency = $1
+		ORDER BY s.last_update DESC
+	`, target)
 	if err != nil {
 		log.Printf("GetLatestPrices: Query error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query failed: " + err.Error()})
@@ -98,17 +141,21 @@ func (h *Handler) GetLatestPrices(c *gin.Context) {
 	}
 	defer rows.Close()
 
+	threshold := verifiedConfidence()
+
 	var results []gin.H
 	for rows.Next() {
 		var name, region string
-		var retailPrice, wholesalePrice float64
+		var retailPrice, wholesalePrice, retailMedian, wholesaleMedian float64
+		var retailSamples, wholesaleSamples int
+		var recentWeight float64
 		var lastUpdate interface{}
 		var historyJSON []byte
 		var distFarmers, anonReports int
 		var submittedBy *int
 		var latestID *int
 
-		if err := rows.Scan(&name, &region, &retailPrice, &wholesalePrice, &lastUpdate, &historyJSON, &distFarmers, &anonReports, &submittedBy, &latestID); err != nil {
+		if err := rows.Scan(&name, &region, &retailPrice, &wholesalePrice, &retailMedian, &wholesaleMedian, &retailSamples, &wholesaleSamples, &recentWeight, &lastUpdate, &historyJSON, &distFarmers, &anonReports, &submittedBy, &latestID); err != nil {
 			log.Printf("GetLatestPrices: Row scan error: %v\n", err)
 			continue
 		}
@@ -118,6 +165,7 @@ func (h *Handler) GetLatestPrices(c *gin.Context) {
 		if historyJSON != nil {
 			historyStr = string(historyJSON)
 		}
+		confidence := pricing.Confidence(recentWeight)
 
 		results = append(results, gin.H{
 			"id":              latestID,
@@ -125,15 +173,33 @@ func (h *Handler) GetLatestPrices(c *gin.Context) {
 			"region":          region,
 			"retail_price":    retailPrice,
 			"wholesale_price": wholesalePrice,
-			"updated_at":      lastUpdate,
-			"history":         historyStr,
-			"dist_farmers":    distFarmers,
-			"anon_reports":    anonReports,
-			"submitted_by":    submittedBy,
+
+			"retail_median":     retailMedian,
+			"wholesale_median":  wholesaleMedian,
+			"retail_samples":    retailSamples,
+			"wholesale_samples": wholesaleSamples,
+			"confidence":        confidence,
+			"verified":          confidence >= threshold,
+
+			"updated_at":   lastUpdate,
+			"history":      historyStr,
+			"dist_farmers": distFarmers,
+			"anon_reports": anonReports,
+			"submitted_by": submittedBy,
+			"currency":     target,
 		})
 	}
 
-	c.JSON(http.StatusOK, results)
+	body, err := json.Marshal(results)
+	if err != nil {
+		log.Printf("GetLatestPrices: Encode error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode prices"})
+		return
+	}
+	h.latestPrices.set(target, generation, body)
+
+	c.Header("X-Cache", "MISS")
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
 }
 
 // DeletePrice handles soft deletion of price entries
@@ -147,9 +213,10 @@ func (h *Handler) DeletePrice(c *gin.Context) {
 	}
 
 	// Verify ownership
-	var ownerID int
+	var ownerID, cropTypeID int
+	var region string
 	err := h.DB.QueryRow(c.Request.Context(),
-		"SELECT submitted_by FROM market_prices WHERE id = $1 AND is_active = TRUE", priceID).Scan(&ownerID)
+		"SELECT submitted_by, crop_type_id, region FROM market_prices WHERE id = $1 AND is_active = TRUE", priceID).Scan(&ownerID, &cropTypeID, &region)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Price entry not found"})
@@ -171,5 +238,7 @@ func (h *Handler) DeletePrice(c *gin.Context) {
 		return
 	}
 
+	h.refreshPriceGroup(c.Request.Context(), cropTypeID, region)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Price entry deleted successfully"})
 }
@@ -0,0 +1,594 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"farmlite/internal/order"
+	"farmlite/internal/review"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Roles allowed to hide and restore reported reviews
+var reviewModeratorRoles = []string{"admin", "officer"}
+
+// Reviews that count towards a farmer's rating: tied to a transaction and not hidden
+const eligibleReviewFilter = "(r.order_id IS NOT NULL OR r.conversation_id IS NOT NULL) AND r.hidden_at IS NULL"
+
+type RatingSchema struct {
+	ID              int        `json:"id"`
+	FarmerID        int        `json:"farmer_id"`
+	BuyerID         int        `json:"buyer_id"`
+	Rating          int        `json:"rating"`
+	Comment         string     `json:"comment"`
+	CreatedAt       time.Time  `json:"created_at"`
+	BuyerName       string     `json:"buyer_name,omitempty"`
+	OrderID         *int       `json:"order_id,omitempty"`
+	ConversationID  *int       `json:"conversation_id,omitempty"`
+	Verified        bool       `json:"verified"` // tied to a transaction, so it counts towards the rating
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+	FarmerReply     *string    `json:"farmer_reply,omitempty"`
+	FarmerRepliedAt *time.Time `json:"farmer_replied_at,omitempty"`
+	Editable        bool       `json:"editable,omitempty"` // the caller wrote it and may still edit it
+}
+
+// CreateReviewRequest rates a farmer for one transaction: a completed order or a
+// conversation where both shared phone numbers. With neither given, the buyer's most
+// recent unreviewed transaction with the farmer is used.
+type CreateReviewRequest struct {
+	FarmerID       int    `json:"farmer_id" binding:"required"`
+	BuyerID        int    `json:"buyer_id" binding:"required"`
+	Rating         int    `json:"rating" binding:"required,min=1,max=5"`
+	Comment        string `json:"comment"`
+	OrderID        *int   `json:"order_id"`
+	ConversationID *int   `json:"conversation_id"`
+}
+
+type UpdateReviewRequest struct {
+	BuyerID int     `json:"buyer_id" binding:"required"`
+	Rating  *int    `json:"rating"`
+	Comment *string `json:"comment"`
+}
+
+type ReviewReplyRequest struct {
+	FarmerID int    `json:"farmer_id" binding:"required"`
+	Reply    string `json:"reply"` // empty removes the reply
+}
+
+type ReportReviewRequest struct {
+	UserID  int    `json:"user_id" binding:"required"`
+	Reason  string `json:"reason" binding:"required"` // abusive, spam, fake, personal_info or other
+	Details string `json:"details"`
+}
+
+type ModerateReviewRequest struct {
+	UserID int    `json:"user_id" binding:"required"`
+	Action string `json:"action" binding:"required"` // hide or restore
+	Reason string `json:"reason"`
+}
+
+// ReportedReview is a review waiting on a moderator, with its open reports.
+type ReportedReview struct {
+	RatingSchema
+	FarmerName      string    `json:"farmer_name"`
+	Hidden          bool      `json:"hidden"`
+	HiddenReason    *string   `json:"hidden_reason,omitempty"`
+	ReportCount     int       `json:"report_count"`
+	Reasons         []string  `json:"reasons"`
+	Details         []string  `json:"details,omitempty"`
+	FirstReportedAt time.Time `json:"first_reported_at"`
+}
+
+// CreateReview records a buyer's review of a farmer. Each order or conversation can
+// be reviewed once; the review can be edited for a week.
+// POST /api/reviews
+func (h *Handler) CreateReview(c *gin.Context) {
+	var req CreateReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.BuyerID == req.FarmerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't review yourself"})
+		return
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if len([]rune(comment)) > review.MaxCommentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("comment is limited to %d characters", review.MaxCommentLength)})
+		return
+	}
+	ctx := c.Request.Context()
+
+	orderID, conversationID := req.OrderID, req.ConversationID
+	switch {
+	case orderID != nil:
+		var buyerID, farmerID int
+		var status string
+		err := h.DB.QueryRow(ctx, "SELECT buyer_id, farmer_id, status FROM orders WHERE id = $1", *orderID).Scan(&buyerID, &farmerID, &status)
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		} else if err != nil {
+			log.Printf("CreateReview: Order error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit review"})
+			return
+		}
+		if buyerID != req.BuyerID || farmerID != req.FarmerID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only review orders you placed with this farmer"})
+			return
+		}
+		if status != order.Completed {
+			c.JSON(http.StatusConflict, gin.H{"error": "Orders can be reviewed once they are completed"})
+			return
+		}
+		conversationID = nil
+	case conversationID != nil:
+		var confirmed bool
+		err := h.DB.QueryRow(ctx, `
+			SELECT a_shared_phone_at IS NOT NULL AND b_shared_phone_at IS NOT NULL
+			FROM conversations
+			WHERE id = $1 AND user_a = LEAST($2::int, $3::int) AND user_b = GREATEST($2::int, $3::int)
+		`, *conversationID, req.BuyerID, req.FarmerID).Scan(&confirmed)
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only review farmers you have a conversation with"})
+			return
+		} else if err != nil {
+			log.Printf("CreateReview: Conversation error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit review"})
+			return
+		}
+		if !confirmed {
+			c.JSON(http.StatusConflict, gin.H{"error": "You can review after you have both shared phone numbers in this conversation"})
+			return
+		}
+	default:
+		var err error
+		orderID, conversationID, err = h.findReviewable(ctx, req.BuyerID, req.FarmerID)
+		if err != nil {
+			log.Printf("CreateReview: Lookup error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit review"})
+			return
+		}
+		if orderID == nil && conversationID == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can review a farmer after a completed order, or once you have both shared phone numbers in a conversation"})
+			return
+		}
+	}
+
+	var reviewID int
+	err := h.DB.QueryRow(ctx, `
+		INSERT INTO seller_reviews (farmer_id, buyer_id, rating, comment, order_id, conversation_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING
+		RETURNING id
+	`, req.FarmerID, req.BuyerID, req.Rating, comment, orderID, conversationID).Scan(&reviewID)
+	if err == pgx.ErrNoRows {
+		var existingID int
+		h.DB.QueryRow(ctx, "SELECT id FROM seller_reviews WHERE order_id = $1 OR conversation_id = $2", orderID, conversationID).Scan(&existingID)
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already reviewed this transaction; edit that review instead", "review_id": existingID})
+		return
+	} else if err != nil {
+		log.Printf("CreateReview: Insert error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit review"})
+		return
+	}
+
+	body := comment
+	if r := []rune(body); len(r) > 100 {
+		body = string(r[:100]) + "…"
+	}
+	data := gin.H{"review_id": reviewID, "rating": req.Rating}
+	title := fmt.Sprintf("New %d-star review", req.Rating)
+	if _, err := h.notify(ctx, req.FarmerID, "review", title, body, data, fmt.Sprintf("review:%d", reviewID)); err != nil {
+		log.Printf("Review notification error (review %d): %v\n", reviewID, err)
+	}
+
+	h.refreshUserTrust(ctx, req.FarmerID)
+	c.JSON(http.StatusCreated, gin.H{"message": "Review submitted successfully", "review_id": reviewID, "order_id": orderID, "conversation_id": conversationID})
+}
+
+// findReviewable returns the buyer's most recent transaction with the farmer that
+// hasn't been reviewed: a completed order, or failing that a conversation where both
+// shared phone numbers. Both are nil when there is none.
+func (h *Handler) findReviewable(ctx context.Context, buyerID, farmerID int) (orderID, conversationID *int, err error) {
+	var id int
+	err = h.DB.QueryRow(ctx, `
+		SELECT o.id FROM orders o
+		WHERE o.buyer_id = $1 AND o.farmer_id = $2 AND o.status = $3
+		  AND NOT EXISTS (SELECT 1 FROM seller_reviews r WHERE r.order_id = o.id)
+		ORDER BY o.updated_at DESC
+		LIMIT 1
+	`, buyerID, farmerID, order.Completed).Scan(&id)
+	if err == nil {
+		return &id, nil, nil
+	} else if err != pgx.ErrNoRows {
+		return nil, nil, err
+	}
+
+	err = h.DB.QueryRow(ctx, `
+		SELECT cv.id FROM conversations cv
+		WHERE cv.user_a = LEAST($1::int, $2::int) AND cv.user_b = GREATEST($1::int, $2::int)
+		  AND cv.a_shared_phone_at IS NOT NULL AND cv.b_shared_phone_at IS NOT NULL
+		  AND NOT EXISTS (SELECT 1 FROM seller_reviews r WHERE r.conversation_id = cv.id)
+		ORDER BY GREATEST(cv.a_shared_phone_at, cv.b_shared_phone_at) DESC
+		LIMIT 1
+	`, buyerID, farmerID).Scan(&id)
+	if err == nil {
+		return nil, &id, nil
+	} else if err != pgx.ErrNoRows {
+		return nil, nil, err
+	}
+	return nil, nil, nil
+}
+
+// GetFarmerReviews lists a farmer's reviews, newest first, leaving out hidden ones.
+// Reviews from before transactions were required are listed but not verified. With
+// user_id, the caller's own reviews say whether they can still be edited.
+// GET /api/farmers/:id/reviews?user_id=
+func (h *Handler) GetFarmerReviews(c *gin.Context) {
+	farmerID := c.Param("id")
+	userID, _ := strconv.Atoi(c.Query("user_id"))
+
+	rows, err := h.DB.Query(c.Request.Context(), `
+		SELECT r.id, r.farmer_id, r.buyer_id, r.rating, COALESCE(r.comment, ''), r.created_at, u.full_name,
+		       r.order_id, r.conversation_id, r.updated_at, r.farmer_reply, r.farmer_replied_at
+		FROM seller_reviews r
+		JOIN users u ON r.buyer_id = u.id
+		WHERE r.farmer_id = $1 AND r.hidden_at IS NULL
+		ORDER BY r.created_at DESC
+	`, farmerID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+	defer rows.Close()
+
+	var reviews []RatingSchema
+	for rows.Next() {
+		var r RatingSchema
+		if err := rows.Scan(&r.ID, &r.FarmerID, &r.BuyerID, &r.Rating, &r.Comment, &r.CreatedAt, &r.BuyerName,
+			&r.OrderID, &r.ConversationID, &r.UpdatedAt, &r.FarmerReply, &r.FarmerRepliedAt); err != nil {
+			continue
+		}
+		r.Verified = r.OrderID != nil || r.ConversationID != nil
+		r.Editable = userID != 0 && userID == r.BuyerID && review.Editable(r.CreatedAt, time.Now())
+		reviews = append(reviews, r)
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// UpdateReview lets the author change their rating or comment within a week of
+// posting. Hidden reviews can't be edited.
+// PUT /api/reviews/:id
+func (h *Handler) UpdateReview(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review id"})
+		return
+	}
+	var req UpdateReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Rating == nil && req.Comment == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+	if req.Rating != nil && (*req.Rating < 1 || *req.Rating > 5) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rating must be between 1 and 5"})
+		return
+	}
+	var comment *string
+	if req.Comment != nil {
+		trimmed := strings.TrimSpace(*req.Comment)
+		if len([]rune(trimmed)) > review.MaxCommentLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("comment is limited to %d characters", review.MaxCommentLength)})
+			return
+		}
+		comment = &trimmed
+	}
+	ctx := c.Request.Context()
+
+	var buyerID, farmerID int
+	var created time.Time
+	var hidden bool
+	err = h.DB.QueryRow(ctx, "SELECT buyer_id, farmer_id, created_at, hidden_at IS NOT NULL FROM seller_reviews WHERE id = $1", reviewID).Scan(&buyerID, &farmerID, &created, &hidden)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	} else if err != nil {
+		log.Printf("UpdateReview: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review"})
+		return
+	}
+	if buyerID != req.BuyerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own reviews"})
+		return
+	}
+	if hidden {
+		c.JSON(http.StatusConflict, gin.H{"error": "This review has been hidden by a moderator"})
+		return
+	}
+	if !review.Editable(created, time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Reviews can only be edited within %d days of posting", int(review.EditWindow.Hours()/24))})
+		return
+	}
+
+	_, err = h.DB.Exec(ctx, `
+		UPDATE seller_reviews
+		SET rating = COALESCE($2, rating), comment = COALESCE($3, comment), updated_at = NOW()
+		WHERE id = $1
+	`, reviewID, req.Rating, comment)
+	if err != nil {
+		log.Printf("UpdateReview: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review"})
+		return
+	}
+
+	h.refreshUserTrust(ctx, farmerID)
+	c.JSON(http.StatusOK, gin.H{"message": "Review updated"})
+}
+
+// ReplyToReview posts or replaces the reviewed farmer's public reply. An empty reply
+// removes it.
+// POST /api/reviews/:id/reply
+func (h *Handler) ReplyToReview(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review id"})
+		return
+	}
+	var req ReviewReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reply := strings.TrimSpace(req.Reply)
+	if len([]rune(reply)) > review.MaxReplyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("reply is limited to %d characters", review.MaxReplyLength)})
+		return
+	}
+	ctx := c.Request.Context()
+
+	var farmerID, buyerID int
+	err = h.DB.QueryRow(ctx, "SELECT farmer_id, buyer_id FROM seller_reviews WHERE id = $1", reviewID).Scan(&farmerID, &buyerID)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	} else if err != nil {
+		log.Printf("ReplyToReview: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reply"})
+		return
+	}
+	if farmerID != req.FarmerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the reviewed farmer can reply"})
+		return
+	}
+
+	_, err = h.DB.Exec(ctx, `
+		UPDATE seller_reviews
+		SET farmer_reply = NULLIF($2, ''), farmer_replied_at = CASE WHEN $2 = '' THEN NULL ELSE NOW() END
+		WHERE id = $1
+	`, reviewID, reply)
+	if err != nil {
+		log.Printf("ReplyToReview: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reply"})
+		return
+	}
+
+	if reply != "" {
+		data := gin.H{"review_id": reviewID, "farmer_id": farmerID}
+		if _, err := h.notify(ctx, buyerID, "review_reply", "The farmer replied to your review", reply, data, fmt.Sprintf("review_reply:%d", reviewID)); err != nil {
+			log.Printf("Review reply notification error (review %d): %v\n", reviewID, err)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Reply posted"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Reply removed"})
+}
+
+// ReportReview flags a review as abusive. Once enough people have reported it, the
+// review is hidden until a moderator decides.
+// POST /api/reviews/:id/report
+func (h *Handler) ReportReview(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review id"})
+		return
+	}
+	var req ReportReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !review.ValidReason(req.Reason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be one of abusive, spam, fake, personal_info, other"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	var buyerID, farmerID int
+	err = h.DB.QueryRow(ctx, "SELECT buyer_id, farmer_id FROM seller_reviews WHERE id = $1", reviewID).Scan(&buyerID, &farmerID)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	} else if err != nil {
+		log.Printf("ReportReview: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report review"})
+		return
+	}
+	if buyerID == req.UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't report your own review"})
+		return
+	}
+
+	tag, err := h.DB.Exec(ctx, `
+		INSERT INTO review_reports (review_id, reporter_id, reason, details)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (review_id, reporter_id) DO NOTHING
+	`, reviewID, req.UserID, req.Reason, strings.TrimSpace(req.Details))
+	if err != nil {
+		log.Printf("ReportReview: Insert error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report review"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already reported this review"})
+		return
+	}
+
+	// The reviewed farmer's own report goes to the moderators but doesn't count
+	// towards hiding the review
+	tag, err = h.DB.Exec(ctx, `
+		UPDATE seller_reviews r SET hidden_at = NOW(), hidden_reason = 'reported'
+		WHERE r.id = $1 AND r.hidden_at IS NULL
+		  AND (SELECT COUNT(*) FROM review_reports rr
+		       WHERE rr.review_id = $1 AND rr.status = 'pending' AND rr.reporter_id <> r.farmer_id) >= $2
+	`, reviewID, review.ReportsToHide)
+	if err != nil {
+		log.Printf("ReportReview: Hide error: %v\n", err)
+	}
+	hidden := err == nil && tag.RowsAffected() > 0
+	if hidden {
+		log.Printf("Review %d hidden after %d reports\n", reviewID, review.ReportsToHide)
+		h.refreshUserTrust(ctx, farmerID)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Thanks, a moderator will look at this review", "hidden": hidden})
+}
+
+// GetReportedReviews lists reviews with open reports for moderators, most reported
+// first.
+// GET /api/reviews/reports?user_id=
+func (h *Handler) GetReportedReviews(c *gin.Context) {
+	userID, _ := strconv.Atoi(c.Query("user_id"))
+	ctx := c.Request.Context()
+	if !h.userHasRole(ctx, userID, reviewModeratorRoles...) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can see reported reviews"})
+		return
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT r.id, r.farmer_id, r.buyer_id, r.rating, COALESCE(r.comment, ''), r.created_at, b.full_name,
+		       r.order_id, r.conversation_id, r.updated_at, r.farmer_reply, r.farmer_replied_at,
+		       f.full_name, r.hidden_at IS NOT NULL, r.hidden_reason,
+		       COUNT(rr.id), ARRAY_AGG(DISTINCT rr.reason), ARRAY_REMOVE(ARRAY_AGG(rr.details ORDER BY rr.created_at), NULL),
+		       MIN(rr.created_at)
+		FROM review_reports rr
+		JOIN seller_reviews r ON r.id = rr.review_id
+		JOIN users b ON b.id = r.buyer_id
+		JOIN users f ON f.id = r.farmer_id
+		WHERE rr.status = 'pending'
+		GROUP BY r.id, b.full_name, f.full_name
+		ORDER BY COUNT(rr.id) DESC, MIN(rr.created_at)
+	`)
+	if err != nil {
+		log.Printf("GetReportedReviews: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reported reviews"})
+		return
+	}
+	defer rows.Close()
+
+	reviews := []ReportedReview{}
+	for rows.Next() {
+		var r ReportedReview
+		if err := rows.Scan(&r.ID, &r.FarmerID, &r.BuyerID, &r.Rating, &r.Comment, &r.CreatedAt, &r.BuyerName,
+			&r.OrderID, &r.ConversationID, &r.UpdatedAt, &r.FarmerReply, &r.FarmerRepliedAt,
+			&r.FarmerName, &r.Hidden, &r.HiddenReason,
+			&r.ReportCount, &r.Reasons, &r.Details, &r.FirstReportedAt); err != nil {
+			log.Printf("GetReportedReviews: Scan error: %v\n", err)
+			continue
+		}
+		r.Verified = r.OrderID != nil || r.ConversationID != nil
+		reviews = append(reviews, r)
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// ModerateReview hides a review or puts it back up, closing its open reports as
+// upheld or dismissed.
+// POST /api/reviews/:id/moderate
+func (h *Handler) ModerateReview(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review id"})
+		return
+	}
+	var req ModerateReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Action != review.Hide && req.Action != review.Restore {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action must be hide or restore"})
+		return
+	}
+	ctx := c.Request.Context()
+	if !h.userHasRole(ctx, req.UserID, reviewModeratorRoles...) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can moderate reviews"})
+		return
+	}
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate review"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	reportStatus, done := review.ReportUpheld, "hidden"
+	var farmerID int
+	if req.Action == review.Hide {
+		reason := strings.TrimSpace(req.Reason)
+		if reason == "" {
+			reason = "moderator"
+		}
+		err = tx.QueryRow(ctx, `
+			UPDATE seller_reviews SET hidden_at = COALESCE(hidden_at, NOW()), hidden_reason = $2 WHERE id = $1
+			RETURNING farmer_id
+		`, reviewID, reason).Scan(&farmerID)
+	} else {
+		reportStatus, done = review.ReportDismissed, "restored"
+		err = tx.QueryRow(ctx, `
+			UPDATE seller_reviews SET hidden_at = NULL, hidden_reason = NULL WHERE id = $1
+			RETURNING farmer_id
+		`, reviewID).Scan(&farmerID)
+	}
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	} else if err != nil {
+		log.Printf("ModerateReview: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate review"})
+		return
+	}
+
+	resolved, err := tx.Exec(ctx, `
+		UPDATE review_reports SET status = $2, resolved_by = $3, resolved_at = NOW()
+		WHERE review_id = $1 AND status = 'pending'
+	`, reviewID, reportStatus, req.UserID)
+	if err != nil {
+		log.Printf("ModerateReview: Reports error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate review"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate review"})
+		return
+	}
+	// Hidden reviews don't count towards the farmer's rating or badges
+	h.refreshUserTrust(ctx, farmerID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review " + done, "reports_resolved": resolved.RowsAffected()})
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"farmlite/internal/currency"
+	"farmlite/internal/estimation"
+	"farmlite/internal/regions"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type ScenarioField struct {
+	Area       float64 `json:"area"`
+	Unit       string  `json:"unit"`
+	Region     string  `json:"region"`
+	Irrigation string  `json:"irrigation"`
+}
+
+type CompareScenariosRequest struct {
+	UserID        int           `json:"user_id"`
+	Name          string        `json:"name"`
+	Field         ScenarioField `json:"field"`
+	Crops         []string      `json:"crops" binding:"required"`
+	WaterBudgetM3 float64       `json:"water_budget_m3"`
+	CostPerHa     *float64      `json:"cost_per_ha"` // USD
+	Currency      string        `json:"currency"`    // results in; defaults to the user's preference, then USD
+	Save          bool          `json:"save"`
+}
+
+type SavedScenario struct {
+	ID            int                   `json:"id"`
+	UserID        int                   `json:"user_id"`
+	Name          string                `json:"name"`
+	Crops         []string              `json:"crops"`
+	WaterBudgetM3 float64               `json:"water_budget_m3"`
+	Result        estimation.Comparison `json:"result"`
+	CreatedAt     time.Time             `json:"created_at"`
+}
+
+// CompareScenarios ranks several candidate crops for the same field.
+// POST /api/estimate/compare
+func (h *Handler) CompareScenarios(c *gin.Context) {
+	var req CompareScenariosRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+
+	if req.Field.Area <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "field.area must be greater than zero"})
+		return
+	}
+	if len(req.Crops) < 1 || len(req.Crops) > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide between 1 and 10 crops to compare"})
+		return
+	}
+	if req.WaterBudgetM3 < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "water_budget_m3 cannot be negative"})
+		return
+	}
+
+	hectares, err := estimation.ToHectares(req.Field.Area, req.Field.Unit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	irrigation, err := estimation.NormalizeIrrigation(req.Field.Irrigation)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	region := ""
+	if req.Field.Region != "" && req.Field.Region != "All" {
+		canonical, ok := regions.Canonical(req.Field.Region)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown region: " + req.Field.Region})
+			return
+		}
+		region = canonical
+	}
+
+	costPerHa := estimation.DefaultCostPerHectare
+	if req.CostPerHa != nil {
+		if *req.CostPerHa < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cost_per_ha cannot be negative"})
+			return
+		}
+		costPerHa = *req.CostPerHa
+	}
+
+	ctx := c.Request.Context()
+
+	// As on the other estimate endpoints: an explicit currency, then the user's preference
+	code := req.Currency
+	if code == "" {
+		code = c.Query("currency")
+	}
+	target, err := currency.Normalize(code, currency.USD)
+	if err == nil && code == "" && req.UserID > 0 {
+		target, err = h.preferredCurrency(ctx, req.UserID, currency.USD)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	unitsPerUSD := 1.0
+	if target != currency.USD {
+		var ok bool
+		if unitsPerUSD, ok = h.loadRates(ctx).Convert(1, currency.USD, target); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No exchange rate available for " + target})
+			return
+		}
+	}
+
+	var crops []estimation.ScenarioCrop
+	names := []string{} // the crops compared, trimmed and without duplicates
+	seen := make(map[string]bool)
+	for _, name := range req.Crops {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+
+		crop := estimation.ScenarioCrop{CropName: name}
+		crop.Price, crop.PriceSource = h.lookupCropPrice(ctx, name, region)
+		if _, stdDev, samples, _ := h.lookupPriceVolatility(ctx, name, region); samples >= 3 {
+			crop.PriceStdDev = stdDev
+		}
+		crop.SupplyKG, crop.DemandKG = h.lookupMarketBalance(ctx, name, region)
+		crops = append(crops, crop)
+	}
+
+	field := estimation.Field{
+		Area:       req.Field.Area,
+		Unit:       req.Field.Unit,
+		Hectares:   hectares,
+		Region:     region,
+		Irrigation: irrigation,
+	}
+	result := estimation.CompareScenarios(field, crops, req.WaterBudgetM3, costPerHa)
+	if target != currency.USD {
+		result.InCurrency(target, unitsPerUSD)
+	}
+
+	if !req.Save {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	if req.UserID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required to save a scenario"})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = fmt.Sprintf("%s (%.2f ha)", strings.Join(names, " vs "), hectares)
+	}
+
+	fieldJSON, _ := json.Marshal(field)
+	cropsJSON, _ := json.Marshal(names)
+	resultJSON, _ := json.Marshal(result)
+
+	var scenarioID int
+	err = h.DB.QueryRow(ctx, `
+		INSERT INTO estimate_scenarios (user_id, name, field, crops, water_budget_m3, result)
+		VALUES ($1, $2, $3::jsonb, $4::jsonb, $5, $6::jsonb)
+		RETURNING id
+	`, req.UserID, name, string(fieldJSON), string(cropsJSON), req.WaterBudgetM3, string(resultJSON)).Scan(&scenarioID)
+
+	if err != nil {
+		log.Printf("CompareScenarios: Insert error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save scenario: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": scenarioID, "name": name, "result": result})
+}
+
+// lookupMarketBalance sums the quantity currently offered in listings and
+// requested in demand requests for a crop, optionally limited to a region.
+func (h *Handler) lookupMarketBalance(ctx context.Context, crop, region string) (supply, demand float64) {
+	err := h.DB.QueryRow(ctx, `
+		SELECT COALESCE(SUM(m.quantity_kg), 0)
+		FROM marketplace_listings m
+		JOIN users u ON m.farmer_id = u.id
+		JOIN crop_types c ON m.crop_type_id = c.id
+		WHERE c.name = $1 AND m.is_active = TRUE AND m.status = 'active' AND ($2 = '' OR u.region = $2)
+	`, crop, region).Scan(&supply)
+	if err != nil {
+		log.Printf("Error fetching listing supply for %s: %v", crop, err)
+	}
+
+	err = h.DB.QueryRow(ctx, `
+		SELECT COALESCE(SUM(d.quantity_kg - d.fulfilled_kg), 0)
+		FROM demand_requests d
+		JOIN crop_types c ON d.crop_type_id = c.id
+		WHERE c.name = $1 AND d.is_active = TRUE AND d.status = 'open' AND ($2 = '' OR d.region = $2)
+	`, crop, region).Scan(&demand)
+	if err != nil {
+		log.Printf("Error fetching demand for %s: %v", crop, err)
+	}
+
+	return supply, demand
+}
+
+func (h *Handler) GetSavedScenarios(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	rows, err := h.DB.Query(c.Request.Context(), `
+		SELECT id, user_id, name, crops, COALESCE(water_budget_m3, 0), result, created_at
+		FROM estimate_scenarios
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scenarios"})
+		return
+	}
+	defer rows.Close()
+
+	scenarios := []SavedScenario{}
+	for rows.Next() {
+		var s SavedScenario
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Name, &s.Crops, &s.WaterBudgetM3, &s.Result, &s.CreatedAt); err != nil {
+			log.Printf("GetSavedScenarios: Scan error: %v", err)
+			continue
+		}
+		scenarios = append(scenarios, s)
+	}
+
+	c.JSON(http.StatusOK, scenarios)
+}
+
+func (h *Handler) GetSavedScenario(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	var s SavedScenario
+	err := h.DB.QueryRow(c.Request.Context(), `
+		SELECT id, user_id, name, crops, COALESCE(water_budget_m3, 0), result, created_at
+		FROM estimate_scenarios
+		WHERE id = $1 AND user_id = $2
+	`, c.Param("id"), userID).Scan(&s.ID, &s.UserID, &s.Name, &s.Crops, &s.WaterBudgetM3, &s.Result, &s.CreatedAt)
+
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scenario not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scenario"})
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+func (h *Handler) DeleteSavedScenario(c *gin.Context) {
+	scenarioID := c.Param("id")
+	userID := c.Query("user_id")
+
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	tag, err := h.DB.Exec(c.Request.Context(),
+		"DELETE FROM estimate_scenarios WHERE id = $1 AND user_id = $2", scenarioID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete scenario"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scenario not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Scenario deleted"})
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"farmlite/internal/search"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Highlighted snippets wrap matches in <mark>; the text is HTML-escaped first so the
+// snippet is safe to render.
+const searchHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=\" … \""
+
+// searchQuery builds a tsquery expression for q with parameters from $idx on. Every
+// word must match, either itself or one of its synonyms. ok is false when q has no words.
+func searchQuery(q string, idx int) (expr string, args []interface{}, ok bool) {
+	terms := search.Terms(q)
+	if len(terms) == 0 {
+		return "", nil, false
+	}
+	groups := make([]string, 0, len(terms))
+	for _, term := range terms {
+		var alternatives []string
+		for _, word := range search.Expand(term) {
+			alternatives = append(alternatives, fmt.Sprintf("search_term($%d)", idx))
+			args = append(args, word)
+			idx++
+		}
+		groups = append(groups, "("+strings.Join(alternatives, " || ")+")")
+	}
+	return strings.Join(groups, " && "), args, true
+}
+
+// searchHeadline returns SQL for a highlighted snippet of the text expression text
+// matching the tsquery expression query.
+func searchHeadline(text, query string) string {
+	escaped := fmt.Sprintf("replace(replace(replace(COALESCE(%s, ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;')", text)
+	return fmt.Sprintf("ts_headline('russian', %s, %s, '%s')", escaped, query, searchHeadlineOptions)
+}
+
+type SearchSuggestion struct {
+	Text  string `json:"text"`
+	Kind  string `json:"kind"` // crop, tag or term
+	Count int    `json:"count,omitempty"`
+}
+
+// GetSearchSuggestions autocompletes a marketplace search from crop names, tags used on
+// active listings and the synonym vocabulary.
+// GET /api/search/suggest?q=pom&limit=8
+func (h *Handler) GetSearchSuggestions(c *gin.Context) {
+	prefix := search.Normalize(strings.TrimSpace(c.Query("q")))
+	limit := 8
+	if v := c.Query("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 20 {
+			limit = n
+		}
+	}
+
+	suggestions := []SearchSuggestion{}
+	if len([]rune(prefix)) < search.MinSuggestRune {
+		c.JSON(http.StatusOK, suggestions)
+		return
+	}
+
+	seen := make(map[string]bool)
+	add := func(s SearchSuggestion) {
+		key := search.Normalize(s.Text)
+		if seen[key] || len(suggestions) >= limit {
+			return
+		}
+		seen[key] = true
+		suggestions = append(suggestions, s)
+	}
+
+	ctx := c.Request.Context()
+	pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT name FROM crop_types
+		WHERE search_normalize(name) LIKE $1
+		ORDER BY name
+		LIMIT $2
+	`, pattern, limit)
+	if err != nil {
+		log.Printf("GetSearchSuggestions: Crop query error: %v\n", err)
+	} else {
+		for rows.Next() {
+			var name string
+			if rows.Scan(&name) == nil {
+				add(SearchSuggestion{Text: name, Kind: "crop"})
+			}
+		}
+		rows.Close()
+	}
+
+	rows, err = h.DB.Query(ctx, `
+		SELECT t.tag, COUNT(*)
+		FROM marketplace_listings m
+		CROSS JOIN LATERAL jsonb_array_elements_text(
+			CASE WHEN jsonb_typeof(m.tags) = 'array' THEN m.tags ELSE '[]'::jsonb END) AS t(tag)
+		WHERE m.is_active = TRUE AND m.status = 'active' AND search_normalize(t.tag) LIKE $1
+		GROUP BY t.tag
+		ORDER BY COUNT(*) DESC, t.tag
+		LIMIT $2
+	`, pattern, limit)
+	if err != nil {
+		log.Printf("GetSearchSuggestions: Tag query error: %v\n", err)
+	} else {
+		for rows.Next() {
+			var s SearchSuggestion
+			if rows.Scan(&s.Text, &s.Count) == nil {
+				s.Kind = "tag"
+				add(s)
+			}
+		}
+		rows.Close()
+	}
+
+	for _, word := range search.Suggest(prefix) {
+		add(SearchSuggestion{Text: word, Kind: "term"})
+	}
+
+	c.JSON(http.StatusOK, suggestions)
+}
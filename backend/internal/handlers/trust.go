@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"farmlite/internal/order"
+	"farmlite/internal/review"
+	"farmlite/internal/trust"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Roles allowed to mark a user's phone number as verified
+var phoneVerifierRoles = []string{"admin", "officer"}
+
+type BuyerReview struct {
+	ID         int        `json:"id"`
+	BuyerID    int        `json:"buyer_id"`
+	FarmerID   int        `json:"farmer_id"`
+	FarmerName string     `json:"farmer_name"`
+	OrderID    int        `json:"order_id"`
+	Rating     int        `json:"rating"`
+	Comment    string     `json:"comment"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	Editable   bool       `json:"editable,omitempty"` // the caller wrote it and may still edit it
+}
+
+type CreateBuyerReviewRequest struct {
+	FarmerID int    `json:"farmer_id" binding:"required"`
+	OrderID  int    `json:"order_id" binding:"required"`
+	Rating   int    `json:"rating" binding:"required,min=1,max=5"`
+	Comment  string `json:"comment"`
+}
+
+type UpdateBuyerReviewRequest struct {
+	FarmerID int     `json:"farmer_id" binding:"required"`
+	Rating   *int    `json:"rating"`
+	Comment  *string `json:"comment"`
+}
+
+// TrustProfile is everything shown about how far a user can be relied on.
+type TrustProfile struct {
+	trust.Signals
+	AccountAgeDays int      `json:"account_age_days"`
+	CompletionRate *float64 `json:"completion_rate,omitempty"` // once enough orders have closed
+	Badges         []string `json:"badges"`
+}
+
+// CreateBuyerReview lets a farmer rate the buyer of one of their orders once it has
+// completed, or once the buyer cancelled it. One rating per order.
+// POST /api/buyer-reviews
+func (h *Handler) CreateBuyerReview(c *gin.Context) {
+	var req CreateBuyerReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if len([]rune(comment)) > review.MaxCommentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("comment is limited to %d characters", review.MaxCommentLength)})
+		return
+	}
+	ctx := c.Request.Context()
+
+	var buyerID, farmerID int
+	var status string
+	err := h.DB.QueryRow(ctx, "SELECT buyer_id, farmer_id, status FROM orders WHERE id = $1", req.OrderID).Scan(&buyerID, &farmerID, &status)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	} else if err != nil {
+		log.Printf("CreateBuyerReview: Order error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit rating"})
+		return
+	}
+	if farmerID != req.FarmerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only rate buyers of your own orders"})
+		return
+	}
+	if status != order.Completed && status != order.Cancelled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Buyers can be rated once the order is completed or cancelled"})
+		return
+	}
+	if status == order.Cancelled {
+		// Only the buyer's own cancellation says anything about the buyer
+		var byBuyer bool
+		err := h.DB.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM order_events WHERE order_id = $1 AND to_status = $2 AND actor_id = $3)
+		`, req.OrderID, order.Cancelled, buyerID).Scan(&byBuyer)
+		if err != nil {
+			log.Printf("CreateBuyerReview: Events error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit rating"})
+			return
+		}
+		if !byBuyer {
+			c.JSON(http.StatusConflict, gin.H{"error": "A cancelled order can only be rated if the buyer cancelled it"})
+			return
+		}
+	}
+
+	var reviewID int
+	err = h.DB.QueryRow(ctx, `
+		INSERT INTO buyer_reviews (buyer_id, farmer_id, order_id, rating, comment)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+		ON CONFLICT (order_id) DO NOTHING
+		RETURNING id
+	`, buyerID, farmerID, req.OrderID, req.Rating, comment).Scan(&reviewID)
+	if err == pgx.ErrNoRows {
+		var existingID int
+		h.DB.QueryRow(ctx, "SELECT id FROM buyer_reviews WHERE order_id = $1", req.OrderID).Scan(&existingID)
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already rated the buyer for this order; edit that rating instead", "review_id": existingID})
+		return
+	} else if err != nil {
+		log.Printf("CreateBuyerReview: Insert error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit rating"})
+		return
+	}
+
+	h.refreshUserTrust(ctx, buyerID)
+	c.JSON(http.StatusCreated, gin.H{"message": "Rating submitted", "review_id": reviewID})
+}
+
+// UpdateBuyerReview lets the farmer change a buyer rating within the review edit
+// window.
+// PUT /api/buyer-reviews/:id
+func (h *Handler) UpdateBuyerReview(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review id"})
+		return
+	}
+	var req UpdateBuyerReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Rating == nil && req.Comment == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+	if req.Rating != nil && (*req.Rating < 1 || *req.Rating > 5) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rating must be between 1 and 5"})
+		return
+	}
+	var comment *string
+	if req.Comment != nil {
+		trimmed := strings.TrimSpace(*req.Comment)
+		if len([]rune(trimmed)) > review.MaxCommentLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("comment is limited to %d characters", review.MaxCommentLength)})
+			return
+		}
+		comment = &trimmed
+	}
+	ctx := c.Request.Context()
+
+	var farmerID, buyerID int
+	var created time.Time
+	err = h.DB.QueryRow(ctx, "SELECT farmer_id, buyer_id, created_at FROM buyer_reviews WHERE id = $1", reviewID).Scan(&farmerID, &buyerID, &created)
+	if err == pgx.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rating not found"})
+		return
+	} else if err != nil {
+		log.Printf("UpdateBuyerReview: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rating"})
+		return
+	}
+	if farmerID != req.FarmerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own ratings"})
+		return
+	}
+	if !review.Editable(created, time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Ratings can only be edited within %d days of posting", int(review.EditWindow.Hours()/24))})
+		return
+	}
+
+	_, err = h.DB.Exec(ctx, `
+		UPDATE buyer_reviews
+		SET rating = COALESCE($2, rating), comment = COALESCE($3, comment), updated_at = NOW()
+		WHERE id = $1
+	`, reviewID, req.Rating, comment)
+	if err != nil {
+		log.Printf("UpdateBuyerReview: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rating"})
+		return
+	}
+
+	h.refreshUserTrust(ctx, buyerID)
+	c.JSON(http.StatusOK, gin.H{"message": "Rating updated"})
+}
+
+// GetBuyerReviews lists the ratings farmers have given a buyer, newest first.
+// GET /api/buyers/:id/reviews?user_id=
+func (h *Handler) GetBuyerReviews(c *gin.Context) {
+	buyerID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid buyer id"})
+		return
+	}
+	userID, _ := strconv.Atoi(c.Query("user_id"))
+
+	rows, err := h.DB.Query(c.Request.Context(), `
+		SELECT r.id, r.buyer_id, r.farmer_id, u.full_name, r.order_id, r.rating, COALESCE(r.comment, ''), r.created_at, r.updated_at
+		FROM buyer_reviews r
+		JOIN users u ON u.id = r.farmer_id
+		WHERE r.buyer_id = $1
+		ORDER BY r.created_at DESC
+	`, buyerID)
+	if err != nil {
+		log.Printf("GetBuyerReviews: Query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ratings"})
+		return
+	}
+	defer rows.Close()
+
+	reviews := []BuyerReview{}
+	for rows.Next() {
+		var r BuyerReview
+		if err := rows.Scan(&r.ID, &r.BuyerID, &r.FarmerID, &r.FarmerName, &r.OrderID, &r.Rating, &r.Comment, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			continue
+		}
+		r.Editable = userID != 0 && userID == r.FarmerID && review.Editable(r.CreatedAt, time.Now())
+		reviews = append(reviews, r)
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// VerifyPhone marks a user's phone number as verified, for an officer or admin who
+// has checked it. verified false takes the mark away.
+// POST /api/users/:id/verify-phone
+func (h *Handler) VerifyPhone(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+	var req struct {
+		VerifierID int   `json:"verifier_id" binding:"required"`
+		Verified   *bool `json:"verified"` // defaults to true
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	if !h.userHasRole(ctx, req.VerifierID, phoneVerifierRoles...) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only officers can verify phone numbers"})
+		return
+	}
+
+	verified := req.Verified == nil || *req.Verified
+	tag, err := h.DB.Exec(ctx, `
+		UPDATE users SET phone_verified_at = CASE WHEN $2 THEN COALESCE(phone_verified_at, NOW()) END WHERE id = $1
+	`, userID, verified)
+	if err != nil {
+		log.Printf("VerifyPhone: Update error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	h.refreshUserTrust(ctx, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Phone verification updated", "user_id": userID, "phone_verified": verified})
+}
+
+// GetUserTrust returns a user's trust signals and badges, computed fresh.
+// GET /api/users/:id/trust
+func (h *Handler) GetUserTrust(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	signals, err := h.loadTrustSignals(c.Request.Context(), &userID)
+	if err != nil {
+		log.Printf("GetUserTrust: Load error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trust signals"})
+		return
+	}
+	if len(signals) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	now := time.Now()
+	s := signals[0]
+	profile := TrustProfile{Signals: s, AccountAgeDays: s.AccountAgeDays(now), Badges: trust.Badges(s, now)}
+	if rate, ok := s.CompletionRate(); ok {
+		profile.CompletionRate = &rate
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// RefreshTrust recomputes every user's trust signals and badges. Run periodically.
+func (h *Handler) RefreshTrust(ctx context.Context) error {
+	return h.storeTrust(ctx, nil)
+}
+
+// refreshUserTrust recomputes one user's badges after something changed them,
+// logging rather than failing the request.
+func (h *Handler) refreshUserTrust(ctx context.Context, userID int) {
+	if err := h.storeTrust(ctx, &userID); err != nil {
+		log.Printf("Trust refresh error (user %d): %v\n", userID, err)
+	}
+}
+
+func (h *Handler) storeTrust(ctx context.Context, userID *int) error {
+	signals, err := h.loadTrustSignals(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	for _, s := range signals {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO user_trust (user_id, orders_completed, orders_cancelled, responses, median_response_minutes, badges, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (user_id) DO UPDATE
+			SET orders_completed = EXCLUDED.orders_completed, orders_cancelled = EXCLUDED.orders_cancelled,
+			    responses = EXCLUDED.responses, median_response_minutes = EXCLUDED.median_response_minutes,
+			    badges = EXCLUDED.badges, updated_at = EXCLUDED.updated_at
+		`, s.UserID, s.OrdersCompleted, s.OrdersCancelled, s.Responses, s.MedianResponseMinutes, trust.Badges(s, now), now)
+		if err != nil {
+			return fmt.Errorf("store trust for user %d: %w", s.UserID, err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// loadTrustSignals computes trust signals for one user, or every user when userID is
+// nil. Response times are measured over the last 90 days: from the first message
+// someone else sent in a conversation they started to the user's first reply. A
+// conversation still unanswered counts with the time it has waited so far, so
+// ignoring messages can't keep a fast median.
+func (h *Handler) loadTrustSignals(ctx context.Context, userID *int) ([]trust.Signals, error) {
+	rows, err := h.DB.Query(ctx, `
+		SELECT u.id, COALESCE(u.created_at, NOW()), u.phone_verified_at IS NOT NULL,
+		       COALESCE(o.completed, 0), COALESCE(o.cancelled, 0),
+		       COALESCE(rt.responses, 0), rt.median_minutes,
+		       COALESCE(sr.rating, 0), COALESCE(sr.ratings, 0),
+		       COALESCE(br.rating, 0), COALESCE(br.ratings, 0)
+		FROM users u
+		LEFT JOIN (
+			SELECT p.user_id,
+			       COUNT(*) FILTER (WHERE p.status = $2) AS completed,
+			       COUNT(*) FILTER (WHERE p.status = $3 AND EXISTS (
+			           SELECT 1 FROM order_events e
+			           WHERE e.order_id = p.id AND e.to_status = $3 AND e.actor_id = p.user_id
+			       )) AS cancelled
+			FROM (
+				SELECT id, buyer_id AS user_id, status FROM orders
+				UNION ALL
+				SELECT id, farmer_id, status FROM orders
+			) p
+			GROUP BY p.user_id
+		) o ON o.user_id = u.id
+		LEFT JOIN (
+			SELECT x.user_id, COUNT(*) FILTER (WHERE x.answered) AS responses,
+			       PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY x.minutes)::float8 AS median_minutes
+			FROM (
+				SELECT p.user_id, r.replied_at IS NOT NULL AS answered,
+				       EXTRACT(EPOCH FROM COALESCE(r.replied_at, NOW()) - f.first_at) / 60 AS minutes
+				FROM conversations cv
+				CROSS JOIN LATERAL (VALUES (cv.user_a), (cv.user_b)) p(user_id)
+				CROSS JOIN LATERAL (
+					SELECT MIN(m.created_at) AS first_at, MIN(m.id) AS first_id FROM messages m
+					WHERE m.conversation_id = cv.id
+				) f
+				CROSS JOIN LATERAL (
+					SELECT MIN(m.created_at) AS replied_at FROM messages m
+					WHERE m.conversation_id = cv.id AND m.sender_id = p.user_id
+				) r
+				WHERE cv.created_at >= NOW() - INTERVAL '90 days'
+				  AND (SELECT sender_id FROM messages WHERE id = f.first_id) <> p.user_id
+			) x
+			GROUP BY x.user_id
+		) rt ON rt.user_id = u.id
+		LEFT JOIN (
+			SELECT r.farmer_id, AVG(r.rating)::float8 AS rating, COUNT(*) AS ratings
+			FROM seller_reviews r
+			WHERE `+eligibleReviewFilter+`
+			GROUP BY r.farmer_id
+		) sr ON sr.farmer_id = u.id
+		LEFT JOIN (
+			SELECT buyer_id, AVG(rating)::float8 AS rating, COUNT(*) AS ratings
+			FROM buyer_reviews
+			GROUP BY buyer_id
+		) br ON br.buyer_id = u.id
+		WHERE $1::int IS NULL OR u.id = $1
+	`, userID, order.Completed, order.Cancelled)
+	if err != nil {
+		return nil, fmt.Errorf("trust query: %w", err)
+	}
+	defer rows.Close()
+
+	var signals []trust.Signals
+	for rows.Next() {
+		var s trust.Signals
+		err := rows.Scan(&s.UserID, &s.AccountCreated, &s.PhoneVerified, &s.OrdersCompleted, &s.OrdersCancelled,
+			&s.Responses, &s.MedianResponseMinutes, &s.SellerRating, &s.SellerRatings, &s.BuyerRating, &s.BuyerRatings)
+		if err != nil {
+			return nil, fmt.Errorf("trust scan: %w", err)
+		}
+		if s.MedianResponseMinutes != nil {
+			rounded := math.Round(*s.MedianResponseMinutes*10) / 10
+			s.MedianResponseMinutes = &rounded
+		}
+		signals = append(signals, s)
+	}
+	return signals, rows.Err()
+}
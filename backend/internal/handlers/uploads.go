@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"farmlite/internal/imaging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImagesPerUpload caps how many extra "images" one request can attach.
+const maxImagesPerUpload = 10
+
+var errTooManyImages = fmt.Errorf("at most %d images can be uploaded at once", maxImagesPerUpload)
+
+// ImageSet is the URL of every stored variant of one uploaded image.
+type ImageSet struct {
+	Thumb  string `json:"thumb"`
+	Medium string `json:"medium"`
+	Full   string `json:"full"`
+}
+
+// imageVariants derives the variant URLs from the full-size URL stored for an upload.
+// Uploads from before images were processed only have the original, so every variant
+// points at it.
+func imageVariants(url string) ImageSet {
+	ext := filepath.Ext(url)
+	base := strings.TrimSuffix(url, ext)
+	if !strings.HasSuffix(base, "_"+imaging.Full.Name) {
+		return ImageSet{Thumb: url, Medium: url, Full: url}
+	}
+	base = strings.TrimSuffix(base, imaging.Full.Name)
+	return ImageSet{
+		Thumb:  base + imaging.Thumb.Name + ext,
+		Medium: base + imaging.Medium.Name + ext,
+		Full:   url,
+	}
+}
+
+// imageSets is imageVariants for each of urls.
+func imageSets(urls []string) []ImageSet {
+	sets := make([]ImageSet, 0, len(urls))
+	for _, url := range urls {
+		sets = append(sets, imageVariants(url))
+	}
+	return sets
+}
+
+// saveUpload processes the image uploaded in form field, stores its variants under
+// ./uploads/<dir> and returns the full-size URL, or "" when no file was sent.
+func saveUpload(c *gin.Context, field, dir string) (string, error) {
+	file, err := c.FormFile(field)
+	if err != nil {
+		return "", nil
+	}
+	urls, err := storeImages([]*multipart.FileHeader{file}, dir)
+	if err != nil {
+		return "", err
+	}
+	return urls[0], nil
+}
+
+// saveUploads is saveUpload for a field holding several files. Every file is checked
+// before any is stored, so one bad file fails the whole upload.
+func saveUploads(c *gin.Context, field, dir string) ([]string, error) {
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File[field]) == 0 {
+		return nil, nil
+	}
+	files := form.File[field]
+	if len(files) > maxImagesPerUpload {
+		return nil, errTooManyImages
+	}
+	return storeImages(files, dir)
+}
+
+// storeImages processes files and writes their variants as
+// <time>_<random>_<variant>.<ext>, returning each file's full-size URL. The client's
+// filename is never used.
+func storeImages(files []*multipart.FileHeader, dir string) ([]string, error) {
+	processed := make([][]imaging.Encoded, 0, len(files))
+	for _, fh := range files {
+		data, err := readUpload(fh)
+		if err != nil {
+			return nil, err
+		}
+		variants, err := imaging.Process(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(fh.Filename), err)
+		}
+		processed = append(processed, variants)
+	}
+
+	uploadDir := filepath.Join("./uploads", dir)
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, 0, len(processed))
+	for _, variants := range processed {
+		suffix := make([]byte, 6)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		prefix := fmt.Sprintf("%d_%s_", time.Now().UnixNano(), hex.EncodeToString(suffix))
+
+		var full string
+		for _, v := range variants {
+			filename := prefix + v.Variant + v.Ext
+			if err := os.WriteFile(filepath.Join(uploadDir, filename), v.Data, 0644); err != nil {
+				return nil, err
+			}
+			if v.Variant == imaging.Full.Name {
+				full = "/uploads/" + dir + "/" + filename // Public URL path
+			}
+		}
+		urls = append(urls, full)
+	}
+	return urls, nil
+}
+
+// removeImages deletes every stored variant of the uploads at urls, logging rather
+// than failing. URLs outside /uploads are left alone.
+func removeImages(urls ...string) {
+	for _, url := range urls {
+		if url == "" {
+			continue
+		}
+		set := imageVariants(url)
+		for _, variant := range []string{set.Thumb, set.Medium, set.Full} {
+			clean := path.Clean(variant)
+			if !strings.HasPrefix(clean, "/uploads/") {
+				continue
+			}
+			err := os.Remove(filepath.Join(".", filepath.FromSlash(clean)))
+			if err != nil && !os.IsNotExist(err) {
+				log.Printf("Upload cleanup error: %v\n", err)
+			}
+		}
+	}
+}
+
+// readUpload reads an uploaded file, refusing it once it passes the size limit.
+func readUpload(fh *multipart.FileHeader) ([]byte, error) {
+	if fh.Size > imaging.MaxUploadBytes {
+		return nil, fmt.Errorf("%w: over %d MB", imaging.ErrTooLarge, imaging.MaxUploadBytes>>20)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, imaging.MaxUploadBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > imaging.MaxUploadBytes {
+		return nil, fmt.Errorf("%w: over %d MB", imaging.ErrTooLarge, imaging.MaxUploadBytes>>20)
+	}
+	return data, nil
+}
+
+// uploadError answers a failed upload: 413 for files that are too large, 415 for ones
+// that aren't a supported image, 400 for unreadable images and 500 otherwise.
+func uploadError(c *gin.Context, err error, where string) {
+	switch {
+	case errors.Is(err, imaging.ErrTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, imaging.ErrUnsupported):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, imaging.ErrInvalid), errors.Is(err, errTooManyImages):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: Upload error: %v\n", where, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
+	}
+}
+
+// addListingImages records extra images for a listing.
+func addListingImages(ctx context.Context, db execer, listingID int, urls []string) error {
+	for _, url := range urls {
+		if _, err := db.Exec(ctx, "INSERT INTO listing_images (listing_id, image_url) VALUES ($1, $2)", listingID, url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
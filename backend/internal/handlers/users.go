@@ -1,19 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 
+	"farmlite/internal/currency"
+
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
 )
 
 type RegisterRequest struct {
-	FullName    string `json:"full_name" binding:"required"`
-	Email       string `json:"email" binding:"required"`
-	PhoneNumber string `json:"phone_number" binding:"required"`
-	Region      string `json:"region" binding:"required"`
-	Role        string `json:"role" binding:"required"`
-	Password    string `json:"password" binding:"required"`
+	FullName          string `json:"full_name" binding:"required"`
+	Email             string `json:"email" binding:"required"`
+	PhoneNumber       string `json:"phone_number" binding:"required"`
+	Region            string `json:"region" binding:"required"`
+	Role              string `json:"role" binding:"required"`
+	Password          string `json:"password" binding:"required"`
+	PreferredCurrency string `json:"preferred_currency"`
 }
 
 type LoginRequest struct {
@@ -29,18 +33,24 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 
+	preferredCurrency, err := currency.Normalize(req.PreferredCurrency, currency.UZS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 1. Check if Phone Number exists (to handle legacy users or duplicates)
 	var existingID int
 	var existingPass *string // Pointer to handle NULL
-	err := h.DB.QueryRow(c.Request.Context(), "SELECT id, password FROM users WHERE phone_number = $1", req.PhoneNumber).Scan(&existingID, &existingPass)
+	err = h.DB.QueryRow(c.Request.Context(), "SELECT id, password FROM users WHERE phone_number = $1", req.PhoneNumber).Scan(&existingID, &existingPass)
 
 	if err == nil {
 		// User with this phone exists!
 		if existingPass == nil || *existingPass == "" {
 			// Case: Legacy user (created before password support). Upgrade them!
 			_, err = h.DB.Exec(c.Request.Context(),
-				"UPDATE users SET full_name=$1, email=$2, region=$3, role=$4, password=$5 WHERE id=$6",
-				req.FullName, req.Email, req.Region, req.Role, req.Password, existingID)
+				"UPDATE users SET full_name=$1, email=$2, region=$3, role=$4, password=$5, preferred_currency=$6, phone_verified_at=NULL WHERE id=$7",
+				req.FullName, req.Email, req.Region, req.Role, req.Password, preferredCurrency, existingID)
 
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upgrade account: " + err.Error()})
@@ -51,12 +61,13 @@ func (h *Handler) Register(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{
 				"message": "Account upgraded successfully!",
 				"user": gin.H{
-					"id":           existingID,
-					"full_name":    req.FullName,
-					"email":        req.Email,
-					"phone_number": req.PhoneNumber,
-					"region":       req.Region,
-					"role":         req.Role,
+					"id":                 existingID,
+					"full_name":          req.FullName,
+					"email":              req.Email,
+					"phone_number":       req.PhoneNumber,
+					"region":             req.Region,
+					"role":               req.Role,
+					"preferred_currency": preferredCurrency,
 				},
 			})
 			return
@@ -78,8 +89,8 @@ func (h *Handler) Register(c *gin.Context) {
 	// 3. Create new user
 	var userID int
 	err = h.DB.QueryRow(c.Request.Context(),
-		"INSERT INTO users (full_name, email, phone_number, region, role, password) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
-		req.FullName, req.Email, req.PhoneNumber, req.Region, req.Role, req.Password).Scan(&userID)
+		"INSERT INTO users (full_name, email, phone_number, region, role, password, preferred_currency) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		req.FullName, req.Email, req.PhoneNumber, req.Region, req.Role, req.Password, preferredCurrency).Scan(&userID)
 
 	if err != nil {
 		// Return the actual error to help debug (e.g., missing column)
@@ -90,12 +101,13 @@ func (h *Handler) Register(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Registration successful!",
 		"user": gin.H{
-			"id":           userID,
-			"full_name":    req.FullName,
-			"email":        req.Email,
-			"phone_number": req.PhoneNumber,
-			"region":       req.Region,
-			"role":         req.Role,
+			"id":                 userID,
+			"full_name":          req.FullName,
+			"email":              req.Email,
+			"phone_number":       req.PhoneNumber,
+			"region":             req.Region,
+			"role":               req.Role,
+			"preferred_currency": preferredCurrency,
 		},
 	})
 }
@@ -109,10 +121,10 @@ func (h *Handler) Login(c *gin.Context) {
 	}
 
 	var userID int
-	var name, phone, region, role, storedPassword string
+	var name, phone, region, role, storedPassword, preferredCurrency string
 
 	err := h.DB.QueryRow(c.Request.Context(),
-		"SELECT id, full_name, phone_number, region, role, password FROM users WHERE email = $1", req.Email).Scan(&userID, &name, &phone, &region, &role, &storedPassword)
+		"SELECT id, full_name, phone_number, region, role, password, COALESCE(preferred_currency, 'UZS') FROM users WHERE email = $1", req.Email).Scan(&userID, &name, &phone, &region, &role, &storedPassword, &preferredCurrency)
 
 	if err == pgx.ErrNoRows {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
@@ -130,12 +142,60 @@ func (h *Handler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Login successful!",
 		"user": gin.H{
-			"id":           userID,
-			"full_name":    name,
-			"email":        req.Email,
-			"phone_number": phone,
-			"region":       region,
-			"role":         role,
+			"id":                 userID,
+			"full_name":          name,
+			"email":              req.Email,
+			"phone_number":       phone,
+			"region":             region,
+			"role":               role,
+			"preferred_currency": preferredCurrency,
 		},
 	})
 }
+
+// UpdatePreferences changes per-user settings such as the display currency.
+func (h *Handler) UpdatePreferences(c *gin.Context) {
+	var req struct {
+		PreferredCurrency string `json:"preferred_currency" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "preferred_currency is required"})
+		return
+	}
+
+	code, err := currency.Normalize(req.PreferredCurrency, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag, err := h.DB.Exec(c.Request.Context(),
+		"UPDATE users SET preferred_currency = $1 WHERE id = $2", code, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update preferences"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Preferences updated", "preferred_currency": code})
+}
+
+// userHasRole reports whether the user exists and has one of the given roles.
+func (h *Handler) userHasRole(ctx context.Context, userID int, roles ...string) bool {
+	if userID <= 0 {
+		return false
+	}
+	var role *string
+	if err := h.DB.QueryRow(ctx, "SELECT role FROM users WHERE id = $1", userID).Scan(&role); err != nil || role == nil {
+		return false
+	}
+	for _, r := range roles {
+		if *role == r {
+			return true
+		}
+	}
+	return false
+}
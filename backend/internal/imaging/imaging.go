@@ -0,0 +1,224 @@
+// Package imaging validates uploaded photos and re-encodes them for the web. Uploads
+// are identified by their content rather than their name, bounded in bytes and pixels,
+// turned upright from their EXIF orientation and re-encoded, which drops EXIF, GPS and
+// every other piece of metadata. Each upload yields a set of variants of bounded size.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // decoded, but always re-encoded as JPEG or PNG
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// Limits on what is accepted. A decoded image takes up to 8 bytes per pixel (16-bit
+// PNG) plus 4 for the RGBA copy, so MaxPixels is about 190 MB at the worst; 16 MP still
+// takes any phone photo.
+const (
+	MaxUploadBytes = 10 << 20
+	MaxPixels      = 16_000_000
+)
+
+// MaxConcurrent is how many uploads are processed at once; the rest wait their turn.
+const MaxConcurrent = 2
+
+// slots bounds the memory held by images being processed
+var slots = make(chan struct{}, MaxConcurrent)
+
+// JPEGQuality is the quality variants are encoded at.
+const JPEGQuality = 82
+
+// Variant is one stored size of an upload: its longest side is at most MaxSide.
+type Variant struct {
+	Name    string
+	MaxSide int
+}
+
+// Variants made of every upload
+var (
+	Thumb  = Variant{"thumb", 320}
+	Medium = Variant{"medium", 1024}
+	Full   = Variant{"full", 2048}
+
+	Variants = []Variant{Thumb, Medium, Full}
+)
+
+var (
+	// ErrTooLarge means the upload has too many bytes or pixels.
+	ErrTooLarge = errors.New("image is too large")
+	// ErrUnsupported means the upload isn't a JPEG, PNG or GIF.
+	ErrUnsupported = errors.New("unsupported image type; use JPEG, PNG or GIF")
+	// ErrInvalid means the upload claims to be an image but can't be decoded.
+	ErrInvalid = errors.New("image could not be read")
+)
+
+// Content types that can be decoded, as sniffed by http.DetectContentType
+var decodable = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Encoded is one variant ready to be stored.
+type Encoded struct {
+	Variant     string
+	ContentType string // image/jpeg, or image/png for images with transparency
+	Ext         string // .jpg or .png
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Process decodes an upload and encodes every variant of it.
+func Process(data []byte) ([]Encoded, error) {
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
+	img, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Encoded, 0, len(Variants))
+	for _, v := range Variants {
+		e, err := Encode(img, v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// Convert decodes an upload and encodes a single variant of it.
+func Convert(data []byte, v Variant) (Encoded, error) {
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
+	img, err := Decode(data)
+	if err != nil {
+		return Encoded{}, err
+	}
+	return Encode(img, v)
+}
+
+// Decode checks an upload's size and sniffed type and decodes it, turned upright. The
+// pixel count is read from the header first so oversized images are refused before
+// they are decoded. Unlike Process and Convert it doesn't wait for a free slot.
+func Decode(data []byte) (*image.RGBA, error) {
+	if len(data) > MaxUploadBytes {
+		return nil, fmt.Errorf("%w: over %d MB", ErrTooLarge, MaxUploadBytes>>20)
+	}
+	contentType := http.DetectContentType(data)
+	if !decodable[contentType] {
+		return nil, fmt.Errorf("%w (got %s)", ErrUnsupported, contentType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrInvalid
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	img := toRGBA(src)
+	if contentType == "image/jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	return img, nil
+}
+
+// Encode scales img down to fit v and encodes it: JPEG when it is opaque, PNG when it
+// has transparency to keep.
+func Encode(img *image.RGBA, v Variant) (Encoded, error) {
+	scaled := Fit(img, v.MaxSide)
+	b := scaled.Bounds()
+	e := Encoded{Variant: v.Name, Width: b.Dx(), Height: b.Dy()}
+
+	var buf bytes.Buffer
+	if scaled.Opaque() {
+		e.ContentType, e.Ext = "image/jpeg", ".jpg"
+		if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+			return Encoded{}, err
+		}
+	} else {
+		e.ContentType, e.Ext = "image/png", ".png"
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := enc.Encode(&buf, scaled); err != nil {
+			return Encoded{}, err
+		}
+	}
+	e.Data = buf.Bytes()
+	return e, nil
+}
+
+// Fit scales img down so its longest side is at most maxSide, averaging the source
+// pixels behind each output pixel. Smaller images are returned as they are.
+func Fit(img *image.RGBA, maxSide int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+	nw, nh := maxSide, max(1, (h*maxSide+w/2)/w)
+	if h > w {
+		nw, nh = max(1, (w*maxSide+h/2)/h), maxSide
+	}
+	return shrink(img, nw, nh)
+}
+
+// shrink box-filters src (with its origin at 0,0) down to w by h.
+func shrink(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a uint64
+			for sy := y0; sy < y1; sy++ {
+				i := sy*src.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(src.Pix[i])
+					g += uint64(src.Pix[i+1])
+					bl += uint64(src.Pix[i+2])
+					a += uint64(src.Pix[i+3])
+					i += 4
+				}
+			}
+			n := uint64((y1 - y0) * (x1 - x0))
+			d := y*dst.Stride + x*4
+			dst.Pix[d] = uint8((r + n/2) / n)
+			dst.Pix[d+1] = uint8((g + n/2) / n)
+			dst.Pix[d+2] = uint8((bl + n/2) / n)
+			dst.Pix[d+3] = uint8((a + n/2) / n)
+		}
+	}
+	return dst
+}
+
+// toRGBA copies img into an RGBA image with its origin at 0,0.
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
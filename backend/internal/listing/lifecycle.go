@@ -0,0 +1,64 @@
+// Package listing defines the marketplace listing lifecycle: its states, the moves
+// farmers may make between them, and when a listing expires.
+package listing
+
+import "time"
+
+// Listing states
+const (
+	Draft   = "draft"
+	Active  = "active"
+	Paused  = "paused"
+	Sold    = "sold"
+	Expired = "expired"
+)
+
+// Lifetime rules
+const (
+	ExpiryDaysAfterHarvest = 30 // a listing stays up this long after its harvest date
+	MinLifetimeDays        = 30 // and at least this long after it is published or renewed
+	ReminderDays           = 3  // farmers are reminded this long before expiry
+)
+
+// transitions lists the states a farmer can move a listing to. Expiry is done by the
+// system; expired and sold listings come back through renewal.
+var transitions = map[string][]string{
+	Draft:   {Active},
+	Active:  {Paused, Sold},
+	Paused:  {Active, Sold},
+	Sold:    {Active},
+	Expired: {Active},
+}
+
+// Valid reports whether state is a known listing state.
+func Valid(state string) bool {
+	_, ok := transitions[state]
+	return ok
+}
+
+// CanTransition reports whether a farmer may move a listing from one state to another.
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Visible reports whether buyers see listings in the state.
+func Visible(state string) bool {
+	return state == Active
+}
+
+// ExpiresAt is when a listing published or renewed at from expires: ExpiryDaysAfterHarvest
+// after its harvest date, but never sooner than MinLifetimeDays after from.
+func ExpiresAt(harvest *time.Time, from time.Time) time.Time {
+	expires := from.AddDate(0, 0, MinLifetimeDays)
+	if harvest != nil {
+		if afterHarvest := harvest.AddDate(0, 0, ExpiryDaysAfterHarvest); afterHarvest.After(expires) {
+			return afterHarvest
+		}
+	}
+	return expires
+}
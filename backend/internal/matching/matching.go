@@ -0,0 +1,128 @@
+// Package matching scores how well a marketplace listing fills a buyer's demand
+// request on quantity, price, timing and distance. Listings and demands only match
+// when they are for the same crop.
+package matching
+
+import (
+	"math"
+	"time"
+
+	"farmlite/internal/geo"
+)
+
+// Weights of each part of the score; they add up to 1
+const (
+	QuantityWeight = 0.25
+	PriceWeight    = 0.30
+	DateWeight     = 0.20
+	DistanceWeight = 0.25
+)
+
+// Tolerances beyond which a listing doesn't match at all
+const (
+	PriceTolerance    = 0.20 // asking price up to 20% over the buyer's maximum
+	DateToleranceDays = 14   // harvest up to two weeks after the buyer needs it
+	MaxDistanceKm     = 800  // scores fall to zero this far apart
+)
+
+// MinScore is the lowest score (out of 100) kept as a match.
+const MinScore = 50
+
+// Score for a part that can't be judged, e.g. a listing without a harvest date
+const unknownScore = 0.6
+
+// Point is a location in decimal degrees.
+type Point struct {
+	Lat, Lng float64
+}
+
+// Listing is the part of a listing the matcher needs. Prices are in one currency
+// shared with the demand; PriceUnknown is set when the price couldn't be converted.
+type Listing struct {
+	ID, FarmerID, CropTypeID int
+	AvailableKG              float64
+	PricePerKG               float64
+	PriceUnknown             bool
+	HarvestReady             *time.Time
+	Location                 *Point
+}
+
+// Demand is the part of a demand request the matcher needs. MaxPricePerKG is 0 when
+// the buyer set no limit; PriceUnknown is set when a limit couldn't be converted.
+type Demand struct {
+	ID, BuyerID, CropTypeID int
+	QuantityKG              float64
+	MaxPricePerKG           float64
+	PriceUnknown            bool
+	NeededBy                *time.Time
+	Location                *Point
+}
+
+// Match is a scored listing/demand pair. Parts are each 0-1; Score is their weighted
+// sum out of 100.
+type Match struct {
+	DemandID   int      `json:"demand_id"`
+	ListingID  int      `json:"listing_id"`
+	Score      float64  `json:"score"`
+	Quantity   float64  `json:"quantity_score"`
+	Price      float64  `json:"price_score"`
+	Date       float64  `json:"date_score"`
+	Distance   float64  `json:"distance_score"`
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+}
+
+// Score rates how well l fills d. ok is false when they don't match: different crops,
+// a price or harvest date beyond tolerance, a price limit that can't be compared, or
+// a score under MinScore.
+func Score(d Demand, l Listing) (m Match, ok bool) {
+	m = Match{DemandID: d.ID, ListingID: l.ID}
+	if d.CropTypeID != l.CropTypeID || d.BuyerID == l.FarmerID || l.AvailableKG <= 0 {
+		return m, false
+	}
+
+	// Quantity: the share of the demand the listing can fill
+	m.Quantity = 1
+	if d.QuantityKG > 0 {
+		m.Quantity = math.Min(l.AvailableKG/d.QuantityKG, 1)
+	}
+
+	// Price: full marks within budget, falling to zero at the tolerance
+	if d.PriceUnknown || (d.MaxPricePerKG > 0 && l.PriceUnknown) {
+		return m, false
+	}
+	m.Price = 1
+	if d.MaxPricePerKG > 0 && l.PricePerKG > d.MaxPricePerKG {
+		over := (l.PricePerKG - d.MaxPricePerKG) / d.MaxPricePerKG
+		if over > PriceTolerance {
+			return m, false
+		}
+		m.Price = 1 - over/PriceTolerance
+	}
+
+	// Date: full marks if harvested in time, falling to zero at the tolerance
+	switch {
+	case d.NeededBy == nil:
+		m.Date = 1
+	case l.HarvestReady == nil:
+		m.Date = unknownScore
+	default:
+		late := l.HarvestReady.Sub(*d.NeededBy).Hours() / 24
+		if late > DateToleranceDays {
+			return m, false
+		}
+		m.Date = math.Min(1, 1-late/DateToleranceDays)
+	}
+
+	// Distance: falls off linearly with kilometres
+	m.Distance = unknownScore
+	if d.Location != nil && l.Location != nil {
+		km := geo.HaversineKm(d.Location.Lat, d.Location.Lng, l.Location.Lat, l.Location.Lng)
+		km = math.Round(km*10) / 10
+		m.DistanceKm = &km
+		m.Distance = math.Max(0, 1-km/MaxDistanceKm)
+	}
+
+	m.Score = 100 * (QuantityWeight*m.Quantity + PriceWeight*m.Price + DateWeight*m.Date + DistanceWeight*m.Distance)
+	m.Score = math.Round(m.Score*10) / 10
+	return m, m.Score >= MinScore
+}
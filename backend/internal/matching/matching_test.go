@@ -0,0 +1,120 @@
+package matching
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var day = time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+
+func at(days int) *time.Time {
+	t := day.AddDate(0, 0, days)
+	return &t
+}
+
+// A demand and a listing that match perfectly on every part
+func pair() (Demand, Listing) {
+	here := &Point{Lat: 40.3864, Lng: 71.7864}
+	d := Demand{ID: 1, BuyerID: 10, CropTypeID: 3, QuantityKG: 100, MaxPricePerKG: 5000, NeededBy: at(0), Location: here}
+	l := Listing{ID: 2, FarmerID: 20, CropTypeID: 3, AvailableKG: 100, PricePerKG: 5000, HarvestReady: at(0), Location: here}
+	return d, l
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestScorePerfectMatch(t *testing.T) {
+	d, l := pair()
+	m, ok := Score(d, l)
+	if !ok || m.Score != 100 {
+		t.Fatalf("Score = %v, ok = %v; want 100, true", m.Score, ok)
+	}
+	if m.DistanceKm == nil || *m.DistanceKm != 0 {
+		t.Errorf("DistanceKm = %v, want 0", m.DistanceKm)
+	}
+}
+
+func TestScoreNoMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*Demand, *Listing)
+	}{
+		{"different crop", func(d *Demand, l *Listing) { l.CropTypeID = 4 }},
+		{"own listing", func(d *Demand, l *Listing) { l.FarmerID = d.BuyerID }},
+		{"no stock left", func(d *Demand, l *Listing) { l.AvailableKG = 0 }},
+		{"price past tolerance", func(d *Demand, l *Listing) { l.PricePerKG = 6100 }},
+		{"listing price unknown", func(d *Demand, l *Listing) { l.PricePerKG, l.PriceUnknown = 0, true }},
+		{"demand limit unknown", func(d *Demand, l *Listing) { d.MaxPricePerKG, d.PriceUnknown = 0, true }},
+		{"harvest too late", func(d *Demand, l *Listing) { l.HarvestReady = at(DateToleranceDays + 1) }},
+		{"under MinScore", func(d *Demand, l *Listing) {
+			l.AvailableKG = 1                         // quantity 0.01
+			l.PricePerKG = 5900                       // price 0.1
+			l.HarvestReady = at(DateToleranceDays)    // date 0
+			l.Location = &Point{Lat: 48.5, Lng: 71.7} // ~900 km, distance 0
+		}},
+	}
+	for _, tt := range tests {
+		d, l := pair()
+		tt.edit(&d, &l)
+		if m, ok := Score(d, l); ok {
+			t.Errorf("%s: matched with score %v", tt.name, m.Score)
+		}
+	}
+}
+
+func TestScoreParts(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*Demand, *Listing)
+		part func(Match) float64
+		want float64
+	}{
+		{"half the quantity", func(d *Demand, l *Listing) { l.AvailableKG = 50 }, quantity, 0.5},
+		{"more than asked", func(d *Demand, l *Listing) { l.AvailableKG = 500 }, quantity, 1},
+		{"no quantity given", func(d *Demand, l *Listing) { d.QuantityKG = 0 }, quantity, 1},
+		{"under budget", func(d *Demand, l *Listing) { l.PricePerKG = 4000 }, price, 1},
+		{"10% over budget", func(d *Demand, l *Listing) { l.PricePerKG = 5500 }, price, 0.5},
+		{"no limit", func(d *Demand, l *Listing) { d.MaxPricePerKG = 0; l.PricePerKG = 99999 }, price, 1},
+		{"no limit, price unknown", func(d *Demand, l *Listing) { d.MaxPricePerKG = 0; l.PriceUnknown = true }, price, 1},
+		{"harvest early", func(d *Demand, l *Listing) { l.HarvestReady = at(-10) }, date, 1},
+		{"a week late", func(d *Demand, l *Listing) { l.HarvestReady = at(7) }, date, 0.5},
+		{"no deadline", func(d *Demand, l *Listing) { d.NeededBy = nil; l.HarvestReady = at(30) }, date, 1},
+		{"harvest unknown", func(d *Demand, l *Listing) { l.HarvestReady = nil }, date, unknownScore},
+		{"location unknown", func(d *Demand, l *Listing) { l.Location = nil }, distance, unknownScore},
+	}
+	for _, tt := range tests {
+		d, l := pair()
+		tt.edit(&d, &l)
+		m, ok := Score(d, l)
+		if !ok {
+			t.Errorf("%s: no match", tt.name)
+			continue
+		}
+		if got := tt.part(m); !near(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScoreDistance(t *testing.T) {
+	d, l := pair()
+	l.Location = &Point{Lat: d.Location.Lat + 2, Lng: d.Location.Lng} // about 222 km north
+	m, ok := Score(d, l)
+	if !ok || m.DistanceKm == nil {
+		t.Fatalf("ok = %v, DistanceKm = %v", ok, m.DistanceKm)
+	}
+	if *m.DistanceKm < 200 || *m.DistanceKm > 240 {
+		t.Errorf("DistanceKm = %v, want about 222", *m.DistanceKm)
+	}
+	if want := 1 - *m.DistanceKm/MaxDistanceKm; !near(m.Distance, want) {
+		t.Errorf("Distance = %v, want %v", m.Distance, want)
+	}
+	if m.Score >= 100 {
+		t.Errorf("Score = %v, want below 100 for a distant listing", m.Score)
+	}
+}
+
+func quantity(m Match) float64 { return m.Quantity }
+func price(m Match) float64    { return m.Price }
+func date(m Match) float64     { return m.Date }
+func distance(m Match) float64 { return m.Distance }
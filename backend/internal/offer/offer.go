@@ -0,0 +1,72 @@
+// Package offer defines price negotiation on listings: a buyer proposes a price and
+// quantity, and each side may accept, reject or counter the other's latest proposal
+// until one is accepted or the thread goes quiet.
+package offer
+
+import "time"
+
+// Offer states
+const (
+	Pending   = "pending"
+	Accepted  = "accepted"
+	Rejected  = "rejected"
+	Countered = "countered" // replaced by a counter-offer from the other side
+	Withdrawn = "withdrawn"
+	Expired   = "expired"
+)
+
+// Responses to an offer
+const (
+	Accept   = "accept"
+	Reject   = "reject"
+	Counter  = "counter"
+	Withdraw = "withdraw" // by whoever made the offer
+)
+
+// Expiry limits
+const (
+	DefaultExpiry = 48 * time.Hour
+	MinExpiry     = time.Hour
+	MaxExpiry     = 7 * 24 * time.Hour
+)
+
+// ExpiresAt is when an offer made at from expires, given the hours its maker asked for
+// (0 for the default), clamped to the allowed range.
+func ExpiresAt(from time.Time, hours int) time.Time {
+	d := DefaultExpiry
+	if hours > 0 {
+		d = time.Duration(hours) * time.Hour
+	}
+	d = max(MinExpiry, min(d, MaxExpiry))
+	return from.Add(d)
+}
+
+// ByMaker reports whether a response is made by the offer's maker rather than the
+// other side.
+func ByMaker(response string) bool {
+	return response == Withdraw
+}
+
+// Valid reports whether response is a known response.
+func Valid(response string) bool {
+	switch response {
+	case Accept, Reject, Counter, Withdraw:
+		return true
+	}
+	return false
+}
+
+// Result is the state an offer ends in after response.
+func Result(response string) string {
+	switch response {
+	case Accept:
+		return Accepted
+	case Reject:
+		return Rejected
+	case Counter:
+		return Countered
+	case Withdraw:
+		return Withdrawn
+	}
+	return ""
+}
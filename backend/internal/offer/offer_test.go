@@ -0,0 +1,49 @@
+package offer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiresAt(t *testing.T) {
+	from := time.Date(2026, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		hours int
+		want  time.Duration
+	}{
+		{0, DefaultExpiry},
+		{-5, DefaultExpiry},
+		{1, MinExpiry},
+		{24, 24 * time.Hour},
+		{168, MaxExpiry},
+		{169, MaxExpiry}, // clamped
+		{10000, MaxExpiry},
+	}
+	for _, tt := range tests {
+		if got := ExpiresAt(from, tt.hours); !got.Equal(from.Add(tt.want)) {
+			t.Errorf("ExpiresAt(from, %d) = from + %v, want from + %v", tt.hours, got.Sub(from), tt.want)
+		}
+	}
+}
+
+func TestResult(t *testing.T) {
+	tests := []struct {
+		response, want string
+	}{
+		{Accept, Accepted},
+		{Reject, Rejected},
+		{Counter, Countered},
+		{Withdraw, Withdrawn},
+		{"expire", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Result(tt.response); got != tt.want {
+			t.Errorf("Result(%q) = %q, want %q", tt.response, got, tt.want)
+		}
+		if valid := Valid(tt.response); valid != (tt.want != "") {
+			t.Errorf("Valid(%q) = %v, want %v", tt.response, valid, tt.want != "")
+		}
+	}
+}
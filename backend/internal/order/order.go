@@ -0,0 +1,98 @@
+// Package order defines the purchase workflow between a buyer and a farmer: the order
+// states, who may move an order between them, and which states hold listing stock.
+package order
+
+// Order states
+const (
+	Placed    = "placed"
+	Accepted  = "accepted"
+	Rejected  = "rejected"
+	Confirmed = "confirmed"
+	Shipped   = "shipped"
+	Delivered = "delivered"
+	Completed = "completed"
+	Cancelled = "cancelled"
+	Disputed  = "disputed"
+)
+
+// Parties to an order
+const (
+	Buyer  = "buyer"
+	Farmer = "farmer"
+)
+
+// transitions lists, for each state, the states an order can move to and which party
+// may make each move. The farmer accepts, ships and settles disputes by cancelling; the
+// buyer confirms, acknowledges delivery and completes.
+var transitions = map[string]map[string][]string{
+	Placed: {
+		Accepted:  {Farmer},
+		Rejected:  {Farmer},
+		Cancelled: {Buyer},
+	},
+	Accepted: {
+		Confirmed: {Buyer},
+		Cancelled: {Buyer, Farmer},
+	},
+	Confirmed: {
+		Shipped:   {Farmer},
+		Cancelled: {Buyer, Farmer},
+		Disputed:  {Buyer, Farmer},
+	},
+	Shipped: {
+		Delivered: {Buyer, Farmer},
+		Disputed:  {Buyer, Farmer},
+	},
+	Delivered: {
+		Completed: {Buyer},
+		Disputed:  {Buyer, Farmer},
+	},
+	Disputed: {
+		Completed: {Buyer},
+		Cancelled: {Farmer},
+	},
+	Rejected:  {},
+	Completed: {},
+	Cancelled: {},
+}
+
+// Valid reports whether state is a known order state.
+func Valid(state string) bool {
+	_, ok := transitions[state]
+	return ok
+}
+
+// CanTransition reports whether party may move an order from one state to another.
+func CanTransition(from, to, party string) bool {
+	for _, p := range transitions[from][to] {
+		if p == party {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the states party may move an order in state to.
+func Next(state, party string) []string {
+	var next []string
+	for _, to := range states {
+		if CanTransition(state, to, party) {
+			next = append(next, to)
+		}
+	}
+	return next
+}
+
+// Final reports whether an order in state can no longer change.
+func Final(state string) bool {
+	return len(transitions[state]) == 0
+}
+
+// Reserves reports whether an order in state holds its quantity against the listing.
+// Stock is reserved from placement until the order completes or falls through.
+func Reserves(state string) bool {
+	return Valid(state) && !Final(state)
+}
+
+// states lists the states in workflow order, so Next is stable.
+var states = []string{Placed, Accepted, Rejected, Confirmed, Shipped, Delivered, Completed, Cancelled, Disputed}
@@ -0,0 +1,69 @@
+package order
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to, party string
+		want            bool
+	}{
+		{Placed, Accepted, Farmer, true},
+		{Placed, Accepted, Buyer, false}, // buyers can't accept their own order
+		{Placed, Rejected, Farmer, true},
+		{Placed, Cancelled, Buyer, true},
+		{Placed, Cancelled, Farmer, false},
+		{Placed, Shipped, Farmer, false}, // no skipping ahead
+		{Accepted, Confirmed, Buyer, true},
+		{Accepted, Confirmed, Farmer, false},
+		{Accepted, Cancelled, Farmer, true},
+		{Confirmed, Shipped, Farmer, true},
+		{Confirmed, Shipped, Buyer, false},
+		{Shipped, Delivered, Buyer, true},
+		{Shipped, Cancelled, Farmer, false},
+		{Delivered, Completed, Buyer, true},
+		{Delivered, Completed, Farmer, false},
+		{Disputed, Cancelled, Farmer, true},
+		{Disputed, Cancelled, Buyer, false},
+		{Completed, Disputed, Buyer, false},
+		{Cancelled, Placed, Buyer, false},
+		{"unknown", Accepted, Farmer, false},
+		{Placed, Accepted, "admin", false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to, tt.party); got != tt.want {
+			t.Errorf("CanTransition(%s, %s, %s) = %v, want %v", tt.from, tt.to, tt.party, got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		state, party string
+		want         []string
+	}{
+		{Placed, Farmer, []string{Accepted, Rejected}},
+		{Placed, Buyer, []string{Cancelled}},
+		{Confirmed, Buyer, []string{Cancelled, Disputed}},
+		{Completed, Buyer, nil},
+	}
+	for _, tt := range tests {
+		if got := Next(tt.state, tt.party); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Next(%s, %s) = %v, want %v", tt.state, tt.party, got, tt.want)
+		}
+	}
+}
+
+func TestReserves(t *testing.T) {
+	for _, s := range states {
+		want := s != Rejected && s != Completed && s != Cancelled
+		if got := Reserves(s); got != want {
+			t.Errorf("Reserves(%s) = %v, want %v", s, got, want)
+		}
+	}
+	if Reserves("unknown") {
+		t.Errorf("Reserves(unknown) = true, want false")
+	}
+}
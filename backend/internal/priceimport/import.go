@@ -0,0 +1,366 @@
+// Package priceimport reads bazaar price sheets (CSV or XLSX) and validates them
+// into price rows ready to insert.
+package priceimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"farmlite/internal/currency"
+	"farmlite/internal/regions"
+)
+
+// Import limits
+const (
+	MaxFileSize = 10 << 20
+	MaxRows     = 20000
+)
+
+// Record is one non-empty line of the source sheet. Line is 1-based as the user sees it.
+type Record struct {
+	Line   int
+	Fields []string
+}
+
+// Fields a sheet can map to
+const (
+	FieldCrop     = "crop"
+	FieldRegion   = "region"
+	FieldPrice    = "price"
+	FieldTier     = "tier"
+	FieldCurrency = "currency"
+	FieldDate     = "date"
+)
+
+// Header names recognised without an explicit mapping (lower-cased), including
+// the Uzbek and Russian headings used on official bazaar sheets.
+var headerAliases = map[string][]string{
+	FieldCrop:     {"crop", "crop_name", "product", "mahsulot", "ekin", "продукт", "культура"},
+	FieldRegion:   {"region", "viloyat", "hudud", "регион", "область"},
+	FieldPrice:    {"price", "price_per_kg", "narx", "narxi", "цена"},
+	FieldTier:     {"tier", "volume_tier", "type", "turi", "тип"},
+	FieldCurrency: {"currency", "valyuta", "валюта"},
+	FieldDate:     {"date", "sana", "дата"},
+}
+
+// Mapping maps fields to column headers in the sheet. Missing fields are auto-detected.
+type Mapping map[string]string
+
+// ParseMapping reads "crop=Mahsulot,region=Viloyat" style mappings.
+func ParseMapping(s string) (Mapping, error) {
+	m := Mapping{}
+	if strings.TrimSpace(s) == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, header, ok := strings.Cut(pair, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !ok || field == "" || strings.TrimSpace(header) == "" {
+			return nil, fmt.Errorf("bad mapping %q (use field=Column)", pair)
+		}
+		if _, known := headerAliases[field]; !known {
+			return nil, fmt.Errorf("unknown field %q in mapping", field)
+		}
+		m[field] = strings.TrimSpace(header)
+	}
+	return m, nil
+}
+
+// Options are the defaults applied to columns a sheet doesn't have.
+type Options struct {
+	Mapping  Mapping
+	Currency string    // default currency, e.g. UZS
+	Tier     string    // default volume tier
+	Date     time.Time // default report date
+}
+
+type Row struct {
+	Line       int       `json:"line"`
+	Crop       string    `json:"crop"`
+	CropTypeID int       `json:"crop_type_id"`
+	Region     string    `json:"region"`
+	PricePerKG float64   `json:"price_per_kg"`
+	VolumeTier string    `json:"volume_tier"`
+	Currency   string    `json:"currency"`
+	Date       time.Time `json:"date"`
+}
+
+type RowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// ReadTable reads a CSV or XLSX sheet. format is "csv" or "xlsx"; when empty it is
+// detected from the content.
+func ReadTable(r io.Reader, format string) ([]Record, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("file is larger than %d MB", MaxFileSize>>20)
+	}
+	if format == "" {
+		format = "csv"
+		if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+			format = "xlsx"
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case "xlsx":
+		return ReadXLSX(data)
+	case "csv":
+		return readCSV(data)
+	}
+	return nil, fmt.Errorf("unsupported format %q (use csv or xlsx)", format)
+}
+
+func readCSV(data []byte) ([]Record, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Excel's UTF-8 BOM
+
+	// Sheets exported with a Russian or Uzbek locale use semicolons
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var table []Record
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if !emptyRecord(fields) {
+			table = append(table, Record{Line: line, Fields: fields})
+		}
+	}
+	return table, nil
+}
+
+// Validate maps the sheet's columns, then checks every data row. crops maps
+// lower-cased crop names to crop_types ids. Rows with any error are left out
+// of the returned rows and reported instead.
+func Validate(table []Record, crops map[string]int, opts Options) ([]Row, []RowError, error) {
+	if len(table) < 2 {
+		return nil, nil, errors.New("sheet needs a header row and at least one data row")
+	}
+	if len(table)-1 > MaxRows {
+		return nil, nil, fmt.Errorf("sheet has more than %d rows", MaxRows)
+	}
+
+	columns, err := resolveColumns(table[0].Fields, opts.Mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defCurrency, err := currency.Normalize(opts.Currency, currency.UZS)
+	if err != nil {
+		return nil, nil, err
+	}
+	defTier := opts.Tier
+	if defTier == "" {
+		defTier = "retail"
+	}
+	defDate := opts.Date
+	if defDate.IsZero() {
+		defDate = time.Now()
+	}
+
+	var rows []Row
+	var rowErrors []RowError
+	for _, rec := range table[1:] {
+		get := func(field string) string {
+			idx, ok := columns[field]
+			if !ok || idx >= len(rec.Fields) {
+				return ""
+			}
+			return rec.Fields[idx]
+		}
+		fail := func(field, value, msg string) {
+			rowErrors = append(rowErrors, RowError{Line: rec.Line, Field: field, Value: value, Message: msg})
+		}
+		before := len(rowErrors)
+
+		row := Row{Line: rec.Line, VolumeTier: defTier, Currency: defCurrency, Date: defDate}
+
+		row.Crop = get(FieldCrop)
+		if id, ok := crops[strings.ToLower(row.Crop)]; ok {
+			row.CropTypeID = id
+		} else {
+			fail(FieldCrop, row.Crop, "unknown crop")
+		}
+
+		if region, ok := regions.Canonical(get(FieldRegion)); ok {
+			row.Region = region
+		} else {
+			fail(FieldRegion, get(FieldRegion), "unknown region")
+		}
+
+		if price, err := ParsePrice(get(FieldPrice)); err != nil {
+			fail(FieldPrice, get(FieldPrice), err.Error())
+		} else {
+			row.PricePerKG = price
+		}
+
+		if v := strings.ToLower(get(FieldTier)); v != "" {
+			switch v {
+			case "retail", "chakana", "розница":
+				row.VolumeTier = "retail"
+			case "wholesale", "ulgurji", "опт":
+				row.VolumeTier = "wholesale"
+			default:
+				fail(FieldTier, v, "tier must be retail or wholesale")
+			}
+		}
+
+		if v := get(FieldCurrency); v != "" {
+			if code, err := currency.Normalize(v, defCurrency); err != nil {
+				fail(FieldCurrency, v, err.Error())
+			} else {
+				row.Currency = code
+			}
+		}
+
+		if v := get(FieldDate); v != "" {
+			if date, err := ParseDate(v); err != nil {
+				fail(FieldDate, v, err.Error())
+			} else if date.After(time.Now().AddDate(0, 0, 1)) {
+				fail(FieldDate, v, "date is in the future")
+			} else {
+				row.Date = date
+			}
+		}
+
+		if len(rowErrors) == before {
+			rows = append(rows, row)
+		}
+	}
+	return rows, rowErrors, nil
+}
+
+// resolveColumns finds the column index of each field from the header row.
+func resolveColumns(header []string, mapping Mapping) (map[string]int, error) {
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+
+	columns := make(map[string]int)
+	for field, aliases := range headerAliases {
+		if name, ok := mapping[field]; ok {
+			i, found := index[strings.ToLower(name)]
+			if !found {
+				return nil, fmt.Errorf("column %q mapped to %s not found in header", name, field)
+			}
+			columns[field] = i
+			continue
+		}
+		for _, alias := range aliases {
+			if i, found := index[alias]; found {
+				columns[field] = i
+				break
+			}
+		}
+	}
+
+	for _, required := range []string{FieldCrop, FieldRegion, FieldPrice} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("no %s column found; map it explicitly", required)
+		}
+	}
+	return columns, nil
+}
+
+// ParsePrice accepts "5000", "5 000", "5,000.50", "5.000,50", "5000,50" and "0.350".
+// The last separator is the decimal point when both kinds appear or when it isn't
+// followed by exactly three digits; otherwise separators group thousands, so "5.000"
+// and "5,000" both read as 5000. Thousands groups must be three digits long.
+func ParsePrice(s string) (float64, error) {
+	s = strings.NewReplacer(" ", "", "\u00a0", "", "'", "").Replace(s)
+	if s == "" {
+		return 0, errors.New("price is missing")
+	}
+
+	var decimal string
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		decimal = s[max(lastDot, lastComma) : max(lastDot, lastComma)+1] // 1.234,56 or 1,234.56
+	case lastDot >= 0 || lastComma >= 0:
+		sep, i := ".", lastDot
+		if lastComma >= 0 {
+			sep, i = ",", lastComma
+		}
+		if strings.Count(s, sep) == 1 && (len(s)-i-1 != 3 || s[:i] == "0") {
+			decimal = sep // 5000,50 or 0.350
+		}
+	}
+
+	whole, frac := s, ""
+	if decimal != "" {
+		i := strings.LastIndex(s, decimal)
+		whole, frac = s[:i], s[i+1:]
+		if strings.ContainsAny(frac, ".,") {
+			return 0, errors.New("price is not a number")
+		}
+	}
+	if strings.ContainsAny(whole, ".,") {
+		groups := strings.FieldsFunc(whole, func(r rune) bool { return r == '.' || r == ',' })
+		if strings.Contains(whole, ".") && strings.Contains(whole, ",") || len(groups) != strings.Count(whole, ".")+strings.Count(whole, ",")+1 {
+			return 0, errors.New("price has misplaced thousands separators")
+		}
+		for i, g := range groups {
+			if len(g) > 3 || (i > 0 && len(g) != 3) {
+				return 0, errors.New("price has misplaced thousands separators")
+			}
+		}
+		whole = strings.Join(groups, "")
+	}
+	if frac != "" {
+		whole += "." + frac
+	}
+
+	price, err := strconv.ParseFloat(whole, 64)
+	if err != nil {
+		return 0, errors.New("price is not a number")
+	}
+	if price <= 0 {
+		return 0, errors.New("price must be positive")
+	}
+	return price, nil
+}
+
+// excelEpoch is day zero of Excel's 1900 date system (accounting for its 1900 leap year bug).
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// ParseDate accepts ISO dates, dd.mm.yyyy, dd/mm/yyyy and Excel serial day numbers.
+func ParseDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "02.01.2006", "02/01/2006", "2.1.2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	if serial, err := strconv.ParseFloat(s, 64); err == nil && serial > 20000 && serial < 80000 {
+		return excelEpoch.AddDate(0, 0, int(serial)), nil
+	}
+	return time.Time{}, errors.New("date must be YYYY-MM-DD or DD.MM.YYYY")
+}
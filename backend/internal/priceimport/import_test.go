@@ -0,0 +1,51 @@
+package priceimport
+
+import "testing"
+
+func TestParsePrice(t *testing.T) {
+	valid := map[string]float64{
+		"5000":         5000,
+		"5 000":        5000,
+		"5\u00a0000":   5000,
+		"5,000":        5000,
+		"5.000":        5000,
+		"1,234,567":    1234567,
+		"1.234.567":    1234567,
+		"5,000.50":     5000.5,
+		"5.000,50":     5000.5,
+		"1.234,56":     1234.56,
+		"1,234.56":     1234.56,
+		"1.234.567,89": 1234567.89,
+		"5000,50":      5000.5,
+		"5000.5":       5000.5,
+		"12,5":         12.5,
+		"0.350":        0.35,
+		"0,350":        0.35,
+		"1.5":          1.5,
+	}
+	for in, want := range valid {
+		got, err := ParsePrice(in)
+		if err != nil {
+			t.Errorf("ParsePrice(%q) error: %v", in, err)
+		} else if got != want {
+			t.Errorf("ParsePrice(%q) = %v, want %v", in, got, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"abc",
+		"0",
+		"-5",
+		"5.000.50",  // decimals can't repeat the thousands separator
+		"1,23.45",   // thousands groups are three digits
+		"12.34,5.6", // separators after the decimal point
+		"1.234,567,8",
+		"1234.567.890,1",
+	}
+	for _, in := range invalid {
+		if got, err := ParsePrice(in); err == nil {
+			t.Errorf("ParsePrice(%q) = %v, want an error", in, got)
+		}
+	}
+}
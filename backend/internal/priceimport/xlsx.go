@@ -0,0 +1,220 @@
+package priceimport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Just enough of the SpreadsheetML schema to read cell values from the first sheet.
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+// xlsxRichText is either a plain <t> or a run of <r><t> fragments.
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.Text)
+	}
+	return b.String()
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string        `xml:"r,attr"`
+			Type   string        `xml:"t,attr"`
+			Value  string        `xml:"v"`
+			Inline *xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadXLSX returns the cell text of the first worksheet of an .xlsx file. Numbers are
+// returned as stored (dates stay Excel serial numbers); empty rows are dropped.
+func ReadXLSX(data []byte) ([]Record, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not an xlsx file: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared xlsxSharedStrings
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeXML(f, &shared); err != nil {
+			return nil, fmt.Errorf("shared strings: %w", err)
+		}
+	}
+
+	var sheet xlsxWorksheet
+	if err := decodeXML(files[sheetPath], &sheet); err != nil {
+		return nil, fmt.Errorf("worksheet: %w", err)
+	}
+
+	var table []Record
+	for i, row := range sheet.Rows {
+		var record []string
+		for j, cell := range row.Cells {
+			col := j
+			if cell.Ref != "" {
+				if c, err := columnIndex(cell.Ref); err == nil {
+					col = c
+				}
+			}
+			if col >= maxColumns {
+				continue
+			}
+
+			var value string
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err != nil || idx < 0 || idx >= len(shared.Items) {
+					return nil, fmt.Errorf("cell %s: bad shared string index %q", cell.Ref, cell.Value)
+				}
+				value = shared.Items[idx].String()
+			case "inlineStr":
+				if cell.Inline != nil {
+					value = cell.Inline.String()
+				}
+			default:
+				value = cell.Value
+			}
+
+			for len(record) <= col {
+				record = append(record, "")
+			}
+			record[col] = strings.TrimSpace(value)
+		}
+		if !emptyRecord(record) {
+			line := row.Number
+			if line == 0 {
+				line = i + 1
+			}
+			table = append(table, Record{Line: line, Fields: record})
+		}
+	}
+	return table, nil
+}
+
+// firstSheetPath resolves the first sheet listed in the workbook to its part name.
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	var wb xlsxWorkbook
+	var rels xlsxRelationships
+	if f, ok := files["xl/workbook.xml"]; ok && decodeXML(f, &wb) == nil && len(wb.Sheets) > 0 {
+		if f, ok := files["xl/_rels/workbook.xml.rels"]; ok && decodeXML(f, &rels) == nil {
+			for _, r := range rels.Relationships {
+				if r.ID != wb.Sheets[0].RID {
+					continue
+				}
+				target := strings.TrimPrefix(r.Target, "/")
+				if !strings.HasPrefix(target, "xl/") {
+					target = path.Join("xl", target)
+				}
+				if _, ok := files[target]; ok {
+					return target, nil
+				}
+			}
+		}
+	}
+
+	// Fall back to the lowest-numbered worksheet part
+	var sheets []string
+	for name := range files {
+		if strings.HasPrefix(name, "xl/worksheets/") && strings.HasSuffix(name, ".xml") {
+			sheets = append(sheets, name)
+		}
+	}
+	if len(sheets) == 0 {
+		return "", errors.New("xlsx file has no worksheets")
+	}
+	sort.Strings(sheets)
+	return sheets[0], nil
+}
+
+func decodeXML(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(io.LimitReader(rc, maxPartSize)).Decode(v)
+}
+
+// maxColumns ignores stray cells far to the right of any real price table
+const maxColumns = 256
+
+// maxPartSize guards against zip bombs; a weekly price sheet is nowhere near this.
+const maxPartSize = 50 << 20
+
+// columnIndex converts a cell reference like "C12" to a zero-based column index.
+func columnIndex(ref string) (int, error) {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r >= 'A' && r <= 'Z' {
+			col = col*26 + int(r-'A'+1)
+			n++
+		} else if r >= 'a' && r <= 'z' {
+			col = col*26 + int(r-'a'+1)
+			n++
+		} else {
+			break
+		}
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("bad cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+func emptyRecord(record []string) bool {
+	for _, v := range record {
+		if v != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Alert kinds
+const (
+	AlertThreshold = "threshold" // price crosses a fixed level
+	AlertChange    = "change"    // price moves by a percentage over a window
+)
+
+// Alert directions: above/below for thresholds, up/down/any for changes
+const (
+	DirectionAbove = "above"
+	DirectionBelow = "below"
+	DirectionUp    = "up"
+	DirectionDown  = "down"
+	DirectionAny   = "any"
+)
+
+// MaxAlertWindowDays bounds how far back a change alert may look.
+const MaxAlertWindowDays = 90
+
+type AlertRule struct {
+	Kind       string  `json:"kind"`
+	Direction  string  `json:"direction"`
+	Threshold  float64 `json:"threshold,omitempty"`
+	Percent    float64 `json:"percent,omitempty"`
+	WindowDays int     `json:"window_days,omitempty"`
+}
+
+// Validate checks the rule is complete for its kind.
+func (r AlertRule) Validate() error {
+	switch r.Kind {
+	case AlertThreshold:
+		if r.Direction != DirectionAbove && r.Direction != DirectionBelow {
+			return errors.New("threshold alerts need direction 'above' or 'below'")
+		}
+		if r.Threshold <= 0 {
+			return errors.New("threshold must be positive")
+		}
+	case AlertChange:
+		if r.Direction != DirectionUp && r.Direction != DirectionDown && r.Direction != DirectionAny {
+			return errors.New("change alerts need direction 'up', 'down' or 'any'")
+		}
+		if r.Percent <= 0 || r.Percent > 1000 {
+			return errors.New("percent must be between 0 and 1000")
+		}
+		if r.WindowDays < 1 || r.WindowDays > MaxAlertWindowDays {
+			return fmt.Errorf("window_days must be between 1 and %d", MaxAlertWindowDays)
+		}
+	default:
+		return errors.New("kind must be 'threshold' or 'change'")
+	}
+	return nil
+}
+
+// Evaluate reports whether the rule's condition holds. current is the recent price and
+// past the price WindowDays ago; either may be nil when there were no reports.
+// For change alerts it also returns the percentage change.
+func (r AlertRule) Evaluate(current, past *float64) (hit bool, change float64) {
+	if current == nil {
+		return false, 0
+	}
+	switch r.Kind {
+	case AlertThreshold:
+		if r.Direction == DirectionAbove {
+			return *current >= r.Threshold, 0
+		}
+		return *current <= r.Threshold, 0
+	case AlertChange:
+		if past == nil || *past <= 0 {
+			return false, 0
+		}
+		change = (*current - *past) / *past * 100
+		switch r.Direction {
+		case DirectionUp:
+			return change >= r.Percent, change
+		case DirectionDown:
+			return -change >= r.Percent, change
+		default:
+			return change >= r.Percent || -change >= r.Percent, change
+		}
+	}
+	return false, 0
+}
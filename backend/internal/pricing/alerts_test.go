@@ -0,0 +1,72 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+)
+
+func price(p float64) *float64 { return &p }
+
+func TestAlertEvaluate(t *testing.T) {
+	above := AlertRule{Kind: AlertThreshold, Direction: DirectionAbove, Threshold: 5000}
+	below := AlertRule{Kind: AlertThreshold, Direction: DirectionBelow, Threshold: 5000}
+	up := AlertRule{Kind: AlertChange, Direction: DirectionUp, Percent: 10, WindowDays: 7}
+	down := AlertRule{Kind: AlertChange, Direction: DirectionDown, Percent: 10, WindowDays: 7}
+	anyway := AlertRule{Kind: AlertChange, Direction: DirectionAny, Percent: 10, WindowDays: 7}
+
+	tests := []struct {
+		name          string
+		rule          AlertRule
+		current, past *float64
+		hit           bool
+		change        float64
+	}{
+		{"above, crossed", above, price(5200), nil, true, 0},
+		{"above, at the threshold", above, price(5000), nil, true, 0},
+		{"above, under", above, price(4999), nil, false, 0},
+		{"below, crossed", below, price(4000), nil, true, 0},
+		{"below, over", below, price(5001), nil, false, 0},
+		{"threshold, no current price", above, nil, nil, false, 0},
+
+		{"up, risen enough", up, price(1100), price(1000), true, 10},
+		{"up, risen too little", up, price(1050), price(1000), false, 5},
+		{"up, fallen", up, price(800), price(1000), false, -20},
+		{"down, fallen enough", down, price(900), price(1000), true, -10},
+		{"down, risen", down, price(1200), price(1000), false, 20},
+		{"any, risen", anyway, price(1150), price(1000), true, 15},
+		{"any, fallen", anyway, price(850), price(1000), true, -15},
+		{"any, flat", anyway, price(1050), price(1000), false, 5},
+		{"change, no past price", anyway, price(1000), nil, false, 0},
+		{"change, zero past price", anyway, price(1000), price(0), false, 0},
+		{"change, no current price", anyway, nil, price(1000), false, 0},
+	}
+	for _, tt := range tests {
+		hit, change := tt.rule.Evaluate(tt.current, tt.past)
+		if hit != tt.hit || math.Abs(change-tt.change) > 1e-9 {
+			t.Errorf("%s: Evaluate = %v, %v, want %v, %v", tt.name, hit, change, tt.hit, tt.change)
+		}
+	}
+}
+
+func TestAlertValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		rule AlertRule
+		ok   bool
+	}{
+		{"threshold", AlertRule{Kind: AlertThreshold, Direction: DirectionAbove, Threshold: 1}, true},
+		{"threshold with a change direction", AlertRule{Kind: AlertThreshold, Direction: DirectionAny, Threshold: 1}, false},
+		{"threshold not positive", AlertRule{Kind: AlertThreshold, Direction: DirectionBelow}, false},
+		{"change any", AlertRule{Kind: AlertChange, Direction: DirectionAny, Percent: 5, WindowDays: 7}, true},
+		{"change with a threshold direction", AlertRule{Kind: AlertChange, Direction: DirectionAbove, Percent: 5, WindowDays: 7}, false},
+		{"change percent too large", AlertRule{Kind: AlertChange, Direction: DirectionUp, Percent: 1001, WindowDays: 7}, false},
+		{"change window too long", AlertRule{Kind: AlertChange, Direction: DirectionUp, Percent: 5, WindowDays: MaxAlertWindowDays + 1}, false},
+		{"change window missing", AlertRule{Kind: AlertChange, Direction: DirectionUp, Percent: 5}, false},
+		{"unknown kind", AlertRule{Kind: "volume"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.rule.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
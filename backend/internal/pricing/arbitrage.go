@@ -0,0 +1,139 @@
+package pricing
+
+import (
+	"sort"
+
+	"farmlite/internal/regions"
+)
+
+// DefaultTransportCostPerTonneKm is a typical truck freight rate in Uzbekistan (USD per tonne per km).
+const DefaultTransportCostPerTonneKm = 0.06
+
+// RegionalPrice is the typical price of a crop in one region and tier.
+type RegionalPrice struct {
+	Crop    string
+	Region  string
+	Tier    string
+	Median  float64
+	Samples int
+}
+
+type CropSpread struct {
+	Crop           string  `json:"crop"`
+	Region         string  `json:"region"`
+	WholesalePrice float64 `json:"wholesale_price"`
+	RetailPrice    float64 `json:"retail_price"`
+	Margin         float64 `json:"margin"`     // retail - wholesale, per kg
+	MarginPct      float64 `json:"margin_pct"` // margin as a share of the wholesale price
+	Samples        int     `json:"samples"`
+}
+
+type RegionGap struct {
+	Crop          string  `json:"crop"`
+	Tier          string  `json:"tier"`
+	FromRegion    string  `json:"from_region"` // where the crop is cheaper
+	ToRegion      string  `json:"to_region"`   // where it sells for more
+	FromPrice     float64 `json:"from_price"`
+	ToPrice       float64 `json:"to_price"`
+	Gap           float64 `json:"gap"`
+	DistanceKm    float64 `json:"distance_km"`
+	TransportCost float64 `json:"transport_cost"` // per kg
+	NetGain       float64 `json:"net_gain"`       // per kg, after transport
+	NetGainPct    float64 `json:"net_gain_pct"`   // relative to the buying price
+}
+
+// Spreads pairs retail and wholesale prices of each crop per region and ranks them
+// by relative margin, largest first.
+func Spreads(prices []RegionalPrice) []CropSpread {
+	type key struct{ crop, region string }
+	tiers := make(map[key]map[string]RegionalPrice)
+	for _, p := range prices {
+		k := key{p.Crop, p.Region}
+		if tiers[k] == nil {
+			tiers[k] = make(map[string]RegionalPrice)
+		}
+		tiers[k][p.Tier] = p
+	}
+
+	var spreads []CropSpread
+	for k, t := range tiers {
+		retail, okR := t["retail"]
+		wholesale, okW := t["wholesale"]
+		if !okR || !okW || wholesale.Median <= 0 {
+			continue
+		}
+		margin := retail.Median - wholesale.Median
+		spreads = append(spreads, CropSpread{
+			Crop:           k.crop,
+			Region:         k.region,
+			WholesalePrice: wholesale.Median,
+			RetailPrice:    retail.Median,
+			Margin:         margin,
+			MarginPct:      margin / wholesale.Median * 100,
+			Samples:        retail.Samples + wholesale.Samples,
+		})
+	}
+
+	sort.Slice(spreads, func(i, j int) bool {
+		if spreads[i].MarginPct != spreads[j].MarginPct {
+			return spreads[i].MarginPct > spreads[j].MarginPct
+		}
+		return spreads[i].Crop+spreads[i].Region < spreads[j].Crop+spreads[j].Region
+	})
+	return spreads
+}
+
+// RegionGaps compares each crop's price between every pair of regions in the same
+// tier and keeps the moves that still pay after transport. costPerKgKm is the cost
+// of moving one kg one km, in the same currency as the prices. Ranked by net gain
+// relative to the buying price.
+func RegionGaps(prices []RegionalPrice, costPerKgKm float64) []RegionGap {
+	type key struct{ crop, tier string }
+	groups := make(map[key][]RegionalPrice)
+	for _, p := range prices {
+		k := key{p.Crop, p.Tier}
+		groups[k] = append(groups[k], p)
+	}
+
+	var gaps []RegionGap
+	for k, group := range groups {
+		for _, from := range group {
+			for _, to := range group {
+				if to.Median <= from.Median || from.Median <= 0 {
+					continue
+				}
+				distance, ok := regions.RoadDistanceKm(from.Region, to.Region)
+				if !ok {
+					continue
+				}
+				gap := to.Median - from.Median
+				transport := distance * costPerKgKm
+				net := gap - transport
+				if net <= 0 {
+					continue
+				}
+				gaps = append(gaps, RegionGap{
+					Crop:          k.crop,
+					Tier:          k.tier,
+					FromRegion:    from.Region,
+					ToRegion:      to.Region,
+					FromPrice:     from.Median,
+					ToPrice:       to.Median,
+					Gap:           gap,
+					DistanceKm:    distance,
+					TransportCost: transport,
+					NetGain:       net,
+					NetGainPct:    net / from.Median * 100,
+				})
+			}
+		}
+	}
+
+	sort.Slice(gaps, func(i, j int) bool {
+		if gaps[i].NetGainPct != gaps[j].NetGainPct {
+			return gaps[i].NetGainPct > gaps[j].NetGainPct
+		}
+		return gaps[i].Crop+gaps[i].FromRegion+gaps[i].ToRegion < gaps[j].Crop+gaps[j].FromRegion+gaps[j].ToRegion
+	})
+	return gaps
+}
@@ -0,0 +1,81 @@
+package pricing
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Outlier detection tuning
+const (
+	MinSamples    = 5   // fewer recent reports than this and we don't judge
+	IQRMultiplier = 3.0 // Tukey "far out" fence
+	MinBandRatio  = 1.5 // never flag prices within 1.5x of the median, even if the IQR is tiny
+)
+
+// TrimFraction is the share of reports dropped from each end before averaging published prices.
+const TrimFraction = 0.1
+
+type Summary struct {
+	Count  int     `json:"count"`
+	Q1     float64 `json:"q1"`
+	Median float64 `json:"median"`
+	Q3     float64 `json:"q3"`
+}
+
+// Summarize computes quartiles of the values. The input slice is not modified.
+func Summarize(values []float64) Summary {
+	if len(values) == 0 {
+		return Summary{}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return Summary{
+		Count:  len(sorted),
+		Q1:     quantile(sorted, 0.25),
+		Median: quantile(sorted, 0.50),
+		Q3:     quantile(sorted, 0.75),
+	}
+}
+
+type Verdict struct {
+	Suspicious bool    `json:"suspicious"`
+	Reason     string  `json:"reason,omitempty"`
+	Low        float64 `json:"expected_low"`
+	High       float64 `json:"expected_high"`
+	Median     float64 `json:"recent_median"`
+	Samples    int     `json:"samples"`
+}
+
+// Check compares a submitted price against recent reports for the same crop,
+// region and tier, using the median/IQR fence widened to at least MinBandRatio
+// around the median.
+func Check(price float64, recent []float64) Verdict {
+	s := Summarize(recent)
+	v := Verdict{Median: s.Median, Samples: s.Count}
+	if s.Count < MinSamples || s.Median <= 0 {
+		return v
+	}
+
+	iqr := s.Q3 - s.Q1
+	v.High = math.Max(s.Q3+IQRMultiplier*iqr, s.Median*MinBandRatio)
+	v.Low = math.Max(0, math.Min(s.Q1-IQRMultiplier*iqr, s.Median/MinBandRatio))
+
+	switch {
+	case price > v.High:
+		v.Suspicious = true
+		v.Reason = fmt.Sprintf("Price is %.1fx the recent median of %.2f for this crop, region and tier", price/s.Median, s.Median)
+	case price < v.Low:
+		v.Suspicious = true
+		v.Reason = fmt.Sprintf("Price is only %.0f%% of the recent median of %.2f for this crop, region and tier", price/s.Median*100, s.Median)
+	}
+	return v
+}
+
+// quantile returns the q-th quantile (0-1) of an ascending slice using linear interpolation.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
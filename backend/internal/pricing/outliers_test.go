@@ -0,0 +1,50 @@
+package pricing
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	flat := []float64{100, 100, 100, 100, 100}
+	spread := []float64{200, 80, 100, 50, 120} // Q1 80, Q3 120: fence at 240, no lower fence
+
+	tests := []struct {
+		name       string
+		price      float64
+		recent     []float64
+		suspicious bool
+	}{
+		{"too few reports", 1000, []float64{100, 100, 100, 100}, false},
+		{"no reports", 1000, nil, false},
+		{"zero median", 1000, []float64{0, 0, 0, 0, 0}, false},
+		{"at the median", 100, flat, false},
+		{"on the band's upper edge", 150, flat, false},
+		{"above the band", 151, flat, true},
+		{"below the band", 66, flat, true},
+		{"inside the band's lower edge", 67, flat, false},
+		{"inside a wide IQR fence", 239, spread, false},
+		{"beyond a wide IQR fence", 241, spread, true},
+		{"low but fence below zero", 1, spread, false},
+	}
+	for _, tt := range tests {
+		v := Check(tt.price, tt.recent)
+		if v.Suspicious != tt.suspicious {
+			t.Errorf("%s: Check(%v) suspicious = %v, want %v (band %v-%v)", tt.name, tt.price, v.Suspicious, tt.suspicious, v.Low, v.High)
+		}
+		if v.Suspicious && v.Reason == "" {
+			t.Errorf("%s: suspicious verdict has no reason", tt.name)
+		}
+		if v.Samples != len(tt.recent) {
+			t.Errorf("%s: Samples = %d, want %d", tt.name, v.Samples, len(tt.recent))
+		}
+	}
+}
+
+func TestSummarizeLeavesInput(t *testing.T) {
+	values := []float64{3, 1, 2}
+	s := Summarize(values)
+	if s.Median != 2 || s.Q1 != 1.5 || s.Q3 != 2.5 {
+		t.Errorf("Summarize = %+v, want Q1 1.5, median 2, Q3 2.5", s)
+	}
+	if values[0] != 3 || values[1] != 1 || values[2] != 2 {
+		t.Errorf("Summarize reordered its input: %v", values)
+	}
+}
@@ -0,0 +1,53 @@
+package pricing
+
+import "math"
+
+// Reputation tuning
+const (
+	AgreementTolerance = 0.20 // a report agrees with consensus if within ±20% of the peer median
+	VoteWeight         = 0.5  // a confirm/dispute vote counts as half a consensus comparison
+	DefaultReputation  = 0.5  // users with no track record
+	AnonymousWeight    = 0.25 // reports without a submitter
+	MinReputation      = 0.05 // nobody's reports are ignored entirely
+
+	// Prior of one agreement in two comparisons, so a single report can't make or break a user
+	priorAgreed   = 1.0
+	priorCompared = 2.0
+)
+
+// DefaultVerifiedConfidence is used when PRICE_VERIFIED_CONFIDENCE is not set.
+const DefaultVerifiedConfidence = 0.7
+
+// confidenceHalfWeight is the total report weight at which a price is 50% confident:
+// three reports from average users, or fewer from trusted ones.
+const confidenceHalfWeight = 1.5
+
+type ReputationStats struct {
+	Agreed   int `json:"agreed"`   // reports within tolerance of the later consensus
+	Compared int `json:"compared"` // reports that had a consensus to compare against, plus rejected ones
+	Confirms int `json:"confirms"` // confirm votes received from other users
+	Disputes int `json:"disputes"` // dispute votes received from other users
+}
+
+// Score turns a user's track record into a 0-1 weight for their future reports.
+func (s ReputationStats) Score() float64 {
+	agreed := priorAgreed + float64(s.Agreed) + VoteWeight*float64(s.Confirms)
+	total := priorCompared + float64(s.Compared) + VoteWeight*float64(s.Confirms+s.Disputes)
+	return math.Max(MinReputation, agreed/total)
+}
+
+// Agrees reports whether a price is within AgreementTolerance of the consensus.
+func Agrees(price, consensus float64) bool {
+	if consensus <= 0 {
+		return false
+	}
+	return math.Abs(price-consensus) <= AgreementTolerance*consensus
+}
+
+// Confidence maps the combined weight of recent reports for a price to 0-1.
+func Confidence(totalWeight float64) float64 {
+	if totalWeight <= 0 {
+		return 0
+	}
+	return totalWeight / (totalWeight + confidenceHalfWeight)
+}
@@ -0,0 +1,65 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestReputationScore(t *testing.T) {
+	tests := []struct {
+		name string
+		s    ReputationStats
+		want float64
+	}{
+		{"no track record", ReputationStats{}, DefaultReputation},
+		{"one agreeing report", ReputationStats{Agreed: 1, Compared: 1}, 2.0 / 3},
+		{"one disagreeing report", ReputationStats{Compared: 1}, 1.0 / 3},
+		{"always agrees", ReputationStats{Agreed: 10, Compared: 10}, 11.0 / 12},
+		{"two confirms", ReputationStats{Confirms: 2}, 2.0 / 3},
+		{"two disputes", ReputationStats{Disputes: 2}, 1.0 / 3},
+		{"confirms and disputes cancel", ReputationStats{Agreed: 1, Compared: 2, Confirms: 2, Disputes: 2}, 0.5},
+		{"at the floor", ReputationStats{Compared: 18}, MinReputation},
+		{"below the floor", ReputationStats{Compared: 100, Disputes: 10}, MinReputation},
+	}
+	for _, tt := range tests {
+		if got := tt.s.Score(); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: Score = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAgrees(t *testing.T) {
+	tests := []struct {
+		price, consensus float64
+		want             bool
+	}{
+		{100, 100, true},
+		{120, 100, true},
+		{80, 100, true},
+		{121, 100, false},
+		{79, 100, false},
+		{0, 0, false},
+		{5, -10, false},
+	}
+	for _, tt := range tests {
+		if got := Agrees(tt.price, tt.consensus); got != tt.want {
+			t.Errorf("Agrees(%v, %v) = %v, want %v", tt.price, tt.consensus, got, tt.want)
+		}
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	tests := []struct {
+		weight, want float64
+	}{
+		{0, 0},
+		{-1, 0},
+		{confidenceHalfWeight, 0.5},
+		{4.5, 0.75},
+	}
+	for _, tt := range tests {
+		if got := Confidence(tt.weight); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Confidence(%v) = %v, want %v", tt.weight, got, tt.want)
+		}
+	}
+}
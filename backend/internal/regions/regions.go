@@ -0,0 +1,120 @@
+package regions
+
+import (
+	"sort"
+	"strings"
+
+	"farmlite/internal/geo"
+)
+
+// All is the canonical list of Uzbekistan regions used across the platform.
+var All = []string{
+	"Tashkent",
+	"Samarkand",
+	"Bukhara",
+	"Fergana",
+	"Andijan",
+	"Namangan",
+	"Kashkadarya",
+	"Surkhandarya",
+	"Jizzakh",
+	"Syrdarya",
+	"Navoiy",
+	"Khorezm",
+	"Karakalpakstan",
+}
+
+// Uzbek (Latin) spellings and common transliterations
+var aliases = map[string]string{
+	"toshkent":         "Tashkent",
+	"samarqand":        "Samarkand",
+	"buxoro":           "Bukhara",
+	"farg'ona":         "Fergana",
+	"fargona":          "Fergana",
+	"ferghana":         "Fergana",
+	"andijon":          "Andijan",
+	"qashqadaryo":      "Kashkadarya",
+	"surxondaryo":      "Surkhandarya",
+	"jizzax":           "Jizzakh",
+	"jizzak":           "Jizzakh",
+	"sirdaryo":         "Syrdarya",
+	"navoi":            "Navoiy",
+	"xorazm":           "Khorezm",
+	"khorazm":          "Khorezm",
+	"qoraqalpog'iston": "Karakalpakstan",
+	"qoraqalpogiston":  "Karakalpakstan",
+}
+
+// Spellings lists every lower-case spelling Canonical accepts alongside the region it
+// maps to, for resolving region names inside SQL queries.
+func Spellings() (spellings, canonical []string) {
+	for _, r := range All {
+		spellings = append(spellings, strings.ToLower(r))
+		canonical = append(canonical, r)
+	}
+	keys := make([]string, 0, len(aliases))
+	for k := range aliases {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		spellings = append(spellings, k)
+		canonical = append(canonical, aliases[k])
+	}
+	return spellings, canonical
+}
+
+// Canonical maps a user-supplied region name to its canonical spelling.
+// Returns false if the name is not a known region.
+func Canonical(name string) (string, bool) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if key == "" {
+		return "", false
+	}
+	for _, r := range All {
+		if strings.ToLower(r) == key {
+			return r, true
+		}
+	}
+	if r, ok := aliases[key]; ok {
+		return r, true
+	}
+	return "", false
+}
+
+// Coordinates of each region's administrative centre (lat, lng)
+var centres = map[string][2]float64{
+	"Tashkent":       {41.2995, 69.2401},
+	"Samarkand":      {39.6542, 66.9597},
+	"Bukhara":        {39.7747, 64.4286},
+	"Fergana":        {40.3864, 71.7864},
+	"Andijan":        {40.7821, 72.3442},
+	"Namangan":       {40.9983, 71.6726},
+	"Kashkadarya":    {38.8606, 65.7891}, // Qarshi
+	"Surkhandarya":   {37.2242, 67.2783}, // Termez
+	"Jizzakh":        {40.1158, 67.8422},
+	"Syrdarya":       {40.4897, 68.7842}, // Gulistan
+	"Navoiy":         {40.0844, 65.3792},
+	"Khorezm":        {41.5500, 60.6333}, // Urgench
+	"Karakalpakstan": {42.4531, 59.6103}, // Nukus
+}
+
+// Roads wind through mountain passes and around the Aral basin; straight-line
+// distances between centres are scaled up by this much.
+const roadFactor = 1.3
+
+// Centre returns the coordinates of a canonical region's administrative centre.
+func Centre(region string) (lat, lng float64, ok bool) {
+	c, ok := centres[region]
+	return c[0], c[1], ok
+}
+
+// RoadDistanceKm estimates the driving distance between two regions' centres.
+func RoadDistanceKm(from, to string) (float64, bool) {
+	a, okA := centres[from]
+	b, okB := centres[to]
+	if !okA || !okB {
+		return 0, false
+	}
+	return geo.HaversineKm(a[0], a[1], b[0], b[1]) * roadFactor, true
+}
@@ -0,0 +1,56 @@
+// Package review defines the rules for seller reviews: a buyer reviews a farmer once
+// per transaction (a completed order, or a conversation where both shared their phone
+// numbers), may edit the review for a while after posting it, and anyone can report
+// an abusive one.
+package review
+
+import "time"
+
+// EditWindow is how long after posting a review its author may still change it.
+const EditWindow = 7 * 24 * time.Hour
+
+// ReportsToHide is how many people must report a review before it is hidden while a
+// moderator looks at it.
+const ReportsToHide = 3
+
+// Limits on free text
+const (
+	MaxCommentLength = 2000
+	MaxReplyLength   = 1000
+)
+
+// Report reasons
+const (
+	Abusive      = "abusive"
+	Spam         = "spam"
+	Fake         = "fake"
+	PersonalInfo = "personal_info"
+	Other        = "other"
+)
+
+// Report states
+const (
+	ReportPending   = "pending"
+	ReportUpheld    = "upheld"    // the review was hidden
+	ReportDismissed = "dismissed" // the review stays up
+)
+
+// Moderator actions on a reported review
+const (
+	Hide    = "hide"
+	Restore = "restore"
+)
+
+// Editable reports whether a review posted at created can still be edited at now.
+func Editable(created, now time.Time) bool {
+	return now.Before(created.Add(EditWindow))
+}
+
+// ValidReason reports whether reason is a known report reason.
+func ValidReason(reason string) bool {
+	switch reason {
+	case Abusive, Spam, Fake, PersonalInfo, Other:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+// Package search turns free-text marketplace queries in Uzbek, Russian or English into
+// search terms, expanding crop and tag synonyms across the three languages.
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Query limits
+const (
+	MaxTerms       = 8
+	MinSuggestRune = 2
+)
+
+// synonymGroups lists words for the same product or quality in English, Uzbek (Latin,
+// apostrophes dropped as Normalize does) and Russian. Crop names match crop_types.
+var synonymGroups = [][]string{
+	{"apple", "olma", "яблоко", "яблоки"},
+	{"apricot", "orik", "абрикос"},
+	{"beetroot", "beet", "lavlagi", "свекла"},
+	{"pepper", "bell", "qalampir", "bolgar", "перец"},
+	{"cabbage", "karam", "капуста"},
+	{"carrot", "sabzi", "морковь"},
+	{"cherry", "gilos", "olcha", "черешня", "вишня"},
+	{"cotton", "paxta", "хлопок"},
+	{"cucumber", "bodring", "огурец", "огурцы"},
+	{"eggplant", "aubergine", "baqlajon", "баклажан"},
+	{"garlic", "sarimsoq", "чеснок"},
+	{"grape", "uzum", "виноград"},
+	{"maize", "corn", "makkajoxori", "кукуруза"},
+	{"melon", "qovun", "дыня"},
+	{"onion", "piyoz", "лук"},
+	{"peach", "shaftoli", "персик"},
+	{"potato", "kartoshka", "картофель", "картошка"},
+	{"pumpkin", "qovoq", "тыква"},
+	{"rice", "guruch", "рис"},
+	{"tomato", "pomidor", "помидор", "помидоры", "томат"},
+	{"watermelon", "tarvuz", "арбуз"},
+	{"wheat", "bugdoy", "пшеница"},
+	{"organic", "organik", "eco", "bio", "органический", "эко"},
+	{"fresh", "yangi", "свежий"},
+	{"dried", "quritilgan", "сушеный"},
+	{"wholesale", "ulgurji", "опт", "оптом"},
+}
+
+var synonyms = func() map[string][]string {
+	m := make(map[string][]string)
+	for _, group := range synonymGroups {
+		for _, word := range group {
+			m[word] = group
+		}
+	}
+	return m
+}()
+
+// apostrophes are the marks written in Uzbek Latin (oʻ, gʻ) and their look-alikes.
+var apostrophes = strings.NewReplacer("ʻ", "", "ʼ", "", "’", "", "‘", "", "`", "", "'", "", "ё", "е")
+
+// Normalize lower-cases text and drops Uzbek apostrophes so "Oʻrik" and "o'rik" both
+// become "orik". The search_normalize SQL function does the same to stored text.
+func Normalize(s string) string {
+	return apostrophes.Replace(strings.ToLower(s))
+}
+
+// Terms splits a query into distinct normalized words, keeping at most MaxTerms.
+func Terms(q string) []string {
+	words := strings.FieldsFunc(Normalize(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool)
+	var terms []string
+	for _, w := range words {
+		if seen[w] {
+			continue
+		}
+		seen[w] = true
+		terms = append(terms, w)
+		if len(terms) == MaxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// Expand returns the term and its synonyms, the term first.
+func Expand(term string) []string {
+	expanded := []string{term}
+	for _, w := range synonyms[term] {
+		if w != term {
+			expanded = append(expanded, w)
+		}
+	}
+	return expanded
+}
+
+// Suggest returns synonym vocabulary words starting with prefix, shortest first.
+func Suggest(prefix string) []string {
+	prefix = Normalize(strings.TrimSpace(prefix))
+	if len([]rune(prefix)) < MinSuggestRune {
+		return nil
+	}
+	var words []string
+	for word := range synonyms {
+		if strings.HasPrefix(word, prefix) {
+			words = append(words, word)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) < len(words[j])
+		}
+		return words[i] < words[j]
+	})
+	return words
+}
@@ -0,0 +1,87 @@
+// Package trust derives the signals that tell one side of a trade whether to rely on
+// the other: how often they see orders through, how quickly they answer messages, how
+// long they've been around, whether their phone is verified and how they are rated.
+// Badges are the signals that clear a bar, shown next to a user's name.
+package trust
+
+import (
+	"math"
+	"time"
+)
+
+// Badges
+const (
+	VerifiedPhone  = "verified_phone"
+	Established    = "established"    // account older than EstablishedDays
+	Reliable       = "reliable"       // sees nearly all their orders through
+	FastResponder  = "fast_responder" // usually answers within FastResponse
+	TopRatedSeller = "top_rated_seller"
+	TopRatedBuyer  = "top_rated_buyer"
+)
+
+// Bars for each badge. A badge needs a few data points so one lucky order doesn't earn it.
+const (
+	EstablishedDays = 180
+	MinOrders       = 3
+	ReliableRate    = 0.9
+	MinResponses    = 3
+	FastResponse    = 2 * time.Hour
+	MinRatings      = 3
+	TopRating       = 4.5
+)
+
+// Signals are what a user's badges are derived from. An order counts as closed once it
+// completes or the user cancels it; orders the other side cancelled or rejected don't
+// count against them.
+type Signals struct {
+	UserID                int       `json:"user_id"`
+	AccountCreated        time.Time `json:"account_created"`
+	PhoneVerified         bool      `json:"phone_verified"`
+	OrdersCompleted       int       `json:"orders_completed"`
+	OrdersCancelled       int       `json:"orders_cancelled"`                  // by this user
+	Responses             int       `json:"responses"`                         // conversations started by others that they answered
+	MedianResponseMinutes *float64  `json:"median_response_minutes,omitempty"` // unanswered ones count as the wait so far
+	SellerRating          float64   `json:"seller_rating"`
+	SellerRatings         int       `json:"seller_ratings"`
+	BuyerRating           float64   `json:"buyer_rating"`
+	BuyerRatings          int       `json:"buyer_ratings"`
+}
+
+// CompletionRate is the share of closed orders that completed, and false when the user
+// has closed too few orders to judge.
+func (s Signals) CompletionRate() (float64, bool) {
+	closed := s.OrdersCompleted + s.OrdersCancelled
+	if closed < MinOrders {
+		return 0, false
+	}
+	return math.Round(float64(s.OrdersCompleted)/float64(closed)*1000) / 1000, true
+}
+
+// AccountAgeDays is how many whole days old the account is at now.
+func (s Signals) AccountAgeDays(now time.Time) int {
+	return int(now.Sub(s.AccountCreated).Hours() / 24)
+}
+
+// Badges returns the badges s earns at now, in a fixed order.
+func Badges(s Signals, now time.Time) []string {
+	badges := []string{}
+	if s.PhoneVerified {
+		badges = append(badges, VerifiedPhone)
+	}
+	if s.AccountAgeDays(now) >= EstablishedDays {
+		badges = append(badges, Established)
+	}
+	if rate, ok := s.CompletionRate(); ok && rate >= ReliableRate {
+		badges = append(badges, Reliable)
+	}
+	if s.Responses >= MinResponses && s.MedianResponseMinutes != nil && *s.MedianResponseMinutes <= FastResponse.Minutes() {
+		badges = append(badges, FastResponder)
+	}
+	if s.SellerRatings >= MinRatings && s.SellerRating >= TopRating {
+		badges = append(badges, TopRatedSeller)
+	}
+	if s.BuyerRatings >= MinRatings && s.BuyerRating >= TopRating {
+		badges = append(badges, TopRatedBuyer)
+	}
+	return badges
+}
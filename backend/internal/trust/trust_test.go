@@ -0,0 +1,75 @@
+package trust
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompletionRate(t *testing.T) {
+	tests := []struct {
+		completed, cancelled int
+		want                 float64
+		wantOK               bool
+	}{
+		{0, 0, 0, false},
+		{2, 0, 0, false}, // too few closed orders to judge
+		{1, 1, 0, false},
+		{3, 0, 1, true},
+		{2, 1, 0.667, true},
+		{9, 1, 0.9, true},
+		{0, 3, 0, true},
+	}
+	for _, tt := range tests {
+		s := Signals{OrdersCompleted: tt.completed, OrdersCancelled: tt.cancelled}
+		got, ok := s.CompletionRate()
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("CompletionRate(%d completed, %d cancelled) = %v, %v, want %v, %v",
+				tt.completed, tt.cancelled, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestBadges(t *testing.T) {
+	now := time.Date(2026, 6, 10, 12, 0, 0, 0, time.UTC)
+	fast := FastResponse.Minutes()
+	slow := FastResponse.Minutes() + 1
+
+	tests := []struct {
+		name string
+		s    Signals
+		want []string
+	}{
+		{"new account", Signals{AccountCreated: now}, []string{}},
+		{"phone verified", Signals{AccountCreated: now, PhoneVerified: true}, []string{VerifiedPhone}},
+		{"established on the day", Signals{AccountCreated: now.AddDate(0, 0, -EstablishedDays)}, []string{Established}},
+		{"a day short of established", Signals{AccountCreated: now.AddDate(0, 0, -EstablishedDays+1)}, []string{}},
+		{"reliable at the bar", Signals{AccountCreated: now, OrdersCompleted: 9, OrdersCancelled: 1}, []string{Reliable}},
+		{"below the reliable bar", Signals{AccountCreated: now, OrdersCompleted: 8, OrdersCancelled: 1}, []string{}},
+		{"one lucky order", Signals{AccountCreated: now, OrdersCompleted: 1}, []string{}},
+		{"fast responder", Signals{AccountCreated: now, Responses: MinResponses, MedianResponseMinutes: &fast}, []string{FastResponder}},
+		{"slow responder", Signals{AccountCreated: now, Responses: MinResponses, MedianResponseMinutes: &slow}, []string{}},
+		{"too few responses", Signals{AccountCreated: now, Responses: MinResponses - 1, MedianResponseMinutes: &fast}, []string{}},
+		{"no response time", Signals{AccountCreated: now, Responses: MinResponses}, []string{}},
+		{"top rated seller", Signals{AccountCreated: now, SellerRating: TopRating, SellerRatings: MinRatings}, []string{TopRatedSeller}},
+		{"too few seller ratings", Signals{AccountCreated: now, SellerRating: 5, SellerRatings: MinRatings - 1}, []string{}},
+		{"top rated buyer", Signals{AccountCreated: now, BuyerRating: 4.8, BuyerRatings: 10}, []string{TopRatedBuyer}},
+		{"buyer below the bar", Signals{AccountCreated: now, BuyerRating: 4.4, BuyerRatings: 10}, []string{}},
+		{"everything, in order", Signals{
+			AccountCreated:        now.AddDate(-1, 0, 0),
+			PhoneVerified:         true,
+			OrdersCompleted:       20,
+			Responses:             5,
+			MedianResponseMinutes: &fast,
+			SellerRating:          4.9,
+			SellerRatings:         12,
+			BuyerRating:           4.6,
+			BuyerRatings:          3,
+		}, []string{VerifiedPhone, Established, Reliable, FastResponder, TopRatedSeller, TopRatedBuyer}},
+	}
+	for _, tt := range tests {
+		if got := Badges(tt.s, now); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Badges = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
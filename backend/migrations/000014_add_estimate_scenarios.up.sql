@@ -0,0 +1,13 @@
+-- 000014_add_estimate_scenarios.up.sql
+CREATE TABLE IF NOT EXISTS estimate_scenarios (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    field JSONB NOT NULL,
+    crops JSONB NOT NULL,
+    water_budget_m3 DECIMAL(12, 2),
+    result JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_estimate_scenarios_user ON estimate_scenarios(user_id, created_at DESC);
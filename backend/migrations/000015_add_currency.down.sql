@@ -0,0 +1,7 @@
+ALTER TABLE users DROP COLUMN IF EXISTS preferred_currency;
+ALTER TABLE demand_requests DROP COLUMN IF EXISTS currency;
+ALTER TABLE marketplace_listings DROP COLUMN IF EXISTS currency;
+ALTER TABLE market_prices DROP COLUMN IF EXISTS currency;
+DROP FUNCTION IF EXISTS fx_rate(TEXT, TEXT, DATE);
+DROP FUNCTION IF EXISTS fx_units_per_usd(TEXT, DATE);
+DROP TABLE IF EXISTS exchange_rates;
@@ -0,0 +1,59 @@
+-- 000015_add_currency.up.sql
+
+-- Exchange rates: how many units of a currency buy one US dollar on a given day
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id SERIAL PRIMARY KEY,
+    currency VARCHAR(3) NOT NULL,
+    units_per_usd DECIMAL(18, 6) NOT NULL CHECK (units_per_usd > 0),
+    effective_date DATE NOT NULL,
+    source VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (currency, effective_date)
+);
+
+INSERT INTO exchange_rates (currency, units_per_usd, effective_date, source) VALUES
+('USD', 1, '2000-01-01', 'seed'),
+('UZS', 12650, '2026-01-01', 'seed'),
+('EUR', 0.86, '2026-01-01', 'seed'),
+('RUB', 80, '2026-01-01', 'seed'),
+('KZT', 510, '2026-01-01', 'seed')
+ON CONFLICT (currency, effective_date) DO NOTHING;
+
+-- fx_rate returns the factor that converts an amount in from_cur into to_cur,
+-- using the latest rate effective on or before at_date (or the earliest known rate).
+-- NULL when either currency has no rate, so aggregates skip rather than mix values.
+CREATE OR REPLACE FUNCTION fx_units_per_usd(cur TEXT, at_date DATE) RETURNS NUMERIC AS $$
+    SELECT units_per_usd FROM exchange_rates
+    WHERE currency = cur
+    ORDER BY (effective_date <= at_date) DESC,
+             CASE WHEN effective_date <= at_date THEN effective_date END DESC,
+             effective_date ASC
+    LIMIT 1
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION fx_rate(from_cur TEXT, to_cur TEXT, at_date DATE DEFAULT CURRENT_DATE) RETURNS NUMERIC AS $$
+    SELECT CASE WHEN from_cur = to_cur THEN 1
+                ELSE fx_units_per_usd(to_cur, at_date) / fx_units_per_usd(from_cur, at_date)
+           END
+$$ LANGUAGE sql STABLE;
+
+-- Currency on prices, listings and demands. Rows created before this migration had
+-- no currency; soum prices per kg are in the thousands, so anything under 100 was
+-- almost certainly entered in dollars.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'market_prices' AND column_name = 'currency') THEN
+        ALTER TABLE market_prices ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'UZS';
+        UPDATE market_prices SET currency = 'USD' WHERE price_per_kg < 100;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'marketplace_listings' AND column_name = 'currency') THEN
+        ALTER TABLE marketplace_listings ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'UZS';
+        UPDATE marketplace_listings SET currency = 'USD' WHERE price_per_kg < 100;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'demand_requests' AND column_name = 'currency') THEN
+        ALTER TABLE demand_requests ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'UZS';
+        UPDATE demand_requests SET currency = 'USD' WHERE max_price_per_kg < 100;
+    END IF;
+END $$;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS preferred_currency VARCHAR(3) DEFAULT 'UZS';
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_market_prices_pending;
+ALTER TABLE market_prices
+DROP COLUMN IF EXISTS reviewed_at,
+DROP COLUMN IF EXISTS reviewed_by,
+DROP COLUMN IF EXISTS flag_reason,
+DROP COLUMN IF EXISTS status;
@@ -0,0 +1,9 @@
+-- 000016_price_moderation.up.sql
+-- Suspicious price reports are held as 'pending' until confirmed; only 'published' rows feed public stats.
+ALTER TABLE market_prices
+ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'published' CHECK (status IN ('published', 'pending', 'rejected')),
+ADD COLUMN IF NOT EXISTS flag_reason TEXT,
+ADD COLUMN IF NOT EXISTS reviewed_by INTEGER REFERENCES users(id),
+ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_market_prices_pending ON market_prices(status) WHERE status = 'pending';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_reputation;
+DROP TABLE IF EXISTS price_votes;
@@ -0,0 +1,23 @@
+-- 000017_price_reputation.up.sql
+-- Community votes on individual price reports
+CREATE TABLE IF NOT EXISTS price_votes (
+    id SERIAL PRIMARY KEY,
+    price_id INTEGER REFERENCES market_prices(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    vote VARCHAR(10) NOT NULL CHECK (vote IN ('confirm', 'dispute')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(price_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_votes_price ON price_votes(price_id);
+
+-- Submitter reputation, recomputed periodically from agreement with later consensus
+CREATE TABLE IF NOT EXISTS user_reputation (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    score DECIMAL(5, 4) NOT NULL DEFAULT 0.5,
+    agreed INTEGER NOT NULL DEFAULT 0,
+    compared INTEGER NOT NULL DEFAULT 0,
+    confirms INTEGER NOT NULL DEFAULT 0,
+    disputes INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
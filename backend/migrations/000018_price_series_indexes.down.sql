@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_market_prices_series_national;
+DROP INDEX IF EXISTS idx_market_prices_series;
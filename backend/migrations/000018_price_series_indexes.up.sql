@@ -0,0 +1,7 @@
+-- 000018_price_series_indexes.up.sql
+-- Range scans for /api/prices/series, per region and nationally
+CREATE INDEX IF NOT EXISTS idx_market_prices_series ON market_prices(crop_type_id, region, volume_tier, submitted_at)
+WHERE is_active = TRUE AND status = 'published';
+
+CREATE INDEX IF NOT EXISTS idx_market_prices_series_national ON market_prices(crop_type_id, volume_tier, submitted_at)
+WHERE is_active = TRUE AND status = 'published';
@@ -0,0 +1,17 @@
+-- 000019_price_forecasts.up.sql
+-- Weekly price forecasts (USD per kg) recomputed nightly; region 'All' is the national series
+CREATE TABLE IF NOT EXISTS price_forecasts (
+    id SERIAL PRIMARY KEY,
+    crop_type_id INTEGER REFERENCES crop_types(id) ON DELETE CASCADE,
+    region VARCHAR(100) NOT NULL,
+    volume_tier VARCHAR(20) NOT NULL,
+    model VARCHAR(30) NOT NULL,
+    points JSONB NOT NULL,
+    backtest_weeks INTEGER NOT NULL,
+    mape DECIMAL(8, 4) NOT NULL,
+    accuracy DECIMAL(5, 4) NOT NULL,
+    observations INTEGER NOT NULL,
+    history_weeks INTEGER NOT NULL,
+    generated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(crop_type_id, region, volume_tier)
+);
@@ -0,0 +1,39 @@
+-- 000020_alerts_notifications.up.sql
+-- In-app notifications. dedupe_key lets producers fire the same event safely more than once.
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT,
+    data JSONB,
+    dedupe_key VARCHAR(255),
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, dedupe_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at DESC);
+
+-- Price alert subscriptions. 'threshold' alerts compare the current price with a target;
+-- 'change' alerts compare it with the price window_days ago.
+CREATE TABLE IF NOT EXISTS price_alerts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    crop_type_id INTEGER REFERENCES crop_types(id) ON DELETE CASCADE,
+    region VARCHAR(100) NOT NULL,
+    volume_tier VARCHAR(20) NOT NULL DEFAULT 'retail',
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('threshold', 'change')),
+    direction VARCHAR(10) NOT NULL CHECK (direction IN ('above', 'below', 'up', 'down', 'any')),
+    threshold DECIMAL(12, 2),
+    percent DECIMAL(6, 2),
+    window_days INTEGER,
+    currency VARCHAR(3) NOT NULL DEFAULT 'UZS',
+    triggered BOOLEAN NOT NULL DEFAULT FALSE,
+    last_triggered_at TIMESTAMP WITH TIME ZONE,
+    last_price DECIMAL(12, 2),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_alerts_crop ON price_alerts(crop_type_id, region) WHERE is_active = TRUE;
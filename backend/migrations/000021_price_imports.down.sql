@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_market_prices_import;
+ALTER TABLE market_prices
+DROP COLUMN IF EXISTS import_id,
+DROP COLUMN IF EXISTS source;
+DROP TABLE IF EXISTS price_imports;
@@ -0,0 +1,16 @@
+-- 000021_price_imports.up.sql
+-- Bulk imports of bazaar price sheets; every imported row points back to its batch
+CREATE TABLE IF NOT EXISTS price_imports (
+    id SERIAL PRIMARY KEY,
+    source VARCHAR(255) NOT NULL,
+    filename VARCHAR(255),
+    imported_by INTEGER REFERENCES users(id),
+    row_count INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE market_prices
+ADD COLUMN IF NOT EXISTS source VARCHAR(255),
+ADD COLUMN IF NOT EXISTS import_id INTEGER REFERENCES price_imports(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_market_prices_import ON market_prices(import_id) WHERE import_id IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS price_summaries;
+DROP INDEX IF EXISTS idx_market_prices_recent;
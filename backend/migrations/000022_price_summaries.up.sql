@@ -0,0 +1,29 @@
+-- 000022_price_summaries.up.sql
+-- Precomputed /api/prices rows, one per crop, region and display currency. Groups are
+-- recomputed when their prices change and the whole table on a schedule.
+CREATE TABLE IF NOT EXISTS price_summaries (
+    crop_type_id INTEGER NOT NULL REFERENCES crop_types(id) ON DELETE CASCADE,
+    region VARCHAR(100) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    retail_price NUMERIC NOT NULL DEFAULT 0,
+    wholesale_price NUMERIC NOT NULL DEFAULT 0,
+    retail_median NUMERIC NOT NULL DEFAULT 0,
+    wholesale_median NUMERIC NOT NULL DEFAULT 0,
+    retail_samples INTEGER NOT NULL DEFAULT 0,
+    wholesale_samples INTEGER NOT NULL DEFAULT 0,
+    recent_weight NUMERIC NOT NULL DEFAULT 0,
+    last_update TIMESTAMP WITH TIME ZONE,
+    history JSONB NOT NULL DEFAULT '[]',
+    dist_farmers INTEGER NOT NULL DEFAULT 0,
+    anon_reports INTEGER NOT NULL DEFAULT 0,
+    owner INTEGER,
+    latest_id INTEGER,
+    refreshed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (crop_type_id, region, currency)
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_summaries_currency ON price_summaries(currency, last_update DESC);
+
+-- The 30-day window every summary is computed from
+CREATE INDEX IF NOT EXISTS idx_market_prices_recent ON market_prices(submitted_at)
+WHERE is_active = TRUE AND status = 'published';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_marketplace_listings_location;
+DROP FUNCTION IF EXISTS haversine_km(DOUBLE PRECISION, DOUBLE PRECISION, DOUBLE PRECISION, DOUBLE PRECISION);
@@ -0,0 +1,12 @@
+-- 000023_listing_distance.up.sql
+-- Great-circle distance in km between two points in decimal degrees (same formula as geo.HaversineKm)
+CREATE OR REPLACE FUNCTION haversine_km(lat1 DOUBLE PRECISION, lng1 DOUBLE PRECISION, lat2 DOUBLE PRECISION, lng2 DOUBLE PRECISION) RETURNS DOUBLE PRECISION AS $$
+    SELECT 2 * 6371.0 * ASIN(LEAST(1, SQRT(
+        POWER(SIN(RADIANS(lat2 - lat1) / 2), 2) +
+        COS(RADIANS(lat1)) * COS(RADIANS(lat2)) * POWER(SIN(RADIANS(lng2 - lng1) / 2), 2)
+    )))
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Bounding-box prefilter for radius searches
+CREATE INDEX IF NOT EXISTS idx_marketplace_listings_location ON marketplace_listings(latitude, longitude)
+WHERE is_active = TRUE;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_seller_reviews_farmer;
+DROP INDEX IF EXISTS idx_listing_images_listing;
+DROP INDEX IF EXISTS idx_marketplace_listings_newest;
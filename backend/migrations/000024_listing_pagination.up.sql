@@ -0,0 +1,8 @@
+-- 000024_listing_pagination.up.sql
+-- Keyset pagination of /api/marketplace by newest, and the per-listing joins
+CREATE INDEX IF NOT EXISTS idx_marketplace_listings_newest ON marketplace_listings(created_at DESC, id DESC)
+WHERE is_active = TRUE;
+
+CREATE INDEX IF NOT EXISTS idx_listing_images_listing ON listing_images(listing_id);
+
+CREATE INDEX IF NOT EXISTS idx_seller_reviews_farmer ON seller_reviews(farmer_id);
@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS demand_requests_search ON demand_requests;
+DROP TRIGGER IF EXISTS marketplace_listings_search ON marketplace_listings;
+DROP FUNCTION IF EXISTS demand_requests_search_update();
+DROP FUNCTION IF EXISTS marketplace_listings_search_update();
+ALTER TABLE demand_requests DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE marketplace_listings DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS jsonb_text_list(JSONB);
+DROP FUNCTION IF EXISTS search_term(TEXT);
+DROP FUNCTION IF EXISTS search_document(TEXT, TEXT, TEXT);
+DROP FUNCTION IF EXISTS search_normalize(TEXT);
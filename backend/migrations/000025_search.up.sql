@@ -0,0 +1,60 @@
+-- 000025_search.up.sql
+-- Full-text search over listings and demand requests. Documents are indexed twice:
+-- with the russian config (Russian stems, English stems for Latin words) and the
+-- simple config, which keeps Uzbek words whole for prefix matching.
+
+-- Same as search.Normalize: lower case, Uzbek apostrophes dropped
+CREATE OR REPLACE FUNCTION search_normalize(t TEXT) RETURNS TEXT AS $$
+    SELECT translate(lower(COALESCE(t, '')), 'ёʻʼ’‘`''', 'е')
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION search_document(crop TEXT, tags TEXT, body TEXT) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('russian', search_normalize(crop)) || to_tsvector('simple', search_normalize(crop)), 'A')
+        || setweight(to_tsvector('russian', search_normalize(tags)) || to_tsvector('simple', search_normalize(tags)), 'B')
+        || setweight(to_tsvector('russian', search_normalize(body)) || to_tsvector('simple', search_normalize(body)), 'C')
+$$ LANGUAGE sql IMMUTABLE;
+
+-- One query word: its stem, or any word it is a prefix of (Uzbek suffixes: pomidor-lar)
+CREATE OR REPLACE FUNCTION search_term(t TEXT) RETURNS tsquery AS $$
+    SELECT plainto_tsquery('russian', search_normalize(t)) || to_tsquery('simple', quote_literal(search_normalize(t)) || ':*')
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION jsonb_text_list(j JSONB) RETURNS TEXT AS $$
+    SELECT CASE WHEN jsonb_typeof(j) = 'array'
+                THEN (SELECT string_agg(value, ' ') FROM jsonb_array_elements_text(j))
+           END
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE marketplace_listings ADD COLUMN IF NOT EXISTS search_vector tsvector;
+ALTER TABLE demand_requests ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION marketplace_listings_search_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := search_document(
+        (SELECT name FROM crop_types WHERE id = NEW.crop_type_id), jsonb_text_list(NEW.tags), NEW.description);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION demand_requests_search_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := search_document(
+        (SELECT name FROM crop_types WHERE id = NEW.crop_type_id), NULL, NEW.description);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS marketplace_listings_search ON marketplace_listings;
+CREATE TRIGGER marketplace_listings_search BEFORE INSERT OR UPDATE OF crop_type_id, tags, description ON marketplace_listings
+FOR EACH ROW EXECUTE FUNCTION marketplace_listings_search_update();
+
+DROP TRIGGER IF EXISTS demand_requests_search ON demand_requests;
+CREATE TRIGGER demand_requests_search BEFORE INSERT OR UPDATE OF crop_type_id, description ON demand_requests
+FOR EACH ROW EXECUTE FUNCTION demand_requests_search_update();
+
+-- Index rows created before search existed
+UPDATE marketplace_listings SET description = description WHERE search_vector IS NULL;
+UPDATE demand_requests SET description = description WHERE search_vector IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_marketplace_listings_search ON marketplace_listings USING GIN(search_vector);
+CREATE INDEX IF NOT EXISTS idx_demand_requests_search ON demand_requests USING GIN(search_vector);
@@ -0,0 +1,14 @@
+-- 000026_listing_changes.up.sql
+-- Edits made to a listing after it was created, one row per changed field.
+-- Price rows (field 'price_per_kg') make up the listing's price history.
+CREATE TABLE IF NOT EXISTS listing_changes (
+    id SERIAL PRIMARY KEY,
+    listing_id INTEGER REFERENCES marketplace_listings(id) ON DELETE CASCADE,
+    changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    field VARCHAR(30) NOT NULL,
+    old_value TEXT,
+    new_value TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_listing_changes_listing ON listing_changes(listing_id, created_at DESC);
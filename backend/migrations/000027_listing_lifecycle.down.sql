@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_marketplace_listings_expiry;
+ALTER TABLE marketplace_listings
+DROP COLUMN IF EXISTS expiry_reminded_at,
+DROP COLUMN IF EXISTS expires_at,
+DROP COLUMN IF EXISTS status_changed_at,
+DROP COLUMN IF EXISTS status;
@@ -0,0 +1,16 @@
+-- 000027_listing_lifecycle.up.sql
+-- Listing states (draft, active, paused, sold, expired). is_active stays the
+-- soft-delete flag; only active listings that haven't expired are shown to buyers.
+ALTER TABLE marketplace_listings
+ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active',
+ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS expiry_reminded_at TIMESTAMP WITH TIME ZONE;
+
+-- Listings from before expiry existed get the usual 30 days after harvest, counted from now at the earliest
+UPDATE marketplace_listings
+SET expires_at = GREATEST(harvest_ready_date + INTERVAL '30 days', NOW() + INTERVAL '30 days')
+WHERE expires_at IS NULL AND status = 'active';
+
+CREATE INDEX IF NOT EXISTS idx_marketplace_listings_expiry ON marketplace_listings(status, expires_at)
+WHERE is_active = TRUE;
@@ -0,0 +1,3 @@
+ALTER TABLE marketplace_listings DROP COLUMN IF EXISTS reserved_kg;
+DROP TABLE IF EXISTS order_events;
+DROP TABLE IF EXISTS orders;
@@ -0,0 +1,37 @@
+-- 000028_orders.up.sql
+-- Orders placed by buyers against marketplace listings. price_per_kg and currency are
+-- fixed when the order is placed. The ordered quantity is held in the listing's
+-- reserved_kg until the order completes (and is taken off quantity_kg) or falls through.
+CREATE TABLE IF NOT EXISTS orders (
+    id SERIAL PRIMARY KEY,
+    listing_id INTEGER NOT NULL REFERENCES marketplace_listings(id),
+    buyer_id INTEGER NOT NULL REFERENCES users(id),
+    farmer_id INTEGER NOT NULL REFERENCES users(id),
+    quantity_kg DECIMAL(10, 2) NOT NULL CHECK (quantity_kg > 0),
+    price_per_kg DECIMAL(10, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL DEFAULT 'UZS',
+    status VARCHAR(20) NOT NULL DEFAULT 'placed',
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_buyer ON orders(buyer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_farmer ON orders(farmer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_listing ON orders(listing_id, status);
+
+-- Audit trail: one row per state change, including placement (from_status NULL)
+CREATE TABLE IF NOT EXISTS order_events (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_events_order ON order_events(order_id, created_at);
+
+ALTER TABLE marketplace_listings
+ADD COLUMN IF NOT EXISTS reserved_kg DECIMAL(10, 2) NOT NULL DEFAULT 0;
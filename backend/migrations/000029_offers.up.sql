@@ -0,0 +1,27 @@
+-- 000029_offers.up.sql
+-- Price negotiation on listings. Each row is one proposal; a thread is every offer
+-- between one buyer and one listing, in order. Only the latest offer in a thread can
+-- be pending. An accepted offer becomes an order at its price.
+CREATE TABLE IF NOT EXISTS offers (
+    id SERIAL PRIMARY KEY,
+    listing_id INTEGER NOT NULL REFERENCES marketplace_listings(id),
+    buyer_id INTEGER NOT NULL REFERENCES users(id),
+    farmer_id INTEGER NOT NULL REFERENCES users(id),
+    proposed_by INTEGER NOT NULL REFERENCES users(id),
+    parent_id INTEGER REFERENCES offers(id), -- the offer this one counters
+    price_per_kg DECIMAL(10, 2) NOT NULL CHECK (price_per_kg > 0),
+    quantity_kg DECIMAL(10, 2) NOT NULL CHECK (quantity_kg > 0),
+    currency VARCHAR(3) NOT NULL DEFAULT 'UZS',
+    message TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    responded_at TIMESTAMP WITH TIME ZONE,
+    order_id INTEGER REFERENCES orders(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_offers_thread ON offers(listing_id, buyer_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_offers_buyer ON offers(buyer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_offers_farmer ON offers(farmer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_offers_pending_expiry ON offers(expires_at) WHERE status = 'pending';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_offers_one_pending ON offers(listing_id, buyer_id) WHERE status = 'pending';
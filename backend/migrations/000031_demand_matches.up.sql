@@ -0,0 +1,20 @@
+-- 000031_demand_matches.up.sql
+-- Scored pairs of demand requests and listings for the same crop, recomputed when
+-- either side is created or changed. notified_at is set once both sides were told.
+CREATE TABLE IF NOT EXISTS demand_matches (
+    demand_id INTEGER NOT NULL REFERENCES demand_requests(id) ON DELETE CASCADE,
+    listing_id INTEGER NOT NULL REFERENCES marketplace_listings(id) ON DELETE CASCADE,
+    score DECIMAL(5, 1) NOT NULL,
+    quantity_score REAL NOT NULL,
+    price_score REAL NOT NULL,
+    date_score REAL NOT NULL,
+    distance_score REAL NOT NULL,
+    distance_km DECIMAL(8, 1),
+    notified_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (demand_id, listing_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_demand_matches_listing ON demand_matches(listing_id, score DESC);
+CREATE INDEX IF NOT EXISTS idx_demand_matches_demand ON demand_matches(demand_id, score DESC);
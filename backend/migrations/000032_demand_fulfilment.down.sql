@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS demand_fulfilments;
+DROP TABLE IF EXISTS demand_responses;
+DROP INDEX IF EXISTS idx_demand_requests_open;
+ALTER TABLE demand_requests
+DROP COLUMN IF EXISTS updated_at,
+DROP COLUMN IF EXISTS closed_at,
+DROP COLUMN IF EXISTS fulfilled_kg,
+DROP COLUMN IF EXISTS status;
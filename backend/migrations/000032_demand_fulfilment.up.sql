@@ -0,0 +1,53 @@
+-- 000032_demand_fulfilment.up.sql
+-- Demand request states (open, filled, expired, closed). Farmers respond with what
+-- they can supply; each accepted response is a fulfilment that adds to fulfilled_kg,
+-- and the request closes as filled once nothing remains. is_active stays the
+-- soft-delete flag.
+ALTER TABLE demand_requests
+ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'open',
+ADD COLUMN IF NOT EXISTS fulfilled_kg DECIMAL(10, 2) NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE demand_requests SET status = 'closed', closed_at = NOW()
+WHERE is_active = FALSE AND status = 'open';
+
+UPDATE demand_requests SET status = 'expired', closed_at = NOW()
+WHERE status = 'open' AND needed_by < CURRENT_DATE;
+
+CREATE INDEX IF NOT EXISTS idx_demand_requests_open ON demand_requests(status, needed_by)
+WHERE is_active = TRUE;
+
+-- A farmer's offer to fill some or all of a request. One pending response per farmer.
+CREATE TABLE IF NOT EXISTS demand_responses (
+    id SERIAL PRIMARY KEY,
+    demand_id INTEGER NOT NULL REFERENCES demand_requests(id) ON DELETE CASCADE,
+    farmer_id INTEGER NOT NULL REFERENCES users(id),
+    listing_id INTEGER REFERENCES marketplace_listings(id) ON DELETE SET NULL,
+    quantity_kg DECIMAL(10, 2) NOT NULL CHECK (quantity_kg > 0),
+    price_per_kg DECIMAL(10, 2) NOT NULL CHECK (price_per_kg > 0),
+    currency VARCHAR(3) NOT NULL DEFAULT 'UZS',
+    message TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    responded_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_demand_responses_demand ON demand_responses(demand_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_demand_responses_farmer ON demand_responses(farmer_id, created_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_demand_responses_one_pending ON demand_responses(demand_id, farmer_id)
+WHERE status = 'pending';
+
+-- Each partial fill of a request: an accepted response, or a quantity the buyer
+-- sourced elsewhere (response_id NULL).
+CREATE TABLE IF NOT EXISTS demand_fulfilments (
+    id SERIAL PRIMARY KEY,
+    demand_id INTEGER NOT NULL REFERENCES demand_requests(id) ON DELETE CASCADE,
+    response_id INTEGER REFERENCES demand_responses(id) ON DELETE SET NULL,
+    farmer_id INTEGER REFERENCES users(id),
+    quantity_kg DECIMAL(10, 2) NOT NULL CHECK (quantity_kg > 0),
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_demand_fulfilments_demand ON demand_fulfilments(demand_id, created_at);
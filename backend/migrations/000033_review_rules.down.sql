@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS review_reports;
+DROP INDEX IF EXISTS idx_seller_reviews_conversation;
+DROP INDEX IF EXISTS idx_seller_reviews_order;
+ALTER TABLE seller_reviews
+DROP COLUMN IF EXISTS hidden_reason,
+DROP COLUMN IF EXISTS hidden_at,
+DROP COLUMN IF EXISTS farmer_replied_at,
+DROP COLUMN IF EXISTS farmer_reply,
+DROP COLUMN IF EXISTS updated_at,
+DROP COLUMN IF EXISTS conversation_id,
+DROP COLUMN IF EXISTS order_id;
@@ -0,0 +1,34 @@
+-- 000033_review_rules.up.sql
+-- Reviews are tied to the transaction they rate: a completed order, or a conversation
+-- where both sides shared their phone numbers. One review per transaction. Older
+-- reviews have neither and no longer count towards ratings. hidden_at is set by a
+-- moderator, or automatically once enough people report the review.
+ALTER TABLE seller_reviews
+ADD COLUMN IF NOT EXISTS order_id INTEGER REFERENCES orders(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS conversation_id INTEGER REFERENCES conversations(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS farmer_reply TEXT,
+ADD COLUMN IF NOT EXISTS farmer_replied_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS hidden_reason TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_seller_reviews_order ON seller_reviews(order_id)
+WHERE order_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_seller_reviews_conversation ON seller_reviews(conversation_id)
+WHERE conversation_id IS NOT NULL;
+
+-- One report per person per review
+CREATE TABLE IF NOT EXISTS review_reports (
+    id SERIAL PRIMARY KEY,
+    review_id INTEGER NOT NULL REFERENCES seller_reviews(id) ON DELETE CASCADE,
+    reporter_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL,
+    details TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    resolved_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (review_id, reporter_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_reports_pending ON review_reports(review_id) WHERE status = 'pending';
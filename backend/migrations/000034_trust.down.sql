@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_trust;
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified_at;
+DROP TABLE IF EXISTS buyer_reviews;
@@ -0,0 +1,29 @@
+-- 000034_trust.up.sql
+-- Farmers rate buyers after an order, the way buyers rate farmers. One rating per order.
+CREATE TABLE IF NOT EXISTS buyer_reviews (
+    id SERIAL PRIMARY KEY,
+    buyer_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    farmer_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    order_id INTEGER NOT NULL UNIQUE REFERENCES orders(id) ON DELETE CASCADE,
+    rating INTEGER NOT NULL CHECK (rating >= 1 AND rating <= 5),
+    comment TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_buyer_reviews_buyer ON buyer_reviews(buyer_id, created_at DESC);
+
+-- Set by an officer or admin who has checked the number belongs to the user
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- Trust signals and the badges they earn, recomputed periodically so listings and
+-- demand requests can show badges without recomputing them
+CREATE TABLE IF NOT EXISTS user_trust (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    orders_completed INTEGER NOT NULL DEFAULT 0,
+    orders_cancelled INTEGER NOT NULL DEFAULT 0,
+    responses INTEGER NOT NULL DEFAULT 0,
+    median_response_minutes REAL,
+    badges TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+-- The spellings the regions were typed with aren't kept, so there is nothing to restore.
@@ -0,0 +1,39 @@
+-- 000035_canonical_price_regions.up.sql
+-- Price reports used to keep the region as typed, so "fergana", "FERGANA" and
+-- "Farg'ona" each formed a group of their own and skipped the outlier check.
+-- Reports are now stored under the canonical name; rewrite the old ones to match.
+UPDATE market_prices p
+SET region = s.region
+FROM (VALUES
+    ('tashkent', 'Tashkent'),
+    ('samarkand', 'Samarkand'),
+    ('bukhara', 'Bukhara'),
+    ('fergana', 'Fergana'),
+    ('andijan', 'Andijan'),
+    ('namangan', 'Namangan'),
+    ('kashkadarya', 'Kashkadarya'),
+    ('surkhandarya', 'Surkhandarya'),
+    ('jizzakh', 'Jizzakh'),
+    ('syrdarya', 'Syrdarya'),
+    ('navoiy', 'Navoiy'),
+    ('khorezm', 'Khorezm'),
+    ('karakalpakstan', 'Karakalpakstan'),
+    ('andijon', 'Andijan'),
+    ('buxoro', 'Bukhara'),
+    ('farg''ona', 'Fergana'),
+    ('fargona', 'Fergana'),
+    ('ferghana', 'Fergana'),
+    ('jizzak', 'Jizzakh'),
+    ('jizzax', 'Jizzakh'),
+    ('khorazm', 'Khorezm'),
+    ('navoi', 'Navoiy'),
+    ('qashqadaryo', 'Kashkadarya'),
+    ('qoraqalpog''iston', 'Karakalpakstan'),
+    ('qoraqalpogiston', 'Karakalpakstan'),
+    ('samarqand', 'Samarkand'),
+    ('sirdaryo', 'Syrdarya'),
+    ('surxondaryo', 'Surkhandarya'),
+    ('toshkent', 'Tashkent'),
+    ('xorazm', 'Khorezm')
+) AS s(spelling, region)
+WHERE LOWER(TRIM(p.region)) = s.spelling AND p.region <> s.region;
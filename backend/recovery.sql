@@ -171,3 +171,628 @@ INSERT INTO crop_types (name, fao_data) VALUES
 ('Melon', '{"category": "Fruits"}'),
 ('Watermelon', '{"category": "Fruits"}')
 ON CONFLICT (name) DO NOTHING;
+
+-- 8. Saved Estimate Scenarios (Migration 14)
+CREATE TABLE IF NOT EXISTS estimate_scenarios (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    field JSONB NOT NULL,
+    crops JSONB NOT NULL,
+    water_budget_m3 DECIMAL(12, 2),
+    result JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_estimate_scenarios_user ON estimate_scenarios(user_id, created_at DESC);
+
+-- 9. Multi-Currency (Migration 15)
+-- Exchange rates: how many units of a currency buy one US dollar on a given day
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id SERIAL PRIMARY KEY,
+    currency VARCHAR(3) NOT NULL,
+    units_per_usd DECIMAL(18, 6) NOT NULL CHECK (units_per_usd > 0),
+    effective_date DATE NOT NULL,
+    source VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (currency, effective_date)
+);
+
+INSERT INTO exchange_rates (currency, units_per_usd, effective_date, source) VALUES
+('USD', 1, '2000-01-01', 'seed'),
+('UZS', 12650, '2026-01-01', 'seed'),
+('EUR', 0.86, '2026-01-01', 'seed'),
+('RUB', 80, '2026-01-01', 'seed'),
+('KZT', 510, '2026-01-01', 'seed')
+ON CONFLICT (currency, effective_date) DO NOTHING;
+
+-- fx_rate returns the factor that converts an amount in from_cur into to_cur,
+-- using the latest rate effective on or before at_date (or the earliest known rate).
+-- NULL when either currency has no rate, so aggregates skip rather than mix values.
+CREATE OR REPLACE FUNCTION fx_units_per_usd(cur TEXT, at_date DATE) RETURNS NUMERIC AS $$
+    SELECT units_per_usd FROM exchange_rates
+    WHERE currency = cur
+    ORDER BY (effective_date <= at_date) DESC,
+             CASE WHEN effective_date <= at_date THEN effective_date END DESC,
+             effective_date ASC
+    LIMIT 1
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION fx_rate(from_cur TEXT, to_cur TEXT, at_date DATE DEFAULT CURRENT_DATE) RETURNS NUMERIC AS $$
+    SELECT CASE WHEN from_cur = to_cur THEN 1
+                ELSE fx_units_per_usd(to_cur, at_date) / fx_units_per_usd(from_cur, at_date)
+           END
+$$ LANGUAGE sql STABLE;
+
+-- Currency on prices, listings and demands. Rows created before this migration had
+-- no currency; soum prices per kg are in the thousands, so anything under 100 was
+-- almost certainly entered in dollars.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'market_prices' AND column_name = 'currency') THEN
+        ALTER TABLE market_prices ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'UZS';
+        UPDATE market_prices SET currency = 'USD' WHERE price_per_kg < 100;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'marketplace_listings' AND column_name = 'currency') THEN
+        ALTER TABLE marketplace_listings ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'UZS';
+        UPDATE marketplace_listings SET currency = 'USD' WHERE price_per_kg < 100;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'demand_requests' AND column_name = 'currency') THEN
+        ALTER TABLE demand_requests ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'UZS';
+        UPDATE demand_requests SET currency = 'USD' WHERE max_price_per_kg < 100;
+    END IF;
+END $$;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS preferred_currency VARCHAR(3) DEFAULT 'UZS';
+
+-- 10. Price Moderation (Migration 16)
+-- Suspicious price reports are held as 'pending' until confirmed; only 'published' rows feed public stats.
+ALTER TABLE market_prices
+ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'published' CHECK (status IN ('published', 'pending', 'rejected')),
+ADD COLUMN IF NOT EXISTS flag_reason TEXT,
+ADD COLUMN IF NOT EXISTS reviewed_by INTEGER REFERENCES users(id),
+ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_market_prices_pending ON market_prices(status) WHERE status = 'pending';
+
+-- 11. Price Reputation (Migration 17)
+-- Community votes on individual price reports
+CREATE TABLE IF NOT EXISTS price_votes (
+    id SERIAL PRIMARY KEY,
+    price_id INTEGER REFERENCES market_prices(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    vote VARCHAR(10) NOT NULL CHECK (vote IN ('confirm', 'dispute')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(price_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_votes_price ON price_votes(price_id);
+
+-- Submitter reputation, recomputed periodically from agreement with later consensus
+CREATE TABLE IF NOT EXISTS user_reputation (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    score DECIMAL(5, 4) NOT NULL DEFAULT 0.5,
+    agreed INTEGER NOT NULL DEFAULT 0,
+    compared INTEGER NOT NULL DEFAULT 0,
+    confirms INTEGER NOT NULL DEFAULT 0,
+    disputes INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 12. Price Series Indexes (Migration 18)
+-- Range scans for /api/prices/series, per region and nationally
+CREATE INDEX IF NOT EXISTS idx_market_prices_series ON market_prices(crop_type_id, region, volume_tier, submitted_at)
+WHERE is_active = TRUE AND status = 'published';
+
+CREATE INDEX IF NOT EXISTS idx_market_prices_series_national ON market_prices(crop_type_id, volume_tier, submitted_at)
+WHERE is_active = TRUE AND status = 'published';
+
+-- 13. Price Forecasts (Migration 19)
+-- Weekly price forecasts (USD per kg) recomputed nightly; region 'All' is the national series
+CREATE TABLE IF NOT EXISTS price_forecasts (
+    id SERIAL PRIMARY KEY,
+    crop_type_id INTEGER REFERENCES crop_types(id) ON DELETE CASCADE,
+    region VARCHAR(100) NOT NULL,
+    volume_tier VARCHAR(20) NOT NULL,
+    model VARCHAR(30) NOT NULL,
+    points JSONB NOT NULL,
+    backtest_weeks INTEGER NOT NULL,
+    mape DECIMAL(8, 4) NOT NULL,
+    accuracy DECIMAL(5, 4) NOT NULL,
+    observations INTEGER NOT NULL,
+    history_weeks INTEGER NOT NULL,
+    generated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(crop_type_id, region, volume_tier)
+);
+
+-- 14. Price Alerts & Notifications (Migration 20)
+-- In-app notifications. dedupe_key lets producers fire the same event safely more than once.
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT,
+    data JSONB,
+    dedupe_key VARCHAR(255),
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, dedupe_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at DESC);
+
+-- Price alert subscriptions. 'threshold' alerts compare the current price with a target;
+-- 'change' alerts compare it with the price window_days ago.
+CREATE TABLE IF NOT EXISTS price_alerts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    crop_type_id INTEGER REFERENCES crop_types(id) ON DELETE CASCADE,
+    region VARCHAR(100) NOT NULL,
+    volume_tier VARCHAR(20) NOT NULL DEFAULT 'retail',
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('threshold', 'change')),
+    direction VARCHAR(10) NOT NULL CHECK (direction IN ('above', 'below', 'up', 'down', 'any')),
+    threshold DECIMAL(12, 2),
+    percent DECIMAL(6, 2),
+    window_days INTEGER,
+    currency VARCHAR(3) NOT NULL DEFAULT 'UZS',
+    triggered BOOLEAN NOT NULL DEFAULT FALSE,
+    last_triggered_at TIMESTAMP WITH TIME ZONE,
+    last_price DECIMAL(12, 2),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_alerts_crop ON price_alerts(crop_type_id, region) WHERE is_active = TRUE;
+
+-- 15. Price Imports (Migration 21)
+-- Bulk imports of bazaar price sheets; every imported row points back to its batch
+CREATE TABLE IF NOT EXISTS price_imports (
+    id SERIAL PRIMARY KEY,
+    source VARCHAR(255) NOT NULL,
+    filename VARCHAR(255),
+    imported_by INTEGER REFERENCES users(id),
+    row_count INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE market_prices
+ADD COLUMN IF NOT EXISTS source VARCHAR(255),
+ADD COLUMN IF NOT EXISTS import_id INTEGER REFERENCES price_imports(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_market_prices_import ON market_prices(import_id) WHERE import_id IS NOT NULL;
+
+-- 16. Price Summaries (Migration 22)
+-- Precomputed /api/prices rows, one per crop, region and display currency. Groups are
+-- recomputed when their prices change and the whole table on a schedule.
+CREATE TABLE IF NOT EXISTS price_summaries (
+    crop_type_id INTEGER NOT NULL REFERENCES crop_types(id) ON DELETE CASCADE,
+    region VARCHAR(100) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    retail_price NUMERIC NOT NULL DEFAULT 0,
+    wholesale_price NUMERIC NOT NULL DEFAULT 0,
+    retail_median NUMERIC NOT NULL DEFAULT 0,
+    wholesale_median NUMERIC NOT NULL DEFAULT 0,
+    retail_samples INTEGER NOT NULL DEFAULT 0,
+    wholesale_samples INTEGER NOT NULL DEFAULT 0,
+    recent_weight NUMERIC NOT NULL DEFAULT 0,
+    last_update TIMESTAMP WITH TIME ZONE,
+    history JSONB NOT NULL DEFAULT '[]',
+    dist_farmers INTEGER NOT NULL DEFAULT 0,
+    anon_reports INTEGER NOT NULL DEFAULT 0,
+    owner INTEGER,
+    latest_id INTEGER,
+    refreshed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (crop_type_id, region, currency)
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_summaries_currency ON price_summaries(currency, last_update DESC);
+
+-- The 30-day window every summary is computed from
+CREATE INDEX IF NOT EXISTS idx_market_prices_recent ON market_prices(submitted_at)
+WHERE is_active = TRUE AND status = 'published';
+
+-- 17. Listing Distance (Migration 23)
+-- Great-circle distance in km between two points in decimal degrees (same formula as geo.HaversineKm)
+CREATE OR REPLACE FUNCTION haversine_km(lat1 DOUBLE PRECISION, lng1 DOUBLE PRECISION, lat2 DOUBLE PRECISION, lng2 DOUBLE PRECISION) RETURNS DOUBLE PRECISION AS $$
+    SELECT 2 * 6371.0 * ASIN(LEAST(1, SQRT(
+        POWER(SIN(RADIANS(lat2 - lat1) / 2), 2) +
+        COS(RADIANS(lat1)) * COS(RADIANS(lat2)) * POWER(SIN(RADIANS(lng2 - lng1) / 2), 2)
+    )))
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Bounding-box prefilter for radius searches
+CREATE INDEX IF NOT EXISTS idx_marketplace_listings_location ON marketplace_listings(latitude, longitude)
+WHERE is_active = TRUE;
+
+-- 18. Listing Pagination (Migration 24)
+-- Keyset pagination of /api/marketplace by newest, and the per-listing joins
+CREATE INDEX IF NOT EXISTS idx_marketplace_listings_newest ON marketplace_listings(created_at DESC, id DESC)
+WHERE is_active = TRUE;
+
+CREATE INDEX IF NOT EXISTS idx_listing_images_listing ON listing_images(listing_id);
+
+CREATE INDEX IF NOT EXISTS idx_seller_reviews_farmer ON seller_reviews(farmer_id);
+
+-- 19. Full-Text Search (Migration 25)
+-- Full-text search over listings and demand requests. Documents are indexed twice:
+-- with the russian config (Russian stems, English stems for Latin words) and the
+-- simple config, which keeps Uzbek words whole for prefix matching.
+
+-- Same as search.Normalize: lower case, Uzbek apostrophes dropped
+CREATE OR REPLACE FUNCTION search_normalize(t TEXT) RETURNS TEXT AS $$
+    SELECT translate(lower(COALESCE(t, '')), 'ёʻʼ’‘`''', 'е')
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION search_document(crop TEXT, tags TEXT, body TEXT) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('russian', search_normalize(crop)) || to_tsvector('simple', search_normalize(crop)), 'A')
+        || setweight(to_tsvector('russian', search_normalize(tags)) || to_tsvector('simple', search_normalize(tags)), 'B')
+        || setweight(to_tsvector('russian', search_normalize(body)) || to_tsvector('simple', search_normalize(body)), 'C')
+$$ LANGUAGE sql IMMUTABLE;
+
+-- One query word: its stem, or any word it is a prefix of (Uzbek suffixes: pomidor-lar)
+CREATE OR REPLACE FUNCTION search_term(t TEXT) RETURNS tsquery AS $$
+    SELECT plainto_tsquery('russian', search_normalize(t)) || to_tsquery('simple', quote_literal(search_normalize(t)) || ':*')
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION jsonb_text_list(j JSONB) RETURNS TEXT AS $$
+    SELECT CASE WHEN jsonb_typeof(j) = 'array'
+                THEN (SELECT string_agg(value, ' ') FROM jsonb_array_elements_text(j))
+           END
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE marketplace_listings ADD COLUMN IF NOT EXISTS search_vector tsvector;
+ALTER TABLE demand_requests ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION marketplace_listings_search_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := search_document(
+        (SELECT name FROM crop_types WHERE id = NEW.crop_type_id), jsonb_text_list(NEW.tags), NEW.description);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION demand_requests_search_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := search_document(
+        (SELECT name FROM crop_types WHERE id = NEW.crop_type_id), NULL, NEW.description);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS marketplace_listings_search ON marketplace_listings;
+CREATE TRIGGER marketplace_listings_search BEFORE INSERT OR UPDATE OF crop_type_id, tags, description ON marketplace_listings
+FOR EACH ROW EXECUTE FUNCTION marketplace_listings_search_update();
+
+DROP TRIGGER IF EXISTS demand_requests_search ON demand_requests;
+CREATE TRIGGER demand_requests_search BEFORE INSERT OR UPDATE OF crop_type_id, description ON demand_requests
+FOR EACH ROW EXECUTE FUNCTION demand_requests_search_update();
+
+-- Index rows created before search existed
+UPDATE marketplace_listings SET description = description WHERE search_vector IS NULL;
+UPDATE demand_requests SET description = description WHERE search_vector IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_marketplace_listings_search ON marketplace_listings USING GIN(search_vector);
+CREATE INDEX IF NOT EXISTS idx_demand_requests_search ON demand_requests USING GIN(search_vector);
+
+-- 20. Listing Changes (Migration 26)
+-- Edits made to a listing after it was created, one row per changed field.
+-- Price rows (field 'price_per_kg') make up the listing's price history.
+CREATE TABLE IF NOT EXISTS listing_changes (
+    id SERIAL PRIMARY KEY,
+    listing_id INTEGER REFERENCES marketplace_listings(id) ON DELETE CASCADE,
+    changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    field VARCHAR(30) NOT NULL,
+    old_value TEXT,
+    new_value TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_listing_changes_listing ON listing_changes(listing_id, created_at DESC);
+
+-- 21. Listing Lifecycle (Migration 27)
+-- Listing states (draft, active, paused, sold, expired). is_active stays the
+-- soft-delete flag; only active listings that haven't expired are shown to buyers.
+ALTER TABLE marketplace_listings
+ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active',
+ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS expiry_reminded_at TIMESTAMP WITH TIME ZONE;
+
+-- Listings from before expiry existed get the usual 30 days after harvest, counted from now at the earliest
+UPDATE marketplace_listings
+SET expires_at = GREATEST(harvest_ready_date + INTERVAL '30 days', NOW() + INTERVAL '30 days')
+WHERE expires_at IS NULL AND status = 'active';
+
+CREATE INDEX IF NOT EXISTS idx_marketplace_listings_expiry ON marketplace_listings(status, expires_at)
+WHERE is_active = TRUE;
+
+-- 22. Orders (Migration 28)
+-- Orders placed by buyers against marketplace listings. price_per_kg and currency are
+-- fixed when the order is placed. The ordered quantity is held in the listing's
+-- reserved_kg until the order completes (and is taken off quantity_kg) or falls through.
+CREATE TABLE IF NOT EXISTS orders (
+    id SERIAL PRIMARY KEY,
+    listing_id INTEGER NOT NULL REFERENCES marketplace_listings(id),
+    buyer_id INTEGER NOT NULL REFERENCES users(id),
+    farmer_id INTEGER NOT NULL REFERENCES users(id),
+    quantity_kg DECIMAL(10, 2) NOT NULL CHECK (quantity_kg > 0),
+    price_per_kg DECIMAL(10, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL DEFAULT 'UZS',
+    status VARCHAR(20) NOT NULL DEFAULT 'placed',
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_buyer ON orders(buyer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_farmer ON orders(farmer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_listing ON orders(listing_id, status);
+
+-- Audit trail: one row per state change, including placement (from_status NULL)
+CREATE TABLE IF NOT EXISTS order_events (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_events_order ON order_events(order_id, created_at);
+
+ALTER TABLE marketplace_listings
+ADD COLUMN IF NOT EXISTS reserved_kg DECIMAL(10, 2) NOT NULL DEFAULT 0;
+
+-- 23. Offers (Migration 29)
+-- Price negotiation on listings. Each row is one proposal; a thread is every offer
+-- between one buyer and one listing, in order. Only the latest offer in a thread can
+-- be pending. An accepted offer becomes an order at its price.
+CREATE TABLE IF NOT EXISTS offers (
+    id SERIAL PRIMARY KEY,
+    listing_id INTEGER NOT NULL REFERENCES marketplace_listings(id),
+    buyer_id INTEGER NOT NULL REFERENCES users(id),
+    farmer_id INTEGER NOT NULL REFERENCES users(id),
+    proposed_by INTEGER NOT NULL REFERENCES users(id),
+    parent_id INTEGER REFERENCES offers(id), -- the offer this one counters
+    price_per_kg DECIMAL(10, 2) NOT NULL CHECK (price_per_kg > 0),
+    quantity_kg DECIMAL(10, 2) NOT NULL CHECK (quantity_kg > 0),
+    currency VARCHAR(3) NOT NULL DEFAULT 'UZS',
+    message TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    responded_at TIMESTAMP WITH TIME ZONE,
+    order_id INTEGER REFERENCES orders(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_offers_thread ON offers(listing_id, buyer_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_offers_buyer ON offers(buyer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_offers_farmer ON offers(farmer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_offers_pending_expiry ON offers(expires_at) WHERE status = 'pending';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_offers_one_pending ON offers(listing_id, buyer_id) WHERE status = 'pending';
+
+-- 24. Messaging (Migration 30)
+-- Conversations between two users about a listing, demand request or order. user_a
+-- is the lower user id so a pair has one conversation per subject. Each side's
+-- phone number is revealed to the other only once both have agreed to share.
+CREATE TABLE IF NOT EXISTS conversations (
+    id SERIAL PRIMARY KEY,
+    subject_type VARCHAR(20) NOT NULL, -- listing, demand or order
+    subject_id INTEGER NOT NULL,
+    user_a INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_b INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    a_shared_phone_at TIMESTAMP WITH TIME ZONE,
+    b_shared_phone_at TIMESTAMP WITH TIME ZONE,
+    last_message_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (user_a < user_b),
+    UNIQUE (subject_type, subject_id, user_a, user_b)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_user_a ON conversations(user_a, last_message_at DESC);
+CREATE INDEX IF NOT EXISTS idx_conversations_user_b ON conversations(user_b, last_message_at DESC);
+
+-- read_at is the read receipt: when the recipient first saw the message
+CREATE TABLE IF NOT EXISTS messages (
+    id SERIAL PRIMARY KEY,
+    conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    sender_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT,
+    image_url TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP WITH TIME ZONE,
+    CHECK (body IS NOT NULL OR image_url IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, id);
+CREATE INDEX IF NOT EXISTS idx_messages_unread ON messages(conversation_id, sender_id) WHERE read_at IS NULL;
+
+-- A block stops messages in both directions
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+
+-- 25. Demand Matches (Migration 31)
+-- Scored pairs of demand requests and listings for the same crop, recomputed when
+-- either side is created or changed. notified_at is set once both sides were told.
+CREATE TABLE IF NOT EXISTS demand_matches (
+    demand_id INTEGER NOT NULL REFERENCES demand_requests(id) ON DELETE CASCADE,
+    listing_id INTEGER NOT NULL REFERENCES marketplace_listings(id) ON DELETE CASCADE,
+    score DECIMAL(5, 1) NOT NULL,
+    quantity_score REAL NOT NULL,
+    price_score REAL NOT NULL,
+    date_score REAL NOT NULL,
+    distance_score REAL NOT NULL,
+    distance_km DECIMAL(8, 1),
+    notified_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (demand_id, listing_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_demand_matches_listing ON demand_matches(listing_id, score DESC);
+CREATE INDEX IF NOT EXISTS idx_demand_matches_demand ON demand_matches(demand_id, score DESC);
+
+-- 26. Demand Request Fulfilment (Migration 32)
+-- Demand request states (open, filled, expired, closed). Farmers respond with what
+-- they can supply; each accepted response is a fulfilment that adds to fulfilled_kg,
+-- and the request closes as filled once nothing remains. is_active stays the
+-- soft-delete flag.
+ALTER TABLE demand_requests
+ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'open',
+ADD COLUMN IF NOT EXISTS fulfilled_kg DECIMAL(10, 2) NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE demand_requests SET status = 'closed', closed_at = NOW()
+WHERE is_active = FALSE AND status = 'open';
+
+UPDATE demand_requests SET status = 'expired', closed_at = NOW()
+WHERE status = 'open' AND needed_by < CURRENT_DATE;
+
+CREATE INDEX IF NOT EXISTS idx_demand_requests_open ON demand_requests(status, needed_by)
+WHERE is_active = TRUE;
+
+-- A farmer's offer to fill some or all of a request. One pending response per farmer.
+CREATE TABLE IF NOT EXISTS demand_responses (
+    id SERIAL PRIMARY KEY,
+    demand_id INTEGER NOT NULL REFERENCES demand_requests(id) ON DELETE CASCADE,
+    farmer_id INTEGER NOT NULL REFERENCES users(id),
+    listing_id INTEGER REFERENCES marketplace_listings(id) ON DELETE SET NULL,
+    quantity_kg DECIMAL(10, 2) NOT NULL CHECK (quantity_kg > 0),
+    price_per_kg DECIMAL(10, 2) NOT NULL CHECK (price_per_kg > 0),
+    currency VARCHAR(3) NOT NULL DEFAULT 'UZS',
+    message TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    responded_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_demand_responses_demand ON demand_responses(demand_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_demand_responses_farmer ON demand_responses(farmer_id, created_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_demand_responses_one_pending ON demand_responses(demand_id, farmer_id)
+WHERE status = 'pending';
+
+-- Each partial fill of a request: an accepted response, or a quantity the buyer
+-- sourced elsewhere (response_id NULL).
+CREATE TABLE IF NOT EXISTS demand_fulfilments (
+    id SERIAL PRIMARY KEY,
+    demand_id INTEGER NOT NULL REFERENCES demand_requests(id) ON DELETE CASCADE,
+    response_id INTEGER REFERENCES demand_responses(id) ON DELETE SET NULL,
+    farmer_id INTEGER REFERENCES users(id),
+    quantity_kg DECIMAL(10, 2) NOT NULL CHECK (quantity_kg > 0),
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_demand_fulfilments_demand ON demand_fulfilments(demand_id, created_at);
+
+-- 27. Review Rules (Migration 33)
+-- Reviews are tied to the transaction they rate: a completed order, or a conversation
+-- where both sides shared their phone numbers. One review per transaction. Older
+-- reviews have neither and no longer count towards ratings. hidden_at is set by a
+-- moderator, or automatically once enough people report the review.
+ALTER TABLE seller_reviews
+ADD COLUMN IF NOT EXISTS order_id INTEGER REFERENCES orders(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS conversation_id INTEGER REFERENCES conversations(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS farmer_reply TEXT,
+ADD COLUMN IF NOT EXISTS farmer_replied_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS hidden_reason TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_seller_reviews_order ON seller_reviews(order_id)
+WHERE order_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_seller_reviews_conversation ON seller_reviews(conversation_id)
+WHERE conversation_id IS NOT NULL;
+
+-- One report per person per review
+CREATE TABLE IF NOT EXISTS review_reports (
+    id SERIAL PRIMARY KEY,
+    review_id INTEGER NOT NULL REFERENCES seller_reviews(id) ON DELETE CASCADE,
+    reporter_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL,
+    details TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    resolved_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (review_id, reporter_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_reports_pending ON review_reports(review_id) WHERE status = 'pending';
+
+-- 28. Buyer Ratings and Trust Badges (Migration 34)
+-- Farmers rate buyers after an order, the way buyers rate farmers. One rating per order.
+CREATE TABLE IF NOT EXISTS buyer_reviews (
+    id SERIAL PRIMARY KEY,
+    buyer_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    farmer_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    order_id INTEGER NOT NULL UNIQUE REFERENCES orders(id) ON DELETE CASCADE,
+    rating INTEGER NOT NULL CHECK (rating >= 1 AND rating <= 5),
+    comment TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_buyer_reviews_buyer ON buyer_reviews(buyer_id, created_at DESC);
+
+-- Set by an officer or admin who has checked the number belongs to the user
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- Trust signals and the badges they earn, recomputed periodically so listings and
+-- demand requests can show badges without recomputing them
+CREATE TABLE IF NOT EXISTS user_trust (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    orders_completed INTEGER NOT NULL DEFAULT 0,
+    orders_cancelled INTEGER NOT NULL DEFAULT 0,
+    responses INTEGER NOT NULL DEFAULT 0,
+    median_response_minutes REAL,
+    badges TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 29. Canonical Price Regions (Migration 35)
+-- Price reports used to keep the region as typed, so "fergana", "FERGANA" and
+-- "Farg'ona" each formed a group of their own and skipped the outlier check.
+-- Reports are now stored under the canonical name; rewrite the old ones to match.
+UPDATE market_prices p
+SET region = s.region
+FROM (VALUES
+    ('tashkent', 'Tashkent'),
+    ('samarkand', 'Samarkand'),
+    ('bukhara', 'Bukhara'),
+    ('fergana', 'Fergana'),
+    ('andijan', 'Andijan'),
+    ('namangan', 'Namangan'),
+    ('kashkadarya', 'Kashkadarya'),
+    ('surkhandarya', 'Surkhandarya'),
+    ('jizzakh', 'Jizzakh'),
+    ('syrdarya', 'Syrdarya'),
+    ('navoiy', 'Navoiy'),
+    ('khorezm', 'Khorezm'),
+    ('karakalpakstan', 'Karakalpakstan'),
+    ('andijon', 'Andijan'),
+    ('buxoro', 'Bukhara'),
+    ('farg''ona', 'Fergana'),
+    ('fargona', 'Fergana'),
+    ('ferghana', 'Fergana'),
+    ('jizzak', 'Jizzakh'),
+    ('jizzax', 'Jizzakh'),
+    ('khorazm', 'Khorezm'),
+    ('navoi', 'Navoiy'),
+    ('qashqadaryo', 'Kashkadarya'),
+    ('qoraqalpog''iston', 'Karakalpakstan'),
+    ('qoraqalpogiston', 'Karakalpakstan'),
+    ('samarqand', 'Samarkand'),
+    ('sirdaryo', 'Syrdarya'),
+    ('surxondaryo', 'Surkhandarya'),
+    ('toshkent', 'Tashkent'),
+    ('xorazm', 'Khorezm')
+) AS s(spelling, region)
+WHERE LOWER(TRIM(p.region)) = s.spelling AND p.region <> s.region;